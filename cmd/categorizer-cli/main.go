@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	app "yashubustudio/categorizer/internal/app"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		benchMain(os.Args[2:])
+		return
+	}
+	var opts app.ClassifyFileOptions
+	flag.StringVar(&opts.InputPath, "input", "", "分類する入力 CSV/TSV")
+	flag.StringVar(&opts.OutputPath, "output", "", "結果 CSV (省略時は入力と同じ場所に設定の OutputTemplate の名前。既定は result_<日付><時刻>.csv、タブ区切りなら .tsv)")
+	batchDir := flag.String("batch-dir", "", "このフォルダ内の CSV/TSV をすべて分類する (-input の代わり)")
+	outputDir := flag.String("output-dir", "", "-batch-dir の結果の出力先 (省略時は -batch-dir と同じ)")
+	flag.StringVar(&opts.TextColumn, "text", "", "本文列 (見出し名または1始まりの列番号)")
+	flag.StringVar(&opts.CategoryPath, "categories", "", "カテゴリファイル (省略時は既定のシードファイル)")
+	flag.StringVar(&opts.Mode, "mode", "", "ランキングモード (seeded / mixed / split)")
+	flag.StringVar(&opts.InputProfile, "input-profile", "", "保存済みの入力列プロファイル名 (-text より優先)")
+	flag.StringVar(&opts.CategoryProfile, "category-profile", "", "保存済みのカテゴリ列プロファイル名 (-categories の CSV/TSV/xlsx に適用)")
+	minScore := flag.Float64("min-score", 0, "1位スコアがこれ未満なら要確認にする (0 で無効)")
+	margin := flag.Float64("auto-accept-margin", 0, "1位と2位の差がこれ未満なら要確認にする (0 で無効)")
+	flag.BoolVar(&opts.Dedupe, "dedupe", false, "同じ内容の入力を1行にまとめる")
+	dedupeThreshold := flag.Float64("dedupe-threshold", 0, "-dedupe でこの類似度以上の入力もまとめる (0 で完全一致のみ)")
+	flag.StringVar(&opts.DumpVectors, "dump-vectors", "", "入力の埋め込みを入力順に書き出す (.npy または CSV/TSV)")
+	flag.StringVar(&opts.DumpIndexVectors, "dump-index-vectors", "", "カテゴリ・NDC の埋め込みを CSV/TSV で書き出す")
+	flag.BoolVar(&opts.Coverage, "coverage", false, "カテゴリごとに候補に出た行数を表示する (一度も出ないカテゴリの確認用)")
+	flag.BoolVar(&opts.Quality, "quality", false, "カテゴリごとの例文数とまとまりを表示する (例文を足すカテゴリの確認用)")
+	flag.BoolVar(&opts.Inspect, "inspect", false, "分類せずに入力・カテゴリファイルの列の解決結果と先頭の数件を表示する")
+	flag.StringVar(&opts.OutputDelimiter, "output-delimiter", "", "結果ファイルの区切り文字 (, / tab / ;。省略時は設定の OutputDelimiter)")
+	flag.StringVar(&opts.ExportState, "export-state", "", "設定・カテゴリ・NDC を埋め込み済みのベクトルごと書き出す (不具合報告用。-input を省くと分類しない)")
+	flag.StringVar(&opts.ImportState, "import-state", "", "-export-state の状態ファイルを埋め込み直さずに読み込んで分類する (モデルが違うとエラー)")
+	flag.StringVar(&opts.OutputColumns, "columns", "", "出力列 (例: index,text,category=カテゴリ,score。省略時は従来の列)")
+	flag.StringVar(&opts.ConfigPath, "config", "", "設定ファイル (JSON。省略した項目は既定値)")
+	flag.StringVar(&opts.ConfigOverridePath, "config-override", "", "-config の上に重ねる設定ファイル (書いた項目だけを上書き)")
+	flag.BoolVar(&opts.StrictConfig, "strict-config", false, "設定ファイルの不明な項目・不正な値をエラーにする")
+	flag.Parse()
+
+	if (opts.InputPath != "" && *batchDir != "") || (opts.InputPath == "" && *batchDir == "" && opts.ExportState == "") {
+		fmt.Println("-input か -batch-dir のどちらか一方を指定してください")
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.MinScore = float32(*minScore)
+	opts.AutoAcceptMargin = float32(*margin)
+	opts.DedupeThreshold = float32(*dedupeThreshold)
+	if *batchDir != "" {
+		if err := app.ClassifyDir(opts, *batchDir, *outputDir, os.Stdout); err != nil {
+			fmt.Println("分類エラー:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := app.ClassifyFile(opts, os.Stdout); err != nil {
+		fmt.Println("分類エラー:", err)
+		os.Exit(1)
+	}
+}
+
+// benchMain は "categorizer-cli bench" サブコマンド。埋め込みの速度とキャッシュの効き方を測る。
+func benchMain(args []string) {
+	var opts app.BenchOptions
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.IntVar(&opts.N, "n", 1000, "埋め込む件数")
+	fs.StringVar(&opts.InputPath, "input", "", "本文を取る CSV/TSV (省略時は合成した文)")
+	fs.StringVar(&opts.TextColumn, "text", "", "本文列 (見出し名または1始まりの列番号)")
+	fs.BoolVar(&opts.JSON, "json", false, "結果を JSON で出力する")
+	fs.StringVar(&opts.ConfigPath, "config", "", "設定ファイル (JSON。省略した項目は既定値)")
+	fs.StringVar(&opts.ConfigOverridePath, "config-override", "", "-config の上に重ねる設定ファイル (書いた項目だけを上書き)")
+	fs.BoolVar(&opts.StrictConfig, "strict-config", false, "設定ファイルの不明な項目・不正な値をエラーにする")
+	fs.Parse(args)
+
+	if err := app.Bench(opts, os.Stdout); err != nil {
+		fmt.Println("ベンチマークエラー:", err)
+		os.Exit(1)
+	}
+}
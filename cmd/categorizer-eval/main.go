@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	app "yashubustudio/categorizer/internal/app"
+)
+
+func main() {
+	var opts app.EvalOptions
+	flag.StringVar(&opts.InputPath, "input", "", "正解ラベル付きの入力 CSV/TSV")
+	flag.StringVar(&opts.TextColumn, "text", "", "本文列 (見出し名または1始まりの列番号)")
+	flag.StringVar(&opts.GoldColumn, "gold", "", "正解ラベル列 (見出し名または1始まりの列番号)")
+	flag.StringVar(&opts.CategoryPath, "categories", "", "カテゴリファイル (省略時は既定のシードファイル)")
+	flag.StringVar(&opts.Mode, "mode", "", "ランキングモード (seeded / mixed / split)")
+	weightNDC := flag.Float64("weight-ndc", 0, "NDC重み (0 で既定値)")
+	flag.StringVar(&opts.RowsOut, "rows-out", "", "行ごとの正誤を書き出す CSV")
+	flag.StringVar(&opts.ConfigPath, "config", "", "設定ファイル (JSON。省略した項目は既定値)")
+	flag.StringVar(&opts.ConfigOverridePath, "config-override", "", "-config の上に重ねる設定ファイル (書いた項目だけを上書き)")
+	flag.BoolVar(&opts.StrictConfig, "strict-config", false, "設定ファイルの不明な項目・不正な値をエラーにする")
+	flag.Parse()
+
+	if opts.InputPath == "" {
+		fmt.Println("-input を指定してください")
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.WeightNDC = float32(*weightNDC)
+	if err := app.Evaluate(opts, os.Stdout); err != nil {
+		fmt.Println("評価エラー:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	app "yashubustudio/categorizer/internal/app"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "待ち受けアドレス")
+	configPath := flag.String("config", "", "設定ファイル (JSON。省略した項目は既定値)")
+	overridePath := flag.String("config-override", "", "-config の上に重ねる設定ファイル (書いた項目だけを上書き)")
+	strict := flag.Bool("strict-config", false, "設定ファイルの不明な項目・不正な値をエラーにする")
+	flag.Parse()
+
+	cfg, err := app.LoadConfigFiles(*strict, *configPath, *overridePath)
+	if err != nil {
+		fmt.Println("設定エラー:", err)
+		os.Exit(2)
+	}
+	if err := app.Serve(*addr, cfg); err != nil {
+		fmt.Println("サーバーエラー:", err)
+		fmt.Println("Config の OrtDLL / ModelPath / TokenizerPath を確認してください。")
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/sugarme/tokenizer"
 	"github.com/sugarme/tokenizer/pretrained"
@@ -23,15 +23,50 @@ type Encoder struct {
 	outputName string // "last_hidden_state" を想定
 	hidden     int    // 例: 1024
 	maxLen     int
-	mu         sync.Mutex // ORTセッションは基本スレッドセーフだが、簡易に直列化
+	pooling    string
+	// free は空いているセッション。Config.Sessions 個のセッションを用意し、
+	// 1セッションにつき同時に1推論だけ走らせる（Sessions=1 なら従来どおり直列）。
+	free     chan *ort.DynamicAdvancedSession
+	sessions []*ort.DynamicAdvancedSession
+	backend  string // 実際に使っている実行プロバイダ (例: "cpu", "cuda:0")
 }
 
+// プーリング方式
+const (
+	PoolingMean = "mean" // attention_mask 付き平均（既定）
+	PoolingMax  = "max"  // トークン方向の最大値
+	PoolingCLS  = "cls"  // 先頭トークン
+)
+
+// 実行プロバイダ。GPU を使えるかは onnxruntime.dll のビルドに依存する
+// (CPU 版の DLL では cuda / directml は登録に失敗し、CPU にフォールバックする)。
+const (
+	ProviderCPU      = "cpu"
+	ProviderCUDA     = "cuda"     // GPU 版 DLL + CUDA/cuDNN が必要
+	ProviderDirectML = "directml" // DirectML 版 DLL (Windows) が必要
+)
+
 type Config struct {
 	// 固定パス（あなたの環境）
 	OrtDLL        string // 例: D:\Ollama\projects\csv-search\onnixruntime-win\lib\onnxruntime.dll
 	ModelPath     string // 例: D:\Ollama\projects\csv-search\models\bge-m3\model.onnx  (必要なら _data も同階層)
 	TokenizerPath string // 例: D:\Ollama\projects\csv-search\models\bge-m3\tokenizer.json
 	MaxSeqLen     int    // 例: 512
+	Pooling       string // "mean" | "max" | "cls"（空なら mean）
+
+	// ORT のスレッド数。0 なら ORT 既定（マシンのコア数に依存）。
+	// 固定すると環境間で浮動小数点の集計順が揃い結果を再現しやすくなるが、速度は落ちうる。
+	IntraOpThreads int
+	InterOpThreads int
+
+	// Sessions は並列に推論できる ORT セッション数。0/1 なら1セッションで直列。
+	// セッションごとにモデルを読み込むため、メモリ使用量はほぼ比例して増える。
+	Sessions int
+
+	// ExecutionProvider は "cpu" (空も同じ) / "cuda" / "directml"。GPU を登録できない
+	// 場合は警告を出して CPU で動く。DeviceID は使う GPU の番号。
+	ExecutionProvider string
+	DeviceID          int
 }
 
 // Init: ORT/DLL読み込み→環境初期化→モデル/トークナイザ読み込み→セッション生成
@@ -113,33 +148,118 @@ func (e *Encoder) Init(cfg Config) error {
 	}
 	e.tok = tk
 
-	// セッション作成
+	// セッション作成 (GPU で失敗したら CPU でやり直す)
+	provider := strings.ToLower(strings.TrimSpace(cfg.ExecutionProvider))
+	if provider == "" {
+		provider = ProviderCPU
+	}
+	if err := e.openSessions(cfg, provider); err != nil {
+		if provider == ProviderCPU {
+			return err
+		}
+		fmt.Printf("実行プロバイダ %s を利用できないため CPU で実行します: %v\n", provider, err)
+		e.closeSessions()
+		if err := e.openSessions(cfg, ProviderCPU); err != nil {
+			return err
+		}
+	}
+
+	if cfg.MaxSeqLen <= 0 {
+		cfg.MaxSeqLen = 512
+	}
+	e.maxLen = cfg.MaxSeqLen
+	switch cfg.Pooling {
+	case PoolingMax, PoolingCLS:
+		e.pooling = cfg.Pooling
+	default:
+		e.pooling = PoolingMean
+	}
+	return nil
+}
+
+// openSessions はセッションオプションに provider を登録し、Config.Sessions 個のセッションを作る。
+func (e *Encoder) openSessions(cfg Config, provider string) error {
+	var err error
 	e.opts, err = ort.NewSessionOptions()
 	if err != nil {
 		return err
 	}
-	e.sess, err = ort.NewDynamicAdvancedSession(cfg.ModelPath, e.inputNames, []string{e.outputName}, e.opts)
-	if err != nil {
-		return err
+	if cfg.IntraOpThreads > 0 {
+		if err := e.opts.SetIntraOpNumThreads(cfg.IntraOpThreads); err != nil {
+			return err
+		}
+	}
+	if cfg.InterOpThreads > 0 {
+		if err := e.opts.SetInterOpNumThreads(cfg.InterOpThreads); err != nil {
+			return err
+		}
+	}
+	e.backend = ProviderCPU
+	switch provider {
+	case ProviderCPU:
+	case ProviderCUDA:
+		cudaOpts, err := ort.NewCUDAProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer cudaOpts.Destroy()
+		if err := cudaOpts.Update(map[string]string{"device_id": strconv.Itoa(cfg.DeviceID)}); err != nil {
+			return err
+		}
+		if err := e.opts.AppendExecutionProviderCUDA(cudaOpts); err != nil {
+			return err
+		}
+		e.backend = fmt.Sprintf("%s:%d", provider, cfg.DeviceID)
+	case ProviderDirectML:
+		if err := e.opts.AppendExecutionProviderDirectML(cfg.DeviceID); err != nil {
+			return err
+		}
+		e.backend = fmt.Sprintf("%s:%d", provider, cfg.DeviceID)
+	default:
+		return fmt.Errorf("未対応の実行プロバイダです: %s", provider)
 	}
 
-	if cfg.MaxSeqLen <= 0 {
-		cfg.MaxSeqLen = 512
+	n := cfg.Sessions
+	if n < 1 {
+		n = 1
 	}
-	e.maxLen = cfg.MaxSeqLen
+	e.free = make(chan *ort.DynamicAdvancedSession, n)
+	for i := 0; i < n; i++ {
+		sess, err := ort.NewDynamicAdvancedSession(cfg.ModelPath, e.inputNames, []string{e.outputName}, e.opts)
+		if err != nil {
+			return err
+		}
+		e.sessions = append(e.sessions, sess)
+		e.free <- sess
+	}
+	e.sess = e.sessions[0]
 	return nil
 }
 
-// Close: ORTリソースの後片付け
-func (e *Encoder) Close() {
-	if e.sess != nil {
-		e.sess.Destroy()
-		e.sess = nil
+// closeSessions はセッションとセッションオプションを破棄する。
+func (e *Encoder) closeSessions() {
+	for _, sess := range e.sessions {
+		sess.Destroy()
 	}
+	e.sessions = nil
+	e.sess = nil
 	if e.opts != nil {
 		e.opts.Destroy()
 		e.opts = nil
 	}
+}
+
+// Backend は実際に使っている実行プロバイダを返す ("cpu" / "cuda:0" / "directml:0")。
+func (e *Encoder) Backend() string {
+	if e.backend == "" {
+		return ProviderCPU
+	}
+	return e.backend
+}
+
+// Close: ORTリソースの後片付け
+func (e *Encoder) Close() {
+	e.closeSessions()
 	// ORT環境終了
 	_ = ort.DestroyEnvironment()
 }
@@ -151,31 +271,11 @@ func (e *Encoder) Encode(text string) ([]float32, error) {
 		return nil, errors.New("encoder is not initialized")
 	}
 
-	// ===== トークナイズ（最大長でトリム、attentionを自動生成）=====
-	if runtime.GOOS == "windows" {
-		text = strings.TrimSpace(text)
-	}
-	enc, err := e.tok.EncodeSingle(text)
+	ids, mask, err := e.tokenize(text)
 	if err != nil {
 		return nil, err
 	}
-	ids := make([]int64, 0, len(enc.Ids))
-	mask := make([]int64, 0, len(enc.Ids))
-	for i, v := range enc.Ids {
-		if len(ids) >= e.maxLen {
-			break
-		}
-		ids = append(ids, int64(v))
-		if len(enc.AttentionMask) > i {
-			mask = append(mask, int64(enc.AttentionMask[i]))
-		} else {
-			mask = append(mask, 1)
-		}
-	}
 	seqLen := int64(len(ids))
-	if seqLen == 0 {
-		return nil, errors.New("empty tokenized input")
-	}
 
 	// ===== 入力テンソル =====
 	shape := ort.NewShape(1, seqLen)
@@ -203,15 +303,12 @@ func (e *Encoder) Encode(text string) ([]float32, error) {
 	}
 	defer tOut.Destroy()
 
-	// 実行（直列化）
-	e.mu.Lock()
-	err = e.sess.Run(inputs, []ort.Value{tOut})
-	e.mu.Unlock()
-	if err != nil {
+	// 実行（空きセッションを待つ）
+	if err := e.run(inputs, []ort.Value{tOut}); err != nil {
 		return nil, err
 	}
 
-	// ===== Mean Pooling + L2 =====
+	// ===== Pooling + L2 =====
 	raw := tOut.GetData() // len = seqLen * hidden
 	if len(raw) != int(seqLen)*e.hidden {
 		// モデル側でpad/切詰めされた可能性を考慮（保険）
@@ -220,8 +317,140 @@ func (e *Encoder) Encode(text string) ([]float32, error) {
 		}
 		seqLen = int64(len(raw) / e.hidden)
 	}
-	vec := meanPoolAndL2(raw, int(seqLen), e.hidden, mask)
-	return vec, nil
+	return e.pool(raw, int(seqLen), mask), nil
+}
+
+// EncodeBatch: 複数テキストを1回の推論でまとめて埋め込む。
+// 返り値は入力と同じ順序。系列長はバッチ内の最大長に合わせて右側をパディングし、
+// attention_mask で除外する。attention_mask を持たないモデルでは
+// パディングが結果に影響するため、1件ずつ Encode する。
+func (e *Encoder) EncodeBatch(texts []string) ([][]float32, error) {
+	if e.sess == nil || e.tok == nil {
+		return nil, errors.New("encoder is not initialized")
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if len(texts) == 1 || len(e.inputNames) != 2 {
+		out := make([][]float32, len(texts))
+		for i, t := range texts {
+			vec, err := e.Encode(t)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = vec
+		}
+		return out, nil
+	}
+
+	// ===== トークナイズ＋パディング =====
+	allIDs := make([][]int64, len(texts))
+	allMask := make([][]int64, len(texts))
+	maxLen := 0
+	for i, t := range texts {
+		ids, mask, err := e.tokenize(t)
+		if err != nil {
+			return nil, err
+		}
+		allIDs[i], allMask[i] = ids, mask
+		if len(ids) > maxLen {
+			maxLen = len(ids)
+		}
+	}
+	batch := len(texts)
+	flatIDs := make([]int64, batch*maxLen)
+	flatMask := make([]int64, batch*maxLen)
+	for i := range texts {
+		copy(flatIDs[i*maxLen:], allIDs[i])
+		copy(flatMask[i*maxLen:], allMask[i])
+	}
+
+	// ===== 入力テンソル（[batch, maxLen]）=====
+	shape := ort.NewShape(int64(batch), int64(maxLen))
+	tIDs, err := ort.NewTensor[int64](shape, flatIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer tIDs.Destroy()
+	tMask, err := ort.NewTensor[int64](shape, flatMask)
+	if err != nil {
+		return nil, err
+	}
+	defer tMask.Destroy()
+
+	// ===== 出力テンソル（[batch, maxLen, hidden]）=====
+	outShape := ort.NewShape(int64(batch), int64(maxLen), int64(e.hidden))
+	tOut, err := ort.NewEmptyTensor[float32](outShape)
+	if err != nil {
+		return nil, err
+	}
+	defer tOut.Destroy()
+
+	if err := e.run([]ort.Value{tIDs, tMask}, []ort.Value{tOut}); err != nil {
+		return nil, err
+	}
+
+	raw := tOut.GetData()
+	stride := maxLen * e.hidden
+	if len(raw) != batch*stride {
+		return nil, fmt.Errorf("unexpected output length: %d", len(raw))
+	}
+	out := make([][]float32, batch)
+	for i := range texts {
+		out[i] = e.pool(raw[i*stride:(i+1)*stride], maxLen, flatMask[i*maxLen:(i+1)*maxLen])
+	}
+	return out, nil
+}
+
+// run: 空いているセッションを1つ借りて推論する
+func (e *Encoder) run(inputs, outputs []ort.Value) error {
+	sess := <-e.free
+	defer func() { e.free <- sess }()
+	return sess.Run(inputs, outputs)
+}
+
+// Sessions: 並列に推論できるセッション数
+func (e *Encoder) Sessions() int {
+	return len(e.sessions)
+}
+
+// tokenize: 最大長でトリムし、attention_mask を自動生成
+func (e *Encoder) tokenize(text string) ([]int64, []int64, error) {
+	if runtime.GOOS == "windows" {
+		text = strings.TrimSpace(text)
+	}
+	enc, err := e.tok.EncodeSingle(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, 0, len(enc.Ids))
+	mask := make([]int64, 0, len(enc.Ids))
+	for i, v := range enc.Ids {
+		if len(ids) >= e.maxLen {
+			break
+		}
+		ids = append(ids, int64(v))
+		if len(enc.AttentionMask) > i {
+			mask = append(mask, int64(enc.AttentionMask[i]))
+		} else {
+			mask = append(mask, 1)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, errors.New("empty tokenized input")
+	}
+	return ids, mask, nil
+}
+
+func (e *Encoder) pool(raw []float32, seqLen int, mask []int64) []float32 {
+	switch e.pooling {
+	case PoolingMax:
+		return maxPoolAndL2(raw, seqLen, e.hidden, mask)
+	case PoolingCLS:
+		return clsPoolAndL2(raw, e.hidden)
+	default:
+		return meanPoolAndL2(raw, seqLen, e.hidden, mask)
+	}
 }
 
 // ===== ヘルパ =====
@@ -244,7 +473,34 @@ func meanPoolAndL2(lastHidden []float32, seqLen, hidden int, attn []int64) []flo
 			out[h] *= float32(inv)
 		}
 	}
-	// L2 normalize
+	return l2Normalize(out)
+}
+
+func maxPoolAndL2(lastHidden []float32, seqLen, hidden int, attn []int64) []float32 {
+	out := make([]float32, hidden)
+	first := true
+	for t := 0; t < seqLen; t++ {
+		if attn != nil && attn[t] == 0 {
+			continue
+		}
+		base := t * hidden
+		for h := 0; h < hidden; h++ {
+			if v := lastHidden[base+h]; first || v > out[h] {
+				out[h] = v
+			}
+		}
+		first = false
+	}
+	return l2Normalize(out)
+}
+
+func clsPoolAndL2(lastHidden []float32, hidden int) []float32 {
+	out := make([]float32, hidden)
+	copy(out, lastHidden[:hidden])
+	return l2Normalize(out)
+}
+
+func l2Normalize(out []float32) []float32 {
 	var s float64
 	for _, v := range out {
 		s += float64(v) * float64(v)
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ambiguousCategoryThreshold 以上に似ているカテゴリ同士は、入力の僅かな違いで
+// Top1 が入れ替わりやすい。
+const ambiguousCategoryThreshold float32 = 0.95
+
+// DetectAmbiguousCategories returns pairs of user categories whose vectors
+// have cosine similarity at or above threshold.
+func (s *Service) DetectAmbiguousCategories(threshold float32) [][]string {
+	s.mu.RLock()
+	cands := append([]Candidate(nil), s.candsCat...)
+	s.mu.RUnlock()
+
+	var pairs [][]string
+	for i := 0; i < len(cands); i++ {
+		qNorm := cands[i].Norm
+		if qNorm == 0 {
+			qNorm = vecNorm(cands[i].Vec)
+		}
+		for j := i + 1; j < len(cands); j++ {
+			if cosineCandidate(cands[i].Vec, qNorm, cands[j]) >= threshold {
+				pairs = append(pairs, []string{cands[i].Label, cands[j].Label})
+			}
+		}
+	}
+	return pairs
+}
+
+func formatAmbiguousPairs(pairs [][]string) string {
+	lines := make([]string, len(pairs))
+	for i, p := range pairs {
+		lines[i] = fmt.Sprintf("・%s / %s", p[0], p[1])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectAmbiguousCategories(t *testing.T) {
+	cand := func(label string, vec ...float32) Candidate {
+		return Candidate{Label: label, Key: normalizeKey(label), Vec: vec, Norm: vecNorm(vec)}
+	}
+	// 「家電」と「電化製品」はほぼ同じ向き (cos ≈ 0.995)、「旅行」とは直交する
+	svc := &Service{candsCat: []Candidate{
+		cand("家電", 1, 0, 0),
+		cand("旅行", 0, 1, 0),
+		cand("電化製品", 0.99, 0.1, 0),
+		cand("料理", 0, 0, 1),
+	}}
+	tests := []struct {
+		name      string
+		threshold float32
+		want      [][]string
+	}{
+		{"default threshold", ambiguousCategoryThreshold, [][]string{{"家電", "電化製品"}}},
+		{"above the pair", 0.999, nil},
+		{"low threshold adds the neighbor", 0.09, [][]string{{"家電", "電化製品"}, {"旅行", "電化製品"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.DetectAmbiguousCategories(tt.threshold); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pairs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
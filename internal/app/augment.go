@@ -0,0 +1,89 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// csvSource remembers the file an input list was loaded from so results can be
+// written back into a copy of it as extra columns.
+type csvSource struct {
+	name      string
+	records   [][]string
+	hasHeader bool
+	delim     rune
+	rowIndex  []int // 入力行 i に対応する records のインデックス
+	// entries は rowIndex と同じ並びの分類対象テキスト。セル内の改行を含んでも
+	// 1件のまま保つため、入力欄を分割し直さずにこちらを分類する。
+	entries []string
+	// inputText は読込直後の入力欄の内容。編集されたかどうかの判定に使う。
+	inputText string
+	encoding  textEncoding // 読込元の文字コード。追記出力も同じ文字コードで書く
+	// 読込時に解析できずスキップしたレコード。records に含まれないため追記出力にも出ない。
+	skipped []ParseWarning
+}
+
+const (
+	augmentLabelHeader = "推定カテゴリ"
+	augmentScoreHeader = "推定スコア"
+)
+
+// writeAugmentedCSV writes every original record unchanged and appends the
+// best label and its score, in the encoding the source was read with.
+// Records that were not classified (e.g. skipped empty cells) get empty
+// cells so the column count stays consistent.
+func writeAugmentedCSV(w io.Writer, src *csvSource, rows []ResultRow) error {
+	if len(src.rowIndex) != len(rows) {
+		return fmt.Errorf("結果の件数 (%d) が読込元の行数 (%d) と一致しません", len(rows), len(src.rowIndex))
+	}
+	w, flush, err := encodeOutput(w, src.encoding)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, rec := range src.records {
+		if len(rec) > width {
+			width = len(rec)
+		}
+	}
+	byRecord := make(map[int]ResultRow, len(rows))
+	for i, idx := range src.rowIndex {
+		byRecord[idx] = rows[i]
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = src.delim
+	for i, rec := range src.records {
+		out := make([]string, width, width+2)
+		copy(out, rec)
+		switch row, ok := byRecord[i]; {
+		case i == 0 && src.hasHeader:
+			out = append(out, augmentLabelHeader, augmentScoreHeader)
+		case ok && len(row.Suggestions) > 0:
+			best := row.Suggestions[0]
+			out = append(out, best.Label, fmt.Sprintf("%.3f", best.Score))
+		default:
+			out = append(out, "", "")
+		}
+		if err := cw.Write(out); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func augmentedFileName(name string) string {
+	ext := filepath.Ext(name)
+	out := ext
+	if strings.EqualFold(ext, ".xlsx") {
+		out = ".csv" // 追記結果は CSV で書き出す
+	}
+	return strings.TrimSuffix(name, ext) + "_categorized" + out
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestWriteAugmentedCSV(t *testing.T) {
+	records := [][]string{{"本文", "id"}, {"一行目\n二行目", "1"}, {"", "2"}, {"りんご", "3"}}
+	src := &csvSource{
+		records:   records,
+		hasHeader: true,
+		delim:     ',',
+		rowIndex:  keptRowIndices(records, []int{0}, true, false),
+		entries:   extractCSVColumns(records, []int{0}, true, false),
+	}
+	rows := []ResultRow{
+		{Text: src.entries[0], Suggestions: []Suggestion{{Label: "文書", Score: 0.5}}},
+		{Text: src.entries[1], Suggestions: []Suggestion{{Label: "果物", Score: 0.9}}},
+	}
+	want := "本文,id,推定カテゴリ,推定スコア\n\"一行目\n二行目\",1,文書,0.500\n,2,,\nりんご,3,果物,0.900\n"
+	sjis, err := japanese.ShiftJIS.NewEncoder().String(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		encoding textEncoding
+		want     string
+	}{
+		{"utf-8", textEncoding{name: EncodingUTF8}, want},
+		{"utf-8 with BOM", textEncoding{name: EncodingUTF8, bom: true}, string(utf8BOM) + want},
+		{"shift_jis", textEncoding{name: EncodingShiftJIS}, sjis},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *src
+			s.encoding = tt.encoding
+			var buf bytes.Buffer
+			if err := writeAugmentedCSV(&buf, &s, rows); err != nil {
+				t.Fatalf("writeAugmentedCSV: %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		enc  string
+		want textEncoding
+	}{
+		{"auto utf-8", []byte("あ"), EncodingAuto, textEncoding{name: EncodingUTF8}},
+		{"auto utf-8 BOM", append(append([]byte(nil), utf8BOM...), "あ"...), "", textEncoding{name: EncodingUTF8, bom: true}},
+		{"auto shift_jis", []byte{0x82, 0xa0}, EncodingAuto, textEncoding{name: EncodingShiftJIS}},
+		{"explicit euc-jp", []byte("x"), "EUC-JP", textEncoding{name: EncodingEUCJP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectEncoding(tt.data, tt.enc); got != tt.want {
+				t.Errorf("detectEncoding = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
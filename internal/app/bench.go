@@ -0,0 +1,245 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// BenchOptions configures Bench.
+type BenchOptions struct {
+	N          int    // 埋め込む件数
+	InputPath  string // 指定するとこのファイルの本文列から先頭 N 件を使う。空なら合成した文
+	TextColumn string // 見出し名または1始まりの列番号。空なら見出しから推定 (無ければ1列目)
+	JSON       bool   // 結果を JSON で出力する
+
+	ConfigPath         string // 設定ファイル (JSON)。空なら既定値
+	ConfigOverridePath string // ConfigPath の上に重ねる設定ファイル。書いた項目だけを上書きする
+	StrictConfig       bool   // 設定ファイルの不明な項目・不正な値をエラーにする
+}
+
+// BenchPhase is the measurement of one pass over the bench texts.
+// Latency is per call, each call embedding up to BenchReport.CallSize texts.
+type BenchPhase struct {
+	Name       string  `json:"name"`
+	Texts      int     `json:"texts"`
+	Seconds    float64 `json:"seconds"`
+	TextsPerS  float64 `json:"texts_per_sec"`
+	P50Millis  float64 `json:"p50_ms"`
+	P95Millis  float64 `json:"p95_ms"`
+	MemoryHits int     `json:"memory_hits"`
+	DiskHits   int     `json:"disk_hits"`
+	Misses     int     `json:"misses"` // エンコーダで埋め込んだ件数 (encoder 段階は 0)
+}
+
+// BenchReport is what Bench prints.
+type BenchReport struct {
+	Model     string       `json:"model"`
+	Backend   string       `json:"backend"`
+	Sessions  int          `json:"sessions"`
+	BatchSize int          `json:"batch_size"`
+	CallSize  int          `json:"call_size"`
+	Source    string       `json:"source"` // "synthetic" または入力ファイル名
+	Phases    []BenchPhase `json:"phases"`
+}
+
+// 計測の段階。encoder はキャッシュを通さずにエンコーダを直接呼び、残りは
+// EmbedBatchCached を通す (cold: すべて埋め込み / memory: メモリから /
+// disk: メモリを空にしてディスクから)。
+const (
+	benchPhaseEncoder = "encoder"
+	benchPhaseCold    = "cold"
+	benchPhaseMemory  = "memory"
+	benchPhaseDisk    = "disk"
+)
+
+// Bench embeds opts.N texts with the configured model and reports
+// throughput, p50/p95 latency and cache behavior per phase, for sizing
+// hardware and checking BatchSize/EmbedWorkers changes. Seeds and NDC are
+// not loaded. The disk cache phases use a temporary folder, so
+// Config.CacheDir is neither read nor filled.
+func Bench(opts BenchOptions, w io.Writer) error {
+	if opts.N <= 0 {
+		return errors.New("-n は 1 以上で指定してください")
+	}
+	cfg, err := LoadConfigFiles(opts.StrictConfig, opts.ConfigPath, opts.ConfigOverridePath)
+	if err != nil {
+		return err
+	}
+	texts, source := syntheticBenchTexts(opts.N), "synthetic"
+	if opts.InputPath != "" {
+		if texts, err = benchInputTexts(opts.InputPath, opts.TextColumn, opts.N, inputSource(cfg)); err != nil {
+			return err
+		}
+		source = opts.InputPath
+	}
+
+	cacheDir, err := os.MkdirTemp("", "categorizer-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cacheDir)
+	cfg.CacheDir = cacheDir
+	enc, err := newEncoder(cfg)
+	if err != nil {
+		return err
+	}
+	defer enc.Close()
+	// 初回の遅延確保を計測に含めないよう先に1回埋め込む (-json の出力を汚さないよう
+	// warmUpEncoder は使わない)
+	warm, err := enc.Encode("ウォームアップ")
+	if err != nil {
+		return err
+	}
+	svc := &Service{cfg: cfg, emb: enc, cache: newEmbedCache(cacheDir, cacheModelID(cfg))}
+	if err := svc.cache.observeEncoded(len(warm)); err != nil {
+		return err
+	}
+	report, err := runBench(context.Background(), svc, texts)
+	if err != nil {
+		return err
+	}
+	report.Source = source
+	if opts.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	writeBenchReport(w, report)
+	return nil
+}
+
+// runBench measures the phases on svc, whose cache must be empty and backed
+// by a disk folder.
+func runBench(ctx context.Context, svc *Service, texts []string) (BenchReport, error) {
+	cfg := svc.Config()
+	batchSize := max(cfg.BatchSize, 1)
+	callSize := batchSize * max(svc.embedWorkers(), 1)
+	report := BenchReport{
+		Model:     svc.cache.modelID,
+		Backend:   svc.emb.Backend(),
+		Sessions:  svc.emb.Sessions(),
+		BatchSize: batchSize,
+		CallSize:  callSize,
+	}
+
+	encodeDirect := func(call []string) error {
+		for start := 0; start < len(call); start += batchSize {
+			if _, err := svc.emb.EncodeBatch(call[start:min(start+batchSize, len(call))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	embedCached := func(call []string) error {
+		_, err := svc.EmbedBatchCached(ctx, call)
+		return err
+	}
+	phases := []struct {
+		name  string
+		embed func([]string) error
+	}{
+		{benchPhaseEncoder, encodeDirect},
+		{benchPhaseCold, embedCached},
+		{benchPhaseMemory, embedCached},
+		{benchPhaseDisk, embedCached},
+	}
+	for _, ph := range phases {
+		if ph.name == benchPhaseDisk {
+			svc.cache.clear(false)
+		}
+		before := svc.CacheStats()
+		var lat []time.Duration
+		start := time.Now()
+		for i := 0; i < len(texts); i += callSize {
+			t := time.Now()
+			if err := ph.embed(texts[i:min(i+callSize, len(texts))]); err != nil {
+				return report, fmt.Errorf("%s: %w", ph.name, err)
+			}
+			lat = append(lat, time.Since(t))
+		}
+		elapsed := time.Since(start)
+		st := svc.CacheStats().Sub(before)
+		p := BenchPhase{
+			Name:       ph.name,
+			Texts:      len(texts),
+			Seconds:    elapsed.Seconds(),
+			P50Millis:  durationPercentile(lat, 50).Seconds() * 1000,
+			P95Millis:  durationPercentile(lat, 95).Seconds() * 1000,
+			MemoryHits: st.MemoryHits,
+			DiskHits:   st.DiskHits,
+			Misses:     st.Misses,
+		}
+		if elapsed > 0 {
+			p.TextsPerS = float64(len(texts)) / elapsed.Seconds()
+		}
+		report.Phases = append(report.Phases, p)
+	}
+	return report, nil
+}
+
+// durationPercentile returns the nearest-rank p-th percentile of ds.
+func durationPercentile(ds []time.Duration, p int) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// syntheticBenchTexts returns n distinct sentences of ordinary length, so
+// every text misses the cache on the first pass.
+func syntheticBenchTexts(n int) []string {
+	subjects := []string{"地域の図書館", "週末の市場", "新しい研究", "高校の部活動", "山あいの温泉", "駅前の再開発"}
+	topics := []string{"で開かれた料理教室の様子", "についての住民アンケートの結果", "を紹介する写真展", "で使われている最新の機材", "が話題になった理由", "の歴史と今後の計画"}
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("%s%s (第%d回)", subjects[i%len(subjects)], topics[(i/len(subjects))%len(topics)], i+1)
+	}
+	return texts
+}
+
+// benchInputTexts reads up to n non-empty texts from the text column of path,
+// read as src.
+func benchInputTexts(path, column string, n int, src tableSource) ([]string, error) {
+	records, err := readEvalRecords(path, src)
+	if err != nil {
+		return nil, err
+	}
+	col, byName, err := resolveEvalColumn(records[0], column, detectTextColumn(records[0]))
+	if err != nil {
+		return nil, err
+	}
+	if col < 0 {
+		col = 0
+	}
+	texts := extractCSVColumns(records, []int{col}, byName, false)
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("本文がありません (%s)", path)
+	}
+	if len(texts) > n {
+		texts = texts[:n]
+	}
+	return texts, nil
+}
+
+func writeBenchReport(w io.Writer, r BenchReport) {
+	fmt.Fprintf(w, "モデル: %s (%s, セッション %d, BatchSize %d, 1回あたり %d件)\n", r.Model, r.Backend, r.Sessions, r.BatchSize, r.CallSize)
+	if len(r.Phases) > 0 {
+		fmt.Fprintf(w, "件数: %d (%s)\n", r.Phases[0].Texts, r.Source)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "段階\t件/秒\tp50 (ms)\tp95 (ms)\tメモリ命中\tディスク命中\t埋め込み")
+	for _, p := range r.Phases {
+		fmt.Fprintf(tw, "%s\t%.1f\t%.1f\t%.1f\t%d\t%d\t%d\n", p.Name, p.TextsPerS, p.P50Millis, p.P95Millis, p.MemoryHits, p.DiskHits, p.Misses)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunBenchCachePhases(t *testing.T) {
+	const n = 50
+	cfg := sanitizeConfig(defaultConfig())
+	cfg.BatchSize = 8
+	cfg.CacheDir = t.TempDir()
+	svc := &Service{cfg: cfg, emb: hashEncoder{dim: 64}, cache: newEmbedCache(cfg.CacheDir, "hash-64")}
+	report, err := runBench(context.Background(), svc, syntheticBenchTexts(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BenchPhase{
+		{Name: benchPhaseEncoder},
+		{Name: benchPhaseCold, Misses: n},
+		{Name: benchPhaseMemory, MemoryHits: n},
+		{Name: benchPhaseDisk, DiskHits: n},
+	}
+	if len(report.Phases) != len(want) {
+		t.Fatalf("got %d phases, want %d", len(report.Phases), len(want))
+	}
+	for i, w := range want {
+		got := report.Phases[i]
+		if got.Name != w.Name || got.MemoryHits != w.MemoryHits || got.DiskHits != w.DiskHits || got.Misses != w.Misses {
+			t.Errorf("phase %d = %s mem %d disk %d miss %d, want %s mem %d disk %d miss %d",
+				i, got.Name, got.MemoryHits, got.DiskHits, got.Misses, w.Name, w.MemoryHits, w.DiskHits, w.Misses)
+		}
+		if got.Texts != n || got.P50Millis > got.P95Millis {
+			t.Errorf("phase %s: texts %d p50 %.3f p95 %.3f", got.Name, got.Texts, got.P50Millis, got.P95Millis)
+		}
+	}
+}
+
+func TestDurationPercentile(t *testing.T) {
+	ms := func(ns ...int) []time.Duration {
+		ds := make([]time.Duration, len(ns))
+		for i, n := range ns {
+			ds[i] = time.Duration(n) * time.Millisecond
+		}
+		return ds
+	}
+	tests := []struct {
+		name string
+		ds   []time.Duration
+		p    int
+		want time.Duration
+	}{
+		{"empty", nil, 50, 0},
+		{"single", ms(7), 95, 7 * time.Millisecond},
+		{"p50 unsorted", ms(5, 1, 4, 2, 3), 50, 3 * time.Millisecond},
+		{"p95 of 20", ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20), 95, 19 * time.Millisecond},
+		{"p95 of 10", ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 95, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := durationPercentile(tt.ds, tt.p); got != tt.want {
+				t.Errorf("durationPercentile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyntheticBenchTextsDistinct(t *testing.T) {
+	texts := syntheticBenchTexts(1000)
+	seen := make(map[string]bool, len(texts))
+	for _, s := range texts {
+		if seen[s] {
+			t.Fatalf("duplicate text %q", s)
+		}
+		seen[s] = true
+	}
+}
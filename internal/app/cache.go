@@ -2,14 +2,30 @@ package app
 
 import (
 	"bytes"
+	"container/list"
 	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
+
+	emb "yashubustudio/categorizer/emb"
+)
+
+// キャッシュファイルの形式:
+//
+//	"CVEC" | version (1 byte) | 次元数 (uint32 LE) | float32 LE × 次元数
+//
+// ファイル名は vec_<モデルIDの sha1 先頭4バイト>_<cacheKey>.bin。version を
+// 持たない旧形式 (次元数から始まる) も読み込む。未知の version は読まずに
+// 埋め込み直し、新しい形式で上書きする。
+const (
+	cacheFileMagic   = "CVEC"
+	cacheFileVersion = 1
 )
 
 type embedCache struct {
@@ -17,6 +33,58 @@ type embedCache struct {
 	m       map[string][]float32
 	dir     string
 	modelID string
+	dim     int // 最後に格納したベクトルの次元。未格納なら 0
+	// modelDim はエンコーダが最初に返したベクトルの次元。ディスク上の
+	// キャッシュはこれと一致しなければ読み込まない。未計測なら 0
+	modelDim int
+
+	// maxEntries が正ならメモリ上のベクトル数をこの件数までに抑え、最も長く
+	// 使われていないものから捨てる (ディスク上のファイルは残る)。0 で無制限
+	maxEntries int
+	lru        *list.List               // 先頭ほど最近使ったキー。maxEntries が 0 なら nil
+	lruPos     map[string]*list.Element // キー → lru 上の位置
+
+	// 命中数の集計 (mu で保護)
+	memHits   int
+	diskHits  int
+	misses    int
+	evictions int
+}
+
+// DimensionMismatchError reports vectors whose length differs from what the
+// current model produces, typically a cache left over from another model.
+type DimensionMismatchError struct {
+	Cache int    // キャッシュ (またはカテゴリ) 側の次元
+	Model int    // 現在のモデルの次元
+	Where string // キャッシュファイルのパスまたはカテゴリ名
+}
+
+func (e *DimensionMismatchError) Error() string {
+	msg := fmt.Sprintf("embedding dimension mismatch: cache %d vs model %d", e.Cache, e.Model)
+	if e.Where != "" {
+		msg += " (" + e.Where + ")"
+	}
+	return msg + "。キャッシュを削除してから再実行してください"
+}
+
+// CacheStats reports how often embeddings were served from the cache.
+type CacheStats struct {
+	MemoryHits int
+	DiskHits   int
+	Misses     int // エンコーダで埋め込んだ件数
+	Evictions  int // MemCacheEntries を超えてメモリから捨てた件数
+	Entries    int // メモリ上のベクトル数
+}
+
+// Sub returns the counters accumulated since prev. Entries is kept as is.
+func (s CacheStats) Sub(prev CacheStats) CacheStats {
+	return CacheStats{
+		MemoryHits: s.MemoryHits - prev.MemoryHits,
+		DiskHits:   s.DiskHits - prev.DiskHits,
+		Misses:     s.Misses - prev.Misses,
+		Evictions:  s.Evictions - prev.Evictions,
+		Entries:    s.Entries,
+	}
 }
 
 func newEmbedCache(dir, modelID string) *embedCache {
@@ -24,34 +92,180 @@ func newEmbedCache(dir, modelID string) *embedCache {
 }
 
 func (c *embedCache) get(key string) ([]float32, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	v, ok := c.m[key]
+	if ok {
+		c.memHits++
+		if c.lru != nil {
+			c.lru.MoveToFront(c.lruPos[key])
+		}
+	}
 	return v, ok
 }
 
+// setLimit changes the maximum number of in-memory vectors (0: unlimited),
+// evicting the least recently used ones if the cache is already larger.
+func (c *embedCache) setLimit(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n < 0 {
+		n = 0
+	}
+	c.maxEntries = n
+	if n == 0 {
+		c.lru, c.lruPos = nil, nil
+		return
+	}
+	if c.lru == nil {
+		// 使用順は分からないので、既存のキーは任意の順で登録する
+		c.lru = list.New()
+		c.lruPos = make(map[string]*list.Element, len(c.m))
+		for key := range c.m {
+			c.lruPos[key] = c.lru.PushBack(key)
+		}
+	}
+	c.evictLocked()
+}
+
+// evictLocked drops least recently used vectors beyond maxEntries.
+// c.mu must be held for writing.
+func (c *embedCache) evictLocked() {
+	for c.lru != nil && len(c.m) > c.maxEntries {
+		back := c.lru.Back()
+		key := back.Value.(string)
+		c.lru.Remove(back)
+		delete(c.lruPos, key)
+		delete(c.m, key)
+		c.evictions++
+	}
+}
+
+// countMiss records a lookup that had to go to the encoder.
+func (c *embedCache) countMiss() {
+	c.mu.Lock()
+	c.misses++
+	c.mu.Unlock()
+}
+
+func (c *embedCache) stats() CacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return CacheStats{MemoryHits: c.memHits, DiskHits: c.diskHits, Misses: c.misses, Evictions: c.evictions, Entries: len(c.m)}
+}
+
+// clear empties the memory cache and, with includeDisk, removes this
+// model's vector files. Files written for other models (different prefix)
+// and files from before the prefix was introduced are left alone.
+func (c *embedCache) clear(includeDisk bool) (int, error) {
+	c.mu.Lock()
+	c.m = make(map[string][]float32)
+	if c.lru != nil {
+		c.lru = list.New()
+		c.lruPos = make(map[string]*list.Element)
+	}
+	c.mu.Unlock()
+	if !includeDisk || c.dir == "" {
+		return 0, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, c.filePrefix()+"*.bin"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// filePrefix distinguishes this model's vector files on disk.
+func (c *embedCache) filePrefix() string {
+	h := sha1.Sum([]byte(c.modelID))
+	return "vec_" + hex.EncodeToString(h[:4]) + "_"
+}
+
+func (c *embedCache) filePath(key string) string {
+	return filepath.Join(c.dir, c.filePrefix()+key+".bin")
+}
+
 func (c *embedCache) put(key string, v []float32) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.m[key] = v
+	c.dim = len(v)
+	if c.lru != nil {
+		if e, ok := c.lruPos[key]; ok {
+			c.lru.MoveToFront(e)
+		} else {
+			c.lruPos[key] = c.lru.PushFront(key)
+		}
+		c.evictLocked()
+	}
+}
+
+// dimension returns the model's vector length once known, otherwise the
+// length of the most recently stored vector, or 0 before the first embedding.
+func (c *embedCache) dimension() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.modelDim > 0 {
+		return c.modelDim
+	}
+	return c.dim
+}
+
+// observeEncoded records the dimension of a vector fresh from the encoder.
+// The first one fixes modelDim; later ones must agree with it.
+func (c *embedCache) observeEncoded(n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.modelDim == 0 {
+		c.modelDim = n
+		return nil
+	}
+	if n != c.modelDim {
+		return &DimensionMismatchError{Cache: c.modelDim, Model: n}
+	}
+	return nil
 }
 
 func (c *embedCache) load(key string) ([]float32, bool, error) {
 	if c.dir == "" {
 		return nil, false, nil
 	}
-	path := filepath.Join(c.dir, key+".bin")
+	path := c.filePath(key)
 	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// 接頭辞導入前のファイル名 (キー自体にモデルIDが含まれるので再利用できる)
+		path = filepath.Join(c.dir, key+".bin")
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, false, nil
 		}
 		return nil, false, err
 	}
+	if bytes.HasPrefix(data, []byte(cacheFileMagic)) {
+		if len(data) < len(cacheFileMagic)+1 || data[len(cacheFileMagic)] != cacheFileVersion {
+			return nil, false, nil
+		}
+		data = data[len(cacheFileMagic)+1:]
+	}
 	if len(data) < 4 {
 		return nil, false, fmt.Errorf("cache file broken: %s", path)
 	}
 	length := binary.LittleEndian.Uint32(data[:4])
+	c.mu.RLock()
+	want := c.modelDim
+	c.mu.RUnlock()
+	if want > 0 && int(length) != want {
+		return nil, false, &DimensionMismatchError{Cache: int(length), Model: want, Where: path}
+	}
 	need := int(length) * 4
 	if len(data) < 4+need {
 		return nil, false, fmt.Errorf("cache truncated: %s", path)
@@ -60,6 +274,9 @@ func (c *embedCache) load(key string) ([]float32, bool, error) {
 	if err := binary.Read(bytes.NewReader(data[4:4+need]), binary.LittleEndian, vec); err != nil {
 		return nil, false, err
 	}
+	c.mu.Lock()
+	c.diskHits++
+	c.mu.Unlock()
 	return vec, true, nil
 }
 
@@ -67,8 +284,10 @@ func (c *embedCache) save(key string, v []float32) error {
 	if c.dir == "" {
 		return nil
 	}
-	path := filepath.Join(c.dir, key+".bin")
+	path := c.filePath(key)
 	buf := &bytes.Buffer{}
+	buf.WriteString(cacheFileMagic)
+	buf.WriteByte(cacheFileVersion)
 	_ = binary.Write(buf, binary.LittleEndian, uint32(len(v)))
 	if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
 		return err
@@ -76,6 +295,75 @@ func (c *embedCache) save(key string, v []float32) error {
 	return os.WriteFile(path, buf.Bytes(), 0o644)
 }
 
+// cacheModelID identifies the vectors produced by the configured model, e.g.
+// "bge-m3/model.onnx@1a2b3c4d5e6f". Exported models are almost always named
+// model.onnx, so the readable part is only for display and the fingerprint of
+// the file contents tells models apart. Non-default pooling is appended so
+// switching it never reuses stale vectors.
+func cacheModelID(cfg Config) string {
+	path := filepath.Clean(cfg.ModelPath)
+	id := filepath.Base(filepath.Dir(path)) + "/" + filepath.Base(path) + "@" + modelFingerprint(path)
+	if cfg.Pooling != "" && cfg.Pooling != emb.PoolingMean {
+		id += "|" + cfg.Pooling
+	}
+	return id
+}
+
+// modelFingerprintChunk は指紋に使うモデルファイル先頭・末尾のバイト数。
+const modelFingerprintChunk = 1 << 20
+
+// modelFingerprint hashes the size, the first and the last MiB of the model
+// and of its external weights file (model.onnx_data), which is enough to
+// tell different models apart without reading gigabytes at startup. It falls
+// back to the absolute path when the file cannot be read.
+func modelFingerprint(path string) string {
+	h := sha1.New()
+	n := 0
+	for _, p := range []string{path, path + "_data", path + ".data"} {
+		if fingerprintFile(h, p) {
+			n++
+		}
+	}
+	if n == 0 {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		h.Write([]byte(abs))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// fingerprintFile writes the size, head and tail of path to w and reports
+// whether the file could be read.
+func fingerprintFile(w io.Writer, path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.IsDir() {
+		return false
+	}
+	size := st.Size()
+	_ = binary.Write(w, binary.LittleEndian, size)
+	if _, err := io.CopyN(w, f, modelFingerprintChunk); err != nil && !errors.Is(err, io.EOF) {
+		return false
+	}
+	if size > 2*modelFingerprintChunk {
+		if _, err := f.Seek(-modelFingerprintChunk, io.SeekEnd); err != nil {
+			return false
+		}
+		if _, err := io.CopyN(w, f, modelFingerprintChunk); err != nil && !errors.Is(err, io.EOF) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheKey is the hex sha1 of "<text>|<model ID>". It is part of the file
+// format: changing it orphans every cached vector.
 func cacheKey(text, model string) string {
 	h := sha1.Sum([]byte(text + "|" + model))
 	return hex.EncodeToString(h[:])
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	emb "yashubustudio/categorizer/emb"
+)
+
+func TestCacheModelID(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) string {
+		p := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	bge := write("a/bge-m3/model.onnx", "bge weights")
+	bgeCopy := write("b/bge-m3/model.onnx", "bge weights")
+	e5 := write("a/e5/model.onnx", "e5 weights")
+	tuned := write("c/bge-m3/model.onnx", "bge weights")
+	write("c/bge-m3/model.onnx_data", "tuned weights")
+
+	id := func(path, pooling string) string { return cacheModelID(Config{ModelPath: path, Pooling: pooling}) }
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"same model at another path", id(bge, ""), id(bgeCopy, ""), true},
+		{"different models named model.onnx", id(bge, ""), id(e5, ""), false},
+		{"different external weights", id(bge, ""), id(tuned, ""), false},
+		{"different pooling", id(bge, ""), id(bge, emb.PoolingCLS), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.a == tt.b) != tt.same {
+				t.Errorf("ids %q and %q: same = %v, want %v", tt.a, tt.b, tt.a == tt.b, tt.same)
+			}
+		})
+	}
+	if got := id(bge, ""); !strings.HasPrefix(got, "bge-m3/model.onnx@") {
+		t.Errorf("id = %q, want bge-m3/model.onnx@<fingerprint>", got)
+	}
+}
+
+func TestCacheKeyCaseVariants(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       string
+		caseFold   bool
+		stripPunct bool
+		same       bool
+	}{
+		{"ascii case", "VRChat", "vrchat", true, false, true},
+		{"ascii case without fold", "VRChat", "vrchat", false, false, false},
+		{"full-width ascii", "ＶＲＣｈａｔ", "vrchat", true, false, true},
+		{"mixed with japanese", "VRChatで遊ぶ", "vrchatで遊ぶ", true, false, true},
+		{"punctuation", "Hello, World!", "hello world", true, true, true},
+		{"punctuation without strip", "Hello, World!", "hello world", true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) {
+				c.CaseFold = tt.caseFold
+				c.StripPunctuation = tt.stripPunct
+			})
+			keyA := cacheKey(svc.prepareText(tt.a), svc.cache.modelID)
+			keyB := cacheKey(svc.prepareText(tt.b), svc.cache.modelID)
+			if (keyA == keyB) != tt.same {
+				t.Fatalf("cache keys of %q and %q: same = %v, want %v", tt.a, tt.b, keyA == keyB, tt.same)
+			}
+			// 分類経路でも2件目はキャッシュから読まれる
+			if _, err := svc.ClassifyAll(context.Background(), []string{tt.a}, nil); err != nil {
+				t.Fatal(err)
+			}
+			before := svc.CacheStats()
+			if _, err := svc.ClassifyAll(context.Background(), []string{tt.b}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if misses := svc.CacheStats().Sub(before).Misses; (misses == 0) != tt.same {
+				t.Errorf("classifying %q after %q embedded %d texts", tt.b, tt.a, misses)
+			}
+		})
+	}
+}
+
+func TestCaseFoldKeepsCJK(t *testing.T) {
+	for _, s := range []string{"日本語の文章", "カタカナとひらがな", "漢字"} {
+		if got := foldText(s, true, false); got != s {
+			t.Errorf("foldText(%q) = %q, want it unchanged", s, got)
+		}
+	}
+}
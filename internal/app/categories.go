@@ -3,9 +3,13 @@ package app
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var defaultUserCategories = []string{
@@ -31,13 +35,145 @@ func initialUserCategories(seedFile string) ([]string, bool, error) {
 	if path == "" {
 		return fallback, false, nil
 	}
-	cats, err := loadCategorySeedFile(path)
+	cats, err := loadCategorySeedFile(path, EncodingAuto)
 	if err != nil {
 		return fallback, false, err
 	}
 	return cats, true, nil
 }
 
+// ParseSeedAliases reads a CSV/TSV (optionally .gz) where each row is a
+// canonical category followed by its aliases. A first row whose first cell
+// is a category header is skipped. The text is decoded as enc (EncodingAuto
+// to detect it) and sheet picks the .xlsx sheet (empty for the first one).
+func ParseSeedAliases(path, enc, sheet string) ([]CategorySpec, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, name, err := readInputData(f, path, enc)
+	if err != nil {
+		return nil, err
+	}
+	records, _, err := readTableRecords(data, name, sheet)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && len(records[0]) > 0 && headerMatches(records[0][0], categoryHeaderNames) {
+		records = records[1:]
+	}
+	var specs []CategorySpec
+	for _, row := range records {
+		var spec CategorySpec
+		for _, cell := range row {
+			v := strings.TrimSpace(cell)
+			if v == "" {
+				continue
+			}
+			if spec.Label == "" {
+				spec.Label = v
+			} else {
+				spec.Aliases = append(spec.Aliases, v)
+			}
+		}
+		if spec.Label != "" {
+			specs = append(specs, spec)
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("別名ファイルにカテゴリがありません (%s)", filepath.Clean(path))
+	}
+	return specs, nil
+}
+
+// seedFileAliases returns the aliases of Config.SeedAliasFile keyed like
+// Candidate.Key, or nil when no file is set. The file is read on every call
+// so every category update (startup, GUI load, server /seeds) uses its
+// current content; a read error is printed and leaves the aliases out.
+func (s *Service) seedFileAliases() map[string][]string {
+	cfg := s.Config()
+	path := strings.TrimSpace(cfg.SeedAliasFile)
+	if path == "" {
+		return nil
+	}
+	src := categorySource(cfg)
+	specs, err := ParseSeedAliases(path, src.encoding, src.sheet)
+	if err != nil {
+		fmt.Printf("カテゴリ別名ファイルの読み込みに失敗しました (%s): %v\n", path, err)
+		return nil
+	}
+	aliases := make(map[string][]string, len(specs))
+	for _, sp := range specs {
+		_, name := splitLanguageTag(sp.Label)
+		if cfg.TrimLabelPunct {
+			name = trimLabelDecoration(name)
+		}
+		key := normalizeKey(name)
+		aliases[key] = append(aliases[key], sp.Aliases...)
+	}
+	return aliases
+}
+
+// withSeedAliases attaches aliases to the labels they name. Canonical
+// labels that are not in labels are appended as new categories.
+func withSeedAliases(labels []string, aliases []CategorySpec) []CategorySpec {
+	specs := labelSpecs(labels)
+	index := make(map[string]int, len(specs))
+	for i, sp := range specs {
+		index[normalizeKey(sp.Label)] = i
+	}
+	for _, al := range aliases {
+		key := normalizeKey(al.Label)
+		if i, ok := index[key]; ok {
+			specs[i].Aliases = append(specs[i].Aliases, al.Aliases...)
+			continue
+		}
+		index[key] = len(specs)
+		specs = append(specs, al)
+	}
+	return specs
+}
+
+// collectCategoryAliases reads each row of records as a category: the cell in
+// the first of cols is the label and the cells in the other cols are its
+// aliases.
+func collectCategoryAliases(records [][]string, cols []int, weightCol int, hasHeader bool) []CategorySpec {
+	if len(cols) == 0 {
+		return nil
+	}
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	var specs []CategorySpec
+	for _, row := range records[start:] {
+		var spec CategorySpec
+		for _, col := range cols {
+			if col < 0 || col >= len(row) {
+				continue
+			}
+			v := strings.TrimSpace(row[col])
+			if v == "" {
+				continue
+			}
+			if spec.Label == "" {
+				spec.Label = v
+			} else {
+				spec.Aliases = append(spec.Aliases, v)
+			}
+		}
+		if spec.Label == "" {
+			continue
+		}
+		if weightCol >= 0 && weightCol < len(row) {
+			spec.Weight = parseSeedWeight(row[weightCol])
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
 func ensureDirs(p string) {
 	if p == "" {
 		return
@@ -70,11 +206,14 @@ func ensureSeedFile(path string, seeds []string) {
 	}
 }
 
-func loadCategorySeedFile(path string) ([]string, error) {
+func loadCategorySeedFile(path, enc string) ([]string, error) {
 	data, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
 		return nil, err
 	}
+	if data, err = decodeInput(data, enc); err != nil {
+		return nil, err
+	}
 	labels := parseCategoryText(string(data))
 	cats := uniqueNormalized(labels)
 	if len(cats) == 0 {
@@ -101,3 +240,233 @@ func parseCategoryText(s string) []string {
 	}
 	return res
 }
+
+// categoryHeaderNames は CSV のカテゴリ列の見出しとして認識する名前。
+var categoryHeaderNames = []string{"category", "categories", "label", "カテゴリ", "カテゴリー", "分類", "ラベル", "大分類", "小分類"}
+
+// weightHeaderNames は重み列の見出しとして認識する名前。
+var weightHeaderNames = []string{"weight", "重み"}
+
+// thresholdHeaderNames はカテゴリ別閾値列の見出しとして認識する名前。
+var thresholdHeaderNames = []string{"threshold", "min_score", "閾値", "しきい値"}
+
+// 見出しで列が決まらないときのカテゴリ列推定に使う値
+const (
+	categoryGuessSampleRows = 200 // 判定に使う先頭行数
+	categoryLabelMaxRunes   = 30  // 平均がこれより長い列は本文とみなす
+)
+
+// guessCategoryColumn picks the column that looks most like category labels
+// when no header matched: mostly filled, not numeric (ids), short cells,
+// and values that repeat across rows. It returns -1 when no column qualifies.
+func guessCategoryColumn(records [][]string, hasHeader bool) int {
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	end := len(records)
+	if end-start > categoryGuessSampleRows {
+		end = start + categoryGuessSampleRows
+	}
+	if end <= start {
+		return -1
+	}
+	cols := 0
+	for _, row := range records[start:end] {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	best, bestScore := -1, 0.0
+	for col := 0; col < cols; col++ {
+		filled, numeric, runes := 0, 0, 0
+		distinct := make(map[string]struct{})
+		for _, row := range records[start:end] {
+			if col >= len(row) {
+				continue
+			}
+			v := strings.TrimSpace(row[col])
+			if v == "" {
+				continue
+			}
+			filled++
+			runes += utf8.RuneCountInString(v)
+			distinct[v] = struct{}{}
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				numeric++
+			}
+		}
+		if filled == 0 || numeric*2 > filled {
+			continue
+		}
+		avgLen := float64(runes) / float64(filled)
+		if avgLen > categoryLabelMaxRunes {
+			continue
+		}
+		fill := float64(filled) / float64(end-start)
+		distinctRatio := float64(len(distinct)) / float64(filled)
+		score := fill * (1 - 0.5*distinctRatio) / (1 + avgLen/10)
+		if score > bestScore {
+			best, bestScore = col, score
+		}
+	}
+	return best
+}
+
+// collectCategoryColumns returns the non-empty cells of cols, column by
+// column in the given order, each with the weight read from weightCol on the
+// same row (weightCol < 0 leaves the weight unset). Duplicates are left to
+// UpdateCategories so the first occurrence (earliest column, then earliest
+// row) wins.
+func collectCategoryColumns(records [][]string, cols []int, weightCol int, hasHeader bool) []WeightedSeed {
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	var seeds []WeightedSeed
+	for _, col := range cols {
+		for i := start; i < len(records); i++ {
+			row := records[i]
+			if col < 0 || col >= len(row) {
+				continue
+			}
+			v := strings.TrimSpace(row[col])
+			if v == "" {
+				continue
+			}
+			seed := WeightedSeed{Label: v}
+			if weightCol >= 0 && weightCol < len(row) {
+				seed.Weight = parseSeedWeight(row[weightCol])
+			}
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds
+}
+
+// unweightedSeeds wraps plain labels as WeightedSeed with the default weight.
+func unweightedSeeds(labels []string) []WeightedSeed {
+	seeds := make([]WeightedSeed, len(labels))
+	for i, lab := range labels {
+		seeds[i] = WeightedSeed{Label: lab}
+	}
+	return seeds
+}
+
+// collectCategoryThresholds reads a per-category minimum score from
+// thresholdCol for the labels in labelCols of each row. Empty or
+// non-numeric cells are skipped so only the categories that need an
+// override get one.
+func collectCategoryThresholds(records [][]string, labelCols []int, thresholdCol int, hasHeader bool) map[string]float32 {
+	if len(labelCols) == 0 || thresholdCol < 0 {
+		return nil
+	}
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	out := make(map[string]float32)
+	for _, row := range records[start:] {
+		if thresholdCol >= len(row) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(row[thresholdCol]), 32)
+		if err != nil {
+			continue
+		}
+		for _, col := range labelCols {
+			if col < 0 || col >= len(row) {
+				continue
+			}
+			label := strings.TrimSpace(row[col])
+			if label == "" {
+				continue
+			}
+			if _, ok := out[label]; !ok {
+				out[label] = float32(v)
+			}
+		}
+	}
+	return clampCategoryThresholds(out)
+}
+
+// categoryRecordThresholds returns the thresholds of a category table read
+// through cols: every selected column holds categories, except with
+// aliases, where only the first one does. Files without a header have no
+// threshold column.
+func categoryRecordThresholds(records [][]string, cols []int, hasHeader, aliases bool) map[string]float32 {
+	if !hasHeader || len(cols) == 0 {
+		return nil
+	}
+	if aliases {
+		cols = cols[:1]
+	}
+	return collectCategoryThresholds(records, cols, detectHeaderColumn(records[0], thresholdHeaderNames), true)
+}
+
+// clampCategoryThresholds returns a copy of m with every value clamped to
+// [0, 1]. It returns nil for an empty map.
+func clampCategoryThresholds(m map[string]float32) map[string]float32 {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]float32, len(m))
+	for label, v := range m {
+		out[label] = float32(math.Max(0, math.Min(1, float64(v))))
+	}
+	return out
+}
+
+func sortedThresholdLabels(m map[string]float32) []string {
+	labels := make([]string, 0, len(m))
+	for label := range m {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// mergeCategoryThresholds returns base with the entries of add on top.
+func mergeCategoryThresholds(base, add map[string]float32) map[string]float32 {
+	out := make(map[string]float32, len(base)+len(add))
+	for label, v := range base {
+		out[label] = v
+	}
+	for label, v := range add {
+		out[label] = v
+	}
+	return out
+}
+
+// withFileThresholds adds the thresholds of a category file to cfg. Values
+// from the file win over CategoryThresholds already in cfg.
+func withFileThresholds(cfg Config, path string) (Config, error) {
+	thresholds, err := categoryThresholdsFromFile(path, categorySource(cfg))
+	if err != nil || len(thresholds) == 0 {
+		return cfg, err
+	}
+	cfg.CategoryThresholds = mergeCategoryThresholds(cfg.CategoryThresholds, thresholds)
+	return cfg, nil
+}
+
+// categoryThresholdsFromFile reads the threshold column of a CSV/TSV/xlsx
+// category file read as src. Other formats and files without such a column
+// yield nil.
+func categoryThresholdsFromFile(path string, src tableSource) (map[string]float32, error) {
+	if !isTableFile(strings.TrimSuffix(path, ".gz")) {
+		return nil, nil
+	}
+	records, err := readEvalRecords(path, src)
+	if err != nil {
+		return nil, err
+	}
+	thresholdCol := detectHeaderColumn(records[0], thresholdHeaderNames)
+	if thresholdCol < 0 {
+		return nil, nil
+	}
+	labelCol := detectHeaderColumn(records[0], categoryHeaderNames)
+	if labelCol < 0 {
+		labelCol = 0
+	}
+	return collectCategoryThresholds(records, []int{labelCol}, thresholdCol, true), nil
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestCategoryRecordThresholds(t *testing.T) {
+	records := [][]string{
+		{"category", "category2", "threshold"},
+		{"果物", "野菜", "0.7"},
+		{"家電", "", "1.5"},
+		{"旅行", "料理", ""},
+	}
+	tests := []struct {
+		name      string
+		cols      []int
+		hasHeader bool
+		aliases   bool
+		want      map[string]float32
+	}{
+		{"every selected column", []int{0, 1}, true, false, map[string]float32{"果物": 0.7, "野菜": 0.7, "家電": 1}},
+		{"aliases use the first column", []int{0, 1}, true, true, map[string]float32{"果物": 0.7, "家電": 1}},
+		{"no header", []int{0}, false, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := categoryRecordThresholds(records, tt.cols, tt.hasHeader, tt.aliases)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("thresholds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryThresholdsFilterSuggestions(t *testing.T) {
+	records := [][]string{
+		{"category", "threshold"},
+		{"果物", "0.99"},
+		{"野菜", "0"},
+	}
+	svc := newTestService(t, func(c *Config) {
+		c.Mode = ModeSeeded
+		c.MinScore = 0.9
+		c.CategoryThresholds = categoryRecordThresholds(records, []int{0}, true, false)
+	})
+	rows, err := svc.ClassifyAll(context.Background(), []string{"りんごとみかんの果物セット"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, s := range rows[0].Suggestions {
+		labels = append(labels, s.Label)
+	}
+	// 果物は閾値 0.99 に届かず落ち、野菜は閾値 0 なので全体の MinScore 0.9 未満でも残る
+	if want := []string{"野菜"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %q, want %q", labels, want)
+	}
+}
+
+func TestCategoryFileEncoding(t *testing.T) {
+	const content = "カテゴリ,別名\n果物,フルーツ\n野菜,ベジタブル\n"
+	wantLabels := []string{"果物", "野菜"}
+	wantAliases := []CategorySpec{{Label: "果物", Aliases: []string{"フルーツ"}}, {Label: "野菜", Aliases: []string{"ベジタブル"}}}
+	dir := t.TempDir()
+	write := func(name string, enc encoding.Encoding) string {
+		data, err := enc.NewEncoder().String(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	sjis := write("sjis.csv", japanese.ShiftJIS)
+	eucjp := write("eucjp.csv", japanese.EUCJP)
+	tests := []struct {
+		name     string
+		path     string
+		input    string // Config.InputEncoding
+		category string // Config.CategoryEncoding
+		want     bool   // ラベルが正しく読めるか
+	}{
+		{"shift_jis auto", sjis, EncodingAuto, "", true},
+		{"shift_jis forced", sjis, EncodingUTF8, EncodingShiftJIS, true},
+		{"euc-jp follows InputEncoding", eucjp, EncodingEUCJP, "", true},
+		{"euc-jp forced", eucjp, EncodingAuto, EncodingEUCJP, true},
+		// auto では Shift_JIS とみなすので EUC-JP は化ける
+		{"euc-jp auto", eucjp, EncodingAuto, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.InputEncoding = tt.input
+			cfg.CategoryEncoding = tt.category
+			src := categorySource(cfg)
+			specs, err := loadEvalCategories(tt.path, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := specLabels(specs); reflect.DeepEqual(got, wantLabels) != tt.want {
+				t.Errorf("categories = %q, want match = %v", got, tt.want)
+			}
+			aliases, err := ParseSeedAliases(tt.path, src.encoding, src.sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.DeepEqual(aliases, wantAliases) != tt.want {
+				t.Errorf("aliases = %+v, want match = %v", aliases, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuessCategoryColumn(t *testing.T) {
+	long := strings.Repeat("北海道の温泉宿を巡る三泊四日の旅の記録と費用のまとめ", 2)
+	tests := []struct {
+		name      string
+		records   [][]string
+		hasHeader bool
+		want      int
+	}{
+		{"id then category", [][]string{{"1", "果物"}, {"2", "野菜"}, {"3", "果物"}, {"4", "家電"}}, false, 1},
+		{"unknown header", [][]string{{"no", "種別"}, {"101", "果物"}, {"102", "野菜"}, {"103", "果物"}}, true, 1},
+		// 長い本文の列は選ばない
+		{"text then category", [][]string{{long, "旅行"}, {long + "2", "旅行"}, {long + "3", "料理"}}, false, 1},
+		// 繰り返しの多い短い列を選ぶ
+		{"repeated labels win", [][]string{{"1", "りんご", "果物"}, {"2", "トマト", "野菜"}, {"3", "みかん", "果物"}, {"4", "キャベツ", "野菜"}}, false, 2},
+		{"mostly empty column", [][]string{{"1", "", "果物"}, {"2", "野菜", "野菜"}, {"3", "", "家電"}}, false, 2},
+		{"numbers only", [][]string{{"1", "0.5"}, {"2", "0.7"}}, false, -1},
+		{"header only", [][]string{{"id", "name"}}, true, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guessCategoryColumn(tt.records, tt.hasHeader); got != tt.want {
+				t.Errorf("guessCategoryColumn = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCategoryColumn(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   [][]string
+		col       int
+		weightCol int
+		hasHeader bool
+	}{
+		{"category header", [][]string{{"id", "weight", "category"}, {"1", "2", "果物"}}, 2, 1, true},
+		// 見出しが一致しなければ列 0 (id) ではなく推定した列
+		{"id and categories without header", [][]string{{"1", "果物"}, {"2", "野菜"}, {"3", "果物"}}, 1, -1, false},
+		{"nothing label-like", [][]string{{"1"}, {"2"}}, 0, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			col, weightCol, hasHeader := resolveCategoryColumn(tt.records)
+			if col != tt.col || weightCol != tt.weightCol || hasHeader != tt.hasHeader {
+				t.Errorf("got %d, %d, %v, want %d, %d, %v", col, weightCol, hasHeader, tt.col, tt.weightCol, tt.hasHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// カテゴリを「弱い」とみなす基準。例文が少なく、まとまりも悪いものに印を付ける。
+const (
+	weakCategoryMaxExamples = 2
+	weakCategoryCohesion    = 0.6
+)
+
+// CategoryStat describes how well a user category's centroid is supported
+// by its examples.
+type CategoryStat struct {
+	Label    string
+	Examples int // セントロイドに混ぜた例文・説明の数 (ラベル自身を除く)
+	// Cohesion はラベルと例文のベクトル同士の平均類似度。例文が無ければ 1。
+	Cohesion float32
+	// Weak は例文が weakCategoryMaxExamples 件以下で Cohesion も
+	// weakCategoryCohesion 未満のカテゴリ。例文を足す候補になる。
+	Weak bool
+}
+
+// CategoryQuality reports the example count and cohesion of every user
+// category, weakest first. It reuses the vectors kept when the categories
+// were embedded, so nothing is re-embedded. Categories restored from an
+// index or state file report no examples.
+func (s *Service) CategoryQuality() []CategoryStat {
+	s.mu.RLock()
+	cfg := s.cfg
+	cands := append([]Candidate(nil), s.candsCat...)
+	members := s.catMembers
+	s.mu.RUnlock()
+
+	sim := metricFunc(cfg.Metric)
+	stats := make([]CategoryStat, 0, len(cands))
+	for _, c := range cands {
+		vecs := members[c.Label]
+		st := CategoryStat{Label: c.Label, Cohesion: 1}
+		if len(vecs) > 1 {
+			st.Examples = len(vecs) - 1
+			st.Cohesion = meanPairwiseSimilarity(sim, vecs)
+		}
+		st.Weak = st.Examples > 0 && st.Examples <= weakCategoryMaxExamples && st.Cohesion < weakCategoryCohesion
+		stats = append(stats, st)
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].Weak != stats[j].Weak {
+			return stats[i].Weak
+		}
+		return stats[i].Cohesion < stats[j].Cohesion
+	})
+	return stats
+}
+
+// meanPairwiseSimilarity averages sim over every pair in vecs.
+func meanPairwiseSimilarity(sim similarityFunc, vecs [][]float32) float32 {
+	var sum float32
+	pairs := 0
+	for i := range vecs {
+		for j := i + 1; j < len(vecs); j++ {
+			sum += sim(vecs[i], vecNorm(vecs[i]), vecs[j], vecNorm(vecs[j]))
+			pairs++
+		}
+	}
+	if pairs == 0 {
+		return 1
+	}
+	return sum / float32(pairs)
+}
+
+// formatCategoryQuality renders stats as aligned "label  examples  cohesion"
+// lines with weak categories marked, for the GUI dialog and the CLI.
+func formatCategoryQuality(stats []CategoryStat) string {
+	weak := 0
+	width := 0
+	for _, st := range stats {
+		if st.Weak {
+			weak++
+		}
+		if w := len([]rune(st.Label)); w > width {
+			width = w
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "例文を足したいカテゴリ %d / %d (例文 %d件以下・まとまり %.2f 未満)\n", weak, len(stats), weakCategoryMaxExamples, weakCategoryCohesion)
+	for _, st := range stats {
+		mark := "  "
+		if st.Weak {
+			mark = "! "
+		}
+		fmt.Fprintf(&b, "%s%s%s  例文 %3d  まとまり %.3f\n", mark, st.Label, strings.Repeat(" ", width-len([]rune(st.Label))), st.Examples, st.Cohesion)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCategoryQuality(t *testing.T) {
+	svc := newTestService(t, nil)
+	specs := []CategorySpec{
+		{Label: "果物"},
+		{Label: "果物ジュース", Examples: []string{"果物ジュースの詰め合わせ", "果物ジュース"}},
+		{Label: "雑多", Examples: []string{"量子力学", "ワールドカップ"}},
+	}
+	if _, err := svc.updateCategories(context.Background(), specs); err != nil {
+		t.Fatalf("updateCategories: %v", err)
+	}
+	got := make(map[string]CategoryStat)
+	for _, st := range svc.CategoryQuality() {
+		got[st.Label] = st
+	}
+	tests := []struct {
+		label    string
+		examples int
+		weak     bool
+	}{
+		{"果物", 0, false},
+		{"果物ジュース", 2, false},
+		{"雑多", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			st, ok := got[tt.label]
+			if !ok {
+				t.Fatalf("%s がありません: %+v", tt.label, got)
+			}
+			if st.Examples != tt.examples || st.Weak != tt.weak {
+				t.Errorf("%+v, want Examples=%d Weak=%v", st, tt.examples, tt.weak)
+			}
+		})
+	}
+	if got["果物ジュース"].Cohesion <= got["雑多"].Cohesion {
+		t.Errorf("cohesion of related examples %.3f should exceed unrelated %.3f", got["果物ジュース"].Cohesion, got["雑多"].Cohesion)
+	}
+}
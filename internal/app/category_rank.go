@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// perCategoryExportLimit はカテゴリ別一覧のエクスポートで各カテゴリに載せる件数。
+const perCategoryExportLimit = 20
+
+// CategoryInputs lists the inputs most similar to one category.
+type CategoryInputs struct {
+	Label  string
+	Inputs []RankedInput
+}
+
+// RankedInput is one input under a category, with its position in the
+// original input list.
+type RankedInput struct {
+	Index int
+	Text  string
+	Score float32
+}
+
+// RankInputsPerCategory classifies texts and returns, for every user
+// category, its k highest scoring inputs. An input can appear under several
+// categories.
+func (s *Service) RankInputsPerCategory(ctx context.Context, texts []string, k int) ([]CategoryInputs, error) {
+	rows, err := s.ClassifyAll(ctx, texts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return rankInputsFromRows(rows, s.categoryLabels(), k), nil
+}
+
+// rankInputsFromRows builds per-category lists from the FinalScores that
+// RankOne already computed for every category, so no extra scoring is done.
+func rankInputsFromRows(rows []ResultRow, labels []string, k int) []CategoryInputs {
+	out := make([]CategoryInputs, 0, len(labels))
+	for _, label := range labels {
+		ranked := make([]RankedInput, 0, len(rows))
+		for i, r := range rows {
+			if sc, ok := r.FinalScores[label]; ok {
+				ranked = append(ranked, RankedInput{Index: i, Text: r.Text, Score: sc})
+			}
+		}
+		sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].Score > ranked[b].Score })
+		if k > 0 && len(ranked) > k {
+			ranked = ranked[:k]
+		}
+		out = append(out, CategoryInputs{Label: label, Inputs: ranked})
+	}
+	return out
+}
+
+// writeCategoryInputsCSV writes one line per (category, rank) pair.
+func writeCategoryInputsCSV(w io.Writer, delim rune, lists []CategoryInputs) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delim
+	if err := cw.Write([]string{"category", "rank", "score", "row", "text"}); err != nil {
+		return err
+	}
+	for _, list := range lists {
+		for rank, in := range list.Inputs {
+			record := []string{
+				list.Label,
+				fmt.Sprintf("%d", rank+1),
+				fmt.Sprintf("%.3f", in.Score),
+				fmt.Sprintf("%d", in.Index+1),
+				in.Text,
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// categoryLabels returns the current user category labels in order.
+func (s *Service) categoryLabels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	labels := make([]string, len(s.candsCat))
+	for i, c := range s.candsCat {
+		labels[i] = c.Label
+	}
+	return labels
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRankInputsFromRows(t *testing.T) {
+	rows := []ResultRow{
+		{Text: "りんごと野菜のジュース", FinalScores: map[string]float32{"果物": 0.8, "野菜": 0.7}},
+		{Text: "トマトの栽培", FinalScores: map[string]float32{"果物": 0.3, "野菜": 0.9}},
+		{Text: "みかん狩り", FinalScores: map[string]float32{"果物": 0.9, "野菜": 0.1}},
+	}
+	labels := []string{"果物", "野菜", "家電"}
+	tests := []struct {
+		name string
+		k    int
+		want []CategoryInputs
+	}{
+		{"top 2", 2, []CategoryInputs{
+			{"果物", []RankedInput{{2, "みかん狩り", 0.9}, {0, "りんごと野菜のジュース", 0.8}}},
+			// 同じ入力が複数のカテゴリに載る
+			{"野菜", []RankedInput{{1, "トマトの栽培", 0.9}, {0, "りんごと野菜のジュース", 0.7}}},
+			{"家電", []RankedInput{}},
+		}},
+		{"all", 0, []CategoryInputs{
+			{"果物", []RankedInput{{2, "みかん狩り", 0.9}, {0, "りんごと野菜のジュース", 0.8}, {1, "トマトの栽培", 0.3}}},
+			{"野菜", []RankedInput{{1, "トマトの栽培", 0.9}, {0, "りんごと野菜のジュース", 0.7}, {2, "みかん狩り", 0.1}}},
+			{"家電", []RankedInput{}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankInputsFromRows(rows, labels, tt.k); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := writeCategoryInputsCSV(&buf, ',', rankInputsFromRows(rows, labels[:1], 1)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "category,rank,score,row,text\n果物,1,0.900,3,みかん狩り\n"; buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRankInputsPerCategory(t *testing.T) {
+	svc := newTestService(t, nil)
+	texts := []string{"りんごとみかんの果物セット", "新鮮な野菜サラダ", "冷蔵庫と洗濯機の家電セール"}
+	k := len(texts)
+	lists, err := svc.RankInputsPerCategory(context.Background(), texts, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(lists), len(svc.categoryLabels()); got != want {
+		t.Fatalf("got %d categories, want %d", got, want)
+	}
+	// k を入力数にすると、どの入力もすべてのカテゴリに載る
+	appearances := make(map[int]int)
+	for _, list := range lists {
+		if len(list.Inputs) != k {
+			t.Errorf("%s: %d inputs, want %d", list.Label, len(list.Inputs), k)
+		}
+		for i, in := range list.Inputs {
+			appearances[in.Index]++
+			if i > 0 && in.Score > list.Inputs[i-1].Score {
+				t.Errorf("%s: not sorted by score", list.Label)
+			}
+		}
+	}
+	for i := range texts {
+		if appearances[i] != len(lists) {
+			t.Errorf("input %d appears under %d categories, want %d", i, appearances[i], len(lists))
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CategorySpec is one category with optional material for its vector.
+// Description and Examples are embedded alongside the label and averaged
+// into a single centroid. Aliases are other names for the same category:
+// each gets its own embedding and a match on any of them counts as the
+// label.
+type CategorySpec struct {
+	Label       string
+	Description string
+	Examples    []string
+	Aliases     []string
+	Weight      float32 // 0 で 1.0
+}
+
+// labelSpecs wraps plain labels as CategorySpec values.
+func labelSpecs(labels []string) []CategorySpec {
+	specs := make([]CategorySpec, len(labels))
+	for i, lab := range labels {
+		specs[i] = CategorySpec{Label: lab}
+	}
+	return specs
+}
+
+// extraTexts returns the texts besides the label that shape the centroid.
+func (c CategorySpec) extraTexts() []string {
+	var out []string
+	if strings.TrimSpace(c.Description) != "" {
+		out = append(out, c.Description)
+	}
+	out = append(out, c.Examples...)
+	return out
+}
+
+// LoadCategorySpecs replaces the user categories like LoadSeedsWeighted.
+// Categories with a description or examples get the normalized mean of
+// those embeddings and the label's own embedding; aliases are matched
+// separately (see applyCategoryAliases).
+func (s *Service) LoadCategorySpecs(ctx context.Context, specs []CategorySpec) (int, error) {
+	return s.updateCategories(ctx, specs)
+}
+
+// applyCategoryAliases embeds each alias (keyed like Candidate.Key) and
+// attaches it to its candidate, so cosineCandidate scores the candidate by
+// its best-matching name. Aliases that normalize to the label are skipped.
+func (s *Service) applyCategoryAliases(ctx context.Context, cands []Candidate, aliases map[string][]string) error {
+	var texts, names []string
+	var owner []int
+	for i, c := range cands {
+		seen := map[string]struct{}{c.Key: {}}
+		for _, al := range aliases[c.Key] {
+			name := normalize(al)
+			key := normalizeKey(name)
+			if _, dup := seen[key]; dup || key == "" {
+				continue
+			}
+			seen[key] = struct{}{}
+			if text := s.embedText(name); text != "" {
+				texts = append(texts, text)
+				names = append(names, name)
+				owner = append(owner, i)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	embedded, err := s.EmbedBatchCached(ctx, texts)
+	if err != nil {
+		return err
+	}
+	for j, v := range embedded {
+		i := owner[j]
+		vec := append([]float32(nil), v...)
+		cands[i].Aliases = append(cands[i].Aliases, AliasVec{Text: names[j], Vec: vec, Norm: vecNorm(vec)})
+	}
+	return nil
+}
+
+// applyCategoryCentroids folds the embeddings of extra texts (keyed like
+// Candidate.Key) into the matching candidates and vecs. It returns the
+// vectors each centroid was built from (label first), keyed by label.
+func (s *Service) applyCategoryCentroids(ctx context.Context, cands []Candidate, vecs map[string][]float32, extras map[string][]string) (map[string][][]float32, error) {
+	var texts []string
+	var owner []int
+	for i, c := range cands {
+		for _, t := range extras[c.Key] {
+			if text := s.embedText(t); text != "" {
+				texts = append(texts, text)
+				owner = append(owner, i)
+			}
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	embedded, err := s.EmbedBatchCached(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[int][]float32)
+	members := make(map[string][][]float32)
+	for j, v := range embedded {
+		i := owner[j]
+		sum, ok := sums[i]
+		if !ok {
+			sum = append([]float32(nil), cands[i].Vec...)
+			sums[i] = sum
+			members[cands[i].Label] = [][]float32{cands[i].Vec}
+		}
+		members[cands[i].Label] = append(members[cands[i].Label], v)
+		for k := range sum {
+			if k < len(v) {
+				sum[k] += v[k]
+			}
+		}
+	}
+	for i, sum := range sums {
+		if n := vecNorm(sum); n > 0 {
+			for k := range sum {
+				sum[k] /= n
+			}
+		}
+		cands[i].Vec = sum
+		cands[i].Norm = vecNorm(sum)
+		vecs[cands[i].Label] = sum
+	}
+	return members, nil
+}
+
+// parseCategoryYAML reads a category file of the form
+//
+//	categories:
+//	  - label: VR空間
+//	    description: 仮想空間での体験や制作
+//	    aliases: [仮想空間, メタバース]
+//	    examples:
+//	      - VRChat でイベントを開いた
+//	    weight: 1.2
+//	  - 教育
+//
+// The top-level "categories:" key may be omitted. A plain string item is a
+// label with no extras.
+func parseCategoryYAML(data []byte) ([]CategorySpec, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("カテゴリ YAML の解析に失敗しました: %w", err)
+	}
+	return categorySpecsFromNode(&doc)
+}
+
+func categorySpecsFromNode(root *yaml.Node) ([]CategorySpec, error) {
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil, errors.New("カテゴリ YAML が空です")
+		}
+		root = root.Content[0]
+	}
+	list := root
+	if root.Kind == yaml.MappingNode {
+		list = nil
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "categories" {
+				list = root.Content[i+1]
+				break
+			}
+		}
+		if list == nil {
+			return nil, yamlNodeError(root, "categories: がありません")
+		}
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, yamlNodeError(list, "カテゴリはリストで指定してください")
+	}
+
+	specs := make([]CategorySpec, 0, len(list.Content))
+	for _, item := range list.Content {
+		var spec CategorySpec
+		switch item.Kind {
+		case yaml.ScalarNode:
+			spec.Label = strings.TrimSpace(item.Value)
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				key, val := item.Content[i], item.Content[i+1]
+				var err error
+				switch key.Value {
+				case "label":
+					spec.Label, err = yamlScalar(val)
+					spec.Label = strings.TrimSpace(spec.Label)
+				case "description":
+					spec.Description, err = yamlScalar(val)
+				case "examples":
+					spec.Examples, err = yamlStrings(val)
+				case "aliases":
+					spec.Aliases, err = yamlStrings(val)
+				case "weight":
+					var s string
+					if s, err = yamlScalar(val); err == nil {
+						w, perr := strconv.ParseFloat(strings.TrimSpace(s), 32)
+						if perr != nil || w <= 0 {
+							err = yamlNodeError(val, "weight は正の数で指定してください: %q", s)
+						}
+						spec.Weight = float32(w)
+					}
+				default:
+					err = yamlNodeError(key, "不明な項目 %q (label / description / examples / aliases / weight)", key.Value)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, yamlNodeError(item, "カテゴリは文字列か label を持つ項目で指定してください")
+		}
+		if spec.Label == "" {
+			return nil, yamlNodeError(item, "label がありません")
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, yamlNodeError(list, "カテゴリがありません")
+	}
+	return specs, nil
+}
+
+func yamlScalar(n *yaml.Node) (string, error) {
+	if n.Kind != yaml.ScalarNode {
+		return "", yamlNodeError(n, "文字列で指定してください")
+	}
+	return n.Value, nil
+}
+
+// yamlStrings accepts either a single string or a list of strings.
+func yamlStrings(n *yaml.Node) ([]string, error) {
+	if n.Kind == yaml.ScalarNode {
+		if v := strings.TrimSpace(n.Value); v != "" {
+			return []string{v}, nil
+		}
+		return nil, nil
+	}
+	if n.Kind != yaml.SequenceNode {
+		return nil, yamlNodeError(n, "文字列のリストで指定してください")
+	}
+	out := make([]string, 0, len(n.Content))
+	for _, c := range n.Content {
+		v, err := yamlScalar(c)
+		if err != nil {
+			return nil, err
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func yamlNodeError(n *yaml.Node, format string, args ...any) error {
+	return fmt.Errorf("カテゴリ YAML %d 行目: %s", n.Line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,588 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reviewMarker は自動確定しなかった行の status 列に書く値。
+const reviewMarker = "review"
+
+// ClassifyFileOptions configures ClassifyFile.
+type ClassifyFileOptions struct {
+	InputPath    string // 本文列を持つ CSV/TSV (.gz 可)
+	OutputPath   string // 結果 CSV。空なら入力と同じ場所に Config.OutputTemplate の名前 (既定 result_<日付><時刻>.csv)
+	TextColumn   string // 見出し名または1始まりの列番号。空なら見出しから推定 (無ければ1列目)
+	CategoryPath string // カテゴリファイル (.txt/.csv/.tsv/.yaml)。空なら Config.SeedFile
+	Mode         string // 空なら既定のランキングモード
+
+	// InputProfile と CategoryProfile は保存済みの列プロファイル名。
+	// 指定すると TextColumn や列の推定の代わりにプロファイルの列を使う。
+	InputProfile    string
+	CategoryProfile string
+
+	// MinScore と AutoAcceptMargin のどちらかが正なら、1位スコアが MinScore
+	// 未満、または1位と2位の差が AutoAcceptMargin 未満の行を要確認にする。
+	// どちらも 0 なら設定の要確認判定 (ResultRow.NeedReview) に従う。
+	MinScore         float32
+	AutoAcceptMargin float32
+
+	// Dedupe を有効にすると同じ内容の入力を1行にまとめ、count 列にまとめた件数を書く。
+	// DedupeThreshold が正なら埋め込みの類似度がそれ以上の入力もまとめる。
+	Dedupe          bool
+	DedupeThreshold float32
+
+	// DumpVectors を指定すると入力の埋め込みを入力と同じ順で書き出す (.npy または CSV/TSV)。
+	// DumpIndexVectors を指定するとカテゴリ・NDC のベクトルを CSV/TSV で書き出す。
+	DumpVectors      string
+	DumpIndexVectors string
+
+	// Coverage を有効にするとカテゴリごとに候補に出た行数 (0 件を含む) を表示する。
+	Coverage bool
+	// Quality を有効にすると分類の前にカテゴリごとの例文数とまとまりを表示する。
+	Quality bool
+
+	// Inspect を有効にすると分類せず、入力・カテゴリファイルの列の解決結果と
+	// 先頭の数件を表示する (モデルは読み込まない)。
+	Inspect bool
+
+	// OutputColumns は "index,text,category=カテゴリ" 形式の出力列指定。
+	// 指定すると設定ファイルの OutputColumns / OutputHeaders より優先する。
+	OutputColumns string
+	// OutputDelimiter は結果ファイルの区切り文字 ("," / "tab" / ";")。
+	// 指定すると設定ファイルの OutputDelimiter より優先する。
+	OutputDelimiter string
+
+	// ExportState を指定すると、読み込んだ設定・カテゴリ・NDC を埋め込み済みの
+	// ベクトルごと書き出す (不具合の再現用)。InputPath が空なら分類はしない。
+	// ImportState を指定すると、その状態ファイルの設定・カテゴリ・NDC を
+	// 埋め込み直さずに使う (CategoryPath とは併用できない)。
+	ExportState string
+	ImportState string
+
+	ConfigPath         string // 設定ファイル (JSON)。空なら既定値
+	ConfigOverridePath string // ConfigPath の上に重ねる設定ファイル。書いた項目だけを上書きする
+	StrictConfig       bool   // 設定ファイルの不明な項目・不正な値をエラーにする
+}
+
+// ClassifyFile classifies every row of a CSV/TSV file without the GUI and
+// writes one line per row with the accepted category, or an empty category
+// and the "review" marker when the row is not confident enough. A count of
+// auto-accepted and flagged rows is written to w. With only ExportState
+// set it writes the state file and classifies nothing.
+func ClassifyFile(opts ClassifyFileOptions, w io.Writer) error {
+	if opts.Inspect {
+		return inspectFiles(opts, []string{opts.InputPath}, w)
+	}
+	cfg, err := fileClassifierConfig(opts)
+	if err != nil {
+		return err
+	}
+	svc, cfg, err := openFileClassifier(opts, cfg)
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+	if err := exportStateFile(svc, opts.ExportState, w); err != nil {
+		return err
+	}
+	if opts.InputPath == "" {
+		return nil
+	}
+	if opts.Quality {
+		fmt.Fprintln(w, formatCategoryQuality(svc.CategoryQuality()))
+	}
+	out := opts.OutputPath
+	if out == "" {
+		out = resultFileName(cfg, time.Now(), filepath.Dir(opts.InputPath), opts.InputPath)
+	}
+	if _, err = classifyOneFile(svc, cfg, opts, opts.InputPath, out, w); err != nil {
+		return err
+	}
+	return dumpIndexVectors(svc, opts.DumpIndexVectors, w)
+}
+
+func dumpIndexVectors(svc *Service, path string, w io.Writer) error {
+	if path == "" {
+		return nil
+	}
+	if err := svc.ExportIndexVectors(path); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "カテゴリのベクトルを %s に出力しました\n", path)
+	return nil
+}
+
+// ClassifyDir classifies every CSV/TSV file (optionally .gz) directly in dir
+// and writes a result named by resultFileNames for each into outDir (dir
+// when empty). The
+// model and categories are loaded once for all files. A failing file is
+// reported and skipped; the returned error counts the failures.
+func ClassifyDir(opts ClassifyFileOptions, dir, outDir string, w io.Writer) error {
+	if outDir == "" {
+		outDir = dir
+	}
+	if opts.DumpVectors != "" {
+		return errors.New("-dump-vectors は -input と組み合わせて使ってください")
+	}
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	var inputs []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(name, ".gz")))
+		if e.IsDir() || (ext != ".csv" && ext != ".tsv") || strings.HasPrefix(name, "result_") {
+			continue
+		}
+		inputs = append(inputs, filepath.Join(dir, name))
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("%s に CSV/TSV ファイルがありません", dir)
+	}
+	if opts.Inspect {
+		return inspectFiles(opts, inputs, w)
+	}
+	cfg, err := fileClassifierConfig(opts)
+	if err != nil {
+		return err
+	}
+	outs := resultFileNames(cfg, time.Now(), outDir, inputs)
+	if err := os.MkdirAll(filepath.Clean(outDir), 0o755); err != nil {
+		return err
+	}
+
+	svc, cfg, err := openFileClassifier(opts, cfg)
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+	if err := exportStateFile(svc, opts.ExportState, w); err != nil {
+		return err
+	}
+	if opts.Quality {
+		fmt.Fprintln(w, formatCategoryQuality(svc.CategoryQuality()))
+	}
+
+	failed := 0
+	for i, in := range inputs {
+		start := time.Now()
+		out := outs[i]
+		n, err := classifyOneFile(svc, cfg, opts, in, out, io.Discard)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "%s: 失敗しました: %v\n", filepath.Base(in), err)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d行 %s -> %s\n", filepath.Base(in), n, time.Since(start).Round(time.Millisecond), out)
+	}
+	fmt.Fprintf(w, "%dファイル中 %dファイルを処理しました\n", len(inputs), len(inputs)-failed)
+	if err := dumpIndexVectors(svc, opts.DumpIndexVectors, w); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%dファイルの分類に失敗しました", failed)
+	}
+	return nil
+}
+
+// resultFileName returns the default output of input in dir. It is named by
+// Config.OutputTemplate like the GUI export (result_<date><time>.csv by
+// default, .tsv for tabs) and gets a _2, _3, … suffix when the file exists.
+func resultFileName(cfg Config, now time.Time, dir, input string) string {
+	return uniqueFileName(filepath.Join(dir, defaultResultFileName(cfg, now, input, parseOutputDelimiter(cfg.OutputDelimiter))), nil)
+}
+
+// resultFileNames returns the output of each input of a batch in dir. A
+// template without {input} gets "_{input}" appended so every result can be
+// traced to its input. Names that would still collide with each other (a.csv
+// and a.tsv) or with existing files get a _2, _3, … suffix.
+func resultFileNames(cfg Config, now time.Time, dir string, inputs []string) []string {
+	if !strings.Contains(cfg.OutputTemplate, "{input}") {
+		cfg.OutputTemplate += "_{input}"
+	}
+	delim := parseOutputDelimiter(cfg.OutputDelimiter)
+	outs := make([]string, len(inputs))
+	taken := make(map[string]bool, len(inputs))
+	for i, in := range inputs {
+		outs[i] = uniqueFileName(filepath.Join(dir, defaultResultFileName(cfg, now, in, delim)), taken)
+		taken[outs[i]] = true
+	}
+	return outs
+}
+
+// fileClassifierConfig loads the config files and applies the command-line
+// overrides and column profiles of opts.
+func fileClassifierConfig(opts ClassifyFileOptions) (Config, error) {
+	cfg, err := LoadConfigFiles(opts.StrictConfig, opts.ConfigPath, opts.ConfigOverridePath)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg, err = withClassifyFlags(cfg, opts); err != nil {
+		return cfg, err
+	}
+	cfg = withColumnProfiles(cfg)
+	if opts.InputProfile != "" {
+		if _, ok := cfg.InputProfiles[opts.InputProfile]; !ok {
+			return cfg, fmt.Errorf("入力列プロファイル %q がありません", opts.InputProfile)
+		}
+	}
+	if opts.CategoryProfile != "" && opts.CategoryPath == "" {
+		return cfg, errors.New("-category-profile にはカテゴリファイルの指定が必要です")
+	}
+	if opts.ImportState != "" && opts.CategoryPath != "" {
+		return cfg, errors.New("-import-state と -categories は同時に使えません")
+	}
+	return cfg, nil
+}
+
+// withClassifyFlags applies the -mode, -columns and -output-delimiter
+// overrides of opts to cfg.
+func withClassifyFlags(cfg Config, opts ClassifyFileOptions) (Config, error) {
+	if opts.Mode != "" {
+		cfg.Mode = opts.Mode
+	}
+	if opts.OutputColumns != "" {
+		cols, headers, err := parseOutputColumnSpec(opts.OutputColumns)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.OutputColumns, cfg.OutputHeaders = cols, headers
+	}
+	if opts.OutputDelimiter != "" {
+		d := canonicalOutputDelimiter(opts.OutputDelimiter)
+		if d != "," && d != "\t" && d != ";" {
+			return cfg, fmt.Errorf("-output-delimiter: %q は使えません (, / tab / ;)", opts.OutputDelimiter)
+		}
+		cfg.OutputDelimiter = d
+	}
+	return cfg, nil
+}
+
+// openFileClassifier loads the model and the categories shared by
+// ClassifyFile and ClassifyDir on top of cfg from fileClassifierConfig, or
+// restores them from opts.ImportState.
+func openFileClassifier(opts ClassifyFileOptions, cfg Config) (*Service, Config, error) {
+	var err error
+	ensureDirs(cfg.CacheDir)
+	ensureCategoryRuleFile(cfg.CategoryRuleFile, rawCategoryRules)
+
+	var specs []CategorySpec
+	if opts.CategoryPath != "" {
+		if opts.CategoryProfile != "" {
+			p, ok := cfg.CategoryProfiles[opts.CategoryProfile]
+			if !ok {
+				return nil, cfg, fmt.Errorf("カテゴリ列プロファイル %q がありません", opts.CategoryProfile)
+			}
+			specs, err = loadProfileCategories(opts.CategoryPath, p, categorySource(cfg))
+		} else {
+			specs, err = loadEvalCategories(opts.CategoryPath, categorySource(cfg))
+		}
+		if err != nil {
+			return nil, cfg, err
+		}
+		if cfg, err = withFileThresholds(cfg, opts.CategoryPath); err != nil {
+			return nil, cfg, err
+		}
+	}
+
+	svc, err := NewService(cfg)
+	if err != nil {
+		return nil, cfg, err
+	}
+	if opts.ImportState != "" {
+		if err := importStateFile(svc, opts.ImportState); err != nil {
+			svc.Close()
+			return nil, cfg, err
+		}
+		// 状態ファイルの設定にコマンドラインの指定を重ね直す
+		cfg, _ = withClassifyFlags(svc.Config(), opts)
+		return svc, svc.UpdateConfig(cfg), nil
+	}
+	if specs != nil {
+		if _, err := svc.LoadCategorySpecs(context.Background(), specs); err != nil {
+			svc.Close()
+			return nil, cfg, err
+		}
+	}
+	return svc, cfg, nil
+}
+
+// classifyOneFile classifies the rows of input with an already loaded
+// service and writes the result to out. It returns the number of rows read.
+// CSV/TSV input is streamed record by record unless -dedupe or
+// -dump-vectors need every row up front.
+func classifyOneFile(svc *Service, cfg Config, opts ClassifyFileOptions, input, out string, w io.Writer) (int, error) {
+	if !opts.Dedupe && opts.DumpVectors == "" && isStreamableInput(input) {
+		return classifyStreamFile(svc, cfg, opts, input, out, w)
+	}
+	records, err := readEvalRecords(input, inputSource(cfg))
+	if err != nil {
+		return 0, err
+	}
+	textCols, hasHeader, err := resolveInputColumns(records[0], opts.TextColumn, opts.InputProfile, cfg)
+	if err != nil {
+		return 0, err
+	}
+	texts := extractCSVColumns(records, textCols, hasHeader, cfg.KeepEmptyRows)
+	if len(texts) == 0 {
+		return 0, errors.New("分類する行がありません")
+	}
+	total := len(texts)
+
+	ctx := context.Background()
+	if opts.DumpVectors != "" {
+		if err := svc.EmbedAndExport(ctx, texts, opts.DumpVectors); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(w, "入力のベクトル %d件を %s に出力しました\n", len(texts), opts.DumpVectors)
+	}
+	var counts []int
+	if opts.Dedupe {
+		keep, owner, err := svc.DedupeInputs(ctx, texts, opts.DedupeThreshold)
+		if err != nil {
+			return 0, err
+		}
+		counts = dedupeCounts(owner, len(keep))
+		if merged := len(texts) - len(keep); merged > 0 {
+			fmt.Fprintf(w, "重複した入力 %d件をまとめました\n", merged)
+		}
+		texts = selectStrings(texts, keep)
+	}
+
+	rows, err := svc.ClassifyAll(ctx, texts, nil)
+	if err != nil {
+		return 0, err
+	}
+	setDuplicateCounts(rows, counts)
+
+	f, err := os.Create(filepath.Clean(out))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	rw, err := newAcceptedRowWriter(f, resultDelimiter(out, cfg), opts, cfg)
+	if err != nil {
+		return 0, err
+	}
+	tally := newResultTally(svc.categoryLabels())
+	for _, r := range rows {
+		tally.add(r)
+		if err := rw.write(r); err != nil {
+			return 0, err
+		}
+	}
+	if err := rw.flush(); err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	reportFileResult(w, svc, opts, tally, rw, out)
+	return total, nil
+}
+
+// isStreamableInput reports whether input is CSV/TSV (optionally .gz),
+// which classifyStreamFile can read without loading it whole.
+func isStreamableInput(input string) bool {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(input, ".gz"))) {
+	case ".csv", ".tsv":
+		return true
+	}
+	return false
+}
+
+// classifyStreamFile reads input one record at a time, classifies the texts
+// in BatchSize chunks and writes each row to out as soon as it is ranked, so
+// memory does not grow with the size of the input.
+func classifyStreamFile(svc *Service, cfg Config, opts ClassifyFileOptions, input, out string, w io.Writer) (int, error) {
+	r, name, closeIn, err := openTextStream(input, cfg.InputEncoding)
+	if err != nil {
+		return 0, err
+	}
+	defer closeIn()
+	inDelim := ','
+	if strings.EqualFold(filepath.Ext(name), ".tsv") {
+		inDelim = '\t'
+	}
+	// 最初は開いた r から読み、閉じていない引用符から読み直すときだけ開き直す
+	opened := false
+	open := func() (io.Reader, func(), error) {
+		if !opened {
+			opened = true
+			return r, func() {}, nil
+		}
+		r, _, closeFn, err := openTextStream(input, cfg.InputEncoding)
+		return r, closeFn, err
+	}
+
+	f, err := os.Create(filepath.Clean(out))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	rw, err := newAcceptedRowWriter(f, resultDelimiter(out, cfg), opts, cfg)
+	if err != nil {
+		return 0, err
+	}
+	tally := newResultTally(svc.categoryLabels())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	texts := make(chan string, cfg.BatchSize)
+	var warnings []ParseWarning
+	var readErr error
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		defer close(texts)
+		var textCols []int
+		first := true
+		warnings, readErr = streamCSVRecords(open, inDelim, func(record []string) error {
+			if first {
+				first = false
+				cols, hasHeader, err := resolveInputColumns(record, opts.TextColumn, opts.InputProfile, cfg)
+				if err != nil {
+					return err
+				}
+				textCols = cols
+				if hasHeader {
+					return nil
+				}
+			}
+			text := joinedCell(record, textCols)
+			if text == "" && !cfg.KeepEmptyRows {
+				return nil
+			}
+			select {
+			case texts <- text:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if readErr != nil {
+			cancel()
+		}
+	}()
+
+	total := 0
+	err = svc.ClassifyStream(ctx, texts, func(row ResultRow) error {
+		total++
+		tally.add(row)
+		return rw.write(row)
+	})
+	cancel()
+	<-readDone
+	if readErr != nil && !errors.Is(readErr, context.Canceled) {
+		return total, readErr
+	}
+	if err != nil {
+		return total, err
+	}
+	if total == 0 {
+		return 0, errors.New("分類する行がありません")
+	}
+	if err := rw.flush(); err != nil {
+		return total, err
+	}
+	if err := f.Close(); err != nil {
+		return total, err
+	}
+	printParseWarnings(filepath.Base(input), warnings)
+	reportFileResult(w, svc, opts, tally, rw, out)
+	return total, nil
+}
+
+// reportFileResult prints the accepted/review counts, the category
+// distribution and, with -coverage, the coverage of one classified file.
+func reportFileResult(w io.Writer, svc *Service, opts ClassifyFileOptions, tally *resultTally, rw *acceptedRowWriter, out string) {
+	fmt.Fprintf(w, "自動確定 %d件 / 要確認 %d件 (全%d行)\n", rw.accepted, rw.rows-rw.accepted, rw.rows)
+	fmt.Fprintln(w, formatCategoryDistribution(SortCategoryCounts(tally.top), svc.categoryLabels(), distributionMaxRows))
+	if opts.Coverage {
+		fmt.Fprintln(w, formatSeedCoverage(tally.coverage))
+	}
+	fmt.Fprintf(w, "結果を %s に出力しました\n", out)
+}
+
+// resolveInputColumns picks the text columns of an input file: the columns
+// of the named profile, else column, else the detected text column.
+func resolveInputColumns(header []string, column, profile string, cfg Config) ([]int, bool, error) {
+	if profile != "" {
+		p, ok := cfg.InputProfiles[profile]
+		if !ok {
+			return nil, false, fmt.Errorf("入力列プロファイル %q がありません", profile)
+		}
+		return resolveProfileColumns(header, p.TextColumns)
+	}
+	col, hasHeader, err := resolveEvalColumn(header, column, detectTextColumn(header))
+	if err != nil {
+		return nil, false, err
+	}
+	if col < 0 {
+		col = 0
+	}
+	return []int{col}, hasHeader, nil
+}
+
+// autoAccept reports whether row's top suggestion can be used without
+// review. It shares needReview with the service so a margin gate behaves
+// exactly like Config.Thresh.Margin12.
+func autoAccept(row ResultRow, minScore, margin float32) bool {
+	if row.Pending || row.TooShort || topLabel(row) == unclassifiedLabel {
+		return false
+	}
+	if minScore <= 0 && margin <= 0 {
+		return !row.NeedReview
+	}
+	if row.Suggestions[0].Score < minScore {
+		return false
+	}
+	return !needReview(row.Suggestions, margin, 0)
+}
+
+// resultDelimiter is the separator of the result file out: .tsv/.csv in an
+// explicit -output name wins over Config.OutputDelimiter, as in the GUI
+// export.
+func resultDelimiter(out string, cfg Config) rune {
+	return exportDelimiter(out, parseOutputDelimiter(cfg.OutputDelimiter))
+}
+
+// acceptedRowWriter writes the CLI result file one row at a time with
+// acceptedOutputColumns, with needReview reflecting the auto-accept decision.
+type acceptedRowWriter struct {
+	out      *outputColumnWriter
+	minScore float32
+	margin   float32
+	rows     int
+	accepted int
+}
+
+func newAcceptedRowWriter(w io.Writer, delim rune, opts ClassifyFileOptions, cfg Config) (*acceptedRowWriter, error) {
+	out, err := newOutputColumnWriter(w, delim, acceptedOutputColumns(cfg), cfg.SourceLabels)
+	if err != nil {
+		return nil, err
+	}
+	return &acceptedRowWriter{out: out, minScore: opts.MinScore, margin: opts.AutoAcceptMargin}, nil
+}
+
+func (rw *acceptedRowWriter) write(r ResultRow) error {
+	ok := autoAccept(r, rw.minScore, rw.margin)
+	if ok {
+		rw.accepted++
+	}
+	rw.rows++
+	r.NeedReview = !ok
+	return rw.out.write(r)
+}
+
+func (rw *acceptedRowWriter) flush() error {
+	return rw.out.flush()
+}
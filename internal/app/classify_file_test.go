@@ -0,0 +1,286 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestResultFileNames(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 5, 7, 0, time.Local)
+	tests := []struct {
+		name      string
+		template  string // Config.OutputTemplate。空なら既定
+		delimiter string
+		inputs    []string
+		existing  []string // 出力先に既にあるファイル
+		want      []string
+	}{
+		{"default", "", "", []string{"a.csv", "b.tsv"}, nil,
+			[]string{"result_20261016090507_a.csv", "result_20261016090507_b.csv"}},
+		{"tab", "", "tab", []string{"a.csv", "b.csv.gz"}, nil,
+			[]string{"result_20261016090507_a.tsv", "result_20261016090507_b.tsv"}},
+		{"same stem", "", "", []string{"a.csv", "a.tsv", "a.csv.gz", "b.csv"}, nil,
+			[]string{"result_20261016090507_a.csv", "result_20261016090507_a_2.csv", "result_20261016090507_a_3.csv", "result_20261016090507_b.csv"}},
+		{"existing file", "", "", []string{"a.csv"}, []string{"result_20261016090507_a.csv", "result_20261016090507_a_2.csv"},
+			[]string{"result_20261016090507_a_3.csv"}},
+		{"template with input", "{input}_{mode}", "", []string{"a.csv"}, nil, []string{"a_seeded.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := defaultConfig()
+			cfg.Mode = ModeSeeded
+			if tt.template != "" {
+				cfg.OutputTemplate = tt.template
+			}
+			cfg.OutputDelimiter = tt.delimiter
+			inputs := make([]string, len(tt.inputs))
+			for i, in := range tt.inputs {
+				inputs[i] = filepath.Join("in", in)
+			}
+			got := resultFileNames(cfg, now, dir, inputs)
+			for i := range got {
+				got[i] = filepath.Base(got[i])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultFileName(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 5, 7, 0, time.Local)
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	// 同じ秒に続けて出力しても上書きしない
+	var got []string
+	for i := 0; i < 3; i++ {
+		out := resultFileName(cfg, now, dir, filepath.Join("in", "talks.csv"))
+		if err := os.WriteFile(out, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.Base(out))
+	}
+	want := []string{"result_20261016090507.csv", "result_20261016090507_2.csv", "result_20261016090507_3.csv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	// GUI の既定名と同じ形式
+	if gui := defaultResultFileName(cfg, now, "talks.csv", ','); gui != want[0] {
+		t.Errorf("GUI name = %q, want %q", gui, want[0])
+	}
+}
+
+func TestClassifyFileTSVOutput(t *testing.T) {
+	// 読点・カンマを含む本文
+	const body = "りんご, みかん、バナナを買った"
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(input, []byte("本文\n\""+body+"\"\n北海道への旅行記\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		delimiter string // ClassifyFileOptions.OutputDelimiter
+		out       string
+		dedupe    bool // 全件を読む経路 (false ならストリーミング)
+		columns   string
+		wantComma rune
+		header    []string
+	}{
+		{"tab streamed", "tab", "result.tsv", false, "", '\t', []string{"text", "category", "status", "top1_score", "margin", "count"}},
+		{"tab read whole", "tab", "result.tsv", true, "", '\t', []string{"text", "category", "status", "top1_score", "margin", "count"}},
+		{"tab with columns", "tab", "result.tsv", false, "index,text=本文,score", '\t', []string{"index", "本文", "score"}},
+		{"semicolon", ";", "result.txt", false, "", ';', []string{"text", "category", "status", "top1_score", "margin", "count"}},
+		// -output の拡張子が区切り文字の指定より優先する
+		{"csv name wins", "tab", "result.csv", false, "", ',', []string{"text", "category", "status", "top1_score", "margin", "count"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ClassifyFileOptions{OutputDelimiter: tt.delimiter, Dedupe: tt.dedupe, OutputColumns: tt.columns}
+			cfg, err := fileClassifierConfig(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			svc := newTestService(t, nil)
+			out := filepath.Join(t.TempDir(), tt.out)
+			if _, err := classifyOneFile(svc, cfg, opts, input, out, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantComma != ',' && strings.Contains(string(data), `"`) {
+				t.Errorf("output is quoted:\n%s", data)
+			}
+			r := csv.NewReader(strings.NewReader(string(data)))
+			r.Comma = tt.wantComma
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("got %d records, want header + 2", len(records))
+			}
+			if !reflect.DeepEqual(records[0], tt.header) {
+				t.Errorf("header = %q, want %q", records[0], tt.header)
+			}
+			textCol := 0
+			for i, h := range tt.header {
+				if h == "text" || h == "本文" {
+					textCol = i
+				}
+			}
+			if got := records[1][textCol]; got != body {
+				t.Errorf("text = %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestClassifyFileInputEncoding(t *testing.T) {
+	texts := []string{"りんごを買った", "北海道への旅行記"}
+	data, err := japanese.EUCJP.NewEncoder().String("本文\n" + strings.Join(texts, "\n") + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(input, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dedupe := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dedupe=%v", dedupe), func(t *testing.T) {
+			opts := ClassifyFileOptions{Dedupe: dedupe, OutputColumns: "text"}
+			cfg, err := fileClassifierConfig(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.InputEncoding = EncodingEUCJP
+			svc := newTestService(t, nil)
+			out := filepath.Join(t.TempDir(), "result.csv")
+			if _, err := classifyOneFile(svc, cfg, opts, input, out, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "text\n" + strings.Join(texts, "\n") + "\n"; string(got) != want {
+				t.Errorf("output = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestClassifyFileUnterminatedQuote(t *testing.T) {
+	const data = "本文\nりんごを買った\n\"壊れた行\n北海道への旅行記\n新鮮な野菜のサラダ\n"
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(plain, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	gz := filepath.Join(dir, "in.csv.gz")
+	if err := os.WriteFile(gz, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 閉じていない引用符の行だけを飛ばし、ストリーミングでも全体を読んでも同じ行を分類する
+	want := "text\nりんごを買った\n北海道への旅行記\n新鮮な野菜のサラダ\n"
+	for _, input := range []string{plain, gz} {
+		for _, dedupe := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/dedupe=%v", filepath.Base(input), dedupe), func(t *testing.T) {
+				opts := ClassifyFileOptions{Dedupe: dedupe, OutputColumns: "text"}
+				cfg, err := fileClassifierConfig(opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				svc := newTestService(t, nil)
+				out := filepath.Join(t.TempDir(), "result.csv")
+				if _, err := classifyOneFile(svc, cfg, opts, input, out, io.Discard); err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("output = %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestClassifyFileKeepEmptyRows(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(input, []byte("本文,id\nりんごを買った,1\n,2\n北海道への旅行記,3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		keepEmpty bool
+		dedupe    bool
+		want      [][]string // text, category, status
+	}{
+		{"skip streamed", false, false, [][]string{{"りんごを買った"}, {"北海道への旅行記"}}},
+		{"skip read whole", false, true, [][]string{{"りんごを買った"}, {"北海道への旅行記"}}},
+		{"keep streamed", true, false, [][]string{{"りんごを買った"}, {"", emptyInputLabel, reviewMarker}, {"北海道への旅行記"}}},
+		{"keep read whole", true, true, [][]string{{"りんごを買った"}, {"", emptyInputLabel, reviewMarker}, {"北海道への旅行記"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ClassifyFileOptions{Dedupe: tt.dedupe, OutputColumns: "text,category,status"}
+			cfg, err := fileClassifierConfig(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.KeepEmptyRows = tt.keepEmpty
+			svc := newTestService(t, func(c *Config) { c.KeepEmptyRows = tt.keepEmpty })
+			out := filepath.Join(t.TempDir(), "result.csv")
+			if _, err := classifyOneFile(svc, cfg, opts, input, out, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := records[1:]
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows %q, want %d", len(rows), rows, len(tt.want))
+			}
+			for i, w := range tt.want {
+				// 空でない行は本文だけ確かめる
+				if !reflect.DeepEqual(rows[i][:len(w)], w) {
+					t.Errorf("row %d = %q, want prefix %q", i+1, rows[i], w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestClusterOrderIndependence(t *testing.T) {
+	// A–B は 40°、B–C は 35°、A–C は 75° 離れた単位ベクトル。閾値 cos 45° では
+	// A–B と B–C はまとまるが A–C はまとまらない。
+	unit := func(deg float64) []float32 {
+		r := deg * math.Pi / 180
+		return []float32{float32(math.Cos(r)), float32(math.Sin(r))}
+	}
+	vecs := map[string][]float32{"A": unit(0), "B": unit(40), "C": unit(75)}
+	lookup := func(label string) []float32 { return vecs[label] }
+	sugs := []Suggestion{{Label: "A", Score: 0.9}, {Label: "B", Score: 0.8}, {Label: "C", Score: 0.7}}
+	tau := float32(math.Cos(45 * math.Pi / 180))
+
+	// 各クラスタをラベルと別名の集合で表し、並べ替えて比べる
+	describe := func(out []Suggestion) string {
+		clusters := make([]string, len(out))
+		for i, s := range out {
+			members := append([]string{s.Label}, s.Aliases...)
+			sort.Strings(members)
+			clusters[i] = strings.Join(members, "+")
+		}
+		sort.Strings(clusters)
+		return strings.Join(clusters, " ")
+	}
+	permutations := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+
+	type clusterFunc func([]Suggestion, float32, string, similarityFunc, func(string) []float32) []Suggestion
+	tests := []struct {
+		name    string
+		cluster clusterFunc
+		linkage string
+		want    string // 空なら並び順によって結果が変わることを確かめる
+	}{
+		{"agglomerative single", agglomerativeClusterSuggestions, LinkageSingle, "A+B+C"},
+		{"agglomerative complete", agglomerativeClusterSuggestions, LinkageComplete, "A B+C"},
+		{"agglomerative average", agglomerativeClusterSuggestions, LinkageAverage, "A B+C"},
+		{"greedy single", clusterSuggestions, LinkageSingle, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string][]int)
+			for _, perm := range permutations {
+				in := make([]Suggestion, len(perm))
+				for i, p := range perm {
+					in[i] = sugs[p]
+				}
+				got := describe(tt.cluster(in, tau, tt.linkage, cosineWithNorm, lookup))
+				seen[got] = perm
+			}
+			if tt.want == "" {
+				if len(seen) < 2 {
+					t.Errorf("greedy gave the same clusters for every order: %v", seen)
+				}
+				return
+			}
+			for got, perm := range seen {
+				if got != tt.want {
+					t.Errorf("order %v: clusters %q, want %q", perm, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,17 +1,74 @@
 package app
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	emb "yashubustudio/categorizer/emb"
+)
 
 const (
 	ModeSeeded = "seeded"
 	ModeMixed  = "mixed"
 	ModeSplit  = "split"
 
+	NoCandidateSilent       = "silent"
+	NoCandidateUnclassified = "unclassified"
+	NoCandidateError        = "error"
+
+	LinkageSingle   = "single"
+	LinkageAverage  = "average"
+	LinkageComplete = "complete"
+
+	ClusterGreedy        = "greedy"
+	ClusterAgglomerative = "agglomerative"
+
+	MixedCombineSeparate = "separate"
+	MixedCombineMax      = "max"
+	MixedCombineSum      = "sum"
+
+	NDCIndexMemory   = "memory"
+	NDCIndexHNSW     = "hnsw"
+	NDCIndexExternal = "external"
+
+	TieBreakHash      = "hash"
+	TieBreakLabel     = "label"
+	TieBreakInsertion = "insertion"
+
+	EncodingAuto     = "auto"
+	EncodingUTF8     = "utf-8"
+	EncodingShiftJIS = "shift_jis"
+	EncodingEUCJP    = "euc-jp"
+
 	fyneAppID       = "studio.yashubu.categorizer"
 	defaultSeedFile = "config/categories_seed.txt"
 	defaultRuleFile = "config/category_rules.json"
+
+	emptyInputLabel   = "未分類(空)"
+	unclassifiedLabel = "未分類"
 )
 
+var noCandidateChoices = []struct {
+	Label string
+	Value string
+}{
+	{Label: "空のまま", Value: NoCandidateSilent},
+	{Label: "未分類にする", Value: NoCandidateUnclassified},
+	{Label: "エラーとして印を付ける", Value: NoCandidateError},
+}
+
+var mixedCombineChoices = []struct {
+	Label string
+	Value string
+}{
+	{Label: "別々に並べる", Value: MixedCombineSeparate},
+	{Label: "高い方を採用", Value: MixedCombineMax},
+	{Label: "合計する", Value: MixedCombineSum},
+}
+
+var encodingChoices = []string{EncodingAuto, EncodingUTF8, EncodingShiftJIS, EncodingEUCJP}
+
 var modeChoices = []struct {
 	Label string
 	Value string
@@ -30,54 +87,304 @@ type Threshold struct {
 type ClusterCfg struct {
 	Enabled   bool
 	Threshold float32 // tau 例: 0.80
+	Linkage   string  // "single" | "average" | "complete"
+	// Algorithm は "greedy" (候補順に1回走査。結果が候補の順序に依存する) または
+	// "agglomerative" (最も近い2クラスタの併合を閾値未満になるまで繰り返す。順序に依存しない)。
+	Algorithm string
 }
 
 type Config struct {
 	TopK      int
+	MaxTopK   int // Top-k の上限 (3〜10)。既定 5
 	Mode      string
-	UseNDC    bool
+	UseNDC    bool // 項目のみモードでは無視される (SeededShowNDC を参照)
 	WeightNDC float32
 	SeedBias  float32
 	Thresh    Threshold
 
+	// SeededShowNDC を有効にすると、項目のみモードでも NDC 候補を別枠で参考表示する。
+	// ランキング (候補1..k) には混ぜない。既定は無効で、項目のみモードは NDC を一切計算しない。
+	SeededShowNDC bool
+
+	// ScoreBreakdown を有効にすると、詳細表示に1位候補のスコア内訳
+	// (コサイン類似度・重み・ルール加点・最終スコア) を出す。閾値調整用。
+	ScoreBreakdown bool
+
+	// MinScore 未満の候補は表示しない (別枠モードでは項目と NDC をそれぞれ判定)。0 で無効。
+	MinScore float32
+
+	// CategoryThresholds はカテゴリ別の MinScore。ここにあるカテゴリは MinScore の代わりに
+	// この値で候補を除外する。カテゴリ CSV の閾値列 (threshold / 閾値) からも読み込む。
+	CategoryThresholds map[string]float32
+
+	// ReviewSingleFloor を有効にすると、候補が1件だけでもスコアが Thresh.Top1 未満なら要確認にする。
+	// (MinScore 未満の候補は既に除外されているため、下限には Top1 閾値を使う)
+	ReviewSingleFloor bool
+
+	// SubstringBoost はカテゴリ名が入力にそのまま含まれる場合に加算するスコア。0 で無効。
+	SubstringBoost float32
+
+	// TieBreak は同点候補の並べ方。"hash": ラベルのハッシュで微小な差を付ける (従来動作)、
+	// "label": ラベル順、"insertion": カテゴリファイルに書かれた順。
+	TieBreak string
+
+	// Metric は入力とカテゴリのベクトルの比較方法 ("cosine" / "dot" / "euclidean")。
+	// 候補のクラスタリングにも同じ方法を使う。dot はベクトルの内積、euclidean は
+	// 距離 d を 1 - d/2 に換算したスコア (どちらも 0〜1 に丸める)。エンコーダの出力は
+	// 常に L2 正規化されるため、dot が cosine と違うのは説明・例文を平均したカテゴリ
+	// (長さ 1 未満のセントロイド) だけで、内積で学習した正規化しないモデル向けの
+	// 指定ではない (スコアを 0〜1 に丸めるので、正規化しない内積は順位を保てない)。
+	Metric string
+
+	// DedupeLabels を有効にすると、混合モードで正規化後に同じラベルとなる候補を1件にまとめる。
+	// MixedCombine が空のときだけ参照する (有効なら "max"、無効なら "separate" と同じ)。
+	DedupeLabels bool
+	// MixedCombine は混合モードで項目と NDC に同じラベルがあるときのスコアの合わせ方。
+	// "separate": 別々の候補として並べる / "max": 高い方の1件にまとめる / "sum": 重み付き後のスコアを合計して1件にする
+	MixedCombine string
+
+	// NoCandidate は候補が1件もスコアを持たない場合の扱い
+	// ("silent": 空のまま / "unclassified": 未分類ラベル / "error": 未分類にして
+	// ResultRow.NoCandidates を立てる。候補が1件も登録されていなければ ErrNoCandidates)。
+	NoCandidate string
+
+	// KeepEmptyRows を有効にすると空行・空セルも1件として扱い (結果は「未分類(空)」)、
+	// 入力の行番号と結果の行番号を一致させる。GUI・コマンドライン版・評価コマンド共通。
+	KeepEmptyRows bool
+	// DedupeInputs を有効にすると、正規化後の本文が同じ入力を最初の1件にまとめてから分類する。
+	// DedupeThreshold が正なら、埋め込みのコサイン類似度がそれ以上の入力もまとめる。
+	DedupeInputs    bool
+	DedupeThreshold float32
+	// CollapseSpaces を有効にすると、読み込んだ各行・セル内の連続した空白 (全角スペース・タブを含む) を
+	// 半角スペース1つにまとめる。
+	CollapseSpaces bool
+	// StripHTML を有効にすると埋め込み前に HTML タグを除去し、実体参照を復号する。
+	StripHTML bool
+	// CaseFold を有効にすると埋め込み前に英字を小文字にそろえる (既定。"VRChat" と "vrchat" が
+	// 同じベクトルになる)。大文字小文字を区別するモデルでは無効にする。キーワード照合は常に区別しない。
+	// StripPunctuation を有効にすると埋め込み前・キーワード照合前に句読点・括弧類を空白に置き換える。
+	// どちらもカテゴリ名にも適用されるため、変更後はカテゴリを読み込み直すと反映される。
+	CaseFold         bool
+	StripPunctuation bool
+	// GuessCategoryColumn を有効にすると、カテゴリ CSV に見出しで分かる列が無いとき、
+	// 先頭列ではなく短く繰り返しの多い (ID や本文ではない) 列を既定で選ぶ。
+	GuessCategoryColumn bool
+	// TrimLabelPunct を有効にするとカテゴリ名の先頭の箇条書き記号・番号と末尾の句読点を除去する。
+	TrimLabelPunct bool
+	// InputEncoding は読み込むファイルの文字コード ("auto" / "utf-8" / "shift_jis" / "euc-jp")。
+	// auto では UTF-8 として不正な場合に Shift_JIS とみなす。
+	InputEncoding string
+	// CategoryEncoding はカテゴリ・別名・プロファイルのファイルの文字コード。
+	// 空なら InputEncoding と同じ。
+	CategoryEncoding string
+	// Sheet は .xlsx を読み込むときのシート名。空なら先頭のシート。
+	Sheet string
+	// CategorySheet はカテゴリ・別名・プロファイルの .xlsx のシート名。空なら Sheet と同じ。
+	CategorySheet string
+	// OutputDelimiter はエクスポートの区切り文字 ("," / "\t" / ";")。"tab" / "tsv" は "\t" として扱う。
+	OutputDelimiter string
+	// MatrixTopN はスコア行列 (.matrix.csv) で入力ごとに残すカテゴリ数。0 なら全カテゴリの密な行列、
+	// 1 以上なら上位 N 件だけを (行, 順位, カテゴリ, スコア) の縦長形式で出力する。
+	MatrixTopN int
+	// OutputTemplate はエクスポート時の既定ファイル名 (拡張子なし)。
+	// {input} 読込ファイル名, {date} 日付, {time} 時刻(秒まで), {mode} ランキングモード が使える。
+	OutputTemplate string
+	// OutputColumns を指定すると結果 CSV をこの列だけ・この順で出力する (GUI・CLI 共通)。
+	// 使える列は outputColumnNames。category や score などの候補の列は "score2" のように
+	// 順位を付けられる。空なら GUI・CLI それぞれの既定の列構成 (exportOutputColumns /
+	// acceptedOutputColumns)。
+	OutputColumns []string
+	// OutputHeaders は OutputColumns の列名 → 見出しの置き換え。ない列は列名をそのまま使う。
+	OutputHeaders map[string]string
+	// SourceLabels は内部のソースコード ("seed"/"hybrid"/"ndc") を表示名に変換する。
+	// 画面表示とエクスポートのみに使い、内部処理はコードのまま扱う。
+	SourceLabels map[string]string
+	// MaxRuntime を超えた場合は処理済みの行だけを返し、残りは未処理として扱う。0 で無制限。
+	MaxRuntime time.Duration
+	// MinInputChars 未満 (ルーン数) の入力は分類はするが要確認として扱う。0 で無効。
+	MinInputChars int
+	// LanguageRouting を有効にすると、入力の言語 (日本語/英語) を判定し、
+	// 言語タグ付きカテゴリのうち同じ言語のものと共通カテゴリだけで分類する。
+	// 判定できない入力は全カテゴリを使う。
+	LanguageRouting bool
+	// LengthNormalization を有効にすると、短い入力ほど要確認判定に使う確信度を割り引く。
+	// 候補の順位やスコア表示には影響しない。
+	LengthNormalization bool
+
 	ClusterCfg ClusterCfg
 
 	OrtDLL        string
 	ModelPath     string
 	TokenizerPath string
 	MaxSeqLen     int
+	Pooling       string // "mean" | "max" | "cls"
+	WarmUp        bool   // 起動時にダミー文を1件埋め込み、初回分類の遅延を抑える
+	BatchSize     int    // まとめて推論する件数。1 以下で1件ずつ
+	// ORT のスレッド数 (0 で ORT 既定)。固定すると環境間で結果を再現しやすくなる代わりに遅くなることがある。
+	IntraOpThreads int
+	InterOpThreads int
+	// EmbedWorkers はキャッシュに無い文を並列に埋め込むワーカー数。ワーカーごとに ORT セッションを持つ。
+	EmbedWorkers int
+	// ExecutionProvider は ORT の実行プロバイダ ("cpu" / "cuda" / "directml")。GPU を使うには
+	// 対応するビルドの onnxruntime.dll が必要で、使えない場合は CPU で動く。DeviceID は GPU 番号。
+	ExecutionProvider string
+	DeviceID          int
+	// EmbedMaxRetries はモデルの初期化・埋め込みが失敗したときに再試行する回数 (0 で再試行しない)。
+	// 待ち時間は EmbedRetryDelay から始めて再試行ごとに倍にする。DLL の読込競合など一時的な失敗向け。
+	EmbedMaxRetries int
+	EmbedRetryDelay time.Duration
 
-	CacheDir         string
+	CacheDir string
+	// MemCacheEntries はメモリ上に保持する埋め込みの最大件数。超えると最も長く使われていない
+	// ものから捨てる (ディスクキャッシュからは再読込できる)。0 で無制限 (既定)。
+	MemCacheEntries  int
 	SeedFile         string
 	CategoryRuleFile string
+	// SeedAliasFile は「正式名, 別名1, 別名2, ...」形式の CSV/TSV。別名はそれぞれ埋め込まれ、
+	// 一致した場合も正式名のカテゴリとして順位付け・表示する。起動時だけでなくカテゴリを
+	// 読み込み直すたびに付け直す。空なら使わない。
+	SeedAliasFile string
+	// NDCFile にコード・ラベル列を持つ CSV/TSV を指定すると、組み込みの NDC 一覧の代わりに使う。
+	NDCFile string
+	// NDCIndex は NDC 候補の探し方 ("memory": 全件と比較 (既定) / "hnsw": 近似検索 /
+	// "external": ExternalIndexURL の外部ベクトル DB に問い合わせる)。memory 以外では
+	// 上位の候補しかスコアを持たない。
+	NDCIndex string
+	// HNSWEfSearch は hnsw の検索で辿る候補数。大きいほど正確で遅い。
+	HNSWEfSearch int
+	// ExternalIndexURL は external の検索 API (問い合わせ形式は ExternalIndex を参照)。
+	ExternalIndexURL string
+
+	// InputProfiles / CategoryProfiles は名前付きの列選択。GUI の列選択で保存・適用でき、
+	// categorizer-cli の -input-profile / -category-profile でも使える。ProfileFile に保存される。
+	InputProfiles    map[string]InputProfile
+	CategoryProfiles map[string]CategoryProfile
+	ProfileFile      string
+
+	// WriteSummary を有効にすると、結果のエクスポート時に同じフォルダへ
+	// summary_*.json (件数・カテゴリ別件数・要確認数・スコア分布・設定指紋) を出力する。
+	WriteSummary bool
+
+	// PostProcessCommand が設定されている場合、分類結果(JSON)を標準入力で渡し、
+	// 標準出力に返された結果で置き換える。失敗時は元の結果を維持する。
+	// 1要素目が実行するプログラム、残りが引数 (例: ["python3", "C:/my tools/fix.py", "--strict"])。
+	// シェルを通さないので空白を含むパスや引数もそのまま渡る。
+	// 一括分類ではまとめて1回 (ストリーミングでは BatchSize 件ごと)、1件ずつの分類
+	// (RankOne・説明表示) では1件ごとに起動する。
+	PostProcessCommand []string
 }
 
 func defaultConfig() Config {
 	return Config{
-		TopK:             3,
-		Mode:             ModeMixed,
-		UseNDC:           true,
-		WeightNDC:        0.85,
-		SeedBias:         0.03,
-		Thresh:           Threshold{Top1: 0.45, Margin12: 0.03, Mean: 0.50},
-		ClusterCfg:       ClusterCfg{Enabled: false, Threshold: 0.80},
-		OrtDLL:           "./onnixruntime-win/lib/onnxruntime.dll",
-		ModelPath:        "./models/bge-m3/model.onnx",
-		TokenizerPath:    "./models/bge-m3/tokenizer.json",
-		MaxSeqLen:        512,
-		CacheDir:         "./cache",
-		SeedFile:         defaultSeedFile,
-		CategoryRuleFile: defaultRuleFile,
+		TopK:                3,
+		MaxTopK:             defaultMaxTopK,
+		Mode:                ModeMixed,
+		UseNDC:              true,
+		WeightNDC:           0.85,
+		SeedBias:            0.03,
+		Thresh:              Threshold{Top1: 0.45, Margin12: 0.03, Mean: 0.50},
+		DedupeLabels:        true,
+		TieBreak:            TieBreakHash,
+		Metric:              MetricCosine,
+		NoCandidate:         NoCandidateSilent,
+		NDCIndex:            NDCIndexMemory,
+		HNSWEfSearch:        defaultHNSWEfSearch,
+		ClusterCfg:          ClusterCfg{Enabled: false, Threshold: 0.80, Linkage: LinkageSingle, Algorithm: ClusterGreedy},
+		OrtDLL:              "./onnixruntime-win/lib/onnxruntime.dll",
+		ModelPath:           "./models/bge-m3/model.onnx",
+		TokenizerPath:       "./models/bge-m3/tokenizer.json",
+		MaxSeqLen:           512,
+		Pooling:             emb.PoolingMean,
+		WarmUp:              true,
+		BatchSize:           32,
+		EmbedWorkers:        1,
+		EmbedMaxRetries:     2,
+		EmbedRetryDelay:     500 * time.Millisecond,
+		CaseFold:            true,
+		ExecutionProvider:   emb.ProviderCPU,
+		SourceLabels:        defaultSourceLabels(),
+		OutputDelimiter:     ",",
+		OutputTemplate:      defaultOutputTemplate,
+		InputEncoding:       EncodingAuto,
+		GuessCategoryColumn: true,
+		CacheDir:            "./cache",
+		SeedFile:            defaultSeedFile,
+		CategoryRuleFile:    defaultRuleFile,
+		ProfileFile:         defaultProfileFile,
+	}
+}
+
+func defaultSourceLabels() map[string]string {
+	return map[string]string{
+		"seed":   "項目",
+		"hybrid": "項目",
+		"ndc":    "NDC",
+		"empty":  "空",
+		"none":   "該当なし",
+	}
+}
+
+// ndcEnabled reports whether NDC candidates are scored under cfg.
+func ndcEnabled(cfg Config) bool {
+	switch cfg.Mode {
+	case ModeSplit:
+		return true
+	case ModeSeeded:
+		return cfg.SeededShowNDC
+	}
+	return cfg.UseNDC
+}
+
+// separateNDC reports whether NDC suggestions are shown in their own
+// columns rather than merged into the ranking.
+func separateNDC(cfg Config) bool {
+	return cfg.Mode == ModeSplit || (cfg.Mode == ModeSeeded && cfg.SeededShowNDC)
+}
+
+// Top-k の範囲。上限は MaxTopK (既定 5) で、topKHardLimit まで広げられる。
+const (
+	minTopK        = 3
+	defaultMaxTopK = 5
+	topKHardLimit  = 10
+)
+
+func clampTopK(k, limit int) int {
+	if k < minTopK {
+		return minTopK
+	}
+	if k > limit {
+		return limit
 	}
+	return k
+}
+
+// topKChoices lists the selectable Top-k values up to limit.
+func topKChoices(limit int) []string {
+	out := make([]string, 0, limit-minTopK+1)
+	for k := minTopK; k <= limit; k++ {
+		out = append(out, strconv.Itoa(k))
+	}
+	return out
+}
+
+// limitTopK caps topK at the number of candidates that can fill a column,
+// so small category sets do not leave empty trailing columns. available
+// <= 0 leaves topK unchanged.
+func limitTopK(topK, available int) int {
+	if available > 0 && available < topK {
+		return available
+	}
+	return topK
 }
 
 func sanitizeConfig(cfg Config) Config {
-	if cfg.TopK < 3 {
-		cfg.TopK = 3
+	if cfg.MaxTopK < minTopK {
+		cfg.MaxTopK = defaultMaxTopK
 	}
-	if cfg.TopK > 5 {
-		cfg.TopK = 5
+	if cfg.MaxTopK > topKHardLimit {
+		cfg.MaxTopK = topKHardLimit
 	}
+	cfg.TopK = clampTopK(cfg.TopK, cfg.MaxTopK)
 	switch cfg.Mode {
 	case ModeSeeded, ModeMixed, ModeSplit:
 	default:
@@ -95,9 +402,81 @@ func sanitizeConfig(cfg Config) Config {
 	if cfg.SeedBias > 0.2 {
 		cfg.SeedBias = 0.2
 	}
+	if cfg.MinScore < 0 {
+		cfg.MinScore = 0
+	}
+	if cfg.MinScore > 1 {
+		cfg.MinScore = 1
+	}
+	cfg.CategoryThresholds = clampCategoryThresholds(cfg.CategoryThresholds)
+	cfg.OutputColumns, cfg.OutputHeaders = sanitizeOutputColumns(cfg.OutputColumns, cfg.OutputHeaders)
+	if cfg.SubstringBoost < 0 {
+		cfg.SubstringBoost = 0
+	}
+	if cfg.SubstringBoost > 0.3 {
+		cfg.SubstringBoost = 0.3
+	}
 	if cfg.ClusterCfg.Threshold <= 0 {
 		cfg.ClusterCfg.Threshold = 0.80
 	}
+	switch cfg.MixedCombine {
+	case MixedCombineSeparate, MixedCombineMax, MixedCombineSum:
+	default:
+		if cfg.DedupeLabels {
+			cfg.MixedCombine = MixedCombineMax
+		} else {
+			cfg.MixedCombine = MixedCombineSeparate
+		}
+	}
+	switch cfg.NoCandidate {
+	case NoCandidateSilent, NoCandidateUnclassified, NoCandidateError:
+	default:
+		cfg.NoCandidate = NoCandidateSilent
+	}
+	switch cfg.NDCIndex {
+	case NDCIndexMemory, NDCIndexHNSW, NDCIndexExternal:
+	default:
+		cfg.NDCIndex = NDCIndexMemory
+	}
+	if cfg.HNSWEfSearch <= 0 {
+		cfg.HNSWEfSearch = defaultHNSWEfSearch
+	}
+	cfg.ExternalIndexURL = strings.TrimSpace(cfg.ExternalIndexURL)
+	switch cfg.TieBreak {
+	case TieBreakHash, TieBreakLabel, TieBreakInsertion:
+	default:
+		cfg.TieBreak = TieBreakHash
+	}
+	switch cfg.Metric {
+	case MetricCosine, MetricDot, MetricEuclidean:
+	default:
+		cfg.Metric = MetricCosine
+	}
+	switch cfg.InputEncoding {
+	case EncodingAuto, EncodingUTF8, EncodingShiftJIS, EncodingEUCJP:
+	default:
+		cfg.InputEncoding = EncodingAuto
+	}
+	switch cfg.CategoryEncoding {
+	case "", EncodingAuto, EncodingUTF8, EncodingShiftJIS, EncodingEUCJP:
+	default:
+		cfg.CategoryEncoding = ""
+	}
+	switch cfg.Pooling {
+	case emb.PoolingMean, emb.PoolingMax, emb.PoolingCLS:
+	default:
+		cfg.Pooling = emb.PoolingMean
+	}
+	switch cfg.ClusterCfg.Linkage {
+	case LinkageSingle, LinkageAverage, LinkageComplete:
+	default:
+		cfg.ClusterCfg.Linkage = LinkageSingle
+	}
+	switch cfg.ClusterCfg.Algorithm {
+	case ClusterGreedy, ClusterAgglomerative:
+	default:
+		cfg.ClusterCfg.Algorithm = ClusterGreedy
+	}
 	if cfg.Thresh.Top1 <= 0 {
 		cfg.Thresh.Top1 = 0.45
 	}
@@ -107,7 +486,64 @@ func sanitizeConfig(cfg Config) Config {
 	if cfg.Thresh.Mean <= 0 {
 		cfg.Thresh.Mean = 0.50
 	}
+	cfg.OutputDelimiter = canonicalOutputDelimiter(cfg.OutputDelimiter)
+	switch cfg.OutputDelimiter {
+	case ",", "\t", ";":
+	default:
+		cfg.OutputDelimiter = ","
+	}
+	if cfg.MatrixTopN < 0 {
+		cfg.MatrixTopN = 0
+	}
+	if validateOutputTemplate(cfg.OutputTemplate) != nil {
+		cfg.OutputTemplate = defaultOutputTemplate
+	}
+	if cfg.SourceLabels == nil {
+		cfg.SourceLabels = defaultSourceLabels()
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	if cfg.MaxRuntime < 0 {
+		cfg.MaxRuntime = 0
+	}
+	if cfg.MemCacheEntries < 0 {
+		cfg.MemCacheEntries = 0
+	}
+	if cfg.EmbedWorkers < 1 {
+		cfg.EmbedWorkers = 1
+	}
+	if cfg.EmbedMaxRetries < 0 {
+		cfg.EmbedMaxRetries = 0
+	}
+	if cfg.EmbedRetryDelay < 0 {
+		cfg.EmbedRetryDelay = 0
+	}
+	switch cfg.ExecutionProvider {
+	case emb.ProviderCPU, emb.ProviderCUDA, emb.ProviderDirectML:
+	default:
+		cfg.ExecutionProvider = emb.ProviderCPU
+	}
+	if cfg.DeviceID < 0 {
+		cfg.DeviceID = 0
+	}
+	if cfg.IntraOpThreads < 0 {
+		cfg.IntraOpThreads = 0
+	}
+	if cfg.InterOpThreads < 0 {
+		cfg.InterOpThreads = 0
+	}
+	if cfg.DedupeThreshold < 0 || cfg.DedupeThreshold > 1 {
+		cfg.DedupeThreshold = 0
+	}
+	if cfg.MinInputChars < 0 {
+		cfg.MinInputChars = 0
+	}
 	cfg.SeedFile = strings.TrimSpace(cfg.SeedFile)
 	cfg.CategoryRuleFile = strings.TrimSpace(cfg.CategoryRuleFile)
+	cfg.NDCFile = strings.TrimSpace(cfg.NDCFile)
+	if len(cfg.PostProcessCommand) > 0 && strings.TrimSpace(cfg.PostProcessCommand[0]) == "" {
+		cfg.PostProcessCommand = nil
+	}
 	return cfg
 }
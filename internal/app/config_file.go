@@ -0,0 +1,288 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	emb "yashubustudio/categorizer/emb"
+)
+
+// LoadConfigFile reads a JSON config file on top of the defaults, so the
+// file only needs the fields it changes. Keys are matched to Config fields
+// the way encoding/json does (case-insensitively). Unknown keys and values
+// that Validate rejects are errors when strict is set; otherwise they are
+// printed as warnings and the values are corrected like any other config.
+// An empty path returns the defaults.
+func LoadConfigFile(path string, strict bool) (Config, error) {
+	return LoadConfigFiles(strict, path)
+}
+
+// LoadConfigFiles layers JSON config files over the defaults in order, so a
+// shared base file can be combined with a small per-run override. Each file
+// only changes the keys it contains (see MergeConfigFile); empty paths are
+// skipped. The result is validated once, after all files are applied.
+func LoadConfigFiles(strict bool, paths ...string) (Config, error) {
+	cfg := defaultConfig()
+	var used []string
+	for _, path := range paths {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		var err error
+		if cfg, err = MergeConfigFile(cfg, path, strict); err != nil {
+			return cfg, err
+		}
+		used = append(used, path)
+	}
+	if len(used) == 0 {
+		return cfg, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		where := strings.Join(used, " + ")
+		if strict {
+			return cfg, fmt.Errorf("設定ファイルの値が不正です (%s):\n%w", where, err)
+		}
+		fmt.Printf("設定ファイルの値を補正しました (%s):\n%v\n", where, err)
+	}
+	return sanitizeConfig(cfg), nil
+}
+
+// MergeConfigFile applies the JSON file at path on top of base. Only the
+// keys present in the file are changed: nested objects such as "Thresh"
+// merge field by field and maps merge by key, so {"TopK": 5} leaves every
+// other setting of base as it was. The result is not validated.
+func MergeConfigFile(base Config, path string, strict bool) (Config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return base, err
+	}
+	unknown, err := unknownConfigKeys(data)
+	if err != nil {
+		return base, fmt.Errorf("設定ファイルを読み込めません (%s): %w", path, err)
+	}
+	if len(unknown) > 0 {
+		if strict {
+			return base, fmt.Errorf("設定ファイルに不明な項目があります (%s): %s", path, strings.Join(unknown, ", "))
+		}
+		fmt.Printf("設定ファイルの不明な項目を無視しました (%s): %s\n", path, strings.Join(unknown, ", "))
+	}
+	cfg := cloneConfigMaps(base)
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return base, fmt.Errorf("設定ファイルを読み込めません (%s): %w", path, err)
+	}
+	return cfg, nil
+}
+
+// cloneConfigMaps copies the map fields of cfg so merging into the copy
+// leaves the caller's maps untouched.
+func cloneConfigMaps(cfg Config) Config {
+	if cfg.SourceLabels != nil {
+		m := make(map[string]string, len(cfg.SourceLabels))
+		for k, v := range cfg.SourceLabels {
+			m[k] = v
+		}
+		cfg.SourceLabels = m
+	}
+	if cfg.CategoryThresholds != nil {
+		cfg.CategoryThresholds = mergeCategoryThresholds(cfg.CategoryThresholds, nil)
+	}
+	if cfg.OutputColumns != nil {
+		cfg.OutputColumns = append([]string(nil), cfg.OutputColumns...)
+	}
+	if cfg.PostProcessCommand != nil {
+		cfg.PostProcessCommand = append([]string(nil), cfg.PostProcessCommand...)
+	}
+	if cfg.OutputHeaders != nil {
+		m := make(map[string]string, len(cfg.OutputHeaders))
+		for k, v := range cfg.OutputHeaders {
+			m[k] = v
+		}
+		cfg.OutputHeaders = m
+	}
+	if cfg.InputProfiles != nil {
+		m := make(map[string]InputProfile, len(cfg.InputProfiles))
+		for k, v := range cfg.InputProfiles {
+			m[k] = v
+		}
+		cfg.InputProfiles = m
+	}
+	if cfg.CategoryProfiles != nil {
+		m := make(map[string]CategoryProfile, len(cfg.CategoryProfiles))
+		for k, v := range cfg.CategoryProfiles {
+			m[k] = v
+		}
+		cfg.CategoryProfiles = m
+	}
+	return cfg
+}
+
+// unknownConfigKeys lists the keys of a JSON object that no Config field
+// would receive, with nested struct keys written as "Thresh.top2".
+func unknownConfigKeys(data []byte) ([]string, error) {
+	var raw map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	var unknown []string
+	collectUnknownKeys(raw, reflect.TypeOf(Config{}), "", &unknown)
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+func collectUnknownKeys(raw map[string]json.RawMessage, t reflect.Type, prefix string, out *[]string) {
+	for key, val := range raw {
+		f, ok := jsonField(t, key)
+		if !ok {
+			*out = append(*out, prefix+key)
+			continue
+		}
+		if f.Type.Kind() != reflect.Struct || f.Type.PkgPath() != t.PkgPath() {
+			continue
+		}
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(val, &nested) == nil {
+			collectUnknownKeys(nested, f.Type, prefix+f.Name+".", out)
+		}
+	}
+}
+
+// jsonField finds the exported field encoding/json would decode key into.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Validate reports every value that sanitizeConfig would silently replace,
+// all at once, so a hand-written config can be fixed in one pass.
+func (c Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	oneOf := func(name, v string, allowed ...string) {
+		for _, a := range allowed {
+			if v == a {
+				return
+			}
+		}
+		bad("%s: %q は使えません (%s)", name, v, strings.Join(allowed, " / "))
+	}
+
+	if c.MaxTopK < minTopK || c.MaxTopK > topKHardLimit {
+		bad("MaxTopK: %d は %d〜%d の範囲で指定してください", c.MaxTopK, minTopK, topKHardLimit)
+	} else if c.TopK < minTopK || c.TopK > c.MaxTopK {
+		bad("TopK: %d は %d〜%d (MaxTopK) の範囲で指定してください", c.TopK, minTopK, c.MaxTopK)
+	}
+	oneOf("Mode", c.Mode, ModeSeeded, ModeMixed, ModeSplit)
+	if c.WeightNDC < 0.5 || c.WeightNDC > 1.2 {
+		bad("WeightNDC: %.2f は 0.5〜1.2 の範囲で指定してください", c.WeightNDC)
+	}
+	if c.SeedBias < 0 || c.SeedBias > 0.2 {
+		bad("SeedBias: %.2f は 0〜0.2 の範囲で指定してください", c.SeedBias)
+	}
+	if c.MinScore < 0 || c.MinScore > 1 {
+		bad("MinScore: %.2f は 0〜1 の範囲で指定してください", c.MinScore)
+	}
+	for _, label := range sortedThresholdLabels(c.CategoryThresholds) {
+		if v := c.CategoryThresholds[label]; v < 0 || v > 1 {
+			bad("CategoryThresholds[%s]: %.2f は 0〜1 の範囲で指定してください", label, v)
+		}
+	}
+	if len(c.PostProcessCommand) > 0 && strings.TrimSpace(c.PostProcessCommand[0]) == "" {
+		bad("PostProcessCommand: 1要素目に実行するプログラムを指定してください")
+	}
+	for _, name := range invalidOutputColumns(c.OutputColumns, c.OutputHeaders) {
+		bad("OutputColumns: %q は使えません (%s)", name, strings.Join(outputColumnNames, ", "))
+	}
+	if c.SubstringBoost < 0 || c.SubstringBoost > 0.3 {
+		bad("SubstringBoost: %.2f は 0〜0.3 の範囲で指定してください", c.SubstringBoost)
+	}
+	if c.ClusterCfg.Threshold <= 0 || c.ClusterCfg.Threshold > 1 {
+		bad("ClusterCfg.Threshold: %.2f は 0 より大きく 1 以下で指定してください", c.ClusterCfg.Threshold)
+	}
+	oneOf("ClusterCfg.Linkage", c.ClusterCfg.Linkage, LinkageSingle, LinkageAverage, LinkageComplete)
+	oneOf("ClusterCfg.Algorithm", c.ClusterCfg.Algorithm, ClusterGreedy, ClusterAgglomerative)
+	if c.Thresh.Top1 <= 0 || c.Thresh.Top1 > 1 {
+		bad("Thresh.Top1: %.2f は 0 より大きく 1 以下で指定してください", c.Thresh.Top1)
+	}
+	if c.Thresh.Margin12 < 0 {
+		bad("Thresh.Margin12: %.2f は 0 以上で指定してください", c.Thresh.Margin12)
+	}
+	if c.Thresh.Mean <= 0 || c.Thresh.Mean > 1 {
+		bad("Thresh.Mean: %.2f は 0 より大きく 1 以下で指定してください", c.Thresh.Mean)
+	}
+	if c.MixedCombine != "" {
+		oneOf("MixedCombine", c.MixedCombine, MixedCombineSeparate, MixedCombineMax, MixedCombineSum)
+	}
+	oneOf("NoCandidate", c.NoCandidate, NoCandidateSilent, NoCandidateUnclassified, NoCandidateError)
+	oneOf("NDCIndex", c.NDCIndex, NDCIndexMemory, NDCIndexHNSW, NDCIndexExternal)
+	if c.NDCIndex == NDCIndexExternal && strings.TrimSpace(c.ExternalIndexURL) == "" {
+		bad("ExternalIndexURL: NDCIndex が %q のときは指定してください", NDCIndexExternal)
+	}
+	if c.HNSWEfSearch <= 0 {
+		bad("HNSWEfSearch: %d は 1 以上で指定してください", c.HNSWEfSearch)
+	}
+	oneOf("TieBreak", c.TieBreak, TieBreakHash, TieBreakLabel, TieBreakInsertion)
+	oneOf("Metric", c.Metric, MetricCosine, MetricDot, MetricEuclidean)
+	oneOf("InputEncoding", c.InputEncoding, EncodingAuto, EncodingUTF8, EncodingShiftJIS, EncodingEUCJP)
+	if c.CategoryEncoding != "" {
+		oneOf("CategoryEncoding", c.CategoryEncoding, EncodingAuto, EncodingUTF8, EncodingShiftJIS, EncodingEUCJP)
+	}
+	oneOf("Pooling", c.Pooling, emb.PoolingMean, emb.PoolingMax, emb.PoolingCLS)
+	oneOf("OutputDelimiter", canonicalOutputDelimiter(c.OutputDelimiter), ",", "\t", ";")
+	if err := validateOutputTemplate(c.OutputTemplate); err != nil {
+		bad("OutputTemplate: %v", err)
+	}
+	if c.DedupeThreshold < 0 || c.DedupeThreshold > 1 {
+		bad("DedupeThreshold: %.2f は 0〜1 の範囲で指定してください", c.DedupeThreshold)
+	}
+	if c.MatrixTopN < 0 {
+		bad("MatrixTopN: %d は 0 以上で指定してください", c.MatrixTopN)
+	}
+	if c.BatchSize < 1 {
+		bad("BatchSize: %d は 1 以上で指定してください", c.BatchSize)
+	}
+	if c.MemCacheEntries < 0 {
+		bad("MemCacheEntries: %d は 0 以上で指定してください (0 で無制限)", c.MemCacheEntries)
+	}
+	if c.EmbedWorkers < 1 {
+		bad("EmbedWorkers: %d は 1 以上で指定してください", c.EmbedWorkers)
+	}
+	if c.EmbedMaxRetries < 0 {
+		bad("EmbedMaxRetries: %d は 0 以上で指定してください", c.EmbedMaxRetries)
+	}
+	if c.EmbedRetryDelay < 0 {
+		bad("EmbedRetryDelay: 負の値は指定できません")
+	}
+	oneOf("ExecutionProvider", c.ExecutionProvider, emb.ProviderCPU, emb.ProviderCUDA, emb.ProviderDirectML)
+	if c.DeviceID < 0 {
+		bad("DeviceID: %d は 0 以上で指定してください", c.DeviceID)
+	}
+	if c.MaxRuntime < 0 {
+		bad("MaxRuntime: 負の値は指定できません")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package app
+
+import "context"
+
+// dedupeExact keeps the first occurrence of each input whose normalized text
+// (NFKC, collapsed whitespace, lower case) repeats. keep holds the indices of
+// the kept inputs and owner[i] the position in keep that input i was folded
+// into. Empty inputs are never merged, so KeepEmptyRows still lines up with
+// the source.
+func dedupeExact(texts []string) (keep []int, owner []int) {
+	first := make(map[string]int, len(texts))
+	owner = make([]int, len(texts))
+	for i, t := range texts {
+		key := normalizeKey(t)
+		if key != "" {
+			if j, ok := first[key]; ok {
+				owner[i] = j
+				continue
+			}
+			first[key] = len(keep)
+		}
+		owner[i] = len(keep)
+		keep = append(keep, i)
+	}
+	return keep, owner
+}
+
+// DedupeInputs returns the indices of the inputs to classify and, for every
+// input, the position in that list of the input it was folded into.
+// Exact duplicates are folded before anything is embedded. With threshold > 0
+// the remaining inputs are embedded (the vectors stay cached for the
+// classification that follows) and an input whose cosine similarity to an
+// earlier kept one reaches threshold is folded into it as well.
+func (s *Service) DedupeInputs(ctx context.Context, texts []string, threshold float32) ([]int, []int, error) {
+	keep, owner := dedupeExact(texts)
+	if threshold <= 0 || len(keep) < 2 {
+		return keep, owner, nil
+	}
+
+	prepared := make([]string, len(keep))
+	for i, idx := range keep {
+		prepared[i] = s.prepareText(texts[idx])
+	}
+	nonEmpty := make([]string, 0, len(prepared))
+	for _, p := range prepared {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	embedded, err := s.EmbedBatchCached(ctx, nonEmpty)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type kept struct {
+		pos  int // keep 上の位置
+		vec  []float32
+		norm float32
+	}
+	var reps []kept
+	merged := make([]int, len(keep)) // 統合先の keep 上の位置。自分自身なら -1
+	next := 0
+	for i, p := range prepared {
+		merged[i] = -1
+		if p == "" {
+			continue
+		}
+		vec := embedded[next]
+		next++
+		norm := vecNorm(vec)
+		for _, r := range reps {
+			if len(r.vec) == len(vec) && cosineWithNorm(vec, norm, r.vec, r.norm) >= threshold {
+				merged[i] = r.pos
+				break
+			}
+		}
+		if merged[i] < 0 {
+			reps = append(reps, kept{pos: i, vec: vec, norm: norm})
+		}
+	}
+
+	outKeep := make([]int, 0, len(keep))
+	outPos := make([]int, len(keep)) // keep 上の位置 → outKeep 上の位置
+	for i, idx := range keep {
+		if to := merged[i]; to >= 0 {
+			outPos[i] = outPos[to]
+			continue
+		}
+		outPos[i] = len(outKeep)
+		outKeep = append(outKeep, idx)
+	}
+	for i, o := range owner {
+		owner[i] = outPos[o]
+	}
+	return outKeep, owner, nil
+}
+
+// dedupeCounts returns how many inputs each of the n kept rows stands for.
+func dedupeCounts(owner []int, n int) []int {
+	counts := make([]int, n)
+	for _, o := range owner {
+		counts[o]++
+	}
+	return counts
+}
+
+// expandDedupedRows returns one row per original input, repeating the row of
+// the kept input each one was folded into. owner == nil returns rows as is.
+func expandDedupedRows(rows []ResultRow, owner []int) []ResultRow {
+	if owner == nil {
+		return rows
+	}
+	out := make([]ResultRow, len(owner))
+	for i, o := range owner {
+		if o < len(rows) {
+			out[i] = rows[o]
+		}
+	}
+	return out
+}
+
+// selectStrings returns items[i] for each i in idx.
+func selectStrings(items []string, idx []int) []string {
+	out := make([]string, len(idx))
+	for i, j := range idx {
+		out[i] = items[j]
+	}
+	return out
+}
+
+// setDuplicateCounts records on each row how many further inputs were
+// folded into it by DedupeInputs.
+func setDuplicateCounts(rows []ResultRow, counts []int) {
+	for i := range rows {
+		if i < len(counts) && counts[i] > 1 {
+			rows[i].Duplicates = counts[i] - 1
+		}
+	}
+}
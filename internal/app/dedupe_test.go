@@ -0,0 +1,70 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeExactOwner(t *testing.T) {
+	tests := []struct {
+		name     string
+		texts    []string
+		keep     []int
+		owner    []int
+		counts   []int
+		expanded []string
+	}{
+		{
+			name:     "no duplicates",
+			texts:    []string{"a", "b"},
+			keep:     []int{0, 1},
+			owner:    []int{0, 1},
+			counts:   []int{1, 1},
+			expanded: []string{"a", "b"},
+		},
+		{
+			name:     "case and width variants fold",
+			texts:    []string{"ＡＢ", "x", "ab", "", ""},
+			keep:     []int{0, 1, 3, 4},
+			owner:    []int{0, 1, 0, 2, 3},
+			counts:   []int{2, 1, 1, 1},
+			expanded: []string{"ＡＢ", "x", "ＡＢ", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, owner := dedupeExact(tt.texts)
+			if !reflect.DeepEqual(keep, tt.keep) || !reflect.DeepEqual(owner, tt.owner) {
+				t.Fatalf("keep=%v owner=%v, want keep=%v owner=%v", keep, owner, tt.keep, tt.owner)
+			}
+			counts := dedupeCounts(owner, len(keep))
+			if !reflect.DeepEqual(counts, tt.counts) {
+				t.Errorf("counts = %v, want %v", counts, tt.counts)
+			}
+			rows := make([]ResultRow, len(keep))
+			for i, idx := range keep {
+				rows[i] = ResultRow{Text: tt.texts[idx]}
+			}
+			out := expandDedupedRows(rows, owner)
+			got := make([]string, len(out))
+			for i, r := range out {
+				got[i] = r.Text
+			}
+			if !reflect.DeepEqual(got, tt.expanded) {
+				t.Errorf("expanded = %q, want %q", got, tt.expanded)
+			}
+		})
+	}
+}
+
+func TestSummarizeResultsCountsDuplicates(t *testing.T) {
+	rows := []ResultRow{
+		{Suggestions: []Suggestion{{Label: "A"}}, Duplicates: 2},
+		{Suggestions: []Suggestion{{Label: "B"}}},
+		{Suggestions: []Suggestion{{Label: "A"}}, Pending: true},
+	}
+	want := map[string]int{"A": 3, "B": 1}
+	if got := SummarizeResults(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("SummarizeResults = %v, want %v", got, want)
+	}
+}
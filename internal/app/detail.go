@@ -0,0 +1,179 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// keywordSnippetRunes は一致箇所の前後に表示する文字数。
+const keywordSnippetRunes = 12
+
+// keywordKindLabels は KeywordSpan.Kind の表示名。
+var keywordKindLabels = map[string]string{
+	keywordStrong: "強",
+	keywordWeak:   "弱",
+	keywordAnti:   "除外",
+}
+
+// markdownEscaper escapes characters that RichText markdown would interpret.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "#", `\#`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "|", `\|`,
+)
+
+// highlightKeywords renders text as markdown with every keyword span in bold.
+// Overlapping spans are merged so the markup stays balanced.
+func highlightKeywords(text string, spans []KeywordSpan) string {
+	type rng struct{ start, end int }
+	ranges := make([]rng, 0, len(spans))
+	for _, sp := range spans {
+		if sp.Start < 0 || sp.End > len(text) || sp.Start >= sp.End {
+			continue
+		}
+		ranges = append(ranges, rng{sp.Start, sp.End})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(ranges); i++ {
+		cur := ranges[i]
+		for i+1 < len(ranges) && ranges[i+1].start <= cur.end {
+			if ranges[i+1].end > cur.end {
+				cur.end = ranges[i+1].end
+			}
+			i++
+		}
+		if cur.start < pos {
+			cur.start = pos
+		}
+		b.WriteString(markdownEscaper.Replace(text[pos:cur.start]))
+		b.WriteString("**")
+		b.WriteString(markdownEscaper.Replace(text[cur.start:cur.end]))
+		b.WriteString("**")
+		pos = cur.end
+	}
+	b.WriteString(markdownEscaper.Replace(text[pos:]))
+	return b.String()
+}
+
+// buildRowDetailMarkdown は結果1行の詳細 (一致キーワードを強調した本文と候補一覧) を markdown で返す。
+func buildRowDetailMarkdown(r ResultRow, sourceLabels map[string]string) string {
+	var b strings.Builder
+	b.WriteString("**本文**\n\n")
+	text := r.Normalized
+	if text == "" {
+		text = r.Text
+	}
+	b.WriteString(highlightKeywords(text, r.KeywordSpans))
+	b.WriteString("\n\n")
+	if r.Duplicates > 0 {
+		fmt.Fprintf(&b, "同じ内容の入力をほかに %d件まとめています\n\n", r.Duplicates)
+	}
+
+	if len(r.KeywordSpans) > 0 {
+		b.WriteString("**一致キーワード**\n\n")
+		byCat := keywordsByCategory(r.KeywordSpans)
+		for _, cat := range byCat.order {
+			fmt.Fprintf(&b, "%s (ルール加点 %+.3f)\n\n", markdownEscaper.Replace(cat), r.RuleBonus[cat])
+			for _, sp := range byCat.spans[cat] {
+				kind := keywordKindLabels[sp.Kind]
+				if kind == "" {
+					kind = sp.Kind
+				}
+				fmt.Fprintf(&b, "- %s: %s 「%s」\n", kind, markdownEscaper.Replace(sp.Keyword), keywordSnippet(text, sp))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(r.Suggestions) > 0 {
+		if bd, ok := r.Debug[r.Suggestions[0].Label]; ok {
+			writeScoreBreakdown(&b, r.Suggestions[0].Label, bd, sourceLabels)
+		}
+	}
+
+	b.WriteString("**候補**\n\n")
+	if len(r.Suggestions) == 0 {
+		b.WriteString("候補なし\n")
+	}
+	for i, s := range r.Suggestions {
+		// 最終スコアの隣に重み・ルール加点を掛ける前の類似度を出す
+		fmt.Fprintf(&b, "%d. %s %.3f (類似度 %.3f / %s)\n", i+1, markdownEscaper.Replace(suggestionLabel(s)), s.Score, s.RawScore, markdownEscaper.Replace(displaySource(s.Source, sourceLabels)))
+	}
+	return b.String()
+}
+
+func writeScoreBreakdown(b *strings.Builder, label string, bd ScoreBreakdown, sourceLabels map[string]string) {
+	fmt.Fprintf(b, "**スコア内訳 (1位: %s / %s)**\n\n", markdownEscaper.Replace(label), markdownEscaper.Replace(displaySource(bd.Source, sourceLabels)))
+	fmt.Fprintf(b, "- コサイン類似度: %.3f\n", bd.Cosine)
+	fmt.Fprintf(b, "- 重み: %.2f\n", bd.Weight)
+	fmt.Fprintf(b, "- 重み付け後: %.3f\n", bd.Base)
+	if bd.RuleBonus != 0 {
+		fmt.Fprintf(b, "- ルール加点: %+.3f\n", bd.RuleBonus)
+	}
+	if other := bd.Final - bd.Base - bd.RuleBonus; other > 0.0005 || other < -0.0005 {
+		fmt.Fprintf(b, "- その他 (バイアス・部分一致など): %+.3f\n", other)
+	}
+	fmt.Fprintf(b, "- 最終スコア: %.3f\n\n", bd.Final)
+}
+
+type categoryKeywords struct {
+	order []string // 最初に一致した順のカテゴリ
+	spans map[string][]KeywordSpan
+}
+
+// keywordsByCategory groups spans by category, strong keywords first, then
+// weak, then anti, each in text order.
+func keywordsByCategory(spans []KeywordSpan) categoryKeywords {
+	out := categoryKeywords{spans: make(map[string][]KeywordSpan)}
+	for _, sp := range spans {
+		if _, ok := out.spans[sp.Category]; !ok {
+			out.order = append(out.order, sp.Category)
+		}
+		out.spans[sp.Category] = append(out.spans[sp.Category], sp)
+	}
+	rank := map[string]int{keywordStrong: 0, keywordWeak: 1, keywordAnti: 2}
+	for _, list := range out.spans {
+		sort.SliceStable(list, func(i, j int) bool {
+			if rank[list[i].Kind] != rank[list[j].Kind] {
+				return rank[list[i].Kind] < rank[list[j].Kind]
+			}
+			return list[i].Start < list[j].Start
+		})
+	}
+	return out
+}
+
+// keywordSnippet renders the matched part of text in bold with up to
+// keywordSnippetRunes characters of context on each side.
+func keywordSnippet(text string, sp KeywordSpan) string {
+	if sp.Start < 0 || sp.End > len(text) || sp.Start >= sp.End {
+		return markdownEscaper.Replace(sp.Keyword)
+	}
+	from := sp.Start
+	for i := 0; i < keywordSnippetRunes && from > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(text[:from])
+		from -= size
+	}
+	to := sp.End
+	for i := 0; i < keywordSnippetRunes && to < len(text); i++ {
+		_, size := utf8.DecodeRuneInString(text[to:])
+		to += size
+	}
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(markdownEscaper.Replace(text[from:sp.Start]))
+	b.WriteString("**")
+	b.WriteString(markdownEscaper.Replace(text[sp.Start:sp.End]))
+	b.WriteString("**")
+	b.WriteString(markdownEscaper.Replace(text[sp.End:to]))
+	if to < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
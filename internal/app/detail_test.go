@@ -0,0 +1,25 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildRowDetailMarkdownRawScore(t *testing.T) {
+	row := ResultRow{
+		Text: "りんご",
+		Suggestions: []Suggestion{
+			{Label: "果物", Score: 0.912, RawScore: 0.734, Source: "seed"},
+			{Label: "野菜", Score: 0.5, RawScore: 0.5, Source: "ndc"},
+		},
+	}
+	md := buildRowDetailMarkdown(row, map[string]string{"seed": "カテゴリ", "ndc": "NDC"})
+	for _, want := range []string{
+		"1. 果物 0.912 (類似度 0.734 / カテゴリ)",
+		"2. 野菜 0.500 (類似度 0.500 / NDC)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("detail lacks %q:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// sessionEncoder は hashEncoder に複数セッションを持つふりをさせ、
+// EmbedBatchCached のワーカー並列を動かす。hashEncoder は状態を持たないので
+// 同時に呼んでも安全。
+type sessionEncoder struct {
+	hashEncoder
+	sessions int
+}
+
+func (e sessionEncoder) Sessions() int { return e.sessions }
+
+// newEmbedTestService builds a bare Service for EmbedBatchCached with the
+// given worker count and batch size. cacheDir may be empty for memory only.
+func newEmbedTestService(workers, batchSize int, cacheDir string) *Service {
+	cfg := sanitizeConfig(defaultConfig())
+	cfg.EmbedWorkers = workers
+	cfg.BatchSize = batchSize
+	cfg.CacheDir = cacheDir
+	return &Service{cfg: cfg, emb: sessionEncoder{hashEncoder{dim: 64}, workers}, cache: newEmbedCache(cacheDir, "hash-64")}
+}
+
+func TestEmbedBatchCachedParallelMatchesSequential(t *testing.T) {
+	texts := syntheticBenchTexts(97)
+	// 重複は最初の位置でだけ埋め込まれ、すべての位置に同じベクトルが入る
+	texts = append(texts, texts[3], texts[50], texts[3])
+	want, err := newEmbedTestService(1, 1, "").EmbedBatchCached(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		workers, batchSize int
+		disk               bool
+	}{
+		{1, 8, false},
+		{2, 1, false},
+		{4, 8, false},
+		{8, 5, false},
+		{16, 32, false}, // チャンク数よりワーカーが多い
+		{4, 8, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("workers=%d/batch=%d/disk=%v", tt.workers, tt.batchSize, tt.disk), func(t *testing.T) {
+			dir := ""
+			if tt.disk {
+				dir = t.TempDir()
+			}
+			svc := newEmbedTestService(tt.workers, tt.batchSize, dir)
+			got, err := svc.EmbedBatchCached(context.Background(), texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("parallel output differs from sequential")
+			}
+			if !tt.disk {
+				return
+			}
+			// ディスクから読み直しても同じ並び
+			svc.cache.clear(false)
+			got, err = svc.EmbedBatchCached(context.Background(), texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("output read back from disk differs from sequential")
+			}
+		})
+	}
+}
+
+func BenchmarkEmbedBatchCached(b *testing.B) {
+	texts := syntheticBenchTexts(512)
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				svc := newEmbedTestService(workers, 32, "")
+				if _, err := svc.EmbedBatchCached(context.Background(), texts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textEncoding is the encoding an input file was actually read with, so
+// output derived from it can be written back the same way.
+type textEncoding struct {
+	name string // EncodingUTF8 / EncodingShiftJIS / EncodingEUCJP
+	bom  bool   // 先頭に UTF-8 BOM があった
+}
+
+// detectEncoding resolves enc for data the way decodeInput does, turning
+// auto into the encoding that was chosen.
+func detectEncoding(data []byte, enc string) textEncoding {
+	switch name := strings.ToLower(strings.TrimSpace(enc)); name {
+	case "", EncodingAuto:
+		if utf8.Valid(data) {
+			return textEncoding{name: EncodingUTF8, bom: bytes.HasPrefix(data, utf8BOM)}
+		}
+		return textEncoding{name: EncodingShiftJIS}
+	case EncodingUTF8:
+		return textEncoding{name: EncodingUTF8, bom: bytes.HasPrefix(data, utf8BOM)}
+	default:
+		return textEncoding{name: name}
+	}
+}
+
+// encodeOutput wraps w so UTF-8 written to it is stored in te. Characters
+// that Shift_JIS/EUC-JP cannot represent are written as "?" rather than
+// failing the whole export. The returned flush must be called after the
+// last write.
+func encodeOutput(w io.Writer, te textEncoding) (io.Writer, func() error, error) {
+	var enc *encoding.Encoder
+	switch te.name {
+	case "", EncodingUTF8:
+		if te.bom {
+			if _, err := w.Write(utf8BOM); err != nil {
+				return nil, nil, err
+			}
+		}
+		return w, func() error { return nil }, nil
+	case EncodingShiftJIS:
+		enc = japanese.ShiftJIS.NewEncoder()
+	case EncodingEUCJP:
+		enc = japanese.EUCJP.NewEncoder()
+	default:
+		return nil, nil, fmt.Errorf("未対応の文字コードです: %s", te.name)
+	}
+	tw := transform.NewWriter(w, encoding.ReplaceUnsupported(enc))
+	return tw, tw.Close, nil
+}
+
+// decodeInput converts data to UTF-8. In auto mode, data that is not valid
+// UTF-8 is assumed to be Shift_JIS (CP932), the usual encoding of CSVs saved
+// from Japanese Excel. A leading UTF-8 BOM is removed.
+func decodeInput(data []byte, enc string) ([]byte, error) {
+	var dec *encoding.Decoder
+	switch strings.ToLower(strings.TrimSpace(enc)) {
+	case "", EncodingAuto:
+		if utf8.Valid(data) {
+			return bytes.TrimPrefix(data, utf8BOM), nil
+		}
+		dec = japanese.ShiftJIS.NewDecoder()
+	case EncodingUTF8:
+		return bytes.TrimPrefix(data, utf8BOM), nil
+	case EncodingShiftJIS:
+		dec = japanese.ShiftJIS.NewDecoder()
+	case EncodingEUCJP:
+		dec = japanese.EUCJP.NewDecoder()
+	default:
+		return nil, fmt.Errorf("未対応の文字コードです: %s", enc)
+	}
+	out, err := dec.Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("文字コードを変換できません (%s): %w", enc, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,316 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// goldHeaderNames は評価用入力の正解ラベル列として認識する見出し。
+var goldHeaderNames = []string{"gold", "answer", "expected", "正解", "正解ラベル"}
+
+// EvalOptions configures Evaluate.
+type EvalOptions struct {
+	InputPath    string  // 本文列と正解列を持つ CSV/TSV (.gz 可)
+	TextColumn   string  // 見出し名または1始まりの列番号。空なら見出しから推定 (無ければ1列目)
+	GoldColumn   string  // 同上。空なら goldHeaderNames から推定
+	CategoryPath string  // カテゴリファイル (.txt/.csv/.tsv/.yaml)。空なら Config.SeedFile
+	Mode         string  // 空なら既定のランキングモード
+	WeightNDC    float32 // 0 なら既定値
+	RowsOut      string  // 指定すると行ごとの正誤を CSV で出力する
+
+	ConfigPath         string // 設定ファイル (JSON)。空なら既定値
+	ConfigOverridePath string // ConfigPath の上に重ねる設定ファイル。書いた項目だけを上書きする
+	StrictConfig       bool   // 設定ファイルの不明な項目・不正な値をエラーにする
+}
+
+// evalStats accumulates accuracy counters for one category (or overall).
+type evalStats struct {
+	Count int
+	Top1  int
+	TopK  int
+	RR    float64
+}
+
+func (s *evalStats) add(rank, topK int) {
+	s.Count++
+	if rank == 1 {
+		s.Top1++
+	}
+	if rank > 0 && rank <= topK {
+		s.TopK++
+	}
+	if rank > 0 {
+		s.RR += 1 / float64(rank)
+	}
+}
+
+func (s evalStats) rate(n int) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(n) / float64(s.Count)
+}
+
+// Evaluate classifies a labeled input file and writes top-1 accuracy,
+// top-k accuracy and MRR@k, overall and per gold category, to w. Ranks are
+// taken from the displayed suggestions (Suggestions, up to TopK), so the
+// result reflects the configured mode and NDC weighting.
+func Evaluate(opts EvalOptions, w io.Writer) error {
+	cfg, err := LoadConfigFiles(opts.StrictConfig, opts.ConfigPath, opts.ConfigOverridePath)
+	if err != nil {
+		return err
+	}
+	if opts.Mode != "" {
+		cfg.Mode = opts.Mode
+	}
+	if opts.WeightNDC > 0 {
+		cfg.WeightNDC = opts.WeightNDC
+	}
+	ensureDirs(cfg.CacheDir)
+	ensureCategoryRuleFile(cfg.CategoryRuleFile, rawCategoryRules)
+
+	records, err := readEvalRecords(opts.InputPath, inputSource(cfg))
+	if err != nil {
+		return err
+	}
+	header := records[0]
+	textCol, textByName, err := resolveEvalColumn(header, opts.TextColumn, detectTextColumn(header))
+	if err != nil {
+		return err
+	}
+	goldCol, goldByName, err := resolveEvalColumn(header, opts.GoldColumn, detectHeaderColumn(header, goldHeaderNames))
+	if err != nil {
+		return err
+	}
+	if goldCol < 0 {
+		return errors.New("正解ラベル列が見つかりません (-gold で列名か列番号を指定してください)")
+	}
+	if textCol < 0 {
+		textCol = 0
+	}
+	hasHeader := textByName || goldByName
+	texts := extractCSVColumns(records, []int{textCol}, hasHeader, cfg.KeepEmptyRows)
+	golds := extractAlignedColumn(records, []int{textCol}, goldCol, hasHeader, cfg.KeepEmptyRows)
+	if len(texts) == 0 {
+		return errors.New("評価する行がありません")
+	}
+
+	if opts.CategoryPath != "" {
+		if cfg, err = withFileThresholds(cfg, opts.CategoryPath); err != nil {
+			return err
+		}
+	}
+	svc, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+	cfg = svc.Config()
+
+	ctx := context.Background()
+	if opts.CategoryPath != "" {
+		specs, err := loadEvalCategories(opts.CategoryPath, categorySource(cfg))
+		if err != nil {
+			return err
+		}
+		if _, err := svc.LoadCategorySpecs(ctx, specs); err != nil {
+			return err
+		}
+	}
+
+	rows, err := svc.ClassifyAll(ctx, texts, nil)
+	if err != nil {
+		return err
+	}
+
+	var total evalStats
+	perCat := make(map[string]*evalStats)
+	ranks := make([]int, len(rows))
+	for i, r := range rows {
+		gold := normalize(golds[i])
+		if gold == "" {
+			continue
+		}
+		rank := suggestionRank(r.Suggestions, gold)
+		ranks[i] = rank
+		total.add(rank, cfg.TopK)
+		st, ok := perCat[gold]
+		if !ok {
+			st = &evalStats{}
+			perCat[gold] = st
+		}
+		st.add(rank, cfg.TopK)
+	}
+	if total.Count == 0 {
+		return errors.New("正解ラベルのある行がありません")
+	}
+	if err := writeEvalSummary(w, cfg, total, perCat); err != nil {
+		return err
+	}
+	if opts.RowsOut != "" {
+		if err := writeEvalRows(opts.RowsOut, rows, golds, ranks); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n行ごとの結果を %s に出力しました\n", opts.RowsOut)
+	}
+	return nil
+}
+
+// readEvalRecords reads a CSV/TSV/xlsx file (optionally .gz) with the
+// encoding and sheet of src.
+func readEvalRecords(path string, src tableSource) ([][]string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, name, err := readInputData(f, path, src.encoding)
+	if err != nil {
+		return nil, err
+	}
+	records, _, err := readTableRecords(data, name, src.sheet)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("入力が空です (%s)", path)
+	}
+	return records, nil
+}
+
+// resolveEvalColumn turns a header name or 1-based column number into a
+// column index. An empty spec returns detected. byName reports whether the
+// column was found through the header row.
+func resolveEvalColumn(header []string, spec string, detected int) (int, bool, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return detected, detected >= 0, nil
+	}
+	if idx := detectHeaderColumn(header, []string{strings.ToLower(normalize(spec))}); idx >= 0 {
+		return idx, true, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return -1, false, fmt.Errorf("列が見つかりません: %s", spec)
+	}
+	return n - 1, false, nil
+}
+
+// loadEvalCategories reads a category file (YAML, CSV/TSV/xlsx or plain
+// text) with the encoding and sheet of src.
+func loadEvalCategories(path string, src tableSource) ([]CategorySpec, error) {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	if ext == ".yaml" || ext == ".yml" {
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+		return parseCategoryYAML(data)
+	}
+	if ext == ".csv" || ext == ".tsv" || ext == ".xlsx" {
+		records, err := readEvalRecords(path, src)
+		if err != nil {
+			return nil, err
+		}
+		col, weightCol, hasHeader := resolveCategoryColumn(records)
+		seeds := collectCategoryColumns(records, []int{col}, weightCol, hasHeader)
+		specs := make([]CategorySpec, len(seeds))
+		for i, sd := range seeds {
+			specs[i] = CategorySpec{Label: sd.Label, Weight: sd.Weight}
+		}
+		return specs, nil
+	}
+	labels, err := loadCategorySeedFile(path, src.encoding)
+	if err != nil {
+		return nil, err
+	}
+	return labelSpecs(labels), nil
+}
+
+// resolveCategoryColumn picks the category column of a category CSV/TSV/xlsx:
+// the column under a category header, else the guessed one, else the first.
+// weightCol is the column under a weight header, or -1.
+func resolveCategoryColumn(records [][]string) (col, weightCol int, hasHeader bool) {
+	col = detectHeaderColumn(records[0], categoryHeaderNames)
+	hasHeader = col >= 0
+	if col < 0 {
+		col = guessCategoryColumn(records, hasHeader)
+	}
+	if col < 0 {
+		col = 0
+	}
+	weightCol = -1
+	if hasHeader {
+		weightCol = detectHeaderColumn(records[0], weightHeaderNames)
+	}
+	return col, weightCol, hasHeader
+}
+
+// suggestionRank returns the 1-based position of label (or one of a
+// suggestion's aliases) in sugs, or 0 when it is absent.
+func suggestionRank(sugs []Suggestion, label string) int {
+	key := normalizeKey(label)
+	for i, s := range sugs {
+		if normalizeKey(s.Label) == key {
+			return i + 1
+		}
+		for _, al := range s.Aliases {
+			if normalizeKey(al) == key {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func writeEvalSummary(w io.Writer, cfg Config, total evalStats, perCat map[string]*evalStats) error {
+	fmt.Fprintf(w, "モード:%s / Top-k:%d / NDC重み:%.2f / 件数:%d\n\n", cfg.Mode, cfg.TopK, cfg.WeightNDC, total.Count)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "カテゴリ\t件数\tTop-1\tTop-%d\tMRR@%d\n", cfg.TopK, cfg.TopK)
+	labels := make([]string, 0, len(perCat))
+	for lab := range perCat {
+		labels = append(labels, lab)
+	}
+	sort.Strings(labels)
+	row := func(name string, st evalStats) {
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.3f\t%.3f\n", name, st.Count, st.rate(st.Top1), st.rate(st.TopK), st.RR/float64(st.Count))
+	}
+	for _, lab := range labels {
+		row(lab, *perCat[lab])
+	}
+	row("(全体)", total)
+	return tw.Flush()
+}
+
+func writeEvalRows(path string, rows []ResultRow, golds []string, ranks []int) error {
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cw := csv.NewWriter(f)
+	if err := cw.Write([]string{"text", "gold", "predicted", "gold_rank", "top1_score", "correct"}); err != nil {
+		return err
+	}
+	for i, r := range rows {
+		correct := "no"
+		if ranks[i] == 1 {
+			correct = "yes"
+		}
+		record := []string{r.Text, golds[i], topLabel(r), strconv.Itoa(ranks[i]), fmt.Sprintf("%.3f", r.Top1Score), correct}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
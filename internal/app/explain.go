@@ -0,0 +1,186 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Explanation reports how one category scored for one input, including why
+// it did not make it into the suggestions.
+type Explanation struct {
+	Text   string
+	Label  string // 見つかったカテゴリ名 (別名で指定した場合も正式名)
+	Found  bool   // カテゴリ一覧 (項目または NDC) にある
+	Source string
+
+	Cosine    float32 // 重み付け前の類似度
+	Weight    float32 // カテゴリの重み / NDC 重み
+	RuleBonus float32
+	Final     float32 // 順位付けに使う最終スコア
+
+	Rank  int // 同じ種類 (項目 / NDC) の全カテゴリ中の順位。1 始まり、0 は対象外
+	Total int
+
+	Shown    bool    // 候補に表示された
+	Cutoff   float32 // 表示された最下位候補のスコア (候補なしなら 0)
+	Gap      float32 // Cutoff - Final。正なら足りない分
+	MinScore float32 // このカテゴリに適用される最低スコア
+
+	Reasons []string
+}
+
+// ExplainText classifies text like RankOne and reports where expectedLabel
+// ended up: its similarity, weight and rule bonus, its rank among all
+// categories, and how far it is from the last suggestion shown. The label
+// may also be given by one of its aliases.
+func (s *Service) ExplainText(ctx context.Context, text string, expectedLabel string) (Explanation, error) {
+	ex := Explanation{Text: text, Label: strings.TrimSpace(expectedLabel)}
+	row, err := s.RankOne(ctx, text)
+	if err != nil {
+		return ex, err
+	}
+	if row.Normalized == "" {
+		ex.Reasons = append(ex.Reasons, "入力が空のため分類されていません")
+		return ex, nil
+	}
+
+	s.mu.RLock()
+	cfg := s.cfg
+	catCands := append([]Candidate(nil), s.candsCat...)
+	ndcCands := append([]Candidate(nil), s.candsNDC...)
+	s.mu.RUnlock()
+
+	cand, ok := findExplainCandidate(catCands, ex.Label)
+	if !ok {
+		cand, ok = findExplainCandidate(ndcCands, ex.Label)
+	}
+	if !ok {
+		ex.Reasons = append(ex.Reasons, "カテゴリ一覧にありません (名前・別名とも一致しません)")
+		return ex, nil
+	}
+	ex.Found = true
+	ex.Label = cand.Label
+	ex.Source = cand.Source
+
+	vec, err := s.EmbedCached(ctx, row.Normalized)
+	if err != nil {
+		return ex, err
+	}
+	sim := metricFunc(cfg.Metric)
+	ex.Cosine = clamp01(candidateSimilarity(sim, vec, vecNorm(vec), cand))
+
+	scores := row.FinalScores
+	if cand.Source == "ndc" {
+		ex.Weight = cfg.WeightNDC
+		scores = row.NDCScores
+		if !ndcEnabled(cfg) {
+			ex.Reasons = append(ex.Reasons, "NDC 候補が無効のため計算されていません (ランキングモードを確認してください)")
+			return ex, nil
+		}
+	} else {
+		ex.Weight = candidateWeight(cand)
+		ex.RuleBonus = row.RuleBonus[cand.Label]
+	}
+	final, scored := scores[cand.Label]
+	if !scored && cand.Source == "ndc" && cfg.NDCIndex != NDCIndexMemory {
+		ex.Reasons = append(ex.Reasons, fmt.Sprintf("NDC の近似検索 (%s) で上位 %d件に入らなかったためスコアがありません", cfg.NDCIndex, len(scores)))
+		return ex, nil
+	}
+	if !scored {
+		ex.Reasons = append(ex.Reasons, "言語別の振り分けで対象外になりました (LanguageRouting)")
+		return ex, nil
+	}
+	ex.Final = final
+	ex.Total = len(scores)
+	ex.Rank = 1
+	for _, sc := range scores {
+		if sc > final {
+			ex.Rank++
+		}
+	}
+
+	// 分割表示のモードでは NDC 候補はカテゴリ候補とは別の列に並ぶ
+	shown, listName := row.Suggestions, "候補"
+	if cand.Source == "ndc" && separateNDC(cfg) {
+		shown, listName = row.NDCSuggestions, "NDC 候補"
+	}
+	for i, sug := range shown {
+		if sug.Label == cand.Label {
+			ex.Shown = true
+			ex.Reasons = append(ex.Reasons, fmt.Sprintf("%sの %d位に表示されています", listName, i+1))
+		}
+	}
+	if n := len(shown); n > 0 {
+		ex.Cutoff = shown[n-1].Score
+		ex.Gap = ex.Cutoff - final
+	}
+	if ex.Shown {
+		return ex, nil
+	}
+
+	ex.MinScore = cfg.MinScore
+	if v, ok := cfg.CategoryThresholds[cand.Label]; ok {
+		ex.MinScore = v
+	}
+	if final < ex.MinScore {
+		ex.Reasons = append(ex.Reasons, fmt.Sprintf("最終スコア %.3f が最低スコア %.2f 未満です", final, ex.MinScore))
+	}
+	if ex.Rank > cfg.TopK {
+		ex.Reasons = append(ex.Reasons, fmt.Sprintf("全%d件中 %d位で、上位 %d件に入っていません (表示の最下位まで %.3f 不足)", ex.Total, ex.Rank, cfg.TopK, ex.Gap))
+	}
+	if len(ex.Reasons) == 0 && cfg.ClusterCfg.Enabled {
+		ex.Reasons = append(ex.Reasons, "似た候補とまとめられた可能性があります (クラスタリング)")
+	}
+	if ex.Weight < 1 {
+		ex.Reasons = append(ex.Reasons, fmt.Sprintf("重み %.2f で類似度が下がっています", ex.Weight))
+	}
+	return ex, nil
+}
+
+// findExplainCandidate matches label against the candidates' names and
+// aliases after normalization.
+func findExplainCandidate(cands []Candidate, label string) (Candidate, bool) {
+	key := normalizeKey(label)
+	if key == "" {
+		return Candidate{}, false
+	}
+	for _, c := range cands {
+		if normalizeKey(c.Label) == key {
+			return c, true
+		}
+	}
+	for _, c := range cands {
+		for _, al := range c.Aliases {
+			if normalizeKey(al.Text) == key {
+				return c, true
+			}
+		}
+	}
+	return Candidate{}, false
+}
+
+func buildExplanationMarkdown(ex Explanation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n\n", markdownEscaper.Replace(ex.Label))
+	if ex.Found && ex.Rank > 0 {
+		fmt.Fprintf(&b, "- 類似度: %.3f\n", ex.Cosine)
+		fmt.Fprintf(&b, "- 重み: %.2f\n", ex.Weight)
+		if ex.RuleBonus != 0 {
+			fmt.Fprintf(&b, "- ルール加点: %+.3f\n", ex.RuleBonus)
+		}
+		fmt.Fprintf(&b, "- 最終スコア: %.3f\n", ex.Final)
+		fmt.Fprintf(&b, "- 順位: %d / %d\n", ex.Rank, ex.Total)
+		if !ex.Shown && ex.Cutoff > 0 {
+			fmt.Fprintf(&b, "- 表示の最下位との差: %.3f\n", ex.Gap)
+		}
+		b.WriteString("\n")
+	}
+	if len(ex.Reasons) > 0 {
+		b.WriteString("**理由**\n\n")
+		for _, r := range ex.Reasons {
+			fmt.Fprintf(&b, "- %s\n", markdownEscaper.Replace(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	exportFormatCSV      = "csv"
+	exportFormatJSON     = "json"
+	exportFormatJSONL    = "jsonl"
+	exportFormatTraining = "training"
+	exportFormatCategory = "bycategory"
+
+	// trainingFileSuffix で終わるファイル名は学習用 JSONL として出力する。
+	trainingFileSuffix = ".train.jsonl"
+	// categoryCSVSuffix / categoryTSVSuffix で終わるファイル名はカテゴリ別の入力一覧として出力する。
+	categoryCSVSuffix = ".bycat.csv"
+	categoryTSVSuffix = ".bycat.tsv"
+)
+
+// exportRecord is one exported row: the input position plus the full result.
+type exportRecord struct {
+	Index int `json:"index"`
+	ResultRow
+}
+
+// exportFormat picks the output format from the file name.
+func exportFormat(name string) string {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, trainingFileSuffix) {
+		return exportFormatTraining
+	}
+	if strings.HasSuffix(lower, categoryCSVSuffix) || strings.HasSuffix(lower, categoryTSVSuffix) {
+		return exportFormatCategory
+	}
+	if strings.HasSuffix(lower, matrixCSVSuffix) || strings.HasSuffix(lower, matrixTSVSuffix) {
+		return exportFormatMatrix
+	}
+	switch filepath.Ext(lower) {
+	case ".json":
+		return exportFormatJSON
+	case ".jsonl":
+		return exportFormatJSONL
+	default:
+		return exportFormatCSV
+	}
+}
+
+func exportRecords(rows []ResultRow) []exportRecord {
+	out := make([]exportRecord, len(rows))
+	for i, r := range rows {
+		out[i] = exportRecord{Index: i + 1, ResultRow: r}
+	}
+	return out
+}
+
+// writeResultsJSONL writes one JSON object per row so the output can be
+// streamed into jq or similar tools.
+func writeResultsJSONL(w io.Writer, rows []ResultRow) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range exportRecords(rows) {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResultsJSON writes all rows as a single JSON array.
+func writeResultsJSON(w io.Writer, rows []ResultRow) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(exportRecords(rows))
+}
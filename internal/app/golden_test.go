@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test ./internal/app -run TestGoldenRanking -update で期待値を作り直す。
+var updateGolden = flag.Bool("update", false, "testdata/golden の期待値を書き直す")
+
+// hashEncoder は文字の1-gram/2-gramをハッシュして次元に振り分ける決定的な
+// 埋め込み。モデル無しでランキング処理全体を動かすために使う。
+type hashEncoder struct{ dim int }
+
+func (h hashEncoder) Encode(text string) ([]float32, error) {
+	v := make([]float32, h.dim)
+	runes := []rune(text)
+	add := func(gram string, w float32) {
+		f := fnv.New32a()
+		f.Write([]byte(gram))
+		sum := f.Sum32()
+		if sum&1 == 1 {
+			w = -w
+		}
+		v[int(sum>>1)%h.dim] += w
+	}
+	for i, r := range runes {
+		add(string(r), 1)
+		if i+1 < len(runes) {
+			add(string(runes[i:i+2]), 2)
+		}
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		inv := float32(1 / math.Sqrt(norm))
+		for i := range v {
+			v[i] *= inv
+		}
+	}
+	return v, nil
+}
+
+func (h hashEncoder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i], _ = h.Encode(t)
+	}
+	return out, nil
+}
+
+func (hashEncoder) Sessions() int   { return 1 }
+func (hashEncoder) Backend() string { return "hash" }
+func (hashEncoder) Close()          {}
+
+// newTestService builds a Service on hashEncoder with the seeds and NDC
+// list under testdata. edit adjusts the configuration before loading.
+func newTestService(t *testing.T, edit func(*Config)) *Service {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.SeedFile = filepath.Join("testdata", "golden_seeds.txt")
+	cfg.NDCFile = filepath.Join("testdata", "golden_ndc.csv")
+	cfg.CategoryRuleFile = ""
+	cfg.ProfileFile = ""
+	cfg.CacheDir = ""
+	cfg.WarmUp = false
+	if edit != nil {
+		edit(&cfg)
+	}
+	svc, err := newService(sanitizeConfig(cfg), hashEncoder{dim: 256}, "hash-256", 0)
+	if err != nil {
+		t.Fatalf("newService: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	return svc
+}
+
+type goldenSuggestion struct {
+	Label  string
+	Source string
+	Score  string
+}
+
+type goldenRow struct {
+	Text        string
+	Suggestions []goldenSuggestion
+	NDC         []goldenSuggestion `json:",omitempty"`
+	NeedReview  bool
+}
+
+func goldenSuggestions(sugs []Suggestion) []goldenSuggestion {
+	out := make([]goldenSuggestion, 0, len(sugs))
+	for _, s := range sugs {
+		out = append(out, goldenSuggestion{Label: s.Label, Source: s.Source, Score: fmt.Sprintf("%.4f", s.Score)})
+	}
+	return out
+}
+
+func TestGoldenRanking(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "golden_inputs.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := splitInputLines(string(data), false)
+	tests := []struct {
+		name string
+		edit func(*Config)
+	}{
+		{"seeded", func(c *Config) { c.Mode = ModeSeeded }},
+		{"mixed", func(c *Config) { c.Mode = ModeMixed }},
+		{"split", func(c *Config) { c.Mode = ModeSplit }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, tt.edit)
+			rows, err := svc.ClassifyAll(context.Background(), inputs, nil)
+			if err != nil {
+				t.Fatalf("ClassifyAll: %v", err)
+			}
+			got := make([]goldenRow, len(rows))
+			for i, r := range rows {
+				got[i] = goldenRow{Text: r.Text, Suggestions: goldenSuggestions(r.Suggestions), NeedReview: r.NeedReview}
+				if len(r.NDCSuggestions) > 0 && separateNDC(svc.Config()) {
+					got[i].NDC = goldenSuggestions(r.NDCSuggestions)
+				}
+			}
+			out, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, '\n')
+			path := filepath.Join("testdata", "golden", tt.name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(path, out, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (-update で作成してください)", err)
+			}
+			if string(out) != strings.ReplaceAll(string(want), "\r\n", "\n") {
+				t.Errorf("%s の結果が期待値と異なります (意図した変更なら -update で更新):\n%s", tt.name, out)
+			}
+		})
+	}
+}
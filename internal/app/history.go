@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxHistoryRuns はセッション内で保持する分類実行の件数。古いものから破棄する。
+const maxHistoryRuns = 10
+
+// historyEntry is one finished classification run kept for read-only review.
+type historyEntry struct {
+	At     time.Time
+	Config Config
+	Rows   []ResultRow
+	Owner  []int      // 重複をまとめた場合の入力ごとの Rows 上の位置 (uiState.rowOwner)
+	Source *csvSource // 分類した入力の読込元 (uiState.rowSource)
+}
+
+func (e historyEntry) label() string {
+	return fmt.Sprintf("%s (%d件 / %s / Top-%d)", e.At.Format("15:04:05"), len(e.Rows), e.Config.Mode, e.Config.TopK)
+}
+
+// runHistory is a bounded, newest-first list of runs.
+type runHistory struct {
+	entries []historyEntry
+}
+
+func (h *runHistory) add(e historyEntry) {
+	h.entries = append([]historyEntry{e}, h.entries...)
+	if len(h.entries) > maxHistoryRuns {
+		h.entries = h.entries[:maxHistoryRuns]
+	}
+}
+
+func (h *runHistory) labels() []string {
+	out := make([]string, len(h.entries))
+	for i, e := range h.entries {
+		out[i] = e.label()
+	}
+	return out
+}
+
+func (h *runHistory) find(label string) (historyEntry, bool) {
+	for _, e := range h.entries {
+		if e.label() == label {
+			return e, true
+		}
+	}
+	return historyEntry{}, false
+}
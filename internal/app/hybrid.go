@@ -1,7 +1,6 @@
 package app
 
 import (
-	"sort"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -380,19 +379,24 @@ const (
 	dampValue     float32 = 0.03
 )
 
-func computeBaseScores(vec []float32, cands []Candidate) map[string]float32 {
+// computeBaseScores returns the weighted base score per category and the
+// raw (unweighted, clamped) cosine similarity.
+func computeBaseScores(vec []float32, cands []Candidate, sim similarityFunc) (map[string]float32, map[string]float32) {
 	scores := make(map[string]float32, len(cands))
+	raw := make(map[string]float32, len(cands))
+	qNorm := vecNorm(vec)
 	for _, c := range cands {
-		sc := cosine32(vec, c.Vec)
+		sc := candidateSimilarity(sim, vec, qNorm, c)
 		if sc < 0 {
 			sc = 0
 		}
-		scores[c.Label] = clamp01(sc)
+		raw[c.Label] = clamp01(sc)
+		scores[c.Label] = clamp01(sc * candidateWeight(c))
 	}
-	return scores
+	return scores, raw
 }
 
-func applyHybridScoring(text string, cands []Candidate, baseScores map[string]float32, seedBias float32, rules map[string]compiledRuleSet) ([]Suggestion, map[string]float32, map[string]float32) {
+func applyHybridScoring(text string, cands []Candidate, baseScores map[string]float32, seedBias, substringBoost float32, tieBreak string, rules map[string]compiledRuleSet, stripPunct bool) ([]Suggestion, map[string]float32, map[string]float32, []KeywordSpan) {
 	ruleBonus := make(map[string]float32, len(cands))
 	finalScores := make(map[string]float32, len(cands))
 
@@ -400,6 +404,7 @@ func applyHybridScoring(text string, cands []Candidate, baseScores map[string]fl
 		rules = defaultCompiledCategoryRules
 	}
 
+	var matched []KeywordSpan
 	hasVRSignal := false
 	for _, c := range cands {
 		base := baseScores[c.Label]
@@ -407,7 +412,11 @@ func applyHybridScoring(text string, cands []Candidate, baseScores map[string]fl
 		if !ok {
 			compiled = compiledRuleSet{}
 		}
-		strongHits, weakHits, antiHits := countRuleHits(text, compiled)
+		strongHits, weakHits, antiHits, spans := countRuleHits(text, compiled)
+		for _, sp := range spans {
+			sp.Category = c.Label
+			matched = append(matched, sp)
+		}
 		bonus := computeRuleBonus(strongHits, weakHits, antiHits)
 		ruleBonus[c.Label] = bonus
 
@@ -419,7 +428,17 @@ func applyHybridScoring(text string, cands []Candidate, baseScores map[string]fl
 			final = floorForced
 		}
 		final += seedBias
-		final += tinyBias(c.Key)
+		// text と c.Key はどちらも NFKC + 小文字化済みなので全角/半角・大小文字を区別しない。
+		key := c.Key
+		if stripPunct {
+			key = foldText(key, false, true)
+		}
+		if substringBoost > 0 && key != "" && strings.Contains(text, key) {
+			final += substringBoost
+		}
+		if tieBreak == TieBreakHash {
+			final += tinyBias(c.Key)
+		}
 		final = clamp01(final)
 		finalScores[c.Label] = final
 
@@ -461,13 +480,12 @@ func applyHybridScoring(text string, cands []Candidate, baseScores map[string]fl
 			})
 		}
 	}
-	sort.SliceStable(suggestions, func(i, j int) bool {
-		if suggestions[i].Score == suggestions[j].Score {
-			return suggestions[i].Label < suggestions[j].Label
-		}
-		return suggestions[i].Score > suggestions[j].Score
-	})
-	return suggestions, ruleBonus, finalScores
+	if tieBreak == TieBreakInsertion {
+		sortSuggestions(suggestions, TieBreakInsertion)
+	} else {
+		sortSuggestions(suggestions, TieBreakLabel)
+	}
+	return suggestions, ruleBonus, finalScores, matched
 }
 
 func compileCategoryRules(raw map[string]keywordRuleSet) map[string]compiledRuleSet {
@@ -498,6 +516,29 @@ func buildVRCategoryKeySet() map[string]struct{} {
 	return keys
 }
 
+// stripRulePunctuation returns rules (or the built-in rules when empty) with
+// punctuation removed from every keyword, to match text prepared with
+// Config.StripPunctuation.
+func stripRulePunctuation(rules map[string]compiledRuleSet) map[string]compiledRuleSet {
+	if len(rules) == 0 {
+		rules = defaultCompiledCategoryRules
+	}
+	strip := func(words []string) []string {
+		out := make([]string, 0, len(words))
+		for _, w := range words {
+			if f := foldText(w, false, true); f != "" {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	out := make(map[string]compiledRuleSet, len(rules))
+	for key, set := range rules {
+		out[key] = compiledRuleSet{strong: strip(set.strong), weak: strip(set.weak), anti: strip(set.anti)}
+	}
+	return out
+}
+
 func normalizeKeywordList(words []string) []string {
 	if len(words) == 0 {
 		return nil
@@ -518,34 +559,61 @@ func normalizeKeywordList(words []string) []string {
 	return res
 }
 
-func countRuleHits(text string, set compiledRuleSet) (int, int, int) {
-	strong := countKeywordHits(text, set.strong)
-	weak := countKeywordHits(text, set.weak)
-	anti := countKeywordHits(text, set.anti)
-	return strong, weak, anti
+// キーワードの種類 (KeywordSpan.Kind)
+const (
+	keywordStrong = "strong"
+	keywordWeak   = "weak"
+	keywordAnti   = "anti"
+)
+
+// KeywordSpan is a rule keyword found in the normalized input. Start and End
+// are byte offsets into ResultRow.Normalized (first occurrence only).
+type KeywordSpan struct {
+	Category string
+	Keyword  string
+	Kind     string // "strong" / "weak" / "anti"
+	Start    int
+	End      int
+}
+
+// countRuleHits returns the number of distinct strong, weak and anti keywords
+// found in text, plus where each of them first matched.
+func countRuleHits(text string, set compiledRuleSet) (int, int, int, []KeywordSpan) {
+	var spans []KeywordSpan
+	strong := countKeywordHits(text, set.strong, keywordStrong, &spans)
+	weak := countKeywordHits(text, set.weak, keywordWeak, &spans)
+	anti := countKeywordHits(text, set.anti, keywordAnti, &spans)
+	return strong, weak, anti, spans
 }
 
-func countKeywordHits(text string, keywords []string) int {
+func countKeywordHits(text string, keywords []string, kind string, spans *[]KeywordSpan) int {
 	if len(keywords) == 0 {
 		return 0
 	}
 	hits := 0
 	for _, kw := range keywords {
-		if containsKeyword(text, kw) {
+		if idx := keywordIndex(text, kw); idx >= 0 {
 			hits++
+			*spans = append(*spans, KeywordSpan{Keyword: kw, Kind: kind, Start: idx, End: idx + len(kw)})
 		}
 	}
 	return hits
 }
 
 func containsKeyword(text, kw string) bool {
+	return keywordIndex(text, kw) >= 0
+}
+
+// keywordIndex returns the byte offset of the first match of kw in text, or
+// -1. Short ASCII keywords only match as whole words.
+func keywordIndex(text, kw string) int {
 	if kw == "" {
-		return false
+		return -1
 	}
 	if useWordBoundary(kw) {
-		return containsAsWord(text, kw)
+		return indexAsWord(text, kw)
 	}
-	return strings.Contains(text, kw)
+	return strings.Index(text, kw)
 }
 
 func useWordBoundary(kw string) bool {
@@ -568,12 +636,12 @@ func useWordBoundary(kw string) bool {
 	return count > 0
 }
 
-func containsAsWord(text, word string) bool {
+func indexAsWord(text, word string) int {
 	start := 0
 	for start < len(text) {
 		idx := strings.Index(text[start:], word)
 		if idx < 0 {
-			return false
+			return -1
 		}
 		idx += start
 		var before rune
@@ -585,11 +653,11 @@ func containsAsWord(text, word string) bool {
 			after, _ = utf8.DecodeRuneInString(text[end:])
 		}
 		if !isAlphaNumRune(before) && !isAlphaNumRune(after) {
-			return true
+			return idx
 		}
 		start = idx + len(word)
 	}
-	return false
+	return -1
 }
 
 func isAlphaNumRune(r rune) bool {
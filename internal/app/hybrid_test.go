@@ -0,0 +1,84 @@
+package app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSubstringBoost(t *testing.T) {
+	// 既定ルールが効かないよう、どのカテゴリにも一致しないルールを渡す
+	noRules := map[string]compiledRuleSet{"-": {}}
+	type cand struct {
+		label string
+		base  float32
+	}
+	tests := []struct {
+		name  string
+		text  string // 照合用に正規化・小文字化済みの入力
+		cands []cand
+		boost float32
+		want  map[string]float32 // 最終スコア
+		top   string
+	}{
+		{
+			name:  "verbatim label",
+			text:  "新しいテレビを買った",
+			cands: []cand{{"テレビ", 0.5}, {"旅行", 0.5}},
+			boost: 0.1,
+			want:  map[string]float32{"テレビ": alphaWeight*0.5 + 0.1, "旅行": alphaWeight * 0.5},
+			top:   "テレビ",
+		},
+		{
+			name:  "disabled",
+			text:  "新しいテレビを買った",
+			cands: []cand{{"テレビ", 0.5}, {"旅行", 0.5}},
+			boost: 0,
+			want:  map[string]float32{"テレビ": alphaWeight * 0.5, "旅行": alphaWeight * 0.5},
+		},
+		{
+			// 全角・大文字のラベルも正規化後の形で照合する
+			name:  "width and case",
+			text:  normalizeKey("4KのＴＶを買った"),
+			cands: []cand{{"ＴＶ", 0.4}, {"旅行", 0.4}},
+			boost: 0.2,
+			want:  map[string]float32{"ＴＶ": alphaWeight*0.4 + 0.2, "旅行": alphaWeight * 0.4},
+			top:   "ＴＶ",
+		},
+		{
+			name:  "clamped to 1",
+			text:  "テレビの修理",
+			cands: []cand{{"テレビ", 1}},
+			boost: 0.3,
+			want:  map[string]float32{"テレビ": 1},
+			top:   "テレビ",
+		},
+		{
+			// 小さな加点では意味的に明らかに近い候補を追い越さない
+			name:  "small boost keeps the better match",
+			text:  "テレビで見た北海道の温泉",
+			cands: []cand{{"テレビ", 0.4}, {"旅行", 0.9}},
+			boost: 0.05,
+			want:  map[string]float32{"テレビ": alphaWeight*0.4 + 0.05, "旅行": alphaWeight * 0.9},
+			top:   "旅行",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands := make([]Candidate, len(tt.cands))
+			base := make(map[string]float32, len(tt.cands))
+			for i, c := range tt.cands {
+				cands[i] = Candidate{Label: c.label, Key: normalizeKey(c.label)}
+				base[c.label] = c.base
+			}
+			sugs, _, final, _ := applyHybridScoring(tt.text, cands, base, 0, tt.boost, "", noRules, false)
+			for label, want := range tt.want {
+				if got := final[label]; math.Abs(float64(got-want)) > 1e-6 {
+					t.Errorf("%s = %.4f, want %.4f", label, got, want)
+				}
+			}
+			if tt.top != "" && (len(sugs) == 0 || sugs[0].Label != tt.top) {
+				t.Errorf("top = %+v, want %q", sugs, tt.top)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Index snapshots store an embedded label set (seed or NDC candidates) in one
+// file so that startup can skip per-label cache lookups and embedding. The
+// header records the model id and vector length; a snapshot written by a
+// different model is rejected instead of silently mixing dimensions.
+//
+// Layout (little endian, strings are u32 len + bytes):
+//
+//	"CIDX" | version u8 | modelID | dim u32 | count u32
+//	count × { label | key | source | lang | weight f32 | dim × f32 |
+//	          aliases u32 × { text | dim × f32 } }
+//
+// Version 1 files (u16 string lengths, no lang/weight/aliases) are still
+// read. Lengths and counts are checked against the file size before
+// anything is allocated, so a damaged file fails instead of exhausting
+// memory.
+const (
+	indexMagic   = "CIDX"
+	indexVersion = 2
+	// indexKeepSnapshots は1つのフォルダに source ごとに残すスナップショットの数。
+	// カテゴリを編集するたびに新しいファイルができるため、古いものから消す。
+	indexKeepSnapshots = 8
+)
+
+var errIndexMismatch = errors.New("保存済みインデックスが現在のモデルと一致しません")
+
+// indexFilePath names the snapshot after the model, source and the exact
+// label list, so editing the seeds naturally invalidates the old snapshot.
+func indexFilePath(dir, modelID, source string, labels []string) string {
+	h := sha1.Sum([]byte(modelID + "\n" + source + "\n" + strings.Join(labels, "\n")))
+	return filepath.Join(dir, fmt.Sprintf("index_%s_%s.bin", source, hex.EncodeToString(h[:8])))
+}
+
+func saveCandidateIndex(path, modelID string, cands []Candidate) error {
+	dim := 0
+	if len(cands) > 0 {
+		dim = len(cands[0].Vec)
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(indexMagic)
+	buf.WriteByte(indexVersion)
+	writeIndexString(buf, modelID)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(dim))
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(cands)))
+	for _, c := range cands {
+		if len(c.Vec) != dim {
+			return fmt.Errorf("ベクトル長が揃っていません (%s: %d / %d)", c.Label, len(c.Vec), dim)
+		}
+		writeIndexString(buf, c.Label)
+		writeIndexString(buf, c.Key)
+		writeIndexString(buf, c.Source)
+		writeIndexString(buf, c.Lang)
+		_ = binary.Write(buf, binary.LittleEndian, c.Weight)
+		_ = binary.Write(buf, binary.LittleEndian, c.Vec)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(c.Aliases)))
+		for _, a := range c.Aliases {
+			if len(a.Vec) != dim {
+				return fmt.Errorf("ベクトル長が揃っていません (%s の別名 %s: %d / %d)", c.Label, a.Text, len(a.Vec), dim)
+			}
+			writeIndexString(buf, a.Text)
+			_ = binary.Write(buf, binary.LittleEndian, a.Vec)
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func loadCandidateIndex(path, modelID string) ([]Candidate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := &indexReader{r: bufio.NewReader(f), left: info.Size()}
+	broken := func(err error) error {
+		return fmt.Errorf("インデックスファイルが不正です (%v): %s", err, path)
+	}
+
+	magic, err := r.bytes(len(indexMagic))
+	if err != nil || string(magic) != indexMagic {
+		return nil, fmt.Errorf("インデックスファイルが不正です: %s", path)
+	}
+	version, err := r.bytes(1)
+	if err != nil {
+		return nil, broken(err)
+	}
+	r.version = version[0]
+	if r.version != 1 && r.version != indexVersion {
+		return nil, fmt.Errorf("未対応のインデックス形式です (version=%d): %s", r.version, path)
+	}
+	storedModel, err := r.string()
+	if err != nil {
+		return nil, broken(err)
+	}
+	if storedModel != modelID {
+		return nil, fmt.Errorf("%w (保存: %s / 現在: %s)", errIndexMismatch, storedModel, modelID)
+	}
+	dim, err := r.uint32()
+	if err != nil {
+		return nil, broken(err)
+	}
+	count, err := r.uint32()
+	if err != nil {
+		return nil, broken(err)
+	}
+	// 1件は少なくともベクトルと文字列の長さを持つので、残りの大きさから件数の上限が決まる
+	if minRecord := int64(dim)*4 + 3*r.lenSize(); minRecord > 0 && int64(count) > r.left/minRecord {
+		return nil, broken(fmt.Errorf("件数 %d がファイルの大きさに合いません", count))
+	}
+	cands := make([]Candidate, 0, count)
+	for i := uint32(0); i < count; i++ {
+		c, err := r.candidate(int(dim))
+		if err != nil {
+			return nil, broken(err)
+		}
+		cands = append(cands, c)
+	}
+	return cands, nil
+}
+
+// indexReader reads a snapshot while tracking the bytes left in the file,
+// so no length read from the file can allocate more than the file holds.
+type indexReader struct {
+	r       *bufio.Reader
+	left    int64
+	version byte
+}
+
+func (r *indexReader) bytes(n int) ([]byte, error) {
+	if n < 0 || int64(n) > r.left {
+		return nil, fmt.Errorf("長さ %d が残りの %d バイトを超えています", n, r.left)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	r.left -= int64(n)
+	return b, nil
+}
+
+func (r *indexReader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// lenSize is the size of a string length prefix in this version.
+func (r *indexReader) lenSize() int64 {
+	if r.version == 1 {
+		return 2
+	}
+	return 4
+}
+
+func (r *indexReader) string() (string, error) {
+	var n int
+	if r.version == 1 {
+		b, err := r.bytes(2)
+		if err != nil {
+			return "", err
+		}
+		n = int(binary.LittleEndian.Uint16(b))
+	} else {
+		v, err := r.uint32()
+		if err != nil {
+			return "", err
+		}
+		if int64(v) > r.left {
+			return "", fmt.Errorf("文字列長 %d が残りの %d バイトを超えています", v, r.left)
+		}
+		n = int(v)
+	}
+	b, err := r.bytes(n)
+	return string(b), err
+}
+
+func (r *indexReader) vector(dim int) ([]float32, error) {
+	if int64(dim)*4 > r.left {
+		return nil, fmt.Errorf("ベクトル長 %d が残りの %d バイトを超えています", dim, r.left)
+	}
+	b, err := r.bytes(dim * 4)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return v, nil
+}
+
+func (r *indexReader) candidate(dim int) (Candidate, error) {
+	var c Candidate
+	var err error
+	if c.Label, err = r.string(); err != nil {
+		return c, err
+	}
+	if c.Key, err = r.string(); err != nil {
+		return c, err
+	}
+	if c.Source, err = r.string(); err != nil {
+		return c, err
+	}
+	if r.version >= 2 {
+		if c.Lang, err = r.string(); err != nil {
+			return c, err
+		}
+		w, err := r.uint32()
+		if err != nil {
+			return c, err
+		}
+		c.Weight = math.Float32frombits(w)
+	}
+	if c.Vec, err = r.vector(dim); err != nil {
+		return c, err
+	}
+	c.Norm = vecNorm(c.Vec)
+	if r.version < 2 {
+		return c, nil
+	}
+	n, err := r.uint32()
+	if err != nil {
+		return c, err
+	}
+	if minAlias := int64(dim)*4 + 4; int64(n) > r.left/minAlias {
+		return c, fmt.Errorf("別名の数 %d がファイルの大きさに合いません", n)
+	}
+	for j := uint32(0); j < n; j++ {
+		var a AliasVec
+		if a.Text, err = r.string(); err != nil {
+			return c, err
+		}
+		if a.Vec, err = r.vector(dim); err != nil {
+			return c, err
+		}
+		a.Norm = vecNorm(a.Vec)
+		c.Aliases = append(c.Aliases, a)
+	}
+	return c, nil
+}
+
+func writeIndexString(buf *bytes.Buffer, s string) {
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// pruneIndexSnapshots removes all but the keep most recently used snapshots
+// of source in dir. Loading a snapshot refreshes its time, so the ones in
+// use survive.
+func pruneIndexSnapshots(dir, source string, keep int) {
+	paths, err := filepath.Glob(filepath.Join(dir, "index_"+source+"_*.bin"))
+	if err != nil || len(paths) <= keep {
+		return
+	}
+	type snapshot struct {
+		path string
+		mod  time.Time
+	}
+	snaps := make([]snapshot, 0, len(paths))
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil {
+			snaps = append(snaps, snapshot{p, info.ModTime()})
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].mod.After(snaps[j].mod) })
+	for _, sn := range snaps[min(keep, len(snaps)):] {
+		if err := os.Remove(sn.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("古いインデックスを削除できません:", err)
+		}
+	}
+}
+
+// touchIndexSnapshot marks path as recently used for pruneIndexSnapshots.
+func touchIndexSnapshot(path string) {
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+}
+
+// embedLabelSetStored behaves like embedLabelSet but first tries the index
+// snapshot in the cache directory and writes one after embedding.
+func (s *Service) embedLabelSetStored(ctx context.Context, labels []string, source string) ([]Candidate, map[string][]float32, error) {
+	dir := s.cache.dir
+	if dir == "" {
+		return s.embedLabelSet(ctx, labels, source)
+	}
+	path := indexFilePath(dir, s.cache.modelID+s.normalizationTag(), source, labels)
+	if cands, err := loadCandidateIndex(path, s.cache.modelID); err == nil {
+		touchIndexSnapshot(path)
+		return cands, candidateVecMap(cands), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("インデックス読込エラー:", err)
+	}
+	cands, vecs, err := s.embedLabelSet(ctx, labels, source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := saveCandidateIndex(path, s.cache.modelID, cands); err != nil {
+		fmt.Println("インデックス保存エラー:", err)
+	}
+	pruneIndexSnapshots(dir, source, indexKeepSnapshots)
+	return cands, vecs, nil
+}
+
+// normalizationTag distinguishes index snapshots embedded with non-default
+// CaseFold / StripPunctuation settings.
+func (s *Service) normalizationTag() string {
+	cfg := s.Config()
+	tag := ""
+	if !cfg.CaseFold {
+		tag += "|case"
+	}
+	if cfg.StripPunctuation {
+		tag += "|nopunct"
+	}
+	return tag
+}
+
+func candidateVecMap(cands []Candidate) map[string][]float32 {
+	vecs := make(map[string][]float32, len(cands))
+	for _, c := range cands {
+		vecs[c.Label] = c.Vec
+	}
+	return vecs
+}
+
+// SaveIndexes writes the current seed and NDC candidate sets to dir.
+func (s *Service) SaveIndexes(dir string) error {
+	s.mu.RLock()
+	seeds := append([]Candidate(nil), s.candsCat...)
+	ndc := append([]Candidate(nil), s.candsNDC...)
+	seedLabels := append([]string(nil), s.userCats...)
+	ndcLabels := s.ndcLabelTexts()
+	s.mu.RUnlock()
+
+	ensureDirs(dir)
+	if err := saveCandidateIndex(indexFilePath(dir, s.cache.modelID, "seed", seedLabels), s.cache.modelID, seeds); err != nil {
+		return err
+	}
+	if err := saveCandidateIndex(indexFilePath(dir, s.cache.modelID, "ndc", ndcLabels), s.cache.modelID, ndc); err != nil {
+		return err
+	}
+	pruneIndexSnapshots(dir, "seed", indexKeepSnapshots)
+	pruneIndexSnapshots(dir, "ndc", indexKeepSnapshots)
+	return nil
+}
+
+// RestoreIndexes loads seed and NDC candidate sets previously written by
+// SaveIndexes for the current model and label lists.
+func (s *Service) RestoreIndexes(dir string) error {
+	s.mu.RLock()
+	seedLabels := append([]string(nil), s.userCats...)
+	ndcLabels := s.ndcLabelTexts()
+	s.mu.RUnlock()
+
+	seeds, err := loadCandidateIndex(indexFilePath(dir, s.cache.modelID, "seed", seedLabels), s.cache.modelID)
+	if err != nil {
+		return err
+	}
+	ndc, err := loadCandidateIndex(indexFilePath(dir, s.cache.modelID, "ndc", ndcLabels), s.cache.modelID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.candsCat = seeds
+	s.seedVec = candidateVecMap(seeds)
+	s.catMembers = nil // 保存済みのセントロイドには例文ごとのベクトルが無い
+	s.candsNDC = ndc
+	s.ndcVec = candidateVecMap(ndc)
+	s.ndcIndex = newNDCIndex(s.cfg, ndc)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandidateIndexRoundTrip(t *testing.T) {
+	cands := []Candidate{
+		{Label: "果物", Key: "果物", Source: "seed", Lang: "ja", Weight: 1.5, Vec: []float32{0.6, 0.8},
+			Aliases: []AliasVec{{Text: "フルーツ", Vec: []float32{1, 0}}}},
+		{Label: strings.Repeat("長", 70000), Key: "long", Source: "seed", Vec: []float32{0, 1}},
+	}
+	path := filepath.Join(t.TempDir(), "index.bin")
+	if err := saveCandidateIndex(path, "m", cands); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCandidateIndex(path, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cands {
+		cands[i].Norm = vecNorm(cands[i].Vec)
+		for j := range cands[i].Aliases {
+			cands[i].Aliases[j].Norm = vecNorm(cands[i].Aliases[j].Vec)
+		}
+	}
+	if !reflect.DeepEqual(got, cands) {
+		t.Errorf("round trip mismatch:\ngot  %+v\nwant %+v", got[0], cands[0])
+	}
+}
+
+// indexHeader builds the start of a snapshot up to and including count.
+func indexHeader(version byte, model string, dim, count uint32) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	buf.WriteString(indexMagic)
+	buf.WriteByte(version)
+	if version == 1 {
+		_ = binary.Write(buf, binary.LittleEndian, uint16(len(model)))
+	} else {
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(model)))
+	}
+	buf.WriteString(model)
+	_ = binary.Write(buf, binary.LittleEndian, dim)
+	_ = binary.Write(buf, binary.LittleEndian, count)
+	return buf
+}
+
+func TestLoadCandidateIndexRejectsDamagedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "valid.bin")
+	if err := saveCandidateIndex(path, "m", []Candidate{{Label: "果物", Key: "果物", Source: "seed", Vec: []float32{1, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hugeString := indexHeader(indexVersion, "m", 2, 1)
+	_ = binary.Write(hugeString, binary.LittleEndian, uint32(1<<31))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"huge count", indexHeader(indexVersion, "m", 2, 1<<31).Bytes()},
+		{"huge dim", indexHeader(indexVersion, "m", 1<<30, 1).Bytes()},
+		{"huge string", hugeString.Bytes()},
+		{"truncated", valid[:len(valid)-3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bad.bin")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadCandidateIndex(path, "m"); err == nil {
+				t.Error("loadCandidateIndex succeeded on a damaged file")
+			}
+		})
+	}
+}
+
+func TestLoadCandidateIndexVersion1(t *testing.T) {
+	buf := indexHeader(1, "m", 2, 1)
+	for _, s := range []string{"果物", "果物", "seed"} {
+		_ = binary.Write(buf, binary.LittleEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	_ = binary.Write(buf, binary.LittleEndian, []float32{0, 1})
+	path := filepath.Join(t.TempDir(), "v1.bin")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCandidateIndex(path, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Candidate{{Label: "果物", Key: "果物", Source: "seed", Vec: []float32{0, 1}, Norm: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPruneIndexSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(dir, "index_seed_"+string(rune('a'+i))+".bin")
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mod := base.Add(time.Duration(i) * time.Minute)
+		_ = os.Chtimes(p, mod, mod)
+	}
+	other := filepath.Join(dir, "index_ndc_x.bin")
+	_ = os.WriteFile(other, nil, 0o644)
+	touchIndexSnapshot(filepath.Join(dir, "index_seed_a.bin"))
+
+	pruneIndexSnapshots(dir, "seed", 2)
+	names, _ := filepath.Glob(filepath.Join(dir, "*.bin"))
+	for i := range names {
+		names[i] = filepath.Base(names[i])
+	}
+	want := []string{"index_ndc_x.bin", "index_seed_a.bin", "index_seed_e.bin"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("kept %v, want %v", names, want)
+	}
+}
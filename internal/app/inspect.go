@@ -0,0 +1,157 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// inspectSampleRows は -inspect で表示する入力・カテゴリの例の件数。
+const inspectSampleRows = 3
+
+// inspectFiles prints how ClassifyFile/ClassifyDir would read inputs and
+// the category file — the header, the resolved columns, whether the first
+// row is skipped as a header and a few parsed records — without loading
+// the model.
+func inspectFiles(opts ClassifyFileOptions, inputs []string, w io.Writer) error {
+	cfg, err := fileClassifierConfig(opts)
+	if err != nil {
+		return err
+	}
+	for _, in := range inputs {
+		if err := inspectInput(w, in, opts, cfg); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(in), err)
+		}
+	}
+	return inspectCategories(w, opts, cfg)
+}
+
+func inspectInput(w io.Writer, path string, opts ClassifyFileOptions, cfg Config) error {
+	records, err := readEvalRecords(path, inputSource(cfg))
+	if err != nil {
+		return err
+	}
+	cols, hasHeader, err := resolveInputColumns(records[0], opts.TextColumn, opts.InputProfile, cfg)
+	if err != nil {
+		return err
+	}
+	rows := keptRowIndices(records, cols, hasHeader, cfg.KeepEmptyRows)
+	fmt.Fprintf(w, "入力: %s (%d行, 分類する行 %d件)\n", path, len(records), len(rows))
+	fmt.Fprintf(w, "  先頭行: %s\n", formatInspectHeader(records[0]))
+	fmt.Fprintf(w, "  本文列: %s\n", formatInspectColumns(records[0], cols, hasHeader))
+	fmt.Fprintf(w, "  見出し行: %s\n", inspectHeaderNote(hasHeader))
+	for _, i := range rows[:min(len(rows), inspectSampleRows)] {
+		fmt.Fprintf(w, "  %d行目: %s\n", i+1, truncateSampleValue(joinedCell(records[i], cols), 60))
+	}
+	return nil
+}
+
+func inspectCategories(w io.Writer, opts ClassifyFileOptions, cfg Config) error {
+	path := opts.CategoryPath
+	if path == "" {
+		labels, _, err := initialUserCategories(cfg.SeedFile)
+		if err != nil {
+			fmt.Fprintf(w, "カテゴリ: %s を読めないため組み込みのカテゴリを使います (%v)\n", cfg.SeedFile, err)
+		} else {
+			fmt.Fprintf(w, "カテゴリ: %s (シードファイル)\n", cfg.SeedFile)
+		}
+		fmt.Fprintf(w, "  %d件: %s\n", len(labels), formatInspectLabels(labels))
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	if ext != ".csv" && ext != ".tsv" && ext != ".xlsx" {
+		specs, err := loadEvalCategories(path, categorySource(cfg))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "カテゴリ: %s\n", path)
+		fmt.Fprintf(w, "  %d件: %s\n", len(specs), formatInspectLabels(specLabels(specs)))
+		return nil
+	}
+
+	records, err := readEvalRecords(path, categorySource(cfg))
+	if err != nil {
+		return err
+	}
+	var (
+		cols      []int
+		weightCol int
+		hasHeader bool
+		specs     []CategorySpec
+	)
+	if opts.CategoryProfile != "" {
+		p, ok := cfg.CategoryProfiles[opts.CategoryProfile]
+		if !ok {
+			return fmt.Errorf("カテゴリ列プロファイル %q がありません", opts.CategoryProfile)
+		}
+		if cols, weightCol, hasHeader, err = resolveProfileCategoryColumns(records[0], p); err != nil {
+			return err
+		}
+		specs, err = loadProfileCategories(path, p, categorySource(cfg))
+	} else {
+		var col int
+		col, weightCol, hasHeader = resolveCategoryColumn(records)
+		cols = []int{col}
+		specs, err = loadEvalCategories(path, categorySource(cfg))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "カテゴリ: %s (%d行)\n", path, len(records))
+	fmt.Fprintf(w, "  先頭行: %s\n", formatInspectHeader(records[0]))
+	fmt.Fprintf(w, "  カテゴリ列: %s\n", formatInspectColumns(records[0], cols, hasHeader))
+	if weightCol >= 0 {
+		fmt.Fprintf(w, "  重み列: %s\n", formatInspectColumns(records[0], []int{weightCol}, hasHeader))
+	}
+	fmt.Fprintf(w, "  見出し行: %s\n", inspectHeaderNote(hasHeader))
+	fmt.Fprintf(w, "  %d件: %s\n", len(specs), formatInspectLabels(specLabels(specs)))
+	return nil
+}
+
+// formatInspectHeader lists the cells of the first row with their 1-based
+// column numbers, as accepted by -text.
+func formatInspectHeader(row []string) string {
+	parts := make([]string, len(row))
+	for i, v := range row {
+		parts[i] = fmt.Sprintf("%d=%s", i+1, truncateSampleValue(strings.TrimSpace(v), 20))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatInspectColumns shows cols as 1-based numbers, with the header name
+// when the first row is a header.
+func formatInspectColumns(header []string, cols []int, hasHeader bool) string {
+	parts := make([]string, len(cols))
+	for i, c := range cols {
+		parts[i] = fmt.Sprintf("%d", c+1)
+		if hasHeader && c < len(header) {
+			parts[i] += fmt.Sprintf(" (%s)", strings.TrimSpace(header[c]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func inspectHeaderNote(hasHeader bool) string {
+	if hasHeader {
+		return "あり (1行目を読み飛ばします)"
+	}
+	return "なし (1行目からデータとして読みます)"
+}
+
+func formatInspectLabels(labels []string) string {
+	const maxLabels = 10
+	s := strings.Join(labels[:min(len(labels), maxLabels)], ", ")
+	if len(labels) > maxLabels {
+		s += ", …"
+	}
+	return s
+}
+
+func specLabels(specs []CategorySpec) []string {
+	labels := make([]string, len(specs))
+	for i, sp := range specs {
+		labels[i] = sp.Label
+	}
+	return labels
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspectFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	withHeader := write("talks.csv", "id,本文\n1,リンゴの収穫\n2,\n3,サッカーの試合\n")
+	noHeader := write("plain.tsv", "リンゴの収穫\t果物\n掃除機の選び方\t家電\n")
+	cats := write("cats.csv", "weight,category\n1.5,果物\n1,家電\n")
+
+	tests := []struct {
+		name string
+		opts ClassifyFileOptions
+		want []string
+	}{
+		{
+			name: "detected text column",
+			opts: ClassifyFileOptions{InputPath: withHeader, CategoryPath: cats, Inspect: true},
+			want: []string{
+				"(4行, 分類する行 2件)",
+				"先頭行: 1=id, 2=本文",
+				"本文列: 2 (本文)",
+				"見出し行: あり",
+				"2行目: リンゴの収穫",
+				"4行目: サッカーの試合",
+				"カテゴリ列: 2 (category)",
+				"重み列: 1 (weight)",
+				"2件: 果物, 家電",
+			},
+		},
+		{
+			name: "column number without header",
+			opts: ClassifyFileOptions{InputPath: noHeader, TextColumn: "2", CategoryPath: cats, Inspect: true},
+			want: []string{
+				"本文列: 2\n",
+				"見出し行: なし",
+				"1行目: 果物",
+				"2行目: 家電",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := ClassifyFile(tt.opts, &b); err != nil {
+				t.Fatal(err)
+			}
+			out := b.String()
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output lacks %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,18 @@ package app
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+const resultFileTimeLayout = "20060102150405"
+
 type csvColumnChoice struct {
 	Index int
 	Label string
@@ -27,34 +33,304 @@ func splitNonEmptyLines(s string) []string {
 	return lines
 }
 
-func readCSVRecords(data []byte, delim rune) ([][]string, error) {
-	r := csv.NewReader(bytes.NewReader(data))
-	r.Comma = delim
-	records, err := r.ReadAll()
+// splitInputLines splits s into one entry per line. When keepEmpty is set,
+// blank lines are kept as empty entries so that every source row maps to
+// exactly one result row; trailing blank lines are still dropped.
+func splitInputLines(s string, keepEmpty bool) []string {
+	if !keepEmpty {
+		return splitNonEmptyLines(s)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	lines := make([]string, 0)
+	last := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lines = append(lines, line)
+		if line != "" {
+			last = len(lines)
+		}
+	}
+	return lines[:last]
+}
+
+// readInputData reads r, transparently decompressing it when name ends in
+// ".gz", and converts the content to UTF-8 according to enc (see
+// decodeInput). The returned name has the ".gz" suffix removed so the caller
+// can pick the delimiter from the remaining extension (e.g. "a.tsv.gz" ->
+// "a.tsv"). .xlsx content is binary and returned as is.
+func readInputData(r io.Reader, name, enc string) ([]byte, string, error) {
+	data, name, _, err := readInputDataEncoding(r, name, enc)
+	return data, name, err
+}
+
+// readInputDataEncoding is readInputData that also reports the encoding the
+// text was read with. XLSX files report the zero textEncoding (UTF-8).
+func readInputDataEncoding(r io.Reader, name, enc string) ([]byte, string, textEncoding, error) {
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, name, textEncoding{}, fmt.Errorf("gzip を展開できません: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+		name = name[:len(name)-len(".gz")]
+	}
+	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return nil, name, textEncoding{}, err
+	}
+	if strings.EqualFold(filepath.Ext(name), ".xlsx") {
+		return data, name, textEncoding{}, nil
+	}
+	te := detectEncoding(data, enc)
+	data, err = decodeInput(data, enc)
+	return data, name, te, err
+}
+
+// isTableFile reports whether name (with any ".gz" already removed) is read
+// as records rather than as lines of text.
+func isTableFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+// tableSource is how a table file is read: the text encoding (EncodingAuto
+// to detect it) and the .xlsx sheet (empty for the first one).
+type tableSource struct {
+	encoding string
+	sheet    string
+}
+
+// inputSource reads input files with InputEncoding and Sheet.
+func inputSource(cfg Config) tableSource {
+	return tableSource{encoding: cfg.InputEncoding, sheet: cfg.Sheet}
+}
+
+// categorySource reads category, alias and profile files with
+// CategoryEncoding and CategorySheet, each falling back to the input
+// setting when it is empty.
+func categorySource(cfg Config) tableSource {
+	src := inputSource(cfg)
+	if cfg.CategoryEncoding != "" {
+		src.encoding = cfg.CategoryEncoding
+	}
+	if cfg.CategorySheet != "" {
+		src.sheet = cfg.CategorySheet
+	}
+	return src
+}
+
+// readTableRecords parses data as CSV, TSV or the given sheet of an XLSX
+// workbook according to name's extension. delim is the delimiter to use
+// when the records are written back out (',' for XLSX). Malformed CSV
+// records are skipped and reported on stdout.
+func readTableRecords(data []byte, name, sheet string) ([][]string, rune, error) {
+	records, delim, warnings, err := readTableRecordsWithWarnings(data, name, sheet)
+	printParseWarnings(name, warnings)
+	return records, delim, err
+}
+
+// readTableRecordsWithWarnings is readTableRecords for callers that show the
+// skipped records themselves.
+func readTableRecordsWithWarnings(data []byte, name, sheet string) ([][]string, rune, []ParseWarning, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx":
+		records, err := readXLSXRecords(data, sheet)
+		return records, ',', nil, err
+	case ".tsv":
+		records, warnings, err := parseCSVRecords(data, '\t')
+		return records, '\t', warnings, err
+	}
+	records, warnings, err := parseCSVRecords(data, ',')
+	return records, ',', warnings, err
+}
+
+// ParseWarning describes a CSV record that was skipped because it could not
+// be parsed (e.g. a stray quote), instead of failing the whole file.
+type ParseWarning struct {
+	Line int // 1 始まりの行番号 (レコードの開始行)
+	// EndLine は閉じていない引用符がこの行まで読み進めたときの最終行 (それ以外は 0)。
+	// Line の行だけを捨て、次の行から読み直している。
+	EndLine int
+	Err     string
+}
+
+func (w ParseWarning) String() string {
+	if w.EndLine > w.Line {
+		return fmt.Sprintf("%d行目: %s (引用符が閉じられず %d〜%d行目が1つのセルになるため、%d行目だけを飛ばして読み直しました)",
+			w.Line, w.Err, w.Line, w.EndLine, w.Line)
+	}
+	return fmt.Sprintf("%d行目: %s", w.Line, w.Err)
+}
+
+func readCSVRecords(data []byte, delim rune) ([][]string, error) {
+	records, warnings, err := parseCSVRecords(data, delim)
+	printParseWarnings("", warnings)
+	return records, err
+}
+
+// parseCSVRecords reads data one record at a time. Rows may have different
+// numbers of fields, quoted fields may span lines, and a record that fails
+// to parse is skipped and reported as a warning. A quote that is never
+// closed would make the reader swallow every following line into one cell,
+// so for an error spanning lines only the starting line is dropped and
+// parsing restarts on the next line. Every cell goes through cleanCell so a
+// BOM left in the middle of concatenated exports is removed.
+func parseCSVRecords(data []byte, delim rune) ([][]string, []ParseWarning, error) {
+	var records [][]string
+	var warnings []ParseWarning
+	offset := 0 // data の先頭より前にある元データの行数
+	for {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comma = delim
+		r.FieldsPerRecord = -1
+		restart := false
+		for {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				w := ParseWarning{Line: offset + pe.StartLine, Err: pe.Err.Error()}
+				if pe.Line > pe.StartLine {
+					w.EndLine = offset + pe.Line
+					data = dropLines(data, pe.StartLine)
+					offset += pe.StartLine
+					restart = true
+				}
+				warnings = append(warnings, w)
+				if restart {
+					break
+				}
+				continue
+			}
+			if err != nil {
+				return nil, warnings, err
+			}
+			for i, cell := range record {
+				record[i] = cleanCell(cell)
+			}
+			records = append(records, record)
+		}
+		if !restart {
+			break
+		}
 	}
 	if len(records) == 0 {
-		return nil, errors.New("CSVが空です")
+		return nil, warnings, errors.New("CSVが空です")
 	}
-	return records, nil
+	return records, warnings, nil
 }
 
-func extractCSVColumn(records [][]string, idx int, hasHeader bool) []string {
+// dropLines returns data without its first n lines.
+func dropLines(data []byte, n int) []byte {
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		data = data[i+1:]
+	}
+	return data
+}
+
+// cleanCell removes byte order marks that end up inside cells when several
+// exported files are concatenated.
+func cleanCell(s string) string {
+	if !strings.ContainsRune(s, '\uFEFF') {
+		return s
+	}
+	return strings.ReplaceAll(s, "\uFEFF", "")
+}
+
+// formatParseWarnings summarizes skipped records for a log line.
+func formatParseWarnings(warnings []ParseWarning) string {
+	const maxListed = 3
+	parts := make([]string, 0, maxListed)
+	for i, w := range warnings {
+		if i == maxListed {
+			break
+		}
+		parts = append(parts, w.String())
+	}
+	msg := fmt.Sprintf("解析できないレコードを %d件スキップしました (%s", len(warnings), strings.Join(parts, " / "))
+	if len(warnings) > maxListed {
+		msg += " ほか"
+	}
+	return msg + ")"
+}
+
+func printParseWarnings(name string, warnings []ParseWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	if name != "" {
+		fmt.Printf("%s: ", name)
+	}
+	fmt.Println(formatParseWarnings(warnings))
+}
+
+// extractCSVColumns returns the text of each data row, joining the cells of
+// cols in the given order with a space. Empty cells are skipped, so a row is
+// only empty when all of its selected cells are.
+func extractCSVColumns(records [][]string, cols []int, hasHeader, keepEmpty bool) []string {
+	indices := keptRowIndices(records, cols, hasHeader, keepEmpty)
+	res := make([]string, 0, len(indices))
+	for _, i := range indices {
+		res = append(res, joinedCell(records[i], cols))
+	}
+	return res
+}
+
+// joinedCell joins the trimmed, non-empty values of cols in row. Columns
+// beyond the row length are treated as empty.
+func joinedCell(row []string, cols []int) string {
+	parts := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if c < 0 || c >= len(row) {
+			continue
+		}
+		if v := strings.TrimSpace(row[c]); v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// keptRowIndices returns the record indices that extractCSVColumns keeps for
+// textCols, in order.
+func keptRowIndices(records [][]string, textCols []int, hasHeader, keepEmpty bool) []int {
 	start := 0
 	if hasHeader {
 		start = 1
 	}
-	res := make([]string, 0, len(records))
+	res := make([]int, 0, len(records))
 	for i := start; i < len(records); i++ {
-		row := records[i]
-		if idx >= len(row) {
+		if joinedCell(records[i], textCols) == "" && !keepEmpty {
 			continue
 		}
-		val := strings.TrimSpace(row[idx])
-		if val != "" {
-			res = append(res, val)
+		res = append(res, i)
+	}
+	return res
+}
+
+// extractAlignedColumn returns the values of col for exactly the rows that
+// extractCSVColumns keeps for textCols, so both slices line up by index.
+func extractAlignedColumn(records [][]string, textCols []int, col int, hasHeader, keepEmpty bool) []string {
+	indices := keptRowIndices(records, textCols, hasHeader, keepEmpty)
+	res := make([]string, 0, len(indices))
+	for _, i := range indices {
+		row := records[i]
+		val := ""
+		if col >= 0 && col < len(row) {
+			val = strings.TrimSpace(row[col])
 		}
+		res = append(res, val)
 	}
 	return res
 }
@@ -113,17 +389,79 @@ func truncateSampleValue(s string, maxLen int) string {
 }
 
 func detectTextColumn(header []string) int {
-	if len(header) == 0 {
-		return -1
-	}
-	candidates := []string{"text", "本文", "content", "body", "description", "message"}
+	return detectHeaderColumn(header, []string{"text", "本文", "content", "body", "description", "message"})
+}
+
+// detectHeaderColumn returns the index of the first header cell matching one
+// of candidates (case-insensitive, NFKC-normalized), or -1.
+func detectHeaderColumn(header []string, candidates []string) int {
 	for idx, h := range header {
-		normalized := strings.ToLower(normalize(h))
-		for _, c := range candidates {
-			if normalized == c {
-				return idx
-			}
+		if headerMatches(h, candidates) {
+			return idx
 		}
 	}
 	return -1
 }
+
+func headerMatches(h string, candidates []string) bool {
+	normalized := strings.ToLower(normalize(h))
+	for _, c := range candidates {
+		if normalized == c {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultResultFileName returns the suggested export name rendered from
+// Config.OutputTemplate. The default template includes seconds so
+// consecutive exports within the same minute do not collide.
+func defaultResultFileName(cfg Config, now time.Time, inputName string, delim rune) string {
+	return renderOutputFileName(cfg.OutputTemplate, now, inputName, cfg.Mode) + delimiterExt(delim)
+}
+
+// canonicalOutputDelimiter maps the spelled-out aliases "tab" and "tsv"
+// (any case) of Config.OutputDelimiter to "\t" and leaves other values as
+// they are. sanitizeConfig and Validate apply it first so the aliases are
+// kept rather than reset to a comma.
+func canonicalOutputDelimiter(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "tab", "tsv":
+		return "\t"
+	}
+	return s
+}
+
+// parseOutputDelimiter converts Config.OutputDelimiter into a csv.Writer
+// separator. Unknown values fall back to a comma.
+func parseOutputDelimiter(s string) rune {
+	switch canonicalOutputDelimiter(s) {
+	case "\t":
+		return '\t'
+	case ";":
+		return ';'
+	default:
+		return ','
+	}
+}
+
+// exportDelimiter honours an explicit .tsv/.csv extension chosen in the save
+// dialog and otherwise uses the configured delimiter.
+func exportDelimiter(name string, configured rune) rune {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tsv":
+		return '\t'
+	case ".csv":
+		if configured == '\t' {
+			return ','
+		}
+	}
+	return configured
+}
+
+func delimiterExt(delim rune) string {
+	if delim == '\t' {
+		return ".tsv"
+	}
+	return ".csv"
+}
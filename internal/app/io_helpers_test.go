@@ -0,0 +1,81 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCSVRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     [][]string
+		warnings []ParseWarning
+	}{
+		{
+			name: "ragged rows and quoted newline",
+			data: "a,b\n1,\"x\ny\"\n3\n",
+			want: [][]string{{"a", "b"}, {"1", "x\ny"}, {"3"}},
+		},
+		{
+			name:     "bare quote skips one record",
+			data:     "a,b\n2,bad\"q\n3,z\n",
+			want:     [][]string{{"a", "b"}, {"3", "z"}},
+			warnings: []ParseWarning{{Line: 2, Err: "bare \" in non-quoted-field"}},
+		},
+		{
+			name:     "unterminated quote keeps the following rows",
+			data:     "1,\"bad\n2,x\n3,y",
+			want:     [][]string{{"2", "x"}, {"3", "y"}},
+			warnings: []ParseWarning{{Line: 1, EndLine: 3, Err: "extraneous or missing \" in quoted-field"}},
+		},
+		{
+			name: "BOM inside cells",
+			data: "\uFEFFa,b\n\uFEFF1,x\n",
+			want: [][]string{{"a", "b"}, {"1", "x"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warnings, err := parseCSVRecords([]byte(tt.data), ',')
+			if err != nil {
+				t.Fatalf("parseCSVRecords: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %+v, want %+v", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestOutputDelimiterAliases(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // sanitizeConfig 後の値
+		valid bool   // Validate が受け付けるか
+	}{
+		{",", ",", true},
+		{";", ";", true},
+		{"\t", "\t", true},
+		{"tab", "\t", true},
+		{" TSV ", "\t", true},
+		{"|", ",", false},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.OutputDelimiter = tt.value
+		got := sanitizeConfig(cfg).OutputDelimiter
+		if got != tt.want {
+			t.Errorf("sanitized %q = %q, want %q", tt.value, got, tt.want)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", tt.value, err, tt.valid)
+		}
+		if r, want := parseOutputDelimiter(got), []rune(tt.want)[0]; r != want {
+			t.Errorf("parseOutputDelimiter(%q) = %q, want %q", got, r, want)
+		}
+	}
+}
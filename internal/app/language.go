@@ -0,0 +1,78 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// カテゴリファイルで "[en] Machine learning" のように先頭に言語タグを付けると、
+// LanguageRouting 有効時にその言語と判定された入力だけがそのカテゴリと比較される。
+// タグのないカテゴリは全言語共通として扱う。
+var languageTagPattern = regexp.MustCompile(`^\[([A-Za-z]{2,3})\]\s*`)
+
+const (
+	langJapanese = "ja"
+	langEnglish  = "en"
+)
+
+// splitLanguageTag returns the lower-cased language tag and the label without
+// it. Labels without a tag return an empty language.
+func splitLanguageTag(label string) (string, string) {
+	label = strings.TrimSpace(label)
+	m := languageTagPattern.FindStringSubmatch(label)
+	if m == nil {
+		return "", label
+	}
+	return strings.ToLower(m[1]), strings.TrimSpace(label[len(m[0]):])
+}
+
+// detectLanguage classifies text as Japanese or English from its letters.
+// Mixed or letter-free input returns "" so the caller can fall back to all
+// categories.
+func detectLanguage(text string) string {
+	var cjk, latin int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			cjk++
+		case unicode.In(r, unicode.Latin):
+			latin++
+		}
+	}
+	letters := cjk + latin
+	if letters == 0 {
+		return ""
+	}
+	switch {
+	case float32(cjk)/float32(letters) >= 0.5:
+		return langJapanese
+	case float32(latin)/float32(letters) >= 0.9:
+		return langEnglish
+	default:
+		return ""
+	}
+}
+
+// filterCandidatesByLanguage keeps candidates tagged with lang plus untagged
+// ones. When lang is unknown, or no candidate would remain, all candidates
+// are returned unchanged.
+func filterCandidatesByLanguage(cands []Candidate, lang string) []Candidate {
+	if lang == "" {
+		return cands
+	}
+	out := make([]Candidate, 0, len(cands))
+	tagged := false
+	for _, c := range cands {
+		if c.Lang != "" {
+			tagged = true
+		}
+		if c.Lang == "" || c.Lang == lang {
+			out = append(out, c)
+		}
+	}
+	if !tagged || len(out) == 0 {
+		return cands
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSplitLanguageTag(t *testing.T) {
+	tests := []struct {
+		in, lang, label string
+	}{
+		{"[en] Machine learning", "en", "Machine learning"},
+		{" [JA]機械学習 ", "ja", "機械学習"},
+		{"機械学習", "", "機械学習"},
+		{"[長すぎる] 旅行", "", "[長すぎる] 旅行"},
+	}
+	for _, tt := range tests {
+		lang, label := splitLanguageTag(tt.in)
+		if lang != tt.lang || label != tt.label {
+			t.Errorf("splitLanguageTag(%q) = %q, %q, want %q, %q", tt.in, lang, label, tt.lang, tt.label)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"japanese", "北海道への旅行記", langJapanese},
+		{"japanese with latin", "AIで変わる旅行の予約", langJapanese},
+		{"english", "A travel guide to Hokkaido", langEnglish},
+		// どちらとも言えない入力は空 (全カテゴリに戻す)
+		{"mostly latin with kana", "Travel guide to Hokkaido のまとめ集", ""},
+		{"digits only", "2024-10-16", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageRouting(t *testing.T) {
+	specs := []CategorySpec{
+		{Label: "[en] Travel"},
+		{Label: "[ja] 旅行"},
+		{Label: "スポーツ"}, // 共通
+	}
+	tests := []struct {
+		name    string
+		routing bool
+		text    string
+		want    []string
+	}{
+		{"english", true, "A travel guide to Hokkaido", []string{"Travel", "スポーツ"}},
+		{"japanese", true, "北海道への旅行記", []string{"スポーツ", "旅行"}},
+		{"uncertain falls back", true, "2024-10-16", []string{"Travel", "スポーツ", "旅行"}},
+		{"routing off", false, "北海道への旅行記", []string{"Travel", "スポーツ", "旅行"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) {
+				c.Mode = ModeSeeded
+				c.LanguageRouting = tt.routing
+				c.MinScore = 0
+			})
+			if _, err := svc.LoadCategorySpecs(context.Background(), specs); err != nil {
+				t.Fatal(err)
+			}
+			row, err := svc.RankOne(context.Background(), tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(row.FinalScores))
+			for label := range row.FinalScores {
+				got = append(got, label)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scored categories = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// その言語のカテゴリがなくても共通カテゴリは残り、何も残らなければ全カテゴリに戻す
+	cands := []Candidate{{Label: "Travel", Lang: langEnglish}, {Label: "スポーツ"}}
+	if got := filterCandidatesByLanguage(cands, "fr"); len(got) != 1 {
+		t.Errorf("fr: kept %d candidates, want the shared one", len(got))
+	}
+	if got := filterCandidatesByLanguage([]Candidate{{Label: "Travel", Lang: langEnglish}}, langJapanese); len(got) != 1 {
+		t.Errorf("ja without ja categories: kept %d candidates, want all", len(got))
+	}
+}
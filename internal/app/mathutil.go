@@ -2,18 +2,110 @@ package app
 
 import "math"
 
-func cosine32(a, b []float32) float32 {
-	var dot, na, nb float32
-	for i := range a {
-		af, bf := a[i], b[i]
-		dot += af * bf
-		na += af * af
-		nb += bf * bf
-	}
-	if na == 0 || nb == 0 {
+func vecNorm(v []float32) float32 {
+	var sum float32
+	for _, x := range v {
+		sum += x * x
+	}
+	return float32(math.Sqrt(float64(sum)))
+}
+
+// Config.Metric の値。
+const (
+	MetricCosine    = "cosine"
+	MetricDot       = "dot"
+	MetricEuclidean = "euclidean"
+)
+
+// similarityFunc scores v against q, higher meaning closer. qNorm and vNorm
+// are the precomputed L2 norms; a zero vNorm is computed on demand.
+type similarityFunc func(q []float32, qNorm float32, v []float32, vNorm float32) float32
+
+// metricFunc returns the scorer for Config.Metric, defaulting to cosine.
+func metricFunc(metric string) similarityFunc {
+	switch metric {
+	case MetricDot:
+		return dotWithNorm
+	case MetricEuclidean:
+		return euclideanWithNorm
+	}
+	return cosineWithNorm
+}
+
+// cosineCandidate scores q against a candidate, reusing the query norm and
+// the candidate's precomputed norm so repeated queries only pay for the dot
+// product. A candidate with aliases scores as its closest name.
+func cosineCandidate(q []float32, qNorm float32, c Candidate) float32 {
+	return candidateSimilarity(cosineWithNorm, q, qNorm, c)
+}
+
+// candidateSimilarity is cosineCandidate for an arbitrary metric.
+func candidateSimilarity(sim similarityFunc, q []float32, qNorm float32, c Candidate) float32 {
+	best := sim(q, qNorm, c.Vec, c.Norm)
+	for _, al := range c.Aliases {
+		if sc := sim(q, qNorm, al.Vec, al.Norm); sc > best {
+			best = sc
+		}
+	}
+	return best
+}
+
+func cosineWithNorm(q []float32, qNorm float32, v []float32, vNorm float32) float32 {
+	if vNorm == 0 {
+		vNorm = vecNorm(v)
+	}
+	if qNorm == 0 || vNorm == 0 {
 		return 0
 	}
-	return dot / (float32(math.Sqrt(float64(na))) * float32(math.Sqrt(float64(nb))))
+	var dot float32
+	for i := range q {
+		dot += q[i] * v[i]
+	}
+	return dot / (qNorm * vNorm)
+}
+
+// dotWithNorm is the raw inner product. Encoder output is always
+// L2-normalized, so it only differs from cosine for averaged vectors
+// (centroids), whose shorter length then lowers their score. It is not a
+// mode for un-normalized dot-product models: scores are clamped to 0..1
+// downstream, which would flatten their unbounded inner products.
+func dotWithNorm(q []float32, _ float32, v []float32, _ float32) float32 {
+	var dot float32
+	for i := range q {
+		dot += q[i] * v[i]
+	}
+	return dot
+}
+
+// euclideanWithNorm turns the Euclidean distance into a score that is 1 for
+// identical vectors and 0 at distance 2 (opposite unit vectors), keeping the
+// same 0..1 scale as cosine for normalized embeddings.
+func euclideanWithNorm(q []float32, _ float32, v []float32, _ float32) float32 {
+	var sum float32
+	for i := range q {
+		d := q[i] - v[i]
+		sum += d * d
+	}
+	return 1 - float32(math.Sqrt(float64(sum)))/2
+}
+
+func centroid(vecs [][]float32) []float32 {
+	if len(vecs) == 0 {
+		return nil
+	}
+	out := make([]float32, len(vecs[0]))
+	for _, v := range vecs {
+		for i := range out {
+			if i < len(v) {
+				out[i] += v[i]
+			}
+		}
+	}
+	inv := 1 / float32(len(vecs))
+	for i := range out {
+		out[i] *= inv
+	}
+	return out
 }
 
 func tinyBias(label string) float32 {
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMetricRanking(t *testing.T) {
+	// A と B は単位ベクトル、C は (1,0) と (0.6,0.8) を平均したセントロイド (長さ約 0.89)
+	cands := []Candidate{
+		{Label: "A", Vec: []float32{1, 0}},
+		{Label: "B", Vec: []float32{0.6, 0.8}},
+		{Label: "C", Vec: []float32{0.8, 0.4}},
+	}
+	q := []float32{0.8, 0.6}
+	tests := []struct {
+		metric string
+		want   []string
+	}{
+		{MetricCosine, []string{"C", "B", "A"}},
+		// 内積ではセントロイドの短さが効いて B が C を上回る
+		{MetricDot, []string{"B", "C", "A"}},
+		{MetricEuclidean, []string{"C", "B", "A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			idx := NewInMemoryIndex(tt.metric)
+			_ = idx.Replace(cands)
+			hits, _ := idx.Search(context.Background(), q, -1)
+			var got []string
+			for _, h := range hits {
+				got = append(got, h.Cand.Label)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The encoder output is L2-normalized, so without centroids dot ranks the
+// categories exactly like cosine.
+func TestDotMatchesCosineOnNormalizedLabels(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "golden_inputs.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := splitInputLines(string(data), false)
+	ranking := func(metric string) [][]string {
+		svc := newTestService(t, func(c *Config) {
+			c.Mode = ModeSeeded
+			c.Metric = metric
+			c.TopK = 5
+		})
+		rows, err := svc.ClassifyAll(context.Background(), inputs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([][]string, len(rows))
+		for i, r := range rows {
+			for _, s := range r.Suggestions {
+				out[i] = append(out[i], s.Label)
+			}
+		}
+		return out
+	}
+	if got, want := ranking(MetricDot), ranking(MetricCosine); !reflect.DeepEqual(got, want) {
+		t.Errorf("dot ranking differs from cosine:\ngot  %v\nwant %v", got, want)
+	}
+}
@@ -1,5 +1,13 @@
 package app
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 type ndcItem struct {
 	Code  string
 	Label string
@@ -1197,3 +1205,93 @@ var defaultNDCLabels = []ndcItem{
 	{"998", "エスペラント文学"},
 	{"999", "その他の特殊文学"},
 }
+
+var (
+	ndcCodeHeaders  = []string{"code", "ndc", "分類記号", "コード"}
+	ndcLabelHeaders = []string{"label", "name", "名称", "分類名", "ラベル"}
+)
+
+// loadNDCFile reads an NDC dictionary from a CSV/TSV file (optionally .gz)
+// with code and label columns. A header row is optional; without one the
+// first two columns are taken as code and label. Rows with an empty label are
+// skipped, blank codes are kept, and later rows with an already-seen code are
+// ignored.
+func loadNDCFile(path string) ([]ndcItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, name, err := readInputData(f, path, EncodingAuto)
+	if err != nil {
+		return nil, err
+	}
+	delim := ','
+	firstLine, _, _ := strings.Cut(string(data), "\n")
+	if strings.EqualFold(filepath.Ext(name), ".tsv") || strings.Contains(firstLine, "\t") {
+		delim = '\t'
+	}
+	records, err := readCSVRecords(data, delim)
+	if err != nil {
+		return nil, err
+	}
+
+	codeIdx := detectHeaderColumn(records[0], ndcCodeHeaders)
+	labelIdx := detectHeaderColumn(records[0], ndcLabelHeaders)
+	hasHeader := codeIdx >= 0 || labelIdx >= 0
+	switch {
+	case hasHeader && labelIdx < 0:
+		if codeIdx+1 < len(records[0]) {
+			labelIdx = codeIdx + 1
+		}
+	case !hasHeader && len(records[0]) >= 2:
+		codeIdx, labelIdx = 0, 1
+	}
+	if labelIdx < 0 {
+		return nil, errors.New("NDCファイルのコード列・ラベル列を判別できません")
+	}
+
+	start := 0
+	if hasHeader {
+		start = 1
+	}
+	items := make([]ndcItem, 0, len(records)-start)
+	seen := make(map[string]struct{})
+	for _, row := range records[start:] {
+		var code, label string
+		if codeIdx >= 0 && codeIdx < len(row) {
+			code = strings.TrimSpace(row[codeIdx])
+		}
+		if labelIdx < len(row) {
+			label = strings.TrimSpace(row[labelIdx])
+		}
+		if label == "" {
+			continue
+		}
+		if code != "" {
+			if _, ok := seen[code]; ok {
+				continue
+			}
+			seen[code] = struct{}{}
+		}
+		items = append(items, ndcItem{Code: code, Label: label})
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("NDCファイルに有効な行がありません: %s", path)
+	}
+	return items, nil
+}
+
+// initialNDCItems returns the NDC dictionary from path, or the built-in list
+// when path is empty or cannot be loaded.
+func initialNDCItems(path string) ([]ndcItem, bool, error) {
+	fallback := append([]ndcItem(nil), defaultNDCLabels...)
+	if path == "" {
+		return fallback, false, nil
+	}
+	items, err := loadNDCFile(path)
+	if err != nil {
+		return fallback, false, err
+	}
+	return items, true, nil
+}
@@ -0,0 +1,432 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Output column names accepted in Config.OutputColumns.
+const (
+	OutputColIndex            = "index"
+	OutputColText             = "text"
+	OutputColCategory         = "category"
+	OutputColScore            = "score"
+	OutputColSource           = "source"
+	OutputColNeedReview       = "needReview"
+	OutputColAliases          = "aliases"
+	OutputColMargin           = "margin"
+	OutputColCount            = "count"
+	OutputColStatus           = "status"           // "accepted" か要確認の印
+	OutputColAcceptedCategory = "acceptedCategory" // 要確認でなければ1位のラベル
+	OutputColTop1Score        = "top1Score"
+	OutputColRawScore         = "rawScore"
+	OutputColSeedFinalScore   = "seedFinalScore"   // 候補ラベルの項目側の最終スコア (混合モード)
+	OutputColNDCWeightedScore = "ndcWeightedScore" // 候補ラベルの NDC 重み適用後のスコア (混合モード)
+	OutputColSeedRawScore     = "seedRawScore"     // 候補ラベルの項目側の重み付け前の類似度 (混合モード)
+	OutputColNDCRawScore      = "ndcRawScore"      // 候補ラベルの NDC 側の重み付け前の類似度 (混合モード)
+	OutputColNDC              = "ndc"
+	OutputColNDCScore         = "ndcScore"
+	OutputColSeedCategory     = "seedCategory"
+	OutputColSeedScore        = "seedScore"
+	OutputColSeedSource       = "seedSource"
+	OutputColAssigned         = "assigned"
+	OutputColAssignedRank     = "assignedRank"
+	OutputColAssignedScore    = "assignedScore"
+	OutputColAssignedMatch    = "assignedMatch"
+)
+
+var outputColumnNames = []string{
+	OutputColIndex, OutputColText, OutputColCategory, OutputColScore, OutputColSource,
+	OutputColNeedReview, OutputColAliases, OutputColMargin, OutputColCount,
+	OutputColStatus, OutputColAcceptedCategory, OutputColTop1Score, OutputColRawScore,
+	OutputColSeedFinalScore, OutputColNDCWeightedScore, OutputColSeedRawScore, OutputColNDCRawScore,
+	OutputColNDC, OutputColNDCScore,
+	OutputColSeedCategory, OutputColSeedScore, OutputColSeedSource,
+	OutputColAssigned, OutputColAssignedRank, OutputColAssignedScore, OutputColAssignedMatch,
+}
+
+// rankedOutputColumns describe one suggestion of a row. They take a 1-based
+// rank suffix ("score2" is the score of the second suggestion); without one
+// they refer to the first.
+var rankedOutputColumns = map[string]bool{
+	OutputColCategory: true, OutputColScore: true, OutputColSource: true, OutputColAliases: true,
+	OutputColRawScore: true, OutputColSeedFinalScore: true, OutputColNDCWeightedScore: true,
+	OutputColSeedRawScore: true, OutputColNDCRawScore: true,
+	OutputColNDC: true, OutputColNDCScore: true,
+	OutputColSeedCategory: true, OutputColSeedScore: true, OutputColSeedSource: true,
+}
+
+// splitOutputColumnRank splits the rank suffix off col: "score2" is
+// ("score", 2). A column without a suffix has rank 1.
+func splitOutputColumnRank(col string) (string, int) {
+	i := len(col)
+	for i > 0 && col[i-1] >= '0' && col[i-1] <= '9' {
+		i--
+	}
+	if i == 0 || i == len(col) {
+		return col, 1
+	}
+	rank, err := strconv.Atoi(col[i:])
+	if err != nil {
+		return col, 1
+	}
+	return col[:i], rank
+}
+
+// canonicalOutputColumn matches name case-insensitively against
+// outputColumnNames, allowing a rank suffix up to topKHardLimit on the
+// ranked columns.
+func canonicalOutputColumn(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	base, rank := splitOutputColumnRank(name)
+	for _, c := range outputColumnNames {
+		if !strings.EqualFold(c, base) {
+			continue
+		}
+		if base == name {
+			return c, true
+		}
+		if !rankedOutputColumns[c] || rank < 1 || rank > topKHardLimit {
+			return "", false
+		}
+		return c + strconv.Itoa(rank), true
+	}
+	return "", false
+}
+
+// outputColumnValue renders one field of r. i is the 0-based row position.
+func outputColumnValue(col string, i int, r ResultRow, sourceLabels map[string]string) string {
+	col, rank := splitOutputColumnRank(col)
+	sug, ok := suggestionAt(r.Suggestions, rank-1)
+	seed, seedOK := suggestionAt(r.SeedSuggestions, rank-1)
+	ndc, ndcOK := suggestionAt(r.NDCSuggestions, rank-1)
+	switch col {
+	case OutputColIndex:
+		return strconv.Itoa(i + 1)
+	case OutputColText:
+		return r.Text
+	case OutputColCategory:
+		if ok {
+			return suggestionLabel(sug)
+		}
+	case OutputColScore:
+		if ok {
+			return fmt.Sprintf("%.3f", sug.Score)
+		}
+	case OutputColSource:
+		if ok {
+			return displaySource(sug.Source, sourceLabels)
+		}
+	case OutputColRawScore:
+		if ok {
+			return fmt.Sprintf("%.3f", sug.RawScore)
+		}
+	case OutputColSeedFinalScore:
+		if ok {
+			return formatSourceScore(r.FinalScores, sug.Label)
+		}
+	case OutputColNDCWeightedScore:
+		if ok {
+			return formatSourceScore(r.NDCScores, sug.Label)
+		}
+	case OutputColSeedRawScore:
+		if ok {
+			return formatSourceScore(r.SeedRawScores, sug.Label)
+		}
+	case OutputColNDCRawScore:
+		if ok {
+			return formatSourceScore(r.NDCRawScores, sug.Label)
+		}
+	case OutputColNDC:
+		if ndcOK {
+			return suggestionLabel(ndc)
+		}
+	case OutputColNDCScore:
+		if ndcOK {
+			return fmt.Sprintf("%.3f", ndc.Score)
+		}
+	case OutputColSeedCategory:
+		if seedOK {
+			return suggestionLabel(seed)
+		}
+	case OutputColSeedScore:
+		if seedOK {
+			return fmt.Sprintf("%.3f", seed.Score)
+		}
+	case OutputColSeedSource:
+		if seedOK {
+			return displaySource(seed.Source, sourceLabels)
+		}
+	case OutputColNeedReview:
+		if r.NeedReview {
+			return "yes"
+		}
+		return "no"
+	case OutputColStatus:
+		if r.NeedReview {
+			return reviewMarker
+		}
+		return "accepted"
+	case OutputColAcceptedCategory:
+		if ok && !r.NeedReview {
+			return sug.Label
+		}
+	case OutputColAliases:
+		if ok {
+			return strings.Join(sug.Aliases, "|")
+		}
+	case OutputColMargin:
+		return fmt.Sprintf("%.3f", r.Margin)
+	case OutputColTop1Score:
+		return fmt.Sprintf("%.3f", r.Top1Score)
+	case OutputColCount:
+		return strconv.Itoa(r.Duplicates + 1)
+	case OutputColAssigned:
+		return r.Assigned
+	case OutputColAssignedRank:
+		if r.Assigned != "" {
+			return strconv.Itoa(r.AssignedRank)
+		}
+	case OutputColAssignedScore:
+		if r.Assigned != "" {
+			return fmt.Sprintf("%.3f", r.AssignedScore)
+		}
+	case OutputColAssignedMatch:
+		if r.Assigned != "" {
+			if r.AssignedMismatch {
+				return "no"
+			}
+			return "yes"
+		}
+	}
+	return ""
+}
+
+// outputColumnHeader returns the custom header for col, or col itself.
+func outputColumnHeader(col string, headers map[string]string) string {
+	if h := strings.TrimSpace(headers[col]); h != "" {
+		return h
+	}
+	return col
+}
+
+// outputColumn is one column of a result CSV: the value to write and its
+// header.
+type outputColumn struct {
+	name   string
+	header string
+}
+
+// configuredOutputColumns returns cfg.OutputColumns with their headers, or
+// nil when none are configured.
+func configuredOutputColumns(cfg Config) []outputColumn {
+	if len(cfg.OutputColumns) == 0 {
+		return nil
+	}
+	cols := make([]outputColumn, len(cfg.OutputColumns))
+	for i, col := range cfg.OutputColumns {
+		cols[i] = outputColumn{col, outputColumnHeader(col, cfg.OutputHeaders)}
+	}
+	return cols
+}
+
+// exportOutputColumns is the layout of the GUI CSV export: cfg.OutputColumns
+// when set, otherwise the default with TopK candidates, the per-source
+// scores of the mixed mode, the NDC list when shown separately, and the
+// verify columns when withAssigned.
+func exportOutputColumns(cfg Config, withAssigned bool) []outputColumn {
+	if cols := configuredOutputColumns(cfg); cols != nil {
+		return cols
+	}
+	cols := []outputColumn{{OutputColText, "text"}}
+	ranked := func(names ...string) {
+		for i := 1; i <= cfg.TopK; i++ {
+			for j := 0; j+1 < len(names); j += 2 {
+				cols = append(cols, outputColumn{names[j] + strconv.Itoa(i), names[j+1] + strconv.Itoa(i)})
+			}
+		}
+	}
+	ranked(OutputColCategory, "suggestion", OutputColScore, "score", OutputColSource, "source")
+	ranked(OutputColRawScore, "raw_score")
+	if cfg.Mode == ModeMixed {
+		// 候補ごとの出典別スコア。同じラベルが両方の索引にあれば両方の値が入る。
+		// raw はどちらも重み付け前の類似度、final / weighted はバイアスや
+		// NDC 重みを適用した後の値。
+		ranked(OutputColSeedRawScore, "seed_raw_score", OutputColNDCRawScore, "ndc_raw_score")
+		ranked(OutputColSeedFinalScore, "seed_final_score", OutputColNDCWeightedScore, "ndc_weighted_score")
+	}
+	if separateNDC(cfg) {
+		ranked(OutputColNDC, "ndc", OutputColNDCScore, "ndc_score")
+	}
+	ranked(OutputColSeedCategory, "final_suggestion", OutputColSeedScore, "final_score", OutputColSeedSource, "final_source")
+	cols = append(cols,
+		outputColumn{OutputColNeedReview, "final_need_review"},
+		outputColumn{OutputColNeedReview, "need_review"},
+		outputColumn{OutputColTop1Score, "top1_score"},
+		outputColumn{OutputColMargin, "margin"})
+	if withAssigned {
+		cols = append(cols,
+			outputColumn{OutputColAssigned, "assigned"},
+			outputColumn{OutputColAssignedRank, "assigned_rank"},
+			outputColumn{OutputColAssignedScore, "assigned_score"},
+			outputColumn{OutputColAssignedMatch, "assigned_match"})
+	}
+	return cols
+}
+
+// acceptedOutputColumns is the layout of the CLI result file:
+// cfg.OutputColumns when set, otherwise the accepted category and status.
+func acceptedOutputColumns(cfg Config) []outputColumn {
+	if cols := configuredOutputColumns(cfg); cols != nil {
+		return cols
+	}
+	return []outputColumn{
+		{OutputColText, "text"},
+		{OutputColAcceptedCategory, "category"},
+		{OutputColStatus, "status"},
+		{OutputColTop1Score, "top1_score"},
+		{OutputColMargin, "margin"},
+		{OutputColCount, "count"},
+	}
+}
+
+// outputColumnWriter writes result rows one at a time with a fixed column
+// layout. The GUI export and the CLI result files both go through it.
+type outputColumnWriter struct {
+	cw           *csv.Writer
+	cols         []outputColumn
+	sourceLabels map[string]string
+	rows         int
+}
+
+func newOutputColumnWriter(w io.Writer, delim rune, cols []outputColumn, sourceLabels map[string]string) (*outputColumnWriter, error) {
+	ow := &outputColumnWriter{cw: csv.NewWriter(w), cols: cols, sourceLabels: sourceLabels}
+	ow.cw.Comma = delim
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.header
+	}
+	if err := ow.cw.Write(header); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+func (ow *outputColumnWriter) write(r ResultRow) error {
+	record := make([]string, len(ow.cols))
+	for j, c := range ow.cols {
+		record[j] = outputColumnValue(c.name, ow.rows, r, ow.sourceLabels)
+	}
+	ow.rows++
+	return ow.cw.Write(record)
+}
+
+func (ow *outputColumnWriter) flush() error {
+	ow.cw.Flush()
+	return ow.cw.Error()
+}
+
+// writeOutputColumns writes rows with the columns cols.
+func writeOutputColumns(w io.Writer, delim rune, rows []ResultRow, cols []outputColumn, sourceLabels map[string]string) error {
+	ow, err := newOutputColumnWriter(w, delim, cols, sourceLabels)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := ow.write(r); err != nil {
+			return err
+		}
+	}
+	return ow.flush()
+}
+
+// sanitizeOutputColumns canonicalizes the names, drops unknown and repeated
+// columns, and keeps only headers for known columns.
+func sanitizeOutputColumns(cols []string, headers map[string]string) ([]string, map[string]string) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, c := range cols {
+		name, ok := canonicalOutputColumn(c)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	var hs map[string]string
+	for k, v := range headers {
+		name, ok := canonicalOutputColumn(k)
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		if hs == nil {
+			hs = make(map[string]string)
+		}
+		hs[name] = strings.TrimSpace(v)
+	}
+	return out, hs
+}
+
+// parseOutputColumnSpec parses the settings form value
+// "index,text,category=カテゴリ,..." into column names and custom headers.
+func parseOutputColumnSpec(spec string) ([]string, map[string]string, error) {
+	var cols []string
+	var headers map[string]string
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, header, _ := strings.Cut(part, "=")
+		col, ok := canonicalOutputColumn(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("出力列 %q は使えません (%s)", strings.TrimSpace(name), strings.Join(outputColumnNames, ", "))
+		}
+		cols = append(cols, col)
+		if h := strings.TrimSpace(header); h != "" {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			headers[col] = h
+		}
+	}
+	return cols, headers, nil
+}
+
+// formatOutputColumnSpec is the inverse of parseOutputColumnSpec.
+func formatOutputColumnSpec(cols []string, headers map[string]string) string {
+	parts := make([]string, len(cols))
+	for i, col := range cols {
+		parts[i] = col
+		if h := headers[col]; h != "" {
+			parts[i] += "=" + h
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// invalidOutputColumns lists the names in cols and headers that are not
+// output columns, for Validate.
+func invalidOutputColumns(cols []string, headers map[string]string) []string {
+	var bad []string
+	for _, c := range cols {
+		if _, ok := canonicalOutputColumn(c); !ok {
+			bad = append(bad, c)
+		}
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := canonicalOutputColumn(k); !ok {
+			bad = append(bad, k)
+		}
+	}
+	return bad
+}
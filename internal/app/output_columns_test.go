@@ -0,0 +1,220 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalOutputColumn(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"Category", OutputColCategory, true},
+		{" score2 ", "score2", true},
+		{"NDCSCORE3", "ndcScore3", true},
+		{"top1score", OutputColTop1Score, true},
+		{"score10", "score10", true},
+		{"score11", "", false}, // topKHardLimit を超える
+		{"score0", "", false},
+		{"count2", "", false}, // 順位を取らない列
+		{"suggestion1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := canonicalOutputColumn(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("canonicalOutputColumn(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAcceptedOutputColumns(t *testing.T) {
+	rows := []ResultRow{
+		{Text: "りんご", Suggestions: []Suggestion{{Label: "果物", Score: 0.9, Aliases: []string{"フルーツ"}}}, Top1Score: 0.9, Margin: 0.4, Duplicates: 1},
+		{Text: "謎", Suggestions: []Suggestion{{Label: "家電", Score: 0.3}}, Top1Score: 0.3, Margin: 0.01, NeedReview: true},
+	}
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"default", Config{}, "text,category,status,top1_score,margin,count\n" +
+			"りんご,果物,accepted,0.900,0.400,2\n" +
+			"謎,,review,0.300,0.010,1\n"},
+		{"configured", Config{OutputColumns: []string{OutputColIndex, OutputColCategory, OutputColNeedReview}, OutputHeaders: map[string]string{OutputColCategory: "カテゴリ"}},
+			"index,カテゴリ,needReview\n" +
+				"1,果物 [フルーツ],no\n" +
+				"2,家電,yes\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rw, err := newAcceptedRowWriter(&buf, ',', ClassifyFileOptions{}, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range rows {
+				if err := rw.write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rw.flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			if rw.rows != 2 || rw.accepted != 1 {
+				t.Errorf("rows %d accepted %d, want 2 and 1", rw.rows, rw.accepted)
+			}
+		})
+	}
+}
+
+func TestExportOutputColumns(t *testing.T) {
+	headers := func(cols []outputColumn) []string {
+		out := make([]string, len(cols))
+		for i, c := range cols {
+			out[i] = c.header
+		}
+		return out
+	}
+	base := []string{
+		"text",
+		"suggestion1", "score1", "source1", "suggestion2", "score2", "source2",
+		"raw_score1", "raw_score2",
+	}
+	final := []string{
+		"final_suggestion1", "final_score1", "final_source1", "final_suggestion2", "final_score2", "final_source2",
+		"final_need_review", "need_review", "top1_score", "margin",
+	}
+	join := func(parts ...[]string) []string {
+		var out []string
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+	tests := []struct {
+		name         string
+		cfg          Config
+		withAssigned bool
+		want         []string
+	}{
+		{"seeded", Config{Mode: ModeSeeded, TopK: 2}, false, join(base, final)},
+		{"mixed", Config{Mode: ModeMixed, TopK: 2}, false, join(base,
+			[]string{"seed_raw_score1", "ndc_raw_score1", "seed_raw_score2", "ndc_raw_score2",
+				"seed_final_score1", "ndc_weighted_score1", "seed_final_score2", "ndc_weighted_score2"}, final)},
+		{"split with assigned", Config{Mode: ModeSplit, TopK: 2}, true, join(base,
+			[]string{"ndc1", "ndc_score1", "ndc2", "ndc_score2"}, final,
+			[]string{"assigned", "assigned_rank", "assigned_score", "assigned_match"})},
+		{"configured", Config{Mode: ModeSplit, TopK: 2, OutputColumns: []string{OutputColText, "score2"}}, true, []string{"text", "score2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := headers(exportOutputColumns(tt.cfg, tt.withAssigned)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("headers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 既定の列構成の値
+	row := ResultRow{
+		Text:            "りんご",
+		Suggestions:     []Suggestion{{Label: "果物", Score: 0.8, RawScore: 0.7, Source: "seed"}},
+		SeedSuggestions: []Suggestion{{Label: "果物", Score: 0.8, Source: "seed"}},
+		NDCSuggestions:  []Suggestion{{Label: "農業", Score: 0.5, Source: "ndc"}},
+		Top1Score:       0.8,
+		Margin:          0.8,
+		Assigned:        "野菜",
+		AssignedRank:    3,
+		AssignedScore:   0.2,
+	}
+	var buf bytes.Buffer
+	cfg := Config{Mode: ModeSplit, TopK: 2, SourceLabels: map[string]string{"seed": "項目"}}
+	if err := writeOutputColumns(&buf, ',', []ResultRow{row}, exportOutputColumns(cfg, true), cfg.SourceLabels); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := "りんご,果物,0.800,項目,,,,0.700,,農業,0.500,,,果物,0.800,項目,,,,no,no,0.800,0.800,野菜,3,0.200,yes"
+	if len(lines) != 2 || lines[1] != want {
+		t.Errorf("row = %q, want %q", lines[len(lines)-1], want)
+	}
+}
+
+func TestMixedSourceScoreColumns(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t, func(cfg *Config) {
+		cfg.Mode = ModeMixed
+		cfg.TopK = topKHardLimit
+		cfg.MinScore = 0
+	})
+	// NDC の候補と同じ名前のカテゴリを置き、1つのラベルが両方の索引でスコアを持つようにする
+	const both = "626 野菜"
+	if _, err := svc.LoadCategorySpecs(ctx, []CategorySpec{{Label: both}, {Label: "果物"}}); err != nil {
+		t.Fatal(err)
+	}
+	const text = "新鮮な野菜のサラダ"
+	row, err := svc.RankOne(ctx, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rank := 0
+	for i, sug := range row.Suggestions {
+		if sug.Label == both {
+			rank = i + 1
+		}
+	}
+	if rank == 0 {
+		t.Fatalf("%q not in suggestions %+v", both, row.Suggestions)
+	}
+
+	// 期待値は入力と各索引の候補ベクトルの類似度 (重み付け前) をそのまま計算する
+	vec, err := svc.EmbedCached(ctx, svc.prepareText(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawIn := func(cands []Candidate) string {
+		for _, c := range cands {
+			if c.Label == both {
+				return fmt.Sprintf("%.3f", clamp01(candidateSimilarity(metricFunc(svc.Config().Metric), vec, vecNorm(vec), c)))
+			}
+		}
+		t.Fatalf("%q not among the candidates", both)
+		return ""
+	}
+	col := func(name string) string {
+		return outputColumnValue(name+fmt.Sprint(rank), 0, row, nil)
+	}
+	tests := []struct {
+		col  string
+		want string
+	}{
+		{OutputColSeedRawScore, rawIn(svc.candsCat)},
+		{OutputColNDCRawScore, rawIn(svc.candsNDC)},
+		{OutputColSeedFinalScore, fmt.Sprintf("%.3f", row.FinalScores[both])},
+		{OutputColNDCWeightedScore, fmt.Sprintf("%.3f", row.NDCScores[both])},
+	}
+	for _, tt := range tests {
+		if got := col(tt.col); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.col, got, tt.want)
+		}
+	}
+	// NDC 重み (既定 0.85) を掛ける前と後で値が変わる
+	if col(OutputColNDCRawScore) == col(OutputColNDCWeightedScore) {
+		t.Errorf("ndcRawScore equals ndcWeightedScore (%s)", col(OutputColNDCRawScore))
+	}
+	// 片方の索引にしかないラベルはもう片方が空欄
+	for i, sug := range row.Suggestions {
+		if sug.Label == "果物" {
+			if got := outputColumnValue(OutputColNDCRawScore+fmt.Sprint(i+1), 0, row, nil); got != "" {
+				t.Errorf("ndcRawScore of a seed-only label = %q, want empty", got)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultOutputTemplate reproduces the original result_YYYYMMDDhhmmss name.
+const defaultOutputTemplate = "result_{date}{time}"
+
+// 出力ファイル名テンプレートで使えるプレースホルダ
+var outputPlaceholders = []string{"{input}", "{date}", "{time}", "{mode}"}
+
+// validateOutputTemplate rejects templates that could leave the chosen
+// folder or that use unknown placeholders.
+func validateOutputTemplate(tmpl string) error {
+	if strings.TrimSpace(tmpl) == "" {
+		return fmt.Errorf("出力ファイル名が空です")
+	}
+	if strings.Contains(tmpl, "..") || strings.ContainsAny(tmpl, `/\`) {
+		return fmt.Errorf("出力ファイル名にフォルダ区切りや .. は使えません: %s", tmpl)
+	}
+	rest := tmpl
+	for _, ph := range outputPlaceholders {
+		rest = strings.ReplaceAll(rest, ph, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("不明なプレースホルダがあります (使えるのは %s): %s", strings.Join(outputPlaceholders, " "), tmpl)
+	}
+	return nil
+}
+
+// renderOutputFileName expands tmpl into a file name (extension excluded).
+// inputName is the loaded file's name and may be empty.
+func renderOutputFileName(tmpl string, now time.Time, inputName, mode string) string {
+	if validateOutputTemplate(tmpl) != nil {
+		tmpl = defaultOutputTemplate
+	}
+	inputName = strings.TrimSuffix(inputName, ".gz")
+	input := strings.TrimSuffix(filepath.Base(inputName), filepath.Ext(inputName))
+	if inputName == "" || input == "." {
+		input = "input"
+	}
+	name := strings.NewReplacer(
+		"{input}", input,
+		"{date}", now.Format("20060102"),
+		"{time}", now.Format("150405"),
+		"{mode}", mode,
+	).Replace(tmpl)
+	return safeFileName(name)
+}
+
+// safeFileName strips characters Windows does not allow in file names,
+// along with trailing dots and spaces.
+func safeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "result"
+	}
+	if isReservedWindowsName(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+func isReservedWindowsName(name string) bool {
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) && base[3] >= '1' && base[3] <= '9' {
+		return true
+	}
+	return false
+}
+
+// uniqueFileName returns path, or path with _2, _3, … inserted before the
+// extension, whichever first neither exists nor is in taken. A name that
+// cannot be checked is returned as is and fails when it is created.
+func uniqueFileName(path string, taken map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		if !taken[path] {
+			if _, err := os.Stat(path); err != nil {
+				return path
+			}
+		}
+		path = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+}
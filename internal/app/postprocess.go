@@ -0,0 +1,61 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runPostProcess pipes rows as JSON to the configured external command
+// (program and arguments, run without a shell) and returns the rows it
+// writes back on stdout. Any failure (command error, malformed JSON, row
+// count mismatch) leaves the original rows untouched.
+func runPostProcess(ctx context.Context, command []string, rows []ResultRow) []ResultRow {
+	if len(command) == 0 || strings.TrimSpace(command[0]) == "" || len(rows) == 0 {
+		return rows
+	}
+	processed, err := execPostProcess(ctx, command, rows)
+	if err != nil {
+		fmt.Printf("後処理コマンドに失敗したため元の結果を使用します (%s): %v\n", strings.Join(command, " "), err)
+		return rows
+	}
+	return processed
+}
+
+func execPostProcess(ctx context.Context, command []string, rows []ResultRow) ([]ResultRow, error) {
+	input, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	dec := json.NewDecoder(&stdout)
+	dec.DisallowUnknownFields()
+	var out []ResultRow
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("出力JSONを解釈できません: %w", err)
+	}
+	if len(out) != len(rows) {
+		return nil, fmt.Errorf("行数が一致しません (入力%d件 / 出力%d件)", len(rows), len(out))
+	}
+	for i := range out {
+		if out[i].Text != rows[i].Text {
+			return nil, errors.New("出力の Text が入力と一致しません")
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// postProcessHelperEnv が "1" のとき、テストバイナリ自身が後処理コマンドとして
+// 動く (TestPostProcessHelper)。
+const postProcessHelperEnv = "CATEGORIZER_POSTPROCESS_HELPER"
+
+// TestPostProcessHelper is not a test: run as a child process it reads rows
+// from stdin and puts a suggestion labeled with its first argument (after
+// "--") in front of each row's suggestions. With "drop" it returns one row
+// fewer.
+func TestPostProcessHelper(t *testing.T) {
+	if os.Getenv(postProcessHelperEnv) != "1" {
+		return
+	}
+	var rows []ResultRow
+	if err := json.NewDecoder(os.Stdin).Decode(&rows); err != nil {
+		os.Exit(2)
+	}
+	label := flag.Arg(0)
+	if label == "drop" {
+		rows = rows[:len(rows)-1]
+	}
+	for i := range rows {
+		rows[i].Suggestions = append([]Suggestion{{Label: label, Score: 1, Source: "post"}}, rows[i].Suggestions...)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(rows)
+	os.Exit(0)
+}
+
+// postProcessHelper returns a PostProcessCommand running TestPostProcessHelper
+// with arg as its single argument.
+func postProcessHelper(arg string) []string {
+	return []string{os.Args[0], "-test.run=^TestPostProcessHelper$", "--", arg}
+}
+
+func TestPostProcessCommand(t *testing.T) {
+	t.Setenv(postProcessHelperEnv, "1")
+	// 空白を含む引数は分割されずに1つの引数として渡る
+	const label = "後処理 済み"
+	inputs := []string{"北海道への旅行記", "新鮮な野菜のサラダ"}
+
+	// 入口ごとに、返ってきた各行の1位ラベルを返す
+	entries := []struct {
+		name string
+		run  func(t *testing.T, svc *Service) []string
+	}{
+		{"ClassifyAll", func(t *testing.T, svc *Service) []string {
+			rows, err := svc.ClassifyAll(context.Background(), inputs, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return topLabels(rows)
+		}},
+		{"RankOne", func(t *testing.T, svc *Service) []string {
+			var rows []ResultRow
+			for _, in := range inputs {
+				row, err := svc.RankOne(context.Background(), in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rows = append(rows, row)
+			}
+			return topLabels(rows)
+		}},
+		{"ClassifyLabels", func(t *testing.T, svc *Service) []string {
+			labels, err := svc.ClassifyLabels(context.Background(), inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return labels
+		}},
+		{"ClassifyStream", func(t *testing.T, svc *Service) []string {
+			in := make(chan string, len(inputs))
+			for _, s := range inputs {
+				in <- s
+			}
+			close(in)
+			var rows []ResultRow
+			if err := svc.ClassifyStream(context.Background(), in, func(r ResultRow) error {
+				rows = append(rows, r)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			return topLabels(rows)
+		}},
+		{"server", func(t *testing.T, svc *Service) []string {
+			srv := httptest.NewServer(newServerMux(svc))
+			defer srv.Close()
+			body, _ := json.Marshal(classifyRequest{Texts: inputs})
+			resp, err := http.Post(srv.URL+"/classify", "application/json", strings.NewReader(string(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var rows []ResultRow
+			if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+				t.Fatal(err)
+			}
+			return topLabels(rows)
+		}},
+	}
+	commands := []struct {
+		name    string
+		command []string
+		applied bool
+	}{
+		{"applied", postProcessHelper(label), true},
+		// 失敗したら元の結果のまま
+		{"row count mismatch", postProcessHelper("drop"), false},
+		{"missing program", []string{"categorizer-no-such-command"}, false},
+	}
+	for _, c := range commands {
+		for _, e := range entries {
+			t.Run(c.name+"/"+e.name, func(t *testing.T) {
+				svc := newTestService(t, func(cfg *Config) { cfg.PostProcessCommand = c.command })
+				got := e.run(t, svc)
+				if len(got) != len(inputs) {
+					t.Fatalf("got %d rows, want %d", len(got), len(inputs))
+				}
+				for i, l := range got {
+					if (l == label) != c.applied {
+						t.Errorf("%s: top label %q, hook applied = %v", inputs[i], l, c.applied)
+					}
+				}
+			})
+		}
+	}
+}
+
+func topLabels(rows []ResultRow) []string {
+	labels := make([]string, len(rows))
+	for i, r := range rows {
+		labels[i] = topLabel(r)
+	}
+	return labels
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const defaultProfileFile = "config/column_profiles.json"
+
+// InputProfile remembers the columns chosen for a recurring input layout.
+// Columns are stored as header names (or 1-based numbers for files without
+// a header) so a profile still applies when the columns are reordered.
+type InputProfile struct {
+	TextColumns    []string
+	AssignedColumn string `json:",omitempty"` // 既存カテゴリ列 (検証用)
+}
+
+// CategoryProfile is the category-file counterpart of InputProfile.
+type CategoryProfile struct {
+	Columns      []string
+	WeightColumn string `json:",omitempty"`
+	Aliases      bool   `json:",omitempty"` // 先頭の列を正式名、残りを別名として読む
+}
+
+// columnProfiles is the on-disk form of Config.InputProfiles and
+// Config.CategoryProfiles.
+type columnProfiles struct {
+	Input    map[string]InputProfile    `json:"input,omitempty"`
+	Category map[string]CategoryProfile `json:"category,omitempty"`
+}
+
+// withColumnProfiles adds the profiles saved in cfg.ProfileFile to cfg.
+// Profiles already in cfg (e.g. from a -config file) win over saved ones.
+// A missing file is not an error.
+func withColumnProfiles(cfg Config) Config {
+	if cfg.ProfileFile == "" {
+		return cfg
+	}
+	data, err := os.ReadFile(filepath.Clean(cfg.ProfileFile))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("列プロファイルの読み込みに失敗しました (%s): %v\n", cfg.ProfileFile, err)
+		}
+		return cfg
+	}
+	var saved columnProfiles
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Printf("列プロファイルの読み込みに失敗しました (%s): %v\n", cfg.ProfileFile, err)
+		return cfg
+	}
+	input := make(map[string]InputProfile, len(saved.Input)+len(cfg.InputProfiles))
+	for name, p := range saved.Input {
+		input[name] = p
+	}
+	for name, p := range cfg.InputProfiles {
+		input[name] = p
+	}
+	category := make(map[string]CategoryProfile, len(saved.Category)+len(cfg.CategoryProfiles))
+	for name, p := range saved.Category {
+		category[name] = p
+	}
+	for name, p := range cfg.CategoryProfiles {
+		category[name] = p
+	}
+	cfg.InputProfiles = input
+	cfg.CategoryProfiles = category
+	return cfg
+}
+
+// saveColumnProfiles writes the profiles of cfg to cfg.ProfileFile.
+func saveColumnProfiles(cfg Config) error {
+	if cfg.ProfileFile == "" {
+		return errors.New("列プロファイルの保存先 (ProfileFile) が設定されていません")
+	}
+	data, err := json.MarshalIndent(columnProfiles{Input: cfg.InputProfiles, Category: cfg.CategoryProfiles}, "", "  ")
+	if err != nil {
+		return err
+	}
+	clean := filepath.Clean(cfg.ProfileFile)
+	if err := os.MkdirAll(filepath.Dir(clean), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(clean, append(data, '\n'), 0o644)
+}
+
+// columnSpec describes column idx the way resolveEvalColumn reads it back:
+// the header name when the file has one, otherwise the 1-based number.
+func columnSpec(header []string, hasHeader bool, idx int) string {
+	if hasHeader && idx < len(header) && normalize(header[idx]) != "" {
+		return normalize(header[idx])
+	}
+	return strconv.Itoa(idx + 1)
+}
+
+func columnSpecs(header []string, hasHeader bool, cols []int) []string {
+	specs := make([]string, len(cols))
+	for i, c := range cols {
+		specs[i] = columnSpec(header, hasHeader, c)
+	}
+	return specs
+}
+
+// resolveProfileColumns maps the column specs of a profile onto header.
+// byName reports whether any column was found by its header name, i.e. the
+// first row is a header.
+func resolveProfileColumns(header []string, specs []string) (cols []int, byName bool, err error) {
+	for _, spec := range specs {
+		idx, named, err := resolveEvalColumn(header, spec, -1)
+		if err != nil {
+			return nil, false, err
+		}
+		if idx >= 0 {
+			cols = append(cols, idx)
+			byName = byName || named
+		}
+	}
+	if len(cols) == 0 {
+		return nil, false, errors.New("プロファイルの列が見つかりません")
+	}
+	return cols, byName, nil
+}
+
+func inputProfileNames(m map[string]InputProfile) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func categoryProfileNames(m map[string]CategoryProfile) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// optionsForColumns returns the labels of the column choices whose index is
+// in cols, in choice order.
+func optionsForColumns(choices []csvColumnChoice, cols []int) []string {
+	var out []string
+	for _, c := range choices {
+		for _, col := range cols {
+			if c.Index == col {
+				out = append(out, c.Label)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// loadProfileCategories reads a CSV/TSV/xlsx category file with the columns
+// of a saved CategoryProfile instead of the detected ones.
+// resolveProfileCategoryColumns resolves the category and weight columns of
+// p against header. weightCol is -1 when p has no weight column.
+func resolveProfileCategoryColumns(header []string, p CategoryProfile) (cols []int, weightCol int, hasHeader bool, err error) {
+	cols, hasHeader, err = resolveProfileColumns(header, p.Columns)
+	if err != nil {
+		return nil, -1, false, err
+	}
+	weightCol = -1
+	if p.WeightColumn != "" {
+		idx, byName, err := resolveEvalColumn(header, p.WeightColumn, -1)
+		if err != nil {
+			return nil, -1, false, err
+		}
+		weightCol = idx
+		hasHeader = hasHeader || byName
+	}
+	return cols, weightCol, hasHeader, nil
+}
+
+func loadProfileCategories(path string, p CategoryProfile, src tableSource) ([]CategorySpec, error) {
+	records, err := readEvalRecords(path, src)
+	if err != nil {
+		return nil, err
+	}
+	cols, weightCol, hasHeader, err := resolveProfileCategoryColumns(records[0], p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Aliases {
+		return collectCategoryAliases(records, cols, weightCol, hasHeader), nil
+	}
+	seeds := collectCategoryColumns(records, cols, weightCol, hasHeader)
+	specs := make([]CategorySpec, len(seeds))
+	for i, sd := range seeds {
+		specs[i] = CategorySpec{Label: sd.Label, Weight: sd.Weight}
+	}
+	return specs, nil
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// retryEmbed runs fn until it succeeds, retrying up to maxRetries times with
+// a delay that starts at delay and doubles after each failure. Each retry is
+// logged. When every attempt fails the last error is returned, wrapped with
+// the number of attempts if any retry was made. Waiting stops early when ctx
+// is done.
+func retryEmbed(ctx context.Context, what string, maxRetries int, delay time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxRetries {
+			if attempt == 0 {
+				return err
+			}
+			return fmt.Errorf("%sに %d回失敗しました: %w", what, attempt+1, err)
+		}
+		fmt.Printf("%sに失敗しました。%v 後に再試行します (%d/%d): %v\n", what, delay, attempt+1, maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryEncode retries an encode call with the configured retry settings.
+func (s *Service) retryEncode(ctx context.Context, fn func() error) error {
+	cfg := s.Config()
+	return retryEmbed(ctx, "埋め込み", cfg.EmbedMaxRetries, cfg.EmbedRetryDelay, fn)
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryEmbed(t *testing.T) {
+	errFail := errors.New("一時的な失敗")
+	tests := []struct {
+		name         string
+		failures     int // 成功するまでに失敗する回数
+		maxRetries   int
+		wantAttempts int
+		wantErr      string // 空なら成功
+	}{
+		{"first try", 0, 3, 1, ""},
+		{"succeeds on retry", 2, 3, 3, ""},
+		{"no retries", 5, 0, 1, "一時的な失敗"},
+		{"gives up", 5, 2, 3, "テストに 3回失敗しました: 一時的な失敗"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := retryEmbed(context.Background(), "テスト", tt.maxRetries, time.Millisecond, func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return errFail
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, errFail) {
+				t.Errorf("err does not wrap the last error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryEmbedStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	start := time.Now()
+	err := retryEmbed(ctx, "テスト", 5, time.Hour, func() error {
+		attempts++
+		cancel()
+		return errors.New("失敗")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Errorf("waited %v after cancel", d)
+	}
+}
+
+func TestNewEncoderMissingFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "none")
+	tests := []struct {
+		name    string
+		edit    func(*Config)
+		wantErr string
+	}{
+		{"unset DLL", func(c *Config) { c.OrtDLL = "" }, "OrtDLL が設定されていません"},
+		{"missing DLL", func(c *Config) { c.OrtDLL = missing }, "OrtDLL が見つかりません"},
+		{"missing model", func(c *Config) { c.ModelPath = missing }, "ModelPath が見つかりません"},
+		{"missing tokenizer", func(c *Config) { c.TokenizerPath = missing }, "TokenizerPath が見つかりません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			// 存在するファイルを置き、1つだけ欠けさせる
+			cfg.OrtDLL, cfg.ModelPath, cfg.TokenizerPath = "retry_test.go", "retry_test.go", "retry_test.go"
+			cfg.EmbedMaxRetries = 5
+			cfg.EmbedRetryDelay = time.Hour // 再試行したらテストが終わらない
+			tt.edit(&cfg)
+			_, err := newEncoder(cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newEncoder error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 
 // Run initializes required resources and starts the desktop UI.
 func Run() error {
-	cfg := defaultConfig()
+	cfg := withColumnProfiles(defaultConfig())
 	ensureDirs(cfg.CacheDir)
 	ensureSeedFile(cfg.SeedFile, defaultUserCategories)
 	ensureCategoryRuleFile(cfg.CategoryRuleFile, rawCategoryRules)
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	exportFormatMatrix = "matrix"
+
+	// matrixCSVSuffix / matrixTSVSuffix で終わるファイル名は入力×カテゴリのスコア行列として出力する。
+	matrixCSVSuffix = ".matrix.csv"
+	matrixTSVSuffix = ".matrix.tsv"
+
+	// matrixBlockRows 行ごとに書き出し、大きな行列でも書き込みバッファが膨らまないようにする。
+	matrixBlockRows = 256
+)
+
+// writeScoreMatrix writes the final score of every input against labels.
+// With topN <= 0 it is a dense matrix (one column per category); otherwise
+// it is a sparse long form keeping only each input's topN categories.
+// Rows are flushed in blocks of matrixBlockRows.
+func writeScoreMatrix(w io.Writer, delim rune, rows []ResultRow, labels []string, topN int) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delim
+	header := []string{"row", "text"}
+	if topN > 0 {
+		header = append(header, "rank", "category", "score")
+	} else {
+		header = append(header, labels...)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, r := range rows {
+		if topN > 0 {
+			for rank, label := range topScoredLabels(r.FinalScores, labels, topN) {
+				record := []string{
+					fmt.Sprintf("%d", i+1),
+					r.Text,
+					fmt.Sprintf("%d", rank+1),
+					label,
+					fmt.Sprintf("%.4f", r.FinalScores[label]),
+				}
+				if err := cw.Write(record); err != nil {
+					return err
+				}
+			}
+		} else {
+			record := make([]string, 0, len(labels)+2)
+			record = append(record, fmt.Sprintf("%d", i+1), r.Text)
+			for _, label := range labels {
+				if v, ok := r.FinalScores[label]; ok {
+					record = append(record, fmt.Sprintf("%.4f", v))
+				} else {
+					record = append(record, "")
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		if (i+1)%matrixBlockRows == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// topScoredLabels returns up to n labels with a score, highest first. Ties
+// keep the category order.
+func topScoredLabels(scores map[string]float32, labels []string, n int) []string {
+	out := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if _, ok := scores[label]; ok {
+			out = append(out, label)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return scores[out[i]] > scores[out[j]] })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteScoreMatrix(t *testing.T) {
+	labels := []string{"果物", "野菜", "家電"}
+	rows := []ResultRow{
+		{Text: "りんご", FinalScores: map[string]float32{"果物": 0.9, "野菜": 0.4, "家電": 0.1}},
+		{Text: "トマト", FinalScores: map[string]float32{"果物": 0.5, "野菜": 0.5}}, // 家電なし、同点
+	}
+	tests := []struct {
+		name  string
+		topN  int
+		delim rune
+		want  string
+	}{
+		{"dense", 0, ',', "row,text,果物,野菜,家電\n" +
+			"1,りんご,0.9000,0.4000,0.1000\n" +
+			"2,トマト,0.5000,0.5000,\n"},
+		{"dense tsv", 0, '\t', "row\ttext\t果物\t野菜\t家電\n" +
+			"1\tりんご\t0.9000\t0.4000\t0.1000\n" +
+			"2\tトマト\t0.5000\t0.5000\t\n"},
+		// 同点はカテゴリの並び順
+		{"sparse top 2", 2, ',', "row,text,rank,category,score\n" +
+			"1,りんご,1,果物,0.9000\n" +
+			"1,りんご,2,野菜,0.4000\n" +
+			"2,トマト,1,果物,0.5000\n" +
+			"2,トマト,2,野菜,0.5000\n"},
+		{"sparse beyond categories", 5, ',', "row,text,rank,category,score\n" +
+			"1,りんご,1,果物,0.9000\n" +
+			"1,りんご,2,野菜,0.4000\n" +
+			"1,りんご,3,家電,0.1000\n" +
+			"2,トマト,1,果物,0.5000\n" +
+			"2,トマト,2,野菜,0.5000\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeScoreMatrix(&buf, tt.delim, rows, labels, tt.topN); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// lineMarks records how many lines had been written at the end of each
+// Write call that reaches it.
+type lineMarks struct {
+	lines int
+	marks map[int]bool
+}
+
+func (w *lineMarks) Write(p []byte) (int, error) {
+	w.lines += bytes.Count(p, []byte("\n"))
+	w.marks[w.lines] = true
+	return len(p), nil
+}
+
+func TestWriteScoreMatrixBlocks(t *testing.T) {
+	labels := []string{"果物"}
+	rows := make([]ResultRow, 2*matrixBlockRows+1)
+	for i := range rows {
+		rows[i] = ResultRow{Text: "りんご", FinalScores: map[string]float32{"果物": 0.5}}
+	}
+	for _, topN := range []int{0, 1} {
+		w := &lineMarks{marks: make(map[int]bool)}
+		if err := writeScoreMatrix(w, ',', rows, labels, topN); err != nil {
+			t.Fatal(err)
+		}
+		// 見出しと matrixBlockRows 行ごとの区切りで書き出しが終わっている
+		for _, want := range []int{1 + matrixBlockRows, 1 + 2*matrixBlockRows, 1 + len(rows)} {
+			if !w.marks[want] {
+				t.Errorf("topN %d: no write ended after line %d", topN, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import "context"
+
+// AddSeeds embeds only the labels that are not already user categories and
+// appends them, leaving the existing vectors (including centroids and
+// aliases from a richer category file) untouched. Labels are cleaned like
+// UpdateCategories and get their Config.SeedAliasFile aliases. It returns
+// the number of categories added.
+func (s *Service) AddSeeds(ctx context.Context, labels []string) (int, error) {
+	trimPunct := s.Config().TrimLabelPunct
+	s.mu.RLock()
+	existing := make(map[string]struct{}, len(s.candsCat))
+	for _, c := range s.candsCat {
+		existing[c.Key] = struct{}{}
+	}
+	s.mu.RUnlock()
+
+	langByKey := make(map[string]string)
+	fresh := make([]string, 0, len(labels))
+	for _, raw := range labels {
+		lang, name := splitLanguageTag(raw)
+		if trimPunct {
+			name = trimLabelDecoration(name)
+		}
+		key := normalizeKey(name)
+		if _, ok := existing[key]; ok || key == "" {
+			continue
+		}
+		if lang != "" {
+			langByKey[key] = lang
+		}
+		fresh = append(fresh, name)
+	}
+	fresh = uniqueNormalized(fresh)
+	if len(fresh) == 0 {
+		return 0, nil
+	}
+	// 差分だけのラベル集合でインデックスファイルを作らないよう、保存なしで埋め込む
+	cands, vecs, err := s.embedLabelSet(ctx, fresh, "seed")
+	if err != nil {
+		return 0, err
+	}
+	if err := s.applyCategoryAliases(ctx, cands, s.seedFileAliases()); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 埋め込み中に同じカテゴリが追加されていれば二重に入れない
+	present := make(map[string]struct{}, len(s.candsCat))
+	for _, c := range s.candsCat {
+		present[c.Key] = struct{}{}
+	}
+	nextCands := append([]Candidate(nil), s.candsCat...)
+	nextCats := append([]string(nil), s.userCats...)
+	nextVec := make(map[string][]float32, len(s.seedVec)+len(cands))
+	for k, v := range s.seedVec {
+		nextVec[k] = v
+	}
+	added := 0
+	for _, c := range cands {
+		if _, ok := present[c.Key]; ok {
+			continue
+		}
+		c.Lang = langByKey[c.Key]
+		c.Weight = clampSeedWeight(0)
+		nextCands = append(nextCands, c)
+		nextCats = append(nextCats, c.Label)
+		nextVec[c.Label] = vecs[c.Label]
+		added++
+	}
+	s.candsCat = nextCands
+	s.userCats = nextCats
+	s.seedVec = nextVec
+	return added, nil
+}
+
+// RemoveSeeds drops the user categories whose normalized label matches one
+// of labels, without re-embedding the rest. It returns the number removed.
+func (s *Service) RemoveSeeds(labels []string) int {
+	drop := make(map[string]struct{}, len(labels))
+	for _, raw := range labels {
+		_, name := splitLanguageTag(raw)
+		if key := normalizeKey(name); key != "" {
+			drop[key] = struct{}{}
+		}
+		if key := normalizeKey(trimLabelDecoration(name)); key != "" {
+			drop[key] = struct{}{}
+		}
+	}
+	if len(drop) == 0 {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nextCands := make([]Candidate, 0, len(s.candsCat))
+	nextVec := make(map[string][]float32, len(s.seedVec))
+	removed := 0
+	for _, c := range s.candsCat {
+		if _, ok := drop[c.Key]; ok {
+			removed++
+			continue
+		}
+		nextCands = append(nextCands, c)
+		if v, ok := s.seedVec[c.Label]; ok {
+			nextVec[c.Label] = v
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+	nextCats := make([]string, 0, len(s.userCats))
+	for _, lab := range s.userCats {
+		if _, ok := drop[normalizeKey(lab)]; !ok {
+			nextCats = append(nextCats, lab)
+		}
+	}
+	s.candsCat = nextCands
+	s.userCats = nextCats
+	s.seedVec = nextVec
+	return removed
+}
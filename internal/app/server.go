@@ -0,0 +1,113 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxRequestBytes はリクエスト本文の上限 (8MB)。
+const maxRequestBytes = 8 << 20
+
+type classifyRequest struct {
+	Texts   []string `json:"texts"`
+	Sources []string `json:"sources,omitempty"`
+}
+
+type seedsRequest struct {
+	Labels []string `json:"labels"`
+}
+
+// Serve initializes the service like Run and answers classification requests
+// over HTTP instead of opening the desktop UI.
+//
+//	POST /classify {"texts": [...], "sources": ["seed"|"ndc"]} -> []ResultRow
+//	POST /seeds    {"labels": [...]}                           -> {"count": n}
+//	GET  /healthz                                              -> {"status": "ok", "model": ..., "dim": ..., "backend": ..., "cache": {...}}
+func Serve(addr string, cfg Config) error {
+	ensureDirs(cfg.CacheDir)
+	ensureSeedFile(cfg.SeedFile, defaultUserCategories)
+	ensureCategoryRuleFile(cfg.CategoryRuleFile, rawCategoryRules)
+
+	svc, err := NewService(cfg)
+	if err != nil {
+		return err
+	}
+	defer svc.Close()
+
+	fmt.Printf("HTTPサーバーを起動します (%s)\n", addr)
+	return http.ListenAndServe(addr, newServerMux(svc))
+}
+
+func newServerMux(svc *Service) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /classify", func(w http.ResponseWriter, r *http.Request) {
+		var req classifyRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(req.Texts) == 0 {
+			writeJSONError(w, http.StatusBadRequest, errors.New("texts が空です"))
+			return
+		}
+		rows, err := svc.ClassifyAllFiltered(r.Context(), req.Texts, req.Sources, nil)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rows)
+	})
+	// UpdateCategories は埋め込み後に Service のロック下で候補を差し替えるため、
+	// 分類中のリクエストとは競合しない。
+	mux.HandleFunc("POST /seeds", func(w http.ResponseWriter, r *http.Request) {
+		var req seedsRequest
+		if err := decodeRequest(w, r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(req.Labels) == 0 {
+			writeJSONError(w, http.StatusBadRequest, errors.New("labels が空です"))
+			return
+		}
+		count, err := svc.UpdateCategories(r.Context(), req.Labels)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"count": count})
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		modelID, dim := svc.ModelInfo()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":     "ok",
+			"categories": len(svc.categoryLabels()),
+			"mode":       svc.Config().Mode,
+			"model":      modelID,
+			"dim":        dim,
+			"backend":    svc.Backend(),
+			"cache":      svc.CacheStats(),
+		})
+	})
+	return mux
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("リクエストJSONを解釈できません: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -4,41 +4,123 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	emb "yashubustudio/categorizer/emb"
 )
 
+// ErrNoCandidates is returned by RankOne when Config.NoCandidate is
+// NoCandidateError and no category or NDC candidate is registered at all.
+// A single input without any scoring candidate is not an error; its row is
+// marked with ResultRow.NoCandidates instead.
+var ErrNoCandidates = errors.New("候補がありません (カテゴリ・NDC とも未登録)")
+
+// textEncoder is what Service needs from the embedding model. *emb.Encoder
+// implements it; tests substitute a deterministic encoder.
+type textEncoder interface {
+	Encode(text string) ([]float32, error)
+	EncodeBatch(texts []string) ([][]float32, error)
+	Sessions() int
+	Backend() string
+	Close()
+}
+
 type Service struct {
 	mu            sync.RWMutex
 	cfg           Config
-	emb           *emb.Encoder
+	emb           textEncoder
 	cache         *embedCache
 	userCats      []string
 	ndcItems      []ndcItem
 	candsCat      []Candidate
 	candsNDC      []Candidate
+	ndcIndex      VectorIndex // candsNDC を Config.NDCIndex の方法で検索する
 	categoryRules map[string]compiledRuleSet
 	seedVec       map[string][]float32
-	ndcVec        map[string][]float32
+	// catMembers はカテゴリごとのセントロイドの材料 (ラベルと例文のベクトル)。
+	// 例文の無いカテゴリは含まない。CategoryQuality で使う。
+	catMembers map[string][][]float32
+	ndcVec     map[string][]float32
 }
 
 func NewService(cfg Config) (*Service, error) {
 	cfg = sanitizeConfig(cfg)
-	enc := &emb.Encoder{}
-	if err := enc.Init(emb.Config{
-		OrtDLL:        cfg.OrtDLL,
-		ModelPath:     cfg.ModelPath,
-		TokenizerPath: cfg.TokenizerPath,
-		MaxSeqLen:     cfg.MaxSeqLen,
-	}); err != nil {
+	enc, err := newEncoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	warmDim := 0
+	if cfg.WarmUp {
+		warmDim = warmUpEncoder(enc)
+	}
+	return newService(cfg, enc, cacheModelID(cfg), warmDim)
+}
+
+// newEncoder initializes the ONNX encoder cfg describes, retrying like the
+// other embedding calls. Missing files fail at once without retrying.
+func newEncoder(cfg Config) (*emb.Encoder, error) {
+	if err := checkEncoderFiles(cfg); err != nil {
+		return nil, err
+	}
+	var enc *emb.Encoder
+	err := retryEmbed(context.Background(), "モデルの初期化", cfg.EmbedMaxRetries, cfg.EmbedRetryDelay, func() error {
+		enc = &emb.Encoder{}
+		err := enc.Init(emb.Config{
+			OrtDLL:         cfg.OrtDLL,
+			ModelPath:      cfg.ModelPath,
+			TokenizerPath:  cfg.TokenizerPath,
+			MaxSeqLen:      cfg.MaxSeqLen,
+			Pooling:        cfg.Pooling,
+			IntraOpThreads: cfg.IntraOpThreads,
+			InterOpThreads: cfg.InterOpThreads,
+			Sessions:       cfg.EmbedWorkers,
+
+			ExecutionProvider: cfg.ExecutionProvider,
+			DeviceID:          cfg.DeviceID,
+		})
+		if err != nil {
+			enc.Close() // 途中まで作ったセッションと ORT 環境を破棄してからやり直す
+		}
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	return enc, nil
+}
 
+// checkEncoderFiles reports an unset or missing ORT DLL, model or tokenizer
+// before newEncoder starts retrying, since waiting does not fix them. Bad
+// pooling or execution provider values are already replaced by
+// sanitizeConfig.
+func checkEncoderFiles(cfg Config) error {
+	files := []struct{ name, path string }{
+		{"OrtDLL", cfg.OrtDLL},
+		{"ModelPath", cfg.ModelPath},
+		{"TokenizerPath", cfg.TokenizerPath},
+	}
+	for _, f := range files {
+		if strings.TrimSpace(f.path) == "" {
+			return fmt.Errorf("%s が設定されていません", f.name)
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("%s が見つかりません: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// newService builds a Service around an initialized encoder: it loads the
+// seed, rule and NDC files named in cfg and embeds the candidates. modelID
+// keys the embedding cache and warmDim is the vector length seen during
+// warm-up (0 if unknown). enc is closed when an error is returned.
+func newService(cfg Config, enc textEncoder, modelID string, warmDim int) (*Service, error) {
 	initialCats, fromFile, catErr := initialUserCategories(cfg.SeedFile)
 	if catErr != nil {
 		if errors.Is(catErr, os.ErrNotExist) {
@@ -61,26 +143,74 @@ func NewService(cfg Config) (*Service, error) {
 		fmt.Printf("カテゴリルールを %s から読み込みました (%dカテゴリ)\n", cfg.CategoryRuleFile, len(categoryRules))
 	}
 
+	ndcItems, ndcFromFile, ndcErr := initialNDCItems(cfg.NDCFile)
+	if ndcErr != nil {
+		fmt.Printf("NDCファイルの読み込みに失敗したため組み込みの一覧を使用します (%s): %v\n", cfg.NDCFile, ndcErr)
+	} else if ndcFromFile {
+		fmt.Printf("NDC一覧を %s から読み込みました (%d件)\n", cfg.NDCFile, len(ndcItems))
+	}
+
 	svc := &Service{
 		cfg:           cfg,
 		emb:           enc,
-		cache:         newEmbedCache(cfg.CacheDir, filepath.Base(cfg.ModelPath)),
+		cache:         newEmbedCache(cfg.CacheDir, modelID),
 		userCats:      initialCats,
-		ndcItems:      append([]ndcItem(nil), defaultNDCLabels...),
+		ndcItems:      ndcItems,
 		categoryRules: categoryRules,
 	}
+	svc.cache.setLimit(cfg.MemCacheEntries)
+	if warmDim > 0 {
+		_ = svc.cache.observeEncoded(warmDim)
+	}
 
 	if err := svc.refreshNDCCandidates(context.Background()); err != nil {
 		enc.Close()
 		return nil, err
 	}
-	if _, err := svc.UpdateCategories(context.Background(), svc.userCats); err != nil {
+	// 別名ファイルにだけあるカテゴリも起動時のカテゴリに加える。別名そのものは
+	// updateCategories が別名ファイルから付ける
+	initialSpecs := labelSpecs(svc.userCats)
+	if path := strings.TrimSpace(cfg.SeedAliasFile); path != "" {
+		src := categorySource(cfg)
+		if aliases, err := ParseSeedAliases(path, src.encoding, src.sheet); err == nil {
+			initialSpecs = withSeedAliases(svc.userCats, aliases)
+			fmt.Printf("カテゴリ別名を %s から読み込みました (%dカテゴリ)\n", path, len(aliases))
+		}
+	}
+	if _, err := svc.updateCategories(context.Background(), initialSpecs); err != nil {
 		enc.Close()
 		return nil, err
 	}
+	if pairs := svc.DetectAmbiguousCategories(ambiguousCategoryThreshold); len(pairs) > 0 {
+		fmt.Printf("非常に似ているカテゴリがあります (%d組):\n%s\n", len(pairs), formatAmbiguousPairs(pairs))
+	}
 	return svc, nil
 }
 
+// embedWorkers is the number of chunks EmbedBatchCached embeds at once,
+// capped by the sessions the encoder actually opened.
+func (s *Service) embedWorkers() int {
+	n := s.Config().EmbedWorkers
+	if sessions := s.emb.Sessions(); n > sessions {
+		n = sessions
+	}
+	return n
+}
+
+// warmUpEncoder runs one throwaway encode so ONNX Runtime's lazy allocations
+// happen at startup rather than on the first real classification. It returns
+// the model's vector length, or 0 when the encode failed.
+func warmUpEncoder(enc textEncoder) int {
+	start := time.Now()
+	v, err := enc.Encode("ウォームアップ")
+	if err != nil {
+		fmt.Println("ウォームアップに失敗しました:", err)
+		return 0
+	}
+	fmt.Printf("ウォームアップ完了 (%.2fs)\n", time.Since(start).Seconds())
+	return len(v)
+}
+
 func (s *Service) Close() {
 	if s.emb != nil {
 		s.emb.Close()
@@ -94,12 +224,28 @@ func (s *Service) Config() Config {
 }
 
 func (s *Service) UpdateConfig(cfg Config) Config {
+	cfg, indexChanged := s.setConfig(cfg)
+	if indexChanged {
+		if err := s.refreshNDCCandidates(context.Background()); err != nil {
+			fmt.Printf("NDC の検索インデックスを作り直せませんでした: %v\n", err)
+		}
+	}
+	return cfg
+}
+
+// setConfig is UpdateConfig without rebuilding the NDC index; indexChanged
+// reports whether the caller has to. ImportState uses it directly because
+// it builds the index from the imported vectors instead of re-embedding.
+func (s *Service) setConfig(cfg Config) (_ Config, indexChanged bool) {
 	cfg = sanitizeConfig(cfg)
 	var prevRuleFile string
 	s.mu.Lock()
 	prevRuleFile = s.cfg.CategoryRuleFile
+	indexChanged = s.cfg.NDCIndex != cfg.NDCIndex || s.cfg.Metric != cfg.Metric ||
+		s.cfg.HNSWEfSearch != cfg.HNSWEfSearch || s.cfg.ExternalIndexURL != cfg.ExternalIndexURL
 	s.cfg = cfg
 	s.mu.Unlock()
+	s.cache.setLimit(cfg.MemCacheEntries)
 
 	if cfg.CategoryRuleFile != prevRuleFile {
 		rules, fromFile, err := loadCompiledCategoryRules(cfg.CategoryRuleFile)
@@ -116,7 +262,33 @@ func (s *Service) UpdateConfig(cfg Config) Config {
 		s.categoryRules = rules
 		s.mu.Unlock()
 	}
-	return cfg
+	return cfg, indexChanged
+}
+
+// CacheStats returns the embedding cache counters since startup (or the
+// last ClearCache).
+func (s *Service) CacheStats() CacheStats {
+	return s.cache.stats()
+}
+
+// ClearCache drops the in-memory embeddings and, with includeDisk, this
+// model's vector files in Config.CacheDir. It returns the number of files
+// removed. Files of other models are kept.
+func (s *Service) ClearCache(includeDisk bool) (int, error) {
+	return s.cache.clear(includeDisk)
+}
+
+// ModelInfo returns the identifier of the loaded model (as used for cache
+// keys, e.g. "bge-m3/model.onnx@1a2b3c4d5e6f") and the embedding dimension,
+// which is 0 until the first embedding.
+func (s *Service) ModelInfo() (string, int) {
+	return s.cache.modelID, s.cache.dimension()
+}
+
+// Backend returns the execution provider the encoder actually runs on, e.g.
+// "cpu" or "cuda:0". It is "cpu" when a requested GPU was unavailable.
+func (s *Service) Backend() string {
+	return s.emb.Backend()
 }
 
 func (s *Service) CandidateStats() (int, int) {
@@ -126,38 +298,113 @@ func (s *Service) CandidateStats() (int, int) {
 }
 
 func (s *Service) refreshNDCCandidates(ctx context.Context) error {
-	texts := make([]string, 0, len(s.ndcItems))
-	for _, it := range s.ndcItems {
-		texts = append(texts, normalize(it.Code+" "+it.Label))
-	}
-	cands, vecs, err := s.embedLabelSet(ctx, texts, "ndc")
-	if err != nil {
-		return err
+	cfg := s.Config()
+	var cands []Candidate
+	var vecs map[string][]float32
+	if cfg.NDCIndex != NDCIndexExternal {
+		// 外部インデックスでは NDC を手元で埋め込まない
+		var err error
+		cands, vecs, err = s.embedLabelSetStored(ctx, s.ndcLabelTexts(), "ndc")
+		if err != nil {
+			return err
+		}
 	}
+	idx := newNDCIndex(cfg, cands)
 	s.mu.Lock()
 	s.candsNDC = cands
 	s.ndcVec = vecs
+	s.ndcIndex = idx
 	s.mu.Unlock()
 	return nil
 }
 
+// newNDCIndex builds the index Config.NDCIndex selects over cands.
+func newNDCIndex(cfg Config, cands []Candidate) VectorIndex {
+	var idx VectorIndex
+	switch cfg.NDCIndex {
+	case NDCIndexExternal:
+		return NewExternalIndex(cfg.ExternalIndexURL, "ndc")
+	case NDCIndexHNSW:
+		idx = NewHNSWIndex(cfg.Metric, cfg.HNSWEfSearch)
+	default:
+		idx = NewInMemoryIndex(cfg.Metric)
+	}
+	_ = idx.Replace(cands) // 手元のインデックスの Replace は失敗しない
+	return idx
+}
+
+func (s *Service) ndcLabelTexts() []string {
+	texts := make([]string, 0, len(s.ndcItems))
+	for _, it := range s.ndcItems {
+		texts = append(texts, normalize(it.Code+" "+it.Label))
+	}
+	return texts
+}
+
 func (s *Service) UpdateCategories(ctx context.Context, labels []string) (int, error) {
-	sanitized := uniqueNormalized(labels)
-	cands, vecs, err := s.embedLabelSet(ctx, sanitized, "seed")
+	return s.updateCategories(ctx, labelSpecs(labels))
+}
+
+// updateCategories embeds specs as the user categories. For duplicate
+// labels the first spec wins. Extra texts are folded into the label vector
+// as a centroid; aliases, including those Config.SeedAliasFile gives the
+// label, are embedded separately and matched as the label.
+func (s *Service) updateCategories(ctx context.Context, specs []CategorySpec) (int, error) {
+	trimPunct := s.Config().TrimLabelPunct
+	fileAliases := s.seedFileAliases()
+	langByKey := make(map[string]string)
+	specByKey := make(map[string]CategorySpec)
+	cleaned := make([]string, len(specs))
+	for i, sp := range specs {
+		lang, name := splitLanguageTag(sp.Label)
+		if trimPunct {
+			name = trimLabelDecoration(name)
+		}
+		key := normalizeKey(name)
+		if lang != "" {
+			langByKey[key] = lang
+		}
+		if _, ok := specByKey[key]; !ok {
+			specByKey[key] = sp
+		}
+		cleaned[i] = name
+	}
+	sanitized := uniqueNormalized(cleaned)
+	cands, vecs, err := s.embedLabelSetStored(ctx, sanitized, "seed")
 	if err != nil {
 		return 0, err
 	}
+	extrasByKey := make(map[string][]string)
+	aliasesByKey := make(map[string][]string)
+	for i := range cands {
+		sp := specByKey[cands[i].Key]
+		cands[i].Lang = langByKey[cands[i].Key]
+		cands[i].Weight = clampSeedWeight(sp.Weight)
+		extrasByKey[cands[i].Key] = sp.extraTexts()
+		// 別名ファイルの別名は読み込んだカテゴリの別名に足す (重複は applyCategoryAliases で除く)
+		aliasesByKey[cands[i].Key] = append(append([]string(nil), sp.Aliases...), fileAliases[cands[i].Key]...)
+	}
+	members, err := s.applyCategoryCentroids(ctx, cands, vecs, extrasByKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.applyCategoryAliases(ctx, cands, aliasesByKey); err != nil {
+		return 0, err
+	}
 	s.mu.Lock()
 	s.userCats = sanitized
 	s.candsCat = cands
 	s.seedVec = vecs
+	s.catMembers = members
 	s.mu.Unlock()
 	return len(cands), nil
 }
 
 func (s *Service) embedLabelSet(ctx context.Context, labels []string, source string) ([]Candidate, map[string][]float32, error) {
-	res := make([]Candidate, 0, len(labels))
-	vecs := make(map[string][]float32, len(labels))
+	type pending struct {
+		display, key, text string
+	}
+	items := make([]pending, 0, len(labels))
 	seen := make(map[string]struct{})
 	for _, raw := range labels {
 		display := normalize(raw)
@@ -172,19 +419,157 @@ func (s *Service) embedLabelSet(ctx context.Context, labels []string, source str
 			continue
 		}
 		seen[key] = struct{}{}
-		embedText := normalizeText(display)
+		embedText := s.embedText(display)
 		if embedText == "" {
 			continue
 		}
-		vec, err := s.EmbedCached(ctx, embedText)
+		items = append(items, pending{display: display, key: key, text: embedText})
+	}
+
+	texts := make([]string, len(items))
+	for i, it := range items {
+		texts[i] = it.text
+	}
+	embedded, err := s.EmbedBatchCached(ctx, texts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := make([]Candidate, 0, len(items))
+	vecs := make(map[string][]float32, len(items))
+	for i, it := range items {
+		vecCopy := append([]float32(nil), embedded[i]...)
+		res = append(res, Candidate{Label: it.display, Key: it.key, Vec: vecCopy, Norm: vecNorm(vecCopy), Source: source})
+		vecs[it.display] = vecCopy
+	}
+	return res, vecs, nil
+}
+
+// EmbedBatchCached embeds texts in input order. Cached vectors (memory or
+// disk) are reused; only the misses go to the encoder, in chunks of
+// Config.BatchSize, and are spliced back at their original positions.
+func (s *Service) EmbedBatchCached(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	missIdx := make(map[string][]int)
+	misses := make([]string, 0)
+	for i, text := range texts {
+		key := cacheKey(text, s.cache.modelID)
+		if v, ok := s.cache.get(key); ok {
+			out[i] = v
+			continue
+		}
+		if v, ok, err := s.cache.load(key); err != nil {
+			return nil, err
+		} else if ok {
+			s.cache.put(key, v)
+			out[i] = v
+			continue
+		}
+		s.cache.countMiss()
+		if _, ok := missIdx[text]; !ok {
+			misses = append(misses, text)
+		}
+		missIdx[text] = append(missIdx[text], i)
+	}
+
+	batchSize := s.Config().BatchSize
+	if batchSize <= 1 {
+		batchSize = 1
+	}
+	chunks := make([][]string, 0, (len(misses)+batchSize-1)/batchSize)
+	for start := 0; start < len(misses); start += batchSize {
+		end := start + batchSize
+		if end > len(misses) {
+			end = len(misses)
+		}
+		chunks = append(chunks, misses[start:end])
+	}
+
+	// 各チャンクの結果は out の自分の位置にだけ書くので、ワーカー間で順序は崩れない。
+	embedChunk := func(chunk []string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var vecs [][]float32
+		err := s.retryEncode(ctx, func() error {
+			if len(chunk) == 1 {
+				v, err := s.emb.Encode(chunk[0])
+				vecs = [][]float32{v}
+				return err
+			}
+			var err error
+			vecs, err = s.emb.EncodeBatch(chunk)
+			return err
+		})
 		if err != nil {
-			return nil, nil, err
+			return err
+		}
+		if len(vecs) > 0 {
+			if err := s.cache.observeEncoded(len(vecs[0])); err != nil {
+				return err
+			}
 		}
-		vecCopy := append([]float32(nil), vec...)
-		res = append(res, Candidate{Label: display, Key: key, Vec: vecCopy, Source: source})
-		vecs[display] = vecCopy
+		for j, text := range chunk {
+			key := cacheKey(text, s.cache.modelID)
+			s.cache.put(key, vecs[j])
+			if err := s.cache.save(key, vecs[j]); err != nil {
+				fmt.Println("cache save error:", err)
+			}
+			for _, idx := range missIdx[text] {
+				out[idx] = vecs[j]
+			}
+		}
+		return nil
 	}
-	return res, vecs, nil
+
+	workers := s.embedWorkers()
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	if workers <= 1 {
+		for _, chunk := range chunks {
+			if err := embedChunk(chunk); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan []string)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				if err := embedChunk(chunk); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for _, chunk := range chunks {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- chunk
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 func (s *Service) EmbedCached(ctx context.Context, text string) ([]float32, error) {
@@ -198,10 +583,22 @@ func (s *Service) EmbedCached(ctx context.Context, text string) ([]float32, erro
 		s.cache.put(key, v)
 		return v, nil
 	}
-	v, err := s.emb.Encode(text)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.cache.countMiss()
+	var v []float32
+	err := s.retryEncode(ctx, func() error {
+		var err error
+		v, err = s.emb.Encode(text)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	if err := s.cache.observeEncoded(len(v)); err != nil {
+		return nil, err
+	}
 	s.cache.put(key, v)
 	if err := s.cache.save(key, v); err != nil {
 		fmt.Println("cache save error:", err)
@@ -209,11 +606,39 @@ func (s *Service) EmbedCached(ctx context.Context, text string) ([]float32, erro
 	return v, nil
 }
 
+// ClassifyAll ranks every text in order. When Config.MaxRuntime is set and the
+// deadline passes, the rows completed so far are returned and the remaining
+// ones are marked Pending instead of failing the whole run.
 func (s *Service) ClassifyAll(ctx context.Context, texts []string, progress func(done, total int)) ([]ResultRow, error) {
 	results := make([]ResultRow, len(texts))
 	total := len(texts)
+	runCtx := ctx
+	if maxRuntime := s.Config().MaxRuntime; maxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, maxRuntime)
+		defer cancel()
+	}
+	batchSize := s.Config().BatchSize
 	for i, t := range texts {
-		row, err := s.RankOne(ctx, t)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if runCtx.Err() != nil {
+			for j := i; j < total; j++ {
+				results[j] = ResultRow{Text: texts[j], Pending: true}
+			}
+			break
+		}
+		if batchSize > 1 && i%batchSize == 0 {
+			end := i + batchSize
+			if end > total {
+				end = total
+			}
+			if err := s.prefetchEmbeddings(ctx, texts[i:end]); err != nil {
+				return nil, err
+			}
+		}
+		row, err := s.rankOne(ctx, t)
 		if err != nil {
 			return nil, err
 		}
@@ -222,13 +647,140 @@ func (s *Service) ClassifyAll(ctx context.Context, texts []string, progress func
 			progress(i+1, total)
 		}
 	}
-	return results, nil
+	return runPostProcess(ctx, s.Config().PostProcessCommand, results), nil
+}
+
+// ClassifyAllFiltered is ClassifyAll with Suggestions and NDCSuggestions
+// restricted to the given sources ("seed" / "ndc"; "seed" also matches
+// hybrid-scored categories), applied after ranking so one service can serve
+// consumers that want only one side regardless of mode (in the split modes
+// the NDC candidates are only in NDCSuggestions). An empty sources list
+// keeps everything.
+func (s *Service) ClassifyAllFiltered(ctx context.Context, texts []string, sources []string, progress func(done, total int)) ([]ResultRow, error) {
+	rows, err := s.ClassifyAll(ctx, texts, progress)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return rows, nil
+	}
+	for i := range rows {
+		rows[i].Suggestions = filterSources(rows[i].Suggestions, sources)
+		rows[i].NDCSuggestions = filterSources(rows[i].NDCSuggestions, sources)
+	}
+	return rows, nil
 }
 
+// filterSources keeps suggestions having at least one of the wanted sources.
+func filterSources(sugs []Suggestion, sources []string) []Suggestion {
+	if len(sugs) == 0 {
+		return sugs
+	}
+	want := make(map[string]struct{}, len(sources)+1)
+	for _, src := range sources {
+		src = strings.TrimSpace(src)
+		want[src] = struct{}{}
+		if src == "seed" {
+			want["hybrid"] = struct{}{}
+		}
+	}
+	out := make([]Suggestion, 0, len(sugs))
+	for _, sug := range sugs {
+		for _, part := range strings.Split(sug.Source, ",") {
+			if _, ok := want[strings.TrimSpace(part)]; ok {
+				out = append(out, sug)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ClassifyLabels returns only the best label per input (after
+// PostProcessCommand), or unclassifiedLabel when no candidate is available.
+func (s *Service) ClassifyLabels(ctx context.Context, texts []string) ([]string, error) {
+	rows := make([]ResultRow, len(texts))
+	for i, t := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		row, err := s.rankOne(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = row
+	}
+	rows = runPostProcess(ctx, s.Config().PostProcessCommand, rows)
+	labels := make([]string, len(rows))
+	for i, row := range rows {
+		labels[i] = topLabel(row)
+	}
+	return labels, nil
+}
+
+func topLabel(row ResultRow) string {
+	if len(row.Suggestions) == 0 || row.Suggestions[0].Label == emptyInputLabel {
+		return unclassifiedLabel
+	}
+	return row.Suggestions[0].Label
+}
+
+// prepareText applies the configured input cleanup and returns the string
+// that is embedded for text.
+func (s *Service) prepareText(text string) string {
+	if s.Config().StripHTML {
+		text = stripHTML(text)
+	}
+	return s.embedText(text)
+}
+
+// embedText normalizes s the way every text is normalized before it is
+// embedded: NFKC and whitespace, then Config.CaseFold and
+// Config.StripPunctuation. Inputs and category names go through the same
+// steps so they stay comparable and share cache keys.
+func (s *Service) embedText(text string) string {
+	cfg := s.Config()
+	return foldText(normalize(text), cfg.CaseFold, cfg.StripPunctuation)
+}
+
+// prefetchEmbeddings batch-embeds the given inputs into the cache so the
+// following RankOne calls only hit memory.
+func (s *Service) prefetchEmbeddings(ctx context.Context, texts []string) error {
+	if s.Config().BatchSize <= 1 {
+		return nil
+	}
+	prepared := make([]string, 0, len(texts))
+	for _, t := range texts {
+		if p := s.prepareText(t); p != "" {
+			prepared = append(prepared, p)
+		}
+	}
+	_, err := s.EmbedBatchCached(ctx, prepared)
+	return err
+}
+
+// RankOne ranks a single text and passes the row through
+// PostProcessCommand, like one row of ClassifyAll. The command is started
+// once per call, so callers ranking many texts should use ClassifyAll or
+// ClassifyStream, which run it once per batch.
 func (s *Service) RankOne(ctx context.Context, text string) (ResultRow, error) {
+	row, err := s.rankOne(ctx, text)
+	if err != nil {
+		return row, err
+	}
+	return runPostProcess(ctx, s.Config().PostProcessCommand, []ResultRow{row})[0], nil
+}
+
+// rankOne ranks text without PostProcessCommand, for the callers that run
+// the hook once over a whole batch.
+func (s *Service) rankOne(ctx context.Context, text string) (ResultRow, error) {
 	row := ResultRow{Text: text}
-	normalized := normalizeText(text)
+	normalized := s.prepareText(text)
 	if normalized == "" {
+		// 空行を残す設定のときだけ「未分類(空)」を1件返す。それ以外は候補なしの要確認
+		if s.Config().KeepEmptyRows {
+			row.Suggestions = []Suggestion{{Label: emptyInputLabel, Source: "empty"}}
+		}
 		row.NeedReview = true
 		return row, nil
 	}
@@ -242,31 +794,68 @@ func (s *Service) RankOne(ctx context.Context, text string) (ResultRow, error) {
 	cfg := s.cfg
 	catCands := append([]Candidate(nil), s.candsCat...)
 	ndcCands := append([]Candidate(nil), s.candsNDC...)
+	ndcIndex := s.ndcIndex
 	rules := s.categoryRules
 	seedVec := cloneVecMap(s.seedVec)
 	ndcVec := cloneVecMap(s.ndcVec)
 	s.mu.RUnlock()
 
+	if cfg.NoCandidate == NoCandidateError && len(catCands) == 0 && (!ndcEnabled(cfg) || ndcIndex == nil || ndcIndex.Size() == 0) {
+		return row, ErrNoCandidates
+	}
+	if err := checkCandidateDims(vec, catCands, ndcCands); err != nil {
+		return row, err
+	}
+
 	topK := cfg.TopK
 
-	baseScores := computeBaseScores(vec, catCands)
-	hybridAll, ruleBonus, finalScores := applyHybridScoring(normalized, catCands, baseScores, cfg.SeedBias, rules)
-	seeds := truncateSuggestions(hybridAll, topK)
+	if cfg.LanguageRouting {
+		catCands = filterCandidatesByLanguage(catCands, detectLanguage(normalized))
+	}
+
+	sim := metricFunc(cfg.Metric)
+	baseScores, rawScores := computeBaseScores(vec, catCands, sim)
+	// キーワード・カテゴリ名の照合は大文字小文字を区別しない (ルールは小文字で保持している)
+	matchText := normalized
+	if !cfg.CaseFold {
+		matchText = strings.ToLower(normalized)
+	}
+	if cfg.StripPunctuation {
+		rules = stripRulePunctuation(rules)
+	}
+	hybridAll, ruleBonus, finalScores, keywordSpans := applyHybridScoring(matchText, catCands, baseScores, cfg.SeedBias, cfg.SubstringBoost, cfg.TieBreak, rules, cfg.StripPunctuation)
+	for i := range hybridAll {
+		hybridAll[i].RawScore = rawScores[hybridAll[i].Label]
+	}
+	seeds := truncateSuggestions(filterMinScore(hybridAll, cfg.MinScore, cfg.CategoryThresholds), topK)
+	row.BelowMinScore = len(seeds) == 0 && len(hybridAll) > 0
 
 	row.BaseScores = baseScores
 	row.RuleBonus = ruleBonus
+	row.Normalized = normalized
+	row.KeywordSpans = keywordSpans
 	row.FinalScores = finalScores
+	row.SeedRawScores = rawScores
 
-	useNDC := (cfg.Mode != ModeSeeded && cfg.UseNDC) || cfg.Mode == ModeSplit
+	useNDC := ndcEnabled(cfg)
 	ndc := []Suggestion{}
+	var ndcAll []Suggestion
 	if useNDC {
-		ndc = scoreCandidates(vec, ndcCands, cfg.WeightNDC, 0)
-		ndc = truncateSuggestions(ndc, topK)
+		ndcAll, err = searchNDC(ctx, ndcIndex, vec, cfg, topK)
+		if err != nil {
+			return row, err
+		}
+		row.NDCScores = suggestionScoreMap(ndcAll)
+		row.NDCRawScores = suggestionRawScoreMap(ndcAll)
+		ndc = truncateSuggestions(filterMinScore(ndcAll, cfg.MinScore, cfg.CategoryThresholds), topK)
+	}
+	if cfg.ScoreBreakdown {
+		row.Debug = scoreBreakdowns(catCands, rawScores, baseScores, ruleBonus, finalScores, ndcAll, cfg.WeightNDC)
 	}
 
 	combined := seeds
 	if cfg.Mode == ModeMixed {
-		combined = mergeSuggestions(seeds, ndc, topK)
+		combined = mergeSuggestions(seeds, ndc, topK, cfg.MixedCombine)
 	}
 	if cfg.Mode == ModeSplit {
 		combined = seeds
@@ -282,10 +871,25 @@ func (s *Service) RankOne(ctx context.Context, text string) (ResultRow, error) {
 		return nil
 	}
 	if cfg.ClusterCfg.Enabled && cfg.ClusterCfg.Threshold > 0 {
-		combined = clusterSuggestions(combined, cfg.ClusterCfg.Threshold, lookup)
+		if cfg.ClusterCfg.Algorithm == ClusterAgglomerative {
+			combined = agglomerativeClusterSuggestions(combined, cfg.ClusterCfg.Threshold, cfg.ClusterCfg.Linkage, sim, lookup)
+		} else {
+			combined = clusterSuggestions(combined, cfg.ClusterCfg.Threshold, cfg.ClusterCfg.Linkage, sim, lookup)
+		}
 		combined = truncateSuggestions(combined, topK)
 	}
 
+	if !hasPositiveScore(combined) && !hasPositiveScore(ndc) {
+		switch cfg.NoCandidate {
+		case NoCandidateError:
+			// 1行のためにバッチ全体を止めず、その行だけ未分類として印を付ける
+			row.NoCandidates = true
+			combined = []Suggestion{{Label: unclassifiedLabel, Source: "none"}}
+		case NoCandidateUnclassified:
+			combined = []Suggestion{{Label: unclassifiedLabel, Source: "none"}}
+		}
+	}
+
 	row.Suggestions = combined
 	row.SeedSuggestions = seeds
 	row.NDCSuggestions = ndc
@@ -298,10 +902,67 @@ func (s *Service) RankOne(ctx context.Context, text string) (ResultRow, error) {
 			ref = ndc
 		}
 	}
-	row.NeedReview = needReview(ref, cfg.Thresh.Margin12)
+	var singleFloor float32
+	if cfg.ReviewSingleFloor {
+		singleFloor = cfg.Thresh.Top1
+	}
+	row.NeedReview = needReview(ref, cfg.Thresh.Margin12, singleFloor)
+	row.Top1Score, row.Margin = topMargin(ref)
+	if cfg.LengthNormalization && len(ref) >= 2 && cfg.Thresh.Margin12 > 0 {
+		factor := lengthConfidence(utf8.RuneCountInString(normalized))
+		if row.Margin*factor < cfg.Thresh.Margin12 {
+			row.NeedReview = true
+		}
+	}
+	if cfg.MinInputChars > 0 && utf8.RuneCountInString(normalized) < cfg.MinInputChars {
+		row.TooShort = true
+		row.NeedReview = true
+	}
+	if row.NoCandidates {
+		row.NeedReview = true
+	}
 	return row, nil
 }
 
+func hasPositiveScore(sugs []Suggestion) bool {
+	for _, s := range sugs {
+		if s.Score > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func countPending(rows []ResultRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.Pending {
+			n++
+		}
+	}
+	return n
+}
+
+func countNoCandidates(rows []ResultRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.NoCandidates {
+			n++
+		}
+	}
+	return n
+}
+
+func countTooShort(rows []ResultRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.TooShort {
+			n++
+		}
+	}
+	return n
+}
+
 func cloneVecMap(src map[string][]float32) map[string][]float32 {
 	if src == nil {
 		return nil
@@ -313,20 +974,159 @@ func cloneVecMap(src map[string][]float32) map[string][]float32 {
 	return dst
 }
 
-func scoreCandidates(q []float32, cands []Candidate, weight, bias float32) []Suggestion {
-	res := make([]Suggestion, 0, len(cands))
+// scoreBreakdowns collects the intermediate scores per label. A label that
+// is both a user category and an NDC entry keeps the user category's entry.
+func scoreBreakdowns(cands []Candidate, raw, base, bonus, final map[string]float32, ndcAll []Suggestion, weightNDC float32) map[string]ScoreBreakdown {
+	out := make(map[string]ScoreBreakdown, len(cands)+len(ndcAll))
 	for _, c := range cands {
-		sc := cosine32(q, c.Vec)
-		if sc < 0 {
-			sc = 0
+		out[c.Label] = ScoreBreakdown{
+			Source:    "hybrid",
+			Cosine:    raw[c.Label],
+			Weight:    candidateWeight(c),
+			Base:      base[c.Label],
+			RuleBonus: bonus[c.Label],
+			Final:     final[c.Label],
 		}
-		sc = sc*weight + bias + tinyBias(c.Key)
-		res = append(res, Suggestion{Label: c.Label, Score: clamp01(sc), Source: c.Source})
 	}
-	sort.SliceStable(res, func(i, j int) bool { return res[i].Score > res[j].Score })
+	for _, sug := range ndcAll {
+		if _, ok := out[sug.Label]; ok {
+			continue
+		}
+		out[sug.Label] = ScoreBreakdown{
+			Source: sug.Source,
+			Cosine: sug.RawScore,
+			Weight: weightNDC,
+			Base:   sug.Score,
+			Final:  sug.Score,
+		}
+	}
+	return out
+}
+
+// checkCandidateDims rejects category vectors whose length differs from the
+// query's. cosineWithNorm would otherwise read past or stop short of the
+// shorter vector and produce meaningless scores.
+func checkCandidateDims(q []float32, groups ...[]Candidate) error {
+	for _, cands := range groups {
+		for _, c := range cands {
+			if len(c.Vec) != len(q) {
+				return &DimensionMismatchError{Cache: len(c.Vec), Model: len(q), Where: c.Label}
+			}
+			for _, al := range c.Aliases {
+				if len(al.Vec) != len(q) {
+					return &DimensionMismatchError{Cache: len(al.Vec), Model: len(q), Where: c.Label}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func scoreCandidates(q []float32, cands []Candidate, sim similarityFunc, weight, bias float32, tieBreak string) []Suggestion {
+	res := make([]Suggestion, 0, len(cands))
+	qNorm := vecNorm(q)
+	for _, c := range cands {
+		res = append(res, weightedSuggestion(c, candidateSimilarity(sim, q, qNorm, c), weight, bias, tieBreak))
+	}
+	sortSuggestions(res, tieBreak)
 	return res
 }
 
+// weightedSuggestion turns the raw similarity sc of c into a suggestion
+// scored sc*weight + bias.
+func weightedSuggestion(c Candidate, sc, weight, bias float32, tieBreak string) Suggestion {
+	if sc < 0 {
+		sc = 0
+	}
+	raw := clamp01(sc)
+	sc = sc*weight + bias
+	if tieBreak == TieBreakHash {
+		sc += tinyBias(c.Key)
+	}
+	return Suggestion{Label: c.Label, Score: clamp01(sc), RawScore: raw, Source: c.Source}
+}
+
+// 近似・外部インデックスで NDC 候補を取り出す件数 (TopK の倍数と下限)。
+// カテゴリ別閾値などで落ちる分を見込んで多めに取る。
+const (
+	ndcSearchFactor = 4
+	ndcSearchMin    = 20
+)
+
+// searchNDC scores the NDC candidates found by idx like scoreCandidates.
+// The in-memory index returns every candidate, so the result is identical
+// to scoring them directly; HNSW and external indexes only return the
+// closest few, and the other candidates get no score.
+func searchNDC(ctx context.Context, idx VectorIndex, q []float32, cfg Config, topK int) ([]Suggestion, error) {
+	if idx == nil {
+		return nil, nil
+	}
+	k := idx.Size()
+	if cfg.NDCIndex != NDCIndexMemory {
+		k = max(topK*ndcSearchFactor, ndcSearchMin)
+	}
+	hits, err := idx.Search(ctx, q, k)
+	if err != nil {
+		return nil, err
+	}
+	// 同点の並びを scoreCandidates と揃えるため候補の登録順に戻してから並べ替える
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Pos < hits[j].Pos })
+	res := make([]Suggestion, 0, len(hits))
+	for _, h := range hits {
+		res = append(res, weightedSuggestion(h.Cand, h.Score, cfg.WeightNDC, 0, cfg.TieBreak))
+	}
+	sortSuggestions(res, cfg.TieBreak)
+	return res, nil
+}
+
+// sortSuggestions orders by descending score. Equal scores keep candidate
+// order for TieBreakInsertion and TieBreakHash (whose tinyBias already
+// separates most ties) and fall back to label order for TieBreakLabel.
+func sortSuggestions(sugs []Suggestion, tieBreak string) {
+	sort.SliceStable(sugs, func(i, j int) bool {
+		if sugs[i].Score == sugs[j].Score && tieBreak == TieBreakLabel {
+			return sugs[i].Label < sugs[j].Label
+		}
+		return sugs[i].Score > sugs[j].Score
+	})
+}
+
+func suggestionScoreMap(sugs []Suggestion) map[string]float32 {
+	scores := make(map[string]float32, len(sugs))
+	for _, s := range sugs {
+		scores[s.Label] = s.Score
+	}
+	return scores
+}
+
+// suggestionRawScoreMap is suggestionScoreMap over the unweighted RawScore.
+func suggestionRawScoreMap(sugs []Suggestion) map[string]float32 {
+	scores := make(map[string]float32, len(sugs))
+	for _, s := range sugs {
+		scores[s.Label] = s.RawScore
+	}
+	return scores
+}
+
+// filterMinScore drops suggestions scoring below their threshold, keeping
+// order. perLabel overrides min for the labels it contains.
+func filterMinScore(sugs []Suggestion, min float32, perLabel map[string]float32) []Suggestion {
+	if min <= 0 && len(perLabel) == 0 {
+		return sugs
+	}
+	out := make([]Suggestion, 0, len(sugs))
+	for _, s := range sugs {
+		floor := min
+		if v, ok := perLabel[s.Label]; ok {
+			floor = v
+		}
+		if s.Score >= floor {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func truncateSuggestions(in []Suggestion, k int) []Suggestion {
 	if len(in) == 0 {
 		return nil
@@ -339,7 +1139,10 @@ func truncateSuggestions(in []Suggestion, k int) []Suggestion {
 	return out
 }
 
-func mergeSuggestions(a, b []Suggestion, topK int) []Suggestion {
+// mergeSuggestions combines seed and NDC suggestions for the mixed ranking.
+// combine decides what happens to labels present in both (see
+// Config.MixedCombine).
+func mergeSuggestions(a, b []Suggestion, topK int, combine string) []Suggestion {
 	merged := make([]Suggestion, 0, len(a)+len(b))
 	merged = append(merged, a...)
 	merged = append(merged, b...)
@@ -347,6 +1150,13 @@ func mergeSuggestions(a, b []Suggestion, topK int) []Suggestion {
 		return nil
 	}
 	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	switch combine {
+	case MixedCombineMax:
+		merged = dedupeSuggestions(merged, false)
+	case MixedCombineSum:
+		merged = dedupeSuggestions(merged, true)
+		sort.SliceStable(merged, func(i, j int) bool { return merged[i].Score > merged[j].Score })
+	}
 	if topK > len(merged) {
 		topK = len(merged)
 	}
@@ -355,12 +1165,51 @@ func mergeSuggestions(a, b []Suggestion, topK int) []Suggestion {
 	return out
 }
 
-func needReview(sugs []Suggestion, tieDelta float32) bool {
+// dedupeSuggestions collapses entries whose labels normalize to the same key,
+// keeping the first (highest-scored, as the input is sorted) entry and merging
+// the sources and aliases of the others into it. With sum, the scores of the
+// collapsed entries are added (capped at 1) instead of keeping the highest.
+func dedupeSuggestions(in []Suggestion, sum bool) []Suggestion {
+	out := make([]Suggestion, 0, len(in))
+	index := make(map[string]int, len(in))
+	for _, sug := range in {
+		key := normalizeKey(sug.Label)
+		if i, ok := index[key]; ok {
+			out[i].Source = mergeSources(out[i].Source, sug.Source)
+			if sum {
+				out[i].Score = clamp01(out[i].Score + sug.Score)
+			}
+			for _, al := range sug.Aliases {
+				if normalizeKey(al) != key && !containsString(out[i].Aliases, al) {
+					out[i].Aliases = append(out[i].Aliases, al)
+				}
+			}
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, sug)
+	}
+	return out
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// needReview flags ambiguous results: no suggestion, a top1-top2 gap below
+// tieDelta, or a lone suggestion scoring below singleFloor (0 disables the
+// floor, matching the previous behaviour for singletons).
+func needReview(sugs []Suggestion, tieDelta, singleFloor float32) bool {
 	if len(sugs) == 0 {
 		return true
 	}
 	if len(sugs) < 2 {
-		return false
+		return singleFloor > 0 && sugs[0].Score < singleFloor
 	}
 	if tieDelta <= 0 {
 		return false
@@ -368,6 +1217,33 @@ func needReview(sugs []Suggestion, tieDelta float32) bool {
 	return (sugs[0].Score - sugs[1].Score) < tieDelta
 }
 
+// lengthNormalizationChars 以上の長さの入力は確信度を割り引かない。
+const lengthNormalizationChars = 20
+
+// lengthConfidence scales confidence linearly with input length (in runes),
+// reaching 1 at lengthNormalizationChars.
+func lengthConfidence(runes int) float32 {
+	if runes >= lengthNormalizationChars {
+		return 1
+	}
+	if runes <= 0 {
+		return 0
+	}
+	return float32(runes) / lengthNormalizationChars
+}
+
+// topMargin returns the top-1 score and the top1-top2 gap. With a single
+// suggestion the margin is the top-1 score itself.
+func topMargin(sugs []Suggestion) (float32, float32) {
+	if len(sugs) == 0 {
+		return 0, 0
+	}
+	if len(sugs) < 2 {
+		return sugs[0].Score, sugs[0].Score
+	}
+	return sugs[0].Score, sugs[0].Score - sugs[1].Score
+}
+
 func meanScore(sugs []Suggestion) float32 {
 	if len(sugs) == 0 {
 		return 0
@@ -379,48 +1255,173 @@ func meanScore(sugs []Suggestion) float32 {
 	return sum / float32(len(sugs))
 }
 
-func clusterSuggestions(in []Suggestion, tau float32, lookup func(string) []float32) []Suggestion {
+func clusterSuggestions(in []Suggestion, tau float32, linkage string, sim similarityFunc, lookup func(string) []float32) []Suggestion {
 	if len(in) <= 1 {
 		return in
 	}
-	clusters := make([]Suggestion, 0, len(in))
+	type cluster struct {
+		sug  Suggestion
+		vecs [][]float32
+	}
+	clusters := make([]cluster, 0, len(in))
 	for _, sug := range in {
 		vec := lookup(sug.Label)
 		if vec == nil {
-			clusters = append(clusters, sug)
+			clusters = append(clusters, cluster{sug: sug})
 			continue
 		}
 		merged := false
 		for i := range clusters {
-			other := lookup(clusters[i].Label)
-			if other == nil {
+			if len(clusters[i].vecs) == 0 {
 				continue
 			}
-			if cosine32(vec, other) >= tau {
-				clusters[i] = mergeSuggestion(clusters[i], sug)
+			if linkageSimilarity(vec, clusters[i].vecs, linkage, sim) >= tau {
+				clusters[i].sug = mergeSuggestion(clusters[i].sug, sug)
+				clusters[i].vecs = append(clusters[i].vecs, vec)
 				merged = true
 				break
 			}
 		}
 		if !merged {
-			clusters = append(clusters, sug)
+			clusters = append(clusters, cluster{sug: sug, vecs: [][]float32{vec}})
+		}
+	}
+	out := make([]Suggestion, len(clusters))
+	for i, c := range clusters {
+		out[i] = c.sug
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+// agglomerativeClusterSuggestions groups suggestions bottom-up: starting
+// from one cluster per suggestion it repeatedly merges the most similar pair
+// of clusters (by linkage) until no pair reaches tau. Clusters are kept in
+// label order and ties go to the first pair, so the result does not depend
+// on the order of in. Suggestions without a vector stay on their own.
+func agglomerativeClusterSuggestions(in []Suggestion, tau float32, linkage string, sim similarityFunc, lookup func(string) []float32) []Suggestion {
+	if len(in) <= 1 {
+		return in
+	}
+	type cluster struct {
+		sugs []Suggestion
+		vecs [][]float32
+	}
+	sorted := append([]Suggestion(nil), in...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Label < sorted[j].Label })
+	clusters := make([]cluster, len(sorted))
+	for i, sug := range sorted {
+		clusters[i] = cluster{sugs: []Suggestion{sug}}
+		if vec := lookup(sug.Label); vec != nil {
+			clusters[i].vecs = [][]float32{vec}
+		}
+	}
+	for {
+		bi, bj := -1, -1
+		best := tau
+		for i := range clusters {
+			if len(clusters[i].vecs) == 0 {
+				continue
+			}
+			for j := i + 1; j < len(clusters); j++ {
+				if len(clusters[j].vecs) == 0 {
+					continue
+				}
+				sc := clusterLinkageSimilarity(clusters[i].vecs, clusters[j].vecs, linkage, sim)
+				if sc > best || (bi < 0 && sc >= tau) {
+					bi, bj, best = i, j, sc
+				}
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		clusters[bi].sugs = append(clusters[bi].sugs, clusters[bj].sugs...)
+		clusters[bi].vecs = append(clusters[bi].vecs, clusters[bj].vecs...)
+		clusters = append(clusters[:bj], clusters[bj+1:]...)
+	}
+
+	out := make([]Suggestion, len(clusters))
+	for i, c := range clusters {
+		members := c.sugs
+		sort.SliceStable(members, func(a, b int) bool {
+			if members[a].Score != members[b].Score {
+				return members[a].Score > members[b].Score
+			}
+			return members[a].Label < members[b].Label
+		})
+		merged := members[0]
+		for _, m := range members[1:] {
+			merged = mergeSuggestion(merged, m)
+		}
+		out[i] = merged
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Label < out[j].Label
+	})
+	return out
+}
+
+// clusterLinkageSimilarity scores two clusters with sim. single: closest
+// pair, complete: farthest pair, average: the two centroids.
+func clusterLinkageSimilarity(a, b [][]float32, linkage string, sim similarityFunc) float32 {
+	if linkage == LinkageAverage {
+		ca := centroid(a)
+		return sim(ca, vecNorm(ca), centroid(b), 0)
+	}
+	var out float32
+	for i, v := range a {
+		sc := linkageSimilarity(v, b, linkage, sim)
+		if i == 0 || (linkage == LinkageComplete && sc < out) || (linkage != LinkageComplete && sc > out) {
+			out = sc
+		}
+	}
+	return out
+}
+
+// linkageSimilarity scores vec against the members of a cluster with sim.
+// single: closest member, complete: farthest member, average: centroid.
+func linkageSimilarity(vec []float32, members [][]float32, linkage string, sim similarityFunc) float32 {
+	qNorm := vecNorm(vec)
+	switch linkage {
+	case LinkageAverage:
+		return sim(vec, qNorm, centroid(members), 0)
+	case LinkageComplete:
+		worst := float32(math.MaxFloat32)
+		for _, m := range members {
+			if sc := sim(vec, qNorm, m, 0); sc < worst {
+				worst = sc
+			}
+		}
+		return worst
+	default:
+		best := float32(-math.MaxFloat32)
+		for _, m := range members {
+			if sc := sim(vec, qNorm, m, 0); sc > best {
+				best = sc
+			}
 		}
+		return best
 	}
-	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Score > clusters[j].Score })
-	return clusters
 }
 
 func mergeSuggestion(a, b Suggestion) Suggestion {
 	label := a.Label
 	score := a.Score
+	raw := a.RawScore
 	if b.Score > score {
 		label = b.Label
 		score = b.Score
+		raw = b.RawScore
 	}
 	res := Suggestion{
-		Label:  label,
-		Score:  score,
-		Source: mergeSources(a.Source, b.Source),
+		Label:    label,
+		Score:    score,
+		RawScore: raw,
+		Source:   mergeSources(a.Source, b.Source),
 	}
 	set := make(map[string]struct{})
 	add := func(name string) {
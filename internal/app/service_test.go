@@ -0,0 +1,604 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNoCandidate(t *testing.T) {
+	inputs := []string{"りんごとみかんの果物セット", "新鮮な野菜サラダ"}
+	tests := []struct {
+		name         string
+		mode         string
+		label        string // 各行の1位。"" は候補なし
+		noCandidates bool
+	}{
+		{"silent", NoCandidateSilent, "", false},
+		{"unclassified", NoCandidateUnclassified, unclassifiedLabel, false},
+		{"error marks the row", NoCandidateError, unclassifiedLabel, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// MinScore を上げて実際のスコア計算で全候補を落とす
+			svc := newTestService(t, func(c *Config) {
+				c.Mode = ModeMixed
+				c.MinScore = 0.99
+				c.NoCandidate = tt.mode
+			})
+			rows, err := svc.ClassifyAll(context.Background(), inputs, nil)
+			if err != nil {
+				t.Fatalf("ClassifyAll: %v", err)
+			}
+			if len(rows) != len(inputs) {
+				t.Fatalf("rows = %d, want %d", len(rows), len(inputs))
+			}
+			for _, r := range rows {
+				got := ""
+				if len(r.Suggestions) > 0 {
+					got = r.Suggestions[0].Label
+				}
+				if got != tt.label {
+					t.Errorf("%s: top = %q, want %q", r.Text, got, tt.label)
+				}
+				if r.NoCandidates != tt.noCandidates {
+					t.Errorf("%s: NoCandidates = %v, want %v", r.Text, r.NoCandidates, tt.noCandidates)
+				}
+				if tt.noCandidates && !r.NeedReview {
+					t.Errorf("%s: NeedReview = false for a row without candidates", r.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestNoCandidateEmptyIndex(t *testing.T) {
+	svc := newTestService(t, func(c *Config) {
+		c.Mode = ModeSeeded
+		c.NoCandidate = NoCandidateError
+	})
+	if _, err := svc.UpdateCategories(context.Background(), nil); err != nil {
+		t.Fatalf("UpdateCategories: %v", err)
+	}
+	if _, err := svc.ClassifyAll(context.Background(), []string{"果物"}, nil); !errors.Is(err, ErrNoCandidates) {
+		t.Errorf("err = %v, want ErrNoCandidates", err)
+	}
+}
+
+func TestSeedAliasFileSurvivesCategoryUpdates(t *testing.T) {
+	aliasFile := filepath.Join(t.TempDir(), "aliases.csv")
+	if err := os.WriteFile(aliasFile, []byte("category,alias\n果物,フルーツ,くだもの\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		update func(*Service) error
+		want   []string
+	}{
+		{"UpdateCategories", func(s *Service) error {
+			_, err := s.UpdateCategories(context.Background(), []string{"果物", "家電"})
+			return err
+		}, []string{"フルーツ", "くだもの"}},
+		{"LoadCategorySpecs with own alias", func(s *Service) error {
+			_, err := s.LoadCategorySpecs(context.Background(), []CategorySpec{{Label: "果物", Aliases: []string{"水菓子", "フルーツ"}}})
+			return err
+		}, []string{"水菓子", "フルーツ", "くだもの"}},
+		{"AddSeeds", func(s *Service) error {
+			if _, err := s.UpdateCategories(context.Background(), []string{"家電"}); err != nil {
+				return err
+			}
+			_, err := s.AddSeeds(context.Background(), []string{"果物"})
+			return err
+		}, []string{"フルーツ", "くだもの"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) { c.SeedAliasFile = aliasFile })
+			if err := tt.update(svc); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range svc.candsCat {
+				if c.Label == "果物" {
+					for _, a := range c.Aliases {
+						got = append(got, a.Text)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aliases of 果物 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyAllFilteredSources(t *testing.T) {
+	inputs := []string{"北海道への旅行記", "小説の新刊を読んだ"}
+	sourcesOf := func(sugs []Suggestion) map[string]bool {
+		m := make(map[string]bool)
+		for _, s := range sugs {
+			m[s.Source] = true
+		}
+		return m
+	}
+	tests := []struct {
+		name       string
+		mode       string
+		sources    []string
+		wantSugs   bool // Suggestions が残るか
+		wantNDC    bool // NDCSuggestions が残るか
+		wantSource string
+	}{
+		{"mixed seed", ModeMixed, []string{"seed"}, true, false, "seed"},
+		// 混合モードでは NDC が上位 k 件に入らないが、NDCSuggestions には残る
+		{"mixed ndc", ModeMixed, []string{"ndc"}, false, true, "ndc"},
+		{"split seed", ModeSplit, []string{"seed"}, true, false, "seed"},
+		{"split ndc", ModeSplit, []string{"ndc"}, false, true, "ndc"},
+		{"split both", ModeSplit, []string{"seed", "ndc"}, true, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) { c.Mode = tt.mode })
+			rows, err := svc.ClassifyAllFiltered(context.Background(), inputs, tt.sources, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range rows {
+				if got := len(r.Suggestions) > 0; got != tt.wantSugs {
+					t.Errorf("%s: Suggestions present = %v, want %v", r.Text, got, tt.wantSugs)
+				}
+				if got := len(r.NDCSuggestions) > 0; got != tt.wantNDC {
+					t.Errorf("%s: NDCSuggestions present = %v, want %v", r.Text, got, tt.wantNDC)
+				}
+				if tt.wantSource == "" {
+					continue
+				}
+				for src := range sourcesOf(append(append([]Suggestion(nil), r.Suggestions...), r.NDCSuggestions...)) {
+					if src != tt.wantSource && !(tt.wantSource == "seed" && src == "hybrid") {
+						t.Errorf("%s: source %q left by filter %v", r.Text, src, tt.sources)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMergeSuggestionsCombine(t *testing.T) {
+	seeds := []Suggestion{{Label: "料理", Score: 0.45, Source: "seed"}, {Label: "旅行", Score: 0.3, Source: "seed"}}
+	ndc := []Suggestion{{Label: "歴史", Score: 0.5, Source: "ndc"}, {Label: "料理", Score: 0.4, Source: "ndc"}}
+	format := func(sugs []Suggestion) []string {
+		out := make([]string, len(sugs))
+		for i, s := range sugs {
+			out[i] = fmt.Sprintf("%s %.2f %s", s.Label, s.Score, s.Source)
+		}
+		return out
+	}
+	tests := []struct {
+		combine string
+		topK    int
+		want    []string
+	}{
+		{MixedCombineSeparate, 10, []string{"歴史 0.50 ndc", "料理 0.45 seed", "料理 0.40 ndc", "旅行 0.30 seed"}},
+		{MixedCombineMax, 10, []string{"歴史 0.50 ndc", "料理 0.45 seed,ndc", "旅行 0.30 seed"}},
+		// 合計すると両方にあるラベルが先頭に上がる
+		{MixedCombineSum, 10, []string{"料理 0.85 seed,ndc", "歴史 0.50 ndc", "旅行 0.30 seed"}},
+		// 1件にまとめてから上位 k 件に切る
+		{MixedCombineMax, 2, []string{"歴史 0.50 ndc", "料理 0.45 seed,ndc"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/top%d", tt.combine, tt.topK), func(t *testing.T) {
+			got := format(mergeSuggestions(seeds, ndc, tt.topK, tt.combine))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 合計は 1 で頭打ちになる
+	high := []Suggestion{{Label: "料理", Score: 0.8, Source: "seed"}}
+	if got := mergeSuggestions(high, []Suggestion{{Label: "料理", Score: 0.7, Source: "ndc"}}, 10, MixedCombineSum); len(got) != 1 || got[0].Score != 1 {
+		t.Errorf("sum over 1 = %v, want a single 料理 at 1", got)
+	}
+}
+
+func TestMixedCombineDefaultsFromDedupeLabels(t *testing.T) {
+	tests := []struct {
+		combine string
+		dedupe  bool
+		want    string
+	}{
+		{"", false, MixedCombineSeparate},
+		{"", true, MixedCombineMax},
+		{MixedCombineSum, true, MixedCombineSum},
+		{MixedCombineSeparate, true, MixedCombineSeparate},
+	}
+	for _, tt := range tests {
+		cfg := defaultConfig()
+		cfg.MixedCombine, cfg.DedupeLabels = tt.combine, tt.dedupe
+		if got := sanitizeConfig(cfg).MixedCombine; got != tt.want {
+			t.Errorf("MixedCombine %q with DedupeLabels %v = %q, want %q", tt.combine, tt.dedupe, got, tt.want)
+		}
+	}
+}
+
+func TestRankOneEmptyInput(t *testing.T) {
+	tests := []struct {
+		keepEmpty bool
+		want      []string // 候補のラベル
+	}{
+		{true, []string{emptyInputLabel}},
+		{false, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("keep=%v", tt.keepEmpty), func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) { c.KeepEmptyRows = tt.keepEmpty })
+			for _, text := range []string{"", "  \t "} {
+				row, err := svc.RankOne(context.Background(), text)
+				if err != nil {
+					t.Fatal(err)
+				}
+				labels := []string{}
+				for _, s := range row.Suggestions {
+					labels = append(labels, s.Label)
+				}
+				if !reflect.DeepEqual(labels, tt.want) || !row.NeedReview {
+					t.Errorf("%q: labels %q needReview %v, want %q and true", text, labels, row.NeedReview, tt.want)
+				}
+				if got := topLabel(row); got != unclassifiedLabel {
+					t.Errorf("%q: topLabel = %q, want %q", text, got, unclassifiedLabel)
+				}
+			}
+		})
+	}
+}
+
+func TestMinInputChars(t *testing.T) {
+	tests := []struct {
+		name     string
+		min      int
+		text     string
+		tooShort bool
+	}{
+		// バイト数ではなくルーン数で数える ("野菜" は6バイト)
+		{"cjk below", 3, "野菜", true},
+		{"cjk at limit", 3, "生野菜", false},
+		{"ascii below", 3, "tv", true},
+		{"ascii at limit", 3, "pcs", false},
+		// 正規化で落ちる前後の空白は数えない
+		{"surrounding spaces", 3, "  野菜　", true},
+		{"disabled", 0, "菜", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) { c.MinInputChars = tt.min })
+			row, err := svc.RankOne(context.Background(), tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.TooShort != tt.tooShort {
+				t.Errorf("TooShort = %v, want %v", row.TooShort, tt.tooShort)
+			}
+			if tt.tooShort && !row.NeedReview {
+				t.Error("short input not flagged for review")
+			}
+			// 短くても分類はする
+			if len(row.Suggestions) == 0 {
+				t.Error("no suggestions")
+			}
+		})
+	}
+}
+
+func TestMinInputCharsSummary(t *testing.T) {
+	svc := newTestService(t, func(c *Config) { c.MinInputChars = 3 })
+	rows, err := svc.ClassifyAll(context.Background(), []string{"野菜", "新鮮な野菜のサラダ", "tv", "北海道への旅行記"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTooShort(rows); n != 2 {
+		t.Errorf("countTooShort = %d, want 2", n)
+	}
+	if sum := buildRunSummary(rows, svc.Config(), time.Time{}); sum.TooShort != 2 {
+		t.Errorf("summary too_short = %d, want 2", sum.TooShort)
+	}
+}
+
+// slowEncoder は slow を含むテキストの埋め込みに delay だけかかる。
+type slowEncoder struct {
+	hashEncoder
+	slow  string
+	delay time.Duration
+}
+
+func (e slowEncoder) Encode(text string) ([]float32, error) {
+	if strings.Contains(text, e.slow) {
+		time.Sleep(e.delay)
+	}
+	return e.hashEncoder.Encode(text)
+}
+
+func (e slowEncoder) EncodeBatch(texts []string) ([][]float32, error) {
+	for _, text := range texts {
+		if strings.Contains(text, e.slow) {
+			time.Sleep(e.delay)
+		}
+	}
+	return e.hashEncoder.EncodeBatch(texts)
+}
+
+func TestClassifyAllMaxRuntime(t *testing.T) {
+	inputs := []string{"北海道への旅行記", "遅い 新鮮な野菜のサラダ", "テレビを買い替えた", "サッカーの試合"}
+	tests := []struct {
+		name       string
+		maxRuntime time.Duration
+		pending    int // 末尾から数えた未処理の行数
+	}{
+		{"unlimited", 0, 0},
+		{"within limit", time.Minute, 0},
+		// 2行目の埋め込み中に期限を過ぎ、それより後が未処理になる
+		{"deadline", 20 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) {
+				c.MaxRuntime = tt.maxRuntime
+				c.BatchSize = 1
+			})
+			svc.emb = slowEncoder{hashEncoder{dim: 256}, "遅い", 100 * time.Millisecond}
+			rows, err := svc.ClassifyAll(context.Background(), inputs, nil)
+			if err != nil {
+				t.Fatalf("ClassifyAll: %v", err)
+			}
+			if len(rows) != len(inputs) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(inputs))
+			}
+			done := len(inputs) - tt.pending
+			for i, r := range rows {
+				// 入力と同じ順で並び、未処理の行も本文を持つ
+				if r.Text != inputs[i] {
+					t.Errorf("row %d text = %q, want %q", i, r.Text, inputs[i])
+				}
+				if r.Pending != (i >= done) {
+					t.Errorf("row %d pending = %v, want %v", i, r.Pending, i >= done)
+				}
+				if r.Pending && len(r.Suggestions) != 0 {
+					t.Errorf("pending row %d has suggestions", i)
+				}
+				if !r.Pending && len(r.Suggestions) == 0 {
+					t.Errorf("finished row %d has no suggestions", i)
+				}
+			}
+			if n := countPending(rows); n != tt.pending {
+				t.Errorf("countPending = %d, want %d", n, tt.pending)
+			}
+			if sum := buildRunSummary(rows, svc.Config(), time.Time{}); sum.Pending != tt.pending || sum.Total != len(inputs) {
+				t.Errorf("summary pending %d total %d, want %d and %d", sum.Pending, sum.Total, tt.pending, len(inputs))
+			}
+		})
+	}
+}
+
+func TestClassifyAllCanceledIsNotPartial(t *testing.T) {
+	svc := newTestService(t, func(c *Config) { c.MaxRuntime = time.Minute })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// 呼び出し側の取り消しは途中結果ではなくエラーにする
+	if _, err := svc.ClassifyAll(ctx, []string{"北海道への旅行記"}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+// zeroEncoder は marker を含むテキストを零ベクトルにし、どの候補とも類似度 0 にする。
+type zeroEncoder struct {
+	hashEncoder
+	marker string
+}
+
+func (e zeroEncoder) Encode(text string) ([]float32, error) {
+	if strings.Contains(text, e.marker) {
+		return make([]float32, e.dim), nil
+	}
+	return e.hashEncoder.Encode(text)
+}
+
+func (e zeroEncoder) EncodeBatch(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v, err := e.Encode(text)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestMinScoreDropsWeakSuggestions(t *testing.T) {
+	const noise = "無関係な入力"
+	tests := []struct {
+		name     string
+		mode     string
+		minScore float32
+		text     string
+		seeds    bool // Suggestions (別枠モードでは項目側) が残るか
+		ndc      bool // NDCSuggestions が残るか
+	}{
+		// 類似度がすべて 0 の入力は、シード偏りぶんのスコアだけでは残らない
+		{"seeded low", ModeSeeded, 0.35, noise, false, false},
+		{"mixed low", ModeMixed, 0.35, noise, false, false},
+		{"split low", ModeSplit, 0.35, noise, false, false},
+		// 無効にするとノイズの候補がそのまま並ぶ
+		{"disabled", ModeSplit, 0, noise, true, true},
+		// 別枠モードでは項目と NDC を別々に判定する
+		{"split independent", ModeSplit, 0.5, "旅行", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) {
+				c.Mode = tt.mode
+				c.MinScore = tt.minScore
+			})
+			svc.emb = zeroEncoder{hashEncoder{dim: 256}, noise}
+			row, err := svc.RankOne(context.Background(), tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(row.Suggestions) > 0; got != tt.seeds {
+				t.Errorf("suggestions = %+v, want present %v", row.Suggestions, tt.seeds)
+			}
+			if got := len(row.NDCSuggestions) > 0; got != tt.ndc {
+				t.Errorf("NDC suggestions = %+v, want present %v", row.NDCSuggestions, tt.ndc)
+			}
+			if row.BelowMinScore != !tt.seeds {
+				t.Errorf("BelowMinScore = %v, want %v", row.BelowMinScore, !tt.seeds)
+			}
+			for _, s := range append(append([]Suggestion(nil), row.Suggestions...), row.NDCSuggestions...) {
+				if s.Score < tt.minScore {
+					t.Errorf("%s scored %.3f below MinScore %.2f", s.Label, s.Score, tt.minScore)
+				}
+			}
+		})
+	}
+}
+
+func TestNeedReview(t *testing.T) {
+	sugs := func(scores ...float32) []Suggestion {
+		out := make([]Suggestion, len(scores))
+		for i, s := range scores {
+			out[i] = Suggestion{Label: fmt.Sprint(i), Score: s}
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		sugs        []Suggestion
+		singleFloor float32
+		want        bool
+	}{
+		{"no suggestions", nil, 0, true},
+		// 下限なしでは1件だけの候補は弱くても通ってしまう
+		{"single weak without floor", sugs(0.2), 0, false},
+		{"single weak below floor", sugs(0.2), 0.45, true},
+		{"single at floor", sugs(0.45), 0.45, false},
+		{"single confident", sugs(0.9), 0.45, false},
+		{"close pair", sugs(0.6, 0.59), 0.45, true},
+		// 2件以上なら下限ではなく1位と2位の差で判定する
+		{"clear pair below floor", sugs(0.3, 0.1), 0.45, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needReview(tt.sugs, 0.03, tt.singleFloor); got != tt.want {
+				t.Errorf("needReview = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewSingleFloor(t *testing.T) {
+	tests := []struct {
+		name  string
+		floor bool
+		top1  float32
+		want  bool
+	}{
+		{"off", false, 0.99, false},
+		{"below floor", true, 0.99, true},
+		{"above floor", true, 0.1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// カテゴリ別閾値で旅行以外を落とし、候補を1件に絞る
+			svc := newTestService(t, func(c *Config) {
+				c.Mode = ModeSeeded
+				c.CategoryThresholds = map[string]float32{"果物": 1, "野菜": 1, "家電": 1, "スポーツ": 1, "料理": 1}
+				c.ReviewSingleFloor = tt.floor
+				c.Thresh.Top1 = tt.top1
+			})
+			row, err := svc.RankOne(context.Background(), "北海道への旅行記")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(row.Suggestions) != 1 {
+				t.Fatalf("got %d suggestions, want 1", len(row.Suggestions))
+			}
+			if row.NeedReview != tt.want {
+				t.Errorf("NeedReview = %v (score %.3f), want %v", row.NeedReview, row.Suggestions[0].Score, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelInfo(t *testing.T) {
+	// 埋め込み前は次元 0、最初の埋め込みで決まる
+	svc := newEmbedTestService(1, 1, "")
+	if id, dim := svc.ModelInfo(); id != "hash-64" || dim != 0 {
+		t.Errorf("before embedding: %q, %d, want hash-64, 0", id, dim)
+	}
+	if _, err := svc.EmbedCached(context.Background(), "北海道への旅行記"); err != nil {
+		t.Fatal(err)
+	}
+	if id, dim := svc.ModelInfo(); id != "hash-64" || dim != 64 {
+		t.Errorf("after embedding: %q, %d, want hash-64, 64", id, dim)
+	}
+
+	// モデルを替えると (サービスを作り直すと) 新しいモデルの値になる
+	tests := []struct {
+		modelID string
+		dim     int
+	}{
+		{"hash-256", 256},
+		{"hash-32", 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			cfg := newTestService(t, nil).Config()
+			svc, err := newService(cfg, hashEncoder{dim: tt.dim}, tt.modelID, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(svc.Close)
+			if id, dim := svc.ModelInfo(); id != tt.modelID || dim != tt.dim {
+				t.Errorf("ModelInfo = %q, %d, want %q, %d", id, dim, tt.modelID, tt.dim)
+			}
+			// /healthz も同じ値を返す
+			rec := httptest.NewRecorder()
+			newServerMux(svc).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			var health struct {
+				Model string
+				Dim   int
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+				t.Fatal(err)
+			}
+			if health.Model != tt.modelID || health.Dim != tt.dim {
+				t.Errorf("healthz = %+v, want %q, %d", health, tt.modelID, tt.dim)
+			}
+		})
+	}
+}
+
+func TestModelIDFollowsModelFile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := defaultConfig()
+	ids := make(map[string]bool)
+	for _, content := range []string{"model-a", "model-b"} {
+		cfg.ModelPath = filepath.Join(dir, "model.onnx")
+		if err := os.WriteFile(cfg.ModelPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ids[cacheModelID(cfg)] = true
+	}
+	// 同じパスでもファイルが替われば別の識別子になる
+	if len(ids) != 2 {
+		t.Errorf("model ids = %v, want two distinct ids", ids)
+	}
+}
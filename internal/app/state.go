@@ -0,0 +1,126 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const stateFormatVersion = 1
+
+// serviceState is the serialized form used to reproduce a user's setup:
+// configuration plus the already embedded seed and NDC candidates.
+type serviceState struct {
+	Version  int
+	ModelID  string
+	Config   Config
+	Seeds    []Candidate
+	NDCItems []ndcItem
+	NDC      []Candidate
+}
+
+// ExportState writes the current configuration, seed vectors and NDC entries
+// as JSON so that another installation can restore them without re-embedding.
+func (s *Service) ExportState(w io.Writer) error {
+	s.mu.RLock()
+	state := serviceState{
+		Version:  stateFormatVersion,
+		ModelID:  s.cache.modelID,
+		Config:   s.cfg,
+		Seeds:    append([]Candidate(nil), s.candsCat...),
+		NDCItems: append([]ndcItem(nil), s.ndcItems...),
+		NDC:      append([]Candidate(nil), s.candsNDC...),
+	}
+	s.mu.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
+
+// ImportState restores a state written by ExportState. The state is rejected
+// when it was produced with a different model, since its vectors would not be
+// comparable with the ones produced by the current encoder. The model ID
+// contains a fingerprint of the model file, so the same model installed at a
+// different path still matches.
+func (s *Service) ImportState(r io.Reader) error {
+	var state serviceState
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("状態ファイルを読み込めません: %w", err)
+	}
+	if state.Version != stateFormatVersion {
+		return fmt.Errorf("未対応の状態ファイル形式です (version=%d)", state.Version)
+	}
+	if state.ModelID != s.cache.modelID {
+		return fmt.Errorf("モデルが一致しません (状態: %s / 現在: %s)", state.ModelID, s.cache.modelID)
+	}
+
+	// Paths in the exported config point at the reporter's machine.
+	cfg := state.Config
+	current := s.Config()
+	cfg.OrtDLL = current.OrtDLL
+	cfg.ModelPath = current.ModelPath
+	cfg.TokenizerPath = current.TokenizerPath
+	cfg.CacheDir = current.CacheDir
+	cfg, _ = s.setConfig(cfg) // NDC の索引は下で状態のベクトルから作る
+
+	labels := make([]string, 0, len(state.Seeds))
+	seedVec := make(map[string][]float32, len(state.Seeds))
+	for _, c := range state.Seeds {
+		labels = append(labels, c.Label)
+		seedVec[c.Label] = c.Vec
+	}
+	ndcVec := make(map[string][]float32, len(state.NDC))
+	for _, c := range state.NDC {
+		ndcVec[c.Label] = c.Vec
+	}
+
+	s.mu.Lock()
+	s.userCats = labels
+	s.candsCat = state.Seeds
+	s.seedVec = seedVec
+	s.catMembers = nil // 状態ファイルには例文ごとのベクトルが無い
+	s.ndcItems = state.NDCItems
+	s.candsNDC = state.NDC
+	s.ndcVec = ndcVec
+	s.ndcIndex = newNDCIndex(cfg, state.NDC)
+	s.mu.Unlock()
+	return nil
+}
+
+// exportStateFile writes ExportState to path, when it is set, for
+// -export-state.
+func exportStateFile(svc *Service, path string, w io.Writer) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	if err := svc.ExportState(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "状態を %s に出力しました\n", path)
+	return nil
+}
+
+// importStateFile restores the state written by exportStateFile for
+// -import-state.
+func importStateFile(svc *Service, path string) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := svc.ImportState(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingEncoder は hashEncoder の呼び出し回数を数え、埋め込み直しが
+// 起きていないことを確かめる。
+type countingEncoder struct {
+	hashEncoder
+	calls *atomic.Int64
+}
+
+func (e countingEncoder) Encode(text string) ([]float32, error) {
+	e.calls.Add(1)
+	return e.hashEncoder.Encode(text)
+}
+
+func (e countingEncoder) EncodeBatch(texts []string) ([][]float32, error) {
+	e.calls.Add(int64(len(texts)))
+	return e.hashEncoder.EncodeBatch(texts)
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newTestService(t, func(cfg *Config) { cfg.Mode = ModeMixed })
+	specs := []CategorySpec{{Label: "宇宙", Examples: []string{"ロケットの打ち上げ"}}, {Label: "音楽", Aliases: []string{"ミュージック"}}}
+	if _, err := src.LoadCategorySpecs(ctx, specs); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := exportStateFile(src, path, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestService(t, nil)
+	var calls atomic.Int64
+	dst.emb = countingEncoder{hashEncoder{dim: 256}, &calls}
+	if err := importStateFile(dst, path); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("import embedded %d texts, want none", n)
+	}
+	if got := dst.Config().Mode; got != ModeMixed {
+		t.Errorf("mode = %q, want the exported %q", got, ModeMixed)
+	}
+
+	// 書き出し直すと同じ内容になり、同じ入力に同じ結果を返す
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := dst.ExportState(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Error("re-exported state differs from the imported one")
+	}
+	for _, text := range []string{"ロケットの打ち上げを見た", "北海道への旅行記"} {
+		a, err := src.RankOne(ctx, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := dst.RankOne(ctx, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a.Suggestions, b.Suggestions) {
+			t.Errorf("%s: suggestions = %+v, want %+v", text, b.Suggestions, a.Suggestions)
+		}
+	}
+}
+
+func TestImportStateRejects(t *testing.T) {
+	src := newTestService(t, nil)
+	var buf bytes.Buffer
+	if err := src.ExportState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	edit := func(f func(*serviceState)) string {
+		var st serviceState
+		if err := json.Unmarshal(buf.Bytes(), &st); err != nil {
+			t.Fatal(err)
+		}
+		f(&st)
+		data, err := json.Marshal(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	tests := []struct {
+		name    string
+		state   string
+		wantErr string
+	}{
+		{"model mismatch", edit(func(st *serviceState) { st.ModelID = "other-model" }), "モデルが一致しません"},
+		{"version", edit(func(st *serviceState) { st.Version = stateFormatVersion + 1 }), "未対応の状態ファイル形式"},
+		{"broken", "{", "状態ファイルを読み込めません"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := newTestService(t, func(cfg *Config) { cfg.Mode = ModeSplit })
+			var before, after bytes.Buffer
+			if err := dst.ExportState(&before); err != nil {
+				t.Fatal(err)
+			}
+			err := dst.ImportState(strings.NewReader(tt.state))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ImportState error = %v, want %q", err, tt.wantErr)
+			}
+			// 拒否したときは設定もカテゴリも置き換えない
+			if err := dst.ExportState(&after); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(after.Bytes(), before.Bytes()) {
+				t.Error("state changed after a rejected import")
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// streamSniffSize は auto 判定で文字コードを調べる先頭のバイト数。
+const streamSniffSize = 64 << 10
+
+// openTextStream opens path for reading record by record: ".gz" is
+// decompressed on the fly and the content is decoded to UTF-8 per enc like
+// decodeInput, except that auto mode decides from the first 64KiB only.
+// The returned name has ".gz" removed. close releases the file.
+func openTextStream(path, enc string) (r io.Reader, name string, closeFn func(), err error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, path, nil, err
+	}
+	closeFn = func() { f.Close() }
+	name = path
+	var src io.Reader = f
+	if strings.EqualFold(filepath.Ext(name), ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, name, nil, fmt.Errorf("gzip を展開できません: %w", err)
+		}
+		closeFn = func() { zr.Close(); f.Close() }
+		src = zr
+		name = name[:len(name)-len(".gz")]
+	}
+	br := bufio.NewReaderSize(src, streamSniffSize)
+	head, _ := br.Peek(streamSniffSize)
+	if strings.HasPrefix(string(head), string(utf8BOM)) {
+		_, _ = br.Discard(len(utf8BOM))
+		head = head[len(utf8BOM):]
+	}
+	switch strings.ToLower(strings.TrimSpace(enc)) {
+	case "", EncodingAuto:
+		if validUTF8Prefix(head, len(head) < streamSniffSize-len(utf8BOM)) {
+			return br, name, closeFn, nil
+		}
+		return japanese.ShiftJIS.NewDecoder().Reader(br), name, closeFn, nil
+	case EncodingUTF8:
+		return br, name, closeFn, nil
+	case EncodingShiftJIS:
+		return japanese.ShiftJIS.NewDecoder().Reader(br), name, closeFn, nil
+	case EncodingEUCJP:
+		return japanese.EUCJP.NewDecoder().Reader(br), name, closeFn, nil
+	}
+	closeFn()
+	return nil, name, nil, fmt.Errorf("未対応の文字コードです: %s", enc)
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, allowing a rune cut off
+// at the end when b is only the start of the data (complete == false).
+func validUTF8Prefix(b []byte, complete bool) bool {
+	if complete {
+		return utf8.Valid(b)
+	}
+	for i := 0; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.Valid(b[:len(b)-i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamCSVRecords reads the text open returns one record at a time and
+// calls fn for each, without buffering the whole file. It recovers from bad
+// records like parseCSVRecords: a record that fails to parse on one line is
+// skipped, and for a quote that is never closed only its starting line is
+// dropped. Since the swallowed lines are gone from the stream, the input is
+// opened again and read from the line after it, so streamed and buffered
+// reads yield the same records and warnings. Each open is closed with the
+// func it returns.
+func streamCSVRecords(open func() (io.Reader, func(), error), delim rune, fn func([]string) error) ([]ParseWarning, error) {
+	var warnings []ParseWarning
+	offset := 0 // 読み直すときに飛ばす元データの行数
+	for {
+		restart, err := func() (bool, error) {
+			r, closeFn, err := open()
+			if err != nil {
+				return false, err
+			}
+			defer closeFn()
+			br := bufio.NewReader(r)
+			if err := skipLines(br, offset); err != nil {
+				return false, err
+			}
+			cr := csv.NewReader(br)
+			cr.Comma = delim
+			cr.FieldsPerRecord = -1
+			cr.ReuseRecord = true
+			for {
+				record, err := cr.Read()
+				if errors.Is(err, io.EOF) {
+					return false, nil
+				}
+				var pe *csv.ParseError
+				if errors.As(err, &pe) {
+					w := ParseWarning{Line: offset + pe.StartLine, Err: pe.Err.Error()}
+					if pe.Line > pe.StartLine {
+						w.EndLine = offset + pe.Line
+						warnings = append(warnings, w)
+						offset += pe.StartLine
+						return true, nil
+					}
+					warnings = append(warnings, w)
+					continue
+				}
+				if err != nil {
+					return false, err
+				}
+				for i, cell := range record {
+					record[i] = cleanCell(cell)
+				}
+				if err := fn(record); err != nil {
+					return false, err
+				}
+			}
+		}()
+		if err != nil || !restart {
+			return warnings, err
+		}
+	}
+}
+
+// skipLines discards the first n lines of br, like dropLines for a stream.
+func skipLines(br *bufio.Reader, n int) error {
+	for n > 0 {
+		_, err := br.ReadSlice('\n')
+		switch {
+		case err == nil:
+			n--
+		case errors.Is(err, bufio.ErrBufferFull):
+			// 長い行の続きを読む
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// ClassifyStream classifies texts as they arrive on in and hands each row to
+// fn in input order, so memory stays bounded by BatchSize rather than the
+// input size. Each batch goes through PostProcessCommand like ClassifyAll,
+// and once MaxRuntime has passed the remaining texts are handed on as
+// pending rows. It returns when in is closed, ctx is cancelled or fn fails.
+func (s *Service) ClassifyStream(ctx context.Context, in <-chan string, fn func(ResultRow) error) error {
+	cfg := s.Config()
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	var deadline time.Time
+	if cfg.MaxRuntime > 0 {
+		deadline = time.Now().Add(cfg.MaxRuntime)
+	}
+	batch := make([]string, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if batchSize > 1 && (deadline.IsZero() || time.Now().Before(deadline)) {
+			if err := s.prefetchEmbeddings(ctx, batch); err != nil {
+				return err
+			}
+		}
+		rows := make([]ResultRow, 0, len(batch))
+		for _, t := range batch {
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				rows = append(rows, ResultRow{Text: t, Pending: true})
+				continue
+			}
+			row, err := s.rankOne(ctx, t)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		for _, row := range runPostProcess(ctx, cfg.PostProcessCommand, rows) {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case t, ok := <-in:
+			if !ok {
+				return flush()
+			}
+			batch = append(batch, t)
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamCSVRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		want     [][]string
+		warnings []ParseWarning
+		opens    int // 入力を開いた回数
+	}{
+		{
+			name:  "ragged rows",
+			data:  "a,b\n1\n2,x,y\n",
+			want:  [][]string{{"a", "b"}, {"1"}, {"2", "x", "y"}},
+			opens: 1,
+		},
+		{
+			name:     "bare quote skips one record",
+			data:     "1,bad\"q\n2,z\n",
+			want:     [][]string{{"2", "z"}},
+			warnings: []ParseWarning{{Line: 1, Err: "bare \" in non-quoted-field"}},
+			opens:    1,
+		},
+		{
+			name:     "unterminated quote keeps the following rows",
+			data:     "1,x\n2,\"bad\n3,y",
+			want:     [][]string{{"1", "x"}, {"3", "y"}},
+			warnings: []ParseWarning{{Line: 2, EndLine: 3, Err: "extraneous or missing \" in quoted-field"}},
+			opens:    2,
+		},
+		{
+			name: "two unterminated quotes",
+			data: "h\n\"a\n1\n\"b\n2\n",
+			want: [][]string{{"h"}, {"1"}, {"2"}},
+			warnings: []ParseWarning{
+				{Line: 2, EndLine: 4, Err: "extraneous or missing \" in quoted-field"},
+				{Line: 4, EndLine: 5, Err: "extraneous or missing \" in quoted-field"},
+			},
+			opens: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opens := 0
+			open := func() (io.Reader, func(), error) {
+				opens++
+				return strings.NewReader(tt.data), func() {}, nil
+			}
+			var got [][]string
+			warnings, err := streamCSVRecords(open, ',', func(rec []string) error {
+				got = append(got, append([]string(nil), rec...))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("warnings = %+v, want %+v", warnings, tt.warnings)
+			}
+			if opens != tt.opens {
+				t.Errorf("opened %d times, want %d", opens, tt.opens)
+			}
+			// 全体を読む parseCSVRecords と同じ結果になる
+			records, bufWarnings, err := parseCSVRecords([]byte(tt.data), ',')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, records) || !reflect.DeepEqual(warnings, bufWarnings) {
+				t.Errorf("streamed %q %+v, buffered %q %+v", got, warnings, records, bufWarnings)
+			}
+		})
+	}
+}
+
+func TestValidUTF8Prefix(t *testing.T) {
+	cut := []byte("あい")[:4]
+	tests := []struct {
+		name     string
+		b        []byte
+		complete bool
+		want     bool
+	}{
+		{"complete utf8", []byte("あい"), true, true},
+		{"rune cut at the end of a prefix", cut, false, true},
+		{"rune cut at the end of the data", cut, true, false},
+		{"shift_jis", []byte{0x82, 0xa0, 0x82, 0xa2}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validUTF8Prefix(tt.b, tt.complete); got != tt.want {
+				t.Errorf("validUTF8Prefix = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,17 +19,41 @@ func suggestionLabel(s Suggestion) string {
 	return fmt.Sprintf("%s [%s]", s.Label, strings.Join(s.Aliases, " / "))
 }
 
-func formatSuggestionAt(list []Suggestion, idx int, showSource bool) string {
+func formatSuggestionAt(list []Suggestion, idx int, showSource bool, sourceLabels map[string]string) string {
 	if sug, ok := suggestionAt(list, idx); ok {
 		label := suggestionLabel(sug)
 		if showSource && sug.Source != "" {
-			return fmt.Sprintf("%s\n%.3f (%s)", label, sug.Score, sug.Source)
+			return fmt.Sprintf("%s\n%.3f (%s)", label, sug.Score, displaySource(sug.Source, sourceLabels))
 		}
 		return fmt.Sprintf("%s\n%.3f", label, sug.Score)
 	}
 	return ""
 }
 
+// displaySource maps internal source codes ("seed", "ndc", "hybrid", or a
+// comma-joined combination) to display names. Codes without a mapping are
+// shown as-is; the codes themselves stay unchanged for filtering and logic.
+func displaySource(source string, labels map[string]string) string {
+	if len(labels) == 0 || source == "" {
+		return source
+	}
+	parts := strings.Split(source, ",")
+	seen := make(map[string]struct{}, len(parts))
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if name, ok := labels[p]; ok && name != "" {
+			p = name
+		}
+		if _, ok := seen[p]; ok || p == "" {
+			continue
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+	}
+	return strings.Join(out, ",")
+}
+
 func suggestionSources(list []Suggestion) string {
 	seen := make(map[string]struct{})
 	out := make([]string, 0, len(list))
@@ -48,3 +72,10 @@ func suggestionSources(list []Suggestion) string {
 	}
 	return strings.Join(out, ",")
 }
+
+func formatSourceScore(scores map[string]float32, label string) string {
+	if sc, ok := scores[label]; ok {
+		return fmt.Sprintf("%.3f", sc)
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDisplaySource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		labels map[string]string
+		want   string
+	}{
+		{"seed", "seed", defaultSourceLabels(), "項目"},
+		{"ndc", "ndc", defaultSourceLabels(), "NDC"},
+		// seed と hybrid はどちらも「項目」なので1つにまとめる
+		{"combined", "seed,hybrid,ndc", defaultSourceLabels(), "項目,NDC"},
+		{"unmapped code", "post", defaultSourceLabels(), "post"},
+		{"no labels", "seed,ndc", nil, "seed,ndc"},
+		{"empty name keeps code", "ndc", map[string]string{"ndc": ""}, "ndc"},
+		{"empty source", "", defaultSourceLabels(), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := displaySource(tt.source, tt.labels); got != tt.want {
+				t.Errorf("displaySource(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceLabelsKeepInternalCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"default", nil},
+		{"custom", map[string]string{"seed": "カテゴリ", "hybrid": "カテゴリ", "ndc": "分類表"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(c *Config) {
+				c.Mode = ModeSplit
+				c.SourceLabels = tt.labels
+			})
+			labels := svc.Config().SourceLabels
+			// 絞り込みは表示名ではなく内部コードで指定する
+			rows, err := svc.ClassifyAllFiltered(context.Background(), []string{"北海道への旅行記"}, []string{"ndc"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := rows[0]
+			if len(r.Suggestions) != 0 || len(r.NDCSuggestions) == 0 {
+				t.Fatalf("filter by code: %d suggestions, %d NDC suggestions", len(r.Suggestions), len(r.NDCSuggestions))
+			}
+			for _, s := range r.NDCSuggestions {
+				if s.Source != "ndc" {
+					t.Errorf("source = %q, want the internal code", s.Source)
+				}
+			}
+			if got := formatSuggestionAt(r.NDCSuggestions, 0, true, labels); !strings.HasSuffix(got, "("+labels["ndc"]+")") {
+				t.Errorf("display = %q, want the name %q", got, labels["ndc"])
+			}
+			if got := outputColumnValue(OutputColSource, 0, ResultRow{Suggestions: r.NDCSuggestions}, labels); got != labels["ndc"] {
+				t.Errorf("source column = %q, want %q", got, labels["ndc"])
+			}
+			// 表示名で指定しても一致しない
+			rows, err = svc.ClassifyAllFiltered(context.Background(), []string{"北海道への旅行記"}, []string{labels["ndc"]}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(rows[0].NDCSuggestions); n != 0 {
+				t.Errorf("filter by display name kept %d NDC suggestions", n)
+			}
+		})
+	}
+}
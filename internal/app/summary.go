@@ -0,0 +1,263 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryHistogramBins は Top1 スコアのヒストグラムの区間数 (0.1 刻み)。
+const summaryHistogramBins = 10
+
+// runSummary is the per-run report written next to exported results.
+type runSummary struct {
+	GeneratedAt       time.Time       `json:"generated_at"`
+	ConfigFingerprint string          `json:"config_fingerprint"`
+	Mode              string          `json:"mode"`
+	Total             int             `json:"total"`
+	NeedReview        int             `json:"need_review"`
+	Pending           int             `json:"pending"`
+	TooShort          int             `json:"too_short"`
+	Categories        []CategoryCount `json:"categories"`
+	ScoreHistogram    []int           `json:"score_histogram"`
+}
+
+// CategoryCount is how many rows got Label as their top-1 category.
+type CategoryCount struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// buildRunSummary aggregates rows by their top-1 label. The histogram counts
+// top-1 scores in [0,0.1), [0.1,0.2), ... [0.9,1.0]; pending rows are
+// excluded from both. Every count is per input, so a row standing for folded
+// duplicates counts Duplicates+1 times.
+func buildRunSummary(rows []ResultRow, cfg Config, now time.Time) runSummary {
+	sum := runSummary{
+		GeneratedAt:       now,
+		ConfigFingerprint: configFingerprint(cfg),
+		Mode:              cfg.Mode,
+		ScoreHistogram:    make([]int, summaryHistogramBins),
+	}
+	for _, r := range rows {
+		n := r.Duplicates + 1
+		sum.Total += n
+		if r.Pending {
+			sum.Pending += n
+			continue
+		}
+		if r.NeedReview {
+			sum.NeedReview += n
+		}
+		if r.TooShort {
+			sum.TooShort += n
+		}
+		if top, ok := suggestionAt(r.Suggestions, 0); ok {
+			bin := int(top.Score * summaryHistogramBins)
+			if bin >= summaryHistogramBins {
+				bin = summaryHistogramBins - 1
+			}
+			if bin < 0 {
+				bin = 0
+			}
+			sum.ScoreHistogram[bin] += n
+		}
+	}
+	sum.Categories = SortCategoryCounts(SummarizeResults(rows))
+	return sum
+}
+
+// SummarizeResults counts inputs by their top-1 label. A row that stands for
+// folded duplicates counts Duplicates+1 times. Rows without a suggestion
+// count as unclassifiedLabel; pending rows are not counted.
+func SummarizeResults(rows []ResultRow) map[string]int {
+	t := newResultTally(nil)
+	for _, r := range rows {
+		t.add(r)
+	}
+	return t.top
+}
+
+// SortCategoryCounts lists counts by descending count, then by label.
+func SortCategoryCounts(counts map[string]int) []CategoryCount {
+	list := make([]CategoryCount, 0, len(counts))
+	for label, n := range counts {
+		list = append(list, CategoryCount{Label: label, Count: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Label < list[j].Label
+	})
+	return list
+}
+
+// SeedCoverage counts, for every user category, the inputs whose
+// suggestions contain it anywhere (also as a clustered alias), counting each
+// row once plus its folded duplicates. Categories that never appear are
+// included with 0.
+func (s *Service) SeedCoverage(rows []ResultRow) map[string]int {
+	t := newResultTally(s.categoryLabels())
+	for _, r := range rows {
+		t.add(r)
+	}
+	return t.coverage
+}
+
+// resultTally accumulates SummarizeResults and SeedCoverage one row at a
+// time, so streamed results can be summarized without keeping them.
+type resultTally struct {
+	top      map[string]int // 1位カテゴリ → 入力数
+	coverage map[string]int // カテゴリ → 候補に出た入力数
+}
+
+// newResultTally starts a tally; labels are the categories SeedCoverage
+// reports (with 0 when they never appear).
+func newResultTally(labels []string) *resultTally {
+	t := &resultTally{top: make(map[string]int), coverage: make(map[string]int, len(labels))}
+	for _, l := range labels {
+		t.coverage[l] = 0
+	}
+	return t
+}
+
+func (t *resultTally) add(r ResultRow) {
+	if r.Pending {
+		return
+	}
+	n := r.Duplicates + 1
+	t.top[topLabel(r)] += n
+	seen := make(map[string]bool)
+	for _, list := range [][]Suggestion{r.Suggestions, r.SeedSuggestions} {
+		for _, sug := range list {
+			seen[sug.Label] = true
+			for _, al := range sug.Aliases {
+				seen[al] = true
+			}
+		}
+	}
+	for label := range seen {
+		if _, ok := t.coverage[label]; ok {
+			t.coverage[label] += n
+		}
+	}
+}
+
+// formatSeedCoverage lists categories by ascending appearance count so the
+// unused ones come first.
+func formatSeedCoverage(cov map[string]int) string {
+	list := SortCategoryCounts(cov)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Count < list[j].Count })
+	unused := 0
+	width := 0
+	for _, c := range list {
+		if c.Count == 0 {
+			unused++
+		}
+		if w := len([]rune(c.Label)); w > width {
+			width = w
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "候補に一度も出なかったカテゴリ %d / %d\n", unused, len(list))
+	for _, c := range list {
+		fmt.Fprintf(&b, "%s%s  %d\n", c.Label, strings.Repeat(" ", width-len([]rune(c.Label))), c.Count)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// distributionBarWidth は分布表示の棒の最大長 (文字数)。
+const distributionBarWidth = 20
+
+// formatCategoryDistribution renders the top maxRows categories as a text
+// histogram, one "label  ████ count (share)" line each, followed by the
+// remaining total and the labels that were never ranked first.
+func formatCategoryDistribution(list []CategoryCount, labels []string, maxRows int) string {
+	total := 0
+	for _, c := range list {
+		total += c.Count
+	}
+	if total == 0 {
+		return "分類結果がありません"
+	}
+	width := 0
+	for i, c := range list {
+		if i == maxRows {
+			break
+		}
+		if w := len([]rune(c.Label)); w > width {
+			width = w
+		}
+	}
+	var b strings.Builder
+	for i, c := range list {
+		if i == maxRows {
+			rest := 0
+			for _, r := range list[i:] {
+				rest += r.Count
+			}
+			fmt.Fprintf(&b, "ほか %dカテゴリ %d件\n", len(list)-i, rest)
+			break
+		}
+		bar := c.Count * distributionBarWidth / list[0].Count
+		if bar == 0 {
+			bar = 1
+		}
+		pad := strings.Repeat(" ", width-len([]rune(c.Label)))
+		fmt.Fprintf(&b, "%s%s  %s %d (%.1f%%)\n", c.Label, pad, strings.Repeat("█", bar), c.Count, float64(c.Count)*100/float64(total))
+	}
+	if never := neverRankedFirst(labels, list); len(never) > 0 {
+		fmt.Fprintf(&b, "1位にならなかったカテゴリ (%d): %s\n", len(never), strings.Join(never, ", "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// neverRankedFirst returns the labels that do not appear in list.
+func neverRankedFirst(labels []string, list []CategoryCount) []string {
+	seen := make(map[string]bool, len(list))
+	for _, c := range list {
+		seen[c.Label] = true
+	}
+	var out []string
+	for _, l := range labels {
+		if !seen[l] {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// configFingerprint identifies the settings a run was produced with.
+func configFingerprint(cfg Config) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	h := sha1.Sum(data)
+	return hex.EncodeToString(h[:])[:12]
+}
+
+func summaryFileName(now time.Time) string {
+	return fmt.Sprintf("summary_%s.json", now.Format(resultFileTimeLayout))
+}
+
+// writeRunSummary writes the summary as JSON into dir and returns its path.
+func writeRunSummary(dir string, rows []ResultRow, cfg Config) (string, error) {
+	now := time.Now()
+	data, err := json.MarshalIndent(buildRunSummary(rows, cfg, now), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, summaryFileName(now))
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
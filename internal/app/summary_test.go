@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildRunSummary(t *testing.T) {
+	sug := func(label string, score float32) []Suggestion {
+		return []Suggestion{{Label: label, Score: score}}
+	}
+	tests := []struct {
+		name string
+		rows []ResultRow
+		want runSummary // GeneratedAt / ConfigFingerprint / Mode 以外
+	}{
+		{
+			name: "counts and histogram",
+			rows: []ResultRow{
+				{Suggestions: sug("果物", 0.85)},
+				{Suggestions: sug("果物", 0.05), NeedReview: true},
+				{Suggestions: sug("野菜", 1), NeedReview: true, TooShort: true}, // 1.0 は最後の区間
+			},
+			want: runSummary{
+				Total: 3, NeedReview: 2, TooShort: 1,
+				Categories:     []CategoryCount{{"果物", 2}, {"野菜", 1}},
+				ScoreHistogram: []int{1, 0, 0, 0, 0, 0, 0, 0, 1, 1},
+			},
+		},
+		{
+			// 畳んだ重複は入力の件数で数え、未処理の行は総数にだけ入る
+			name: "duplicates and pending",
+			rows: []ResultRow{
+				{Suggestions: sug("家電", 0.55), Duplicates: 2},
+				{Pending: true, NeedReview: true},
+				{NeedReview: true},
+			},
+			want: runSummary{
+				Total: 5, NeedReview: 1, Pending: 1,
+				Categories:     []CategoryCount{{"家電", 3}, {unclassifiedLabel, 1}},
+				ScoreHistogram: []int{0, 0, 0, 0, 0, 3, 0, 0, 0, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildRunSummary(tt.rows, Config{}, time.Time{})
+			got.ConfigFingerprint, got.Mode = "", ""
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summary = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunSummaryMatchesRows writes the summary of a real run and checks each
+// number against the rows it was built from.
+func TestRunSummaryMatchesRows(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "golden_inputs.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestService(t, func(c *Config) { c.Mode = ModeMixed })
+	rows, err := svc.ClassifyAll(context.Background(), splitInputLines(string(data), false), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := writeRunSummary(t.TempDir(), rows, svc.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(path), "summary_") {
+		t.Errorf("file name %q", filepath.Base(path))
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum runSummary
+	if err := json.Unmarshal(raw, &sum); err != nil {
+		t.Fatal(err)
+	}
+
+	needReview, histTotal := 0, 0
+	byLabel := make(map[string]int)
+	for _, r := range rows {
+		if r.NeedReview {
+			needReview++
+		}
+		byLabel[topLabel(r)]++
+	}
+	for _, n := range sum.ScoreHistogram {
+		histTotal += n
+	}
+	catTotal := 0
+	for _, c := range sum.Categories {
+		if c.Count != byLabel[c.Label] {
+			t.Errorf("%s: %d in summary, %d rows", c.Label, c.Count, byLabel[c.Label])
+		}
+		catTotal += c.Count
+	}
+	if sum.Total != len(rows) || sum.NeedReview != needReview || catTotal != len(rows) || histTotal != len(rows) {
+		t.Errorf("total %d need_review %d categories %d histogram %d, want %d, %d, %d, %d",
+			sum.Total, sum.NeedReview, catTotal, histTotal, len(rows), needReview, len(rows), len(rows))
+	}
+	if sum.Mode != ModeMixed || sum.ConfigFingerprint != configFingerprint(svc.Config()) {
+		t.Errorf("mode %q fingerprint %q", sum.Mode, sum.ConfigFingerprint)
+	}
+	// 設定が変われば指紋も変わる
+	cfg := svc.Config()
+	cfg.TopK++
+	if configFingerprint(cfg) == sum.ConfigFingerprint {
+		t.Error("fingerprint unchanged after a config change")
+	}
+}
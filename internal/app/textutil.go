@@ -1,11 +1,61 @@
 package app
 
 import (
+	"html"
+	"regexp"
 	"strings"
+	"unicode"
 
 	"golang.org/x/text/unicode/norm"
 )
 
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p\s*>|</div\s*>|</li\s*>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+
+	// "1." などの番号は区切りの後に空白か数字以外が続くときだけ番号とみなし、
+	// "2.5次元" や "3.11対応" は残す。区切りの直後の文字は $1 で戻す。
+	labelNumberingPattern = regexp.MustCompile(`^(?:[0-9]+[.)．）、](?:\s+|([^0-9０-９\s])|$)|[(（][0-9]+[)）]\s*|[①-⑳]\s*)`)
+)
+
+const (
+	labelBulletChars   = "・･•●○◆◇■□▪▫★☆※-*+> 　"
+	labelTrailingChars = "。、，,.．;；:：・･ 　"
+)
+
+// stripHTML removes markup from scraped text: line-breaking tags become
+// newlines, remaining tags are dropped and entities are decoded.
+func stripHTML(s string) string {
+	if !strings.Contains(s, "<") && !strings.Contains(s, "&") {
+		return s
+	}
+	s = htmlBreakPattern.ReplaceAllString(s, "\n")
+	s = htmlTagPattern.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+// trimLabelDecoration removes list bullets, numbering such as "1. " or "(2)"
+// and trailing punctuation that leak into labels from hand-written files.
+func trimLabelDecoration(s string) string {
+	s = strings.TrimSpace(s)
+	for {
+		prev := s
+		s = strings.TrimLeft(s, labelBulletChars)
+		s = labelNumberingPattern.ReplaceAllString(s, "$1")
+		if s == prev {
+			break
+		}
+	}
+	return strings.TrimRight(s, labelTrailingChars)
+}
+
+// collapseSpaces trims s and collapses runs of whitespace (tabs, full-width
+// spaces, repeated spaces) into a single space, as normalize does, without
+// applying NFKC so the text is otherwise left as written.
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
 func normalize(s string) string {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -28,11 +78,25 @@ func normalizeKey(s string) string {
 }
 
 func normalizeText(s string) string {
-	normed := normalize(s)
-	if normed == "" {
-		return ""
+	return foldText(normalize(s), true, false)
+}
+
+// foldText applies the optional normalization steps to already normalized
+// text. Punctuation becomes a space so words on either side stay apart.
+// Case folding leaves CJK text as is since it has no case.
+func foldText(s string, caseFold, stripPunct bool) string {
+	if stripPunct {
+		s = strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) {
+				return ' '
+			}
+			return r
+		}, s)), " ")
 	}
-	return strings.ToLower(normed)
+	if caseFold {
+		s = strings.ToLower(s)
+	}
+	return s
 }
 
 func uniqueNormalized(labels []string) []string {
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTrimLabelDecoration(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"numbered with space", "1. 果物", "果物"},
+		{"numbered without space", "2)野菜", "野菜"},
+		{"full-width numbering", "3．家電", "家電"},
+		{"ideographic comma", "10、スポーツ", "スポーツ"},
+		{"parenthesized", "（4）旅行", "旅行"},
+		{"circled", "⑤ 料理", "料理"},
+		{"bullet", "・果物", "果物"},
+		{"bullet and number", "- 1. 野菜。", "野菜"},
+		{"trailing punctuation", "家電、", "家電"},
+		// 区切りの直後が数字なら番号ではない
+		{"decimal prefix", "2.5次元", "2.5次元"},
+		{"date prefix", "3.11対応", "3.11対応"},
+		{"numbered decimal", "1. 2.5次元", "2.5次元"},
+		{"plain number", "2024年の話題", "2024年の話題"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimLabelDecoration(tt.in); got != tt.want {
+				t.Errorf("trimLabelDecoration(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "新鮮な野菜", "新鮮な野菜"},
+		{"tags", "<p>新鮮な<b>野菜</b>の話</p>", "新鮮な野菜の話\n"},
+		{"attributes", `<a href="https://example.com/?a=1&amp;b=2">リンク</a>`, "リンク"},
+		{"entities", "果物 &amp; 野菜 &lt;旬&gt; &quot;特集&quot;", `果物 & 野菜 <旬> "特集"`},
+		{"numeric entity", "&#26412;&#x306E;話", "本の話"},
+		{"br", "一行目<br>二行目<BR/>三行目<br />四行目", "一行目\n二行目\n三行目\n四行目"},
+		{"block ends", "<li>りんご</li><li>みかん</li><div>梨</div>", "りんご\nみかん\n梨\n"},
+		{"lone ampersand", "A&B", "A&B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripHTML(tt.in); got != tt.want {
+				t.Errorf("stripHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripHTMLConfig(t *testing.T) {
+	const text = "<p>新鮮な<b>野菜</b> &amp; 果物</p>"
+	tests := []struct {
+		name      string
+		stripHTML bool
+		want      string // 埋め込まれる正規化後の文字列
+	}{
+		// 既定では無効で、タグも実体参照もそのまま埋め込む
+		{"off", false, "<p>新鮮な<b>野菜</b> &amp; 果物</p>"},
+		{"on", true, "新鮮な野菜 & 果物"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(cfg *Config) { cfg.StripHTML = tt.stripHTML })
+			row, err := svc.RankOne(context.Background(), text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.Normalized != tt.want {
+				t.Errorf("normalized = %q, want %q", row.Normalized, tt.want)
+			}
+			if row.Text != text {
+				t.Errorf("text = %q, want the input unchanged", row.Text)
+			}
+		})
+	}
+	if defaultConfig().StripHTML {
+		t.Error("StripHTML is on by default")
+	}
+}
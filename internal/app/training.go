@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// TrainingExample is one (input, prediction) pair for downstream ML pipelines.
+//
+// The JSON field names are part of the export format and are kept stable;
+// new fields may be appended but existing ones are not renamed or removed.
+type TrainingExample struct {
+	Text       string  `json:"text"`
+	Predicted  string  `json:"predicted"`
+	Score      float32 `json:"score"`
+	Margin     float32 `json:"margin"`
+	NeedReview bool    `json:"need_review"`
+	Source     string  `json:"source,omitempty"`
+}
+
+// ClassifyForTraining classifies texts and returns one TrainingExample per
+// input in the same order. Margin is the top1-top2 score gap (the top-1 score
+// itself when only one candidate exists).
+func (s *Service) ClassifyForTraining(ctx context.Context, texts []string) ([]TrainingExample, error) {
+	rows, err := s.ClassifyAll(ctx, texts, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TrainingExample, len(rows))
+	for i, row := range rows {
+		out[i] = trainingExampleFromRow(row)
+	}
+	return out, nil
+}
+
+func trainingExampleFromRow(row ResultRow) TrainingExample {
+	ex := TrainingExample{
+		Text:       row.Text,
+		Predicted:  topLabel(row),
+		NeedReview: row.NeedReview,
+	}
+	if top, ok := suggestionAt(row.Suggestions, 0); ok {
+		ex.Score = top.Score
+		ex.Margin = top.Score
+		ex.Source = top.Source
+		if second, ok := suggestionAt(row.Suggestions, 1); ok {
+			ex.Margin = top.Score - second.Score
+		}
+	}
+	return ex
+}
+
+// writeTrainingJSONL writes one JSON object per line.
+func writeTrainingJSONL(w io.Writer, examples []TrainingExample) error {
+	enc := json.NewEncoder(w)
+	for _, ex := range examples {
+		if err := enc.Encode(ex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,14 +4,27 @@ type Candidate struct {
 	Label  string
 	Key    string
 	Vec    []float32
-	Source string // "seed" or "ndc"
+	Norm   float32 // |Vec| を事前計算したもの。0 なら都度計算する
+	Source string  // "seed" or "ndc"
+	Lang   string  // 言語タグ ("ja" / "en" など)。空なら全言語共通
+	Weight float32 // 類似度に掛ける重み。0 なら 1 として扱う
+	// Aliases は同じカテゴリの別名。最も近い名前の類似度をカテゴリの類似度とする。
+	Aliases []AliasVec
+}
+
+// AliasVec is another name for a candidate with its own embedding.
+type AliasVec struct {
+	Text string
+	Vec  []float32
+	Norm float32
 }
 
 type Suggestion struct {
-	Label   string
-	Score   float32
-	Source  string
-	Aliases []string
+	Label    string
+	Score    float32 // 重み・ボーナス適用後のスコア (順位付けに使用)
+	RawScore float32 // 重み付け前のコサイン類似度
+	Source   string
+	Aliases  []string
 }
 
 type ResultRow struct {
@@ -20,7 +33,41 @@ type ResultRow struct {
 	SeedSuggestions []Suggestion
 	NDCSuggestions  []Suggestion
 	NeedReview      bool
+	Top1Score       float32 // 要確認判定に使った候補リストの1位スコア
+	Margin          float32 // 同リストの1位と2位の差 (候補が1件なら1位スコア)
+	TooShort        bool
+	Pending         bool // MaxRuntime 超過で未処理
+	Duplicates      int  // DedupeInputs でこの行にまとめた他の入力の件数
+	BelowMinScore   bool // 項目候補がすべて MinScore (またはカテゴリ別閾値) 未満だった
+	NoCandidates    bool // NoCandidate が "error" で、スコアを持つ候補が1件もなかった
 	BaseScores      map[string]float32
 	RuleBonus       map[string]float32
 	FinalScores     map[string]float32
+	NDCScores       map[string]float32
+	SeedRawScores   map[string]float32 // カテゴリごとの重み付け前の類似度
+	NDCRawScores    map[string]float32 // NDC 候補ごとの重み付け前の類似度
+
+	// Debug はラベルごとのスコア内訳 (Config.ScoreBreakdown が有効なときのみ)。
+	Debug map[string]ScoreBreakdown
+
+	// ルールで一致したキーワード。位置は Normalized (埋め込みに使った正規化済み本文) 上のバイト位置。
+	Normalized   string
+	KeywordSpans []KeywordSpan
+
+	// 既存ラベルの検証 (verify モード)
+	Assigned         string
+	AssignedRank     int
+	AssignedScore    float32
+	AssignedMismatch bool
+}
+
+// ScoreBreakdown shows how a label's score was composed. Base and RuleBonus
+// are only set for user categories; NDC scores are Cosine * Weight.
+type ScoreBreakdown struct {
+	Source    string
+	Cosine    float32 // 重み付け前のコサイン類似度
+	Weight    float32 // カテゴリの重み / NDC 重み
+	Base      float32 // Cosine * Weight
+	RuleBonus float32
+	Final     float32 // バイアス・部分一致ボーナス等を含む最終スコア
 }
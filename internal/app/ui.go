@@ -2,10 +2,8 @@ package app
 
 import (
 	"context"
-	"encoding/csv"
 	"errors"
 	"fmt"
-	"io"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -52,14 +50,31 @@ type uiState struct {
 	status        *widget.Label
 	progress      *widget.ProgressBar
 	configSummary *widget.Label
+	distribution  *widget.Label
 
 	// 結果
-	resTbl    *widget.Table
-	columns   []tableColumn
-	rows      []ResultRow
-	viewRows  []ResultRow // フィルタ後の表示用
+	resTbl   *widget.Table
+	columns  []tableColumn
+	rows     []ResultRow
+	viewRows []ResultRow // フィルタ後の表示用
+	viewIdx  []int       // viewRows の各行の rows 上の位置。nil なら rows と同じ並び
+	// rowOwner は重複をまとめて分類したときの、入力 i をまとめた先の rows 上の位置。nil ならまとめていない。
+	rowOwner  []int
 	filterEnt *widget.Entry
 
+	// CSV の既存ラベル列 (入力行と同じ並び)。verify 表示に使う。
+	assigned []string
+	// 入力の読込元 CSV。元ファイルへの列追加出力に使う。
+	source *csvSource
+	// rowSource は rows を分類したときの読込元。rows は rowSource.entries と同じ並び。
+	rowSource *csvSource
+	// 入力ファイルの文字コード。setSource で source に引き継ぐ。
+	loadEncoding textEncoding
+	// 入力ファイルの読込時に解析できずスキップしたレコード。setSource で source に引き継ぐ。
+	loadWarnings []ParseWarning
+	// 読み込んだ入力ファイル名。出力ファイル名の {input} に使う。
+	inputName string
+
 	// データバインド
 	statusBind   binding.String
 	logBind      binding.String
@@ -70,11 +85,23 @@ type uiState struct {
 	logMu       sync.Mutex
 	logUpdateCh chan struct{}
 
+	// セッション内の分類履歴 (表示のみ)
+	history        runHistory
+	historySel     *widget.Select
+	historyLoading bool
+
+	// 実行中の分類ジョブの中止用
+	cancelClassify context.CancelFunc
+
 	// 操作ボタン
 	classifyBtn *widget.Button
+	cancelBtn   *widget.Button
 	exportBtn   *widget.Button
+	augmentBtn  *widget.Button
 	loadBtn     *widget.Button
 	catBtn      *widget.Button
+	catEditBtn  *widget.Button
+	reclassBtn  *widget.Button
 }
 
 func buildUI(a fyne.App, svc *Service) *uiState {
@@ -105,18 +132,26 @@ func buildUI(a fyne.App, svc *Service) *uiState {
 	u.progress = widget.NewProgressBarWithData(u.progressBind)
 	u.progress.Hide()
 	u.configSummary = widget.NewLabel("")
+	u.distribution = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
 
 	// 操作ボタン
 	u.classifyBtn = widget.NewButtonWithIcon("分類実行", theme.ConfirmIcon(), func() { u.onClassify() })
 
+	u.cancelBtn = widget.NewButtonWithIcon("中止", theme.CancelIcon(), func() { u.onCancelClassify() })
+	u.cancelBtn.Disable()
+
 	u.exportBtn = widget.NewButtonWithIcon("CSVエクスポート", theme.DocumentSaveIcon(), func() { u.onExport() })
 
+	u.augmentBtn = widget.NewButtonWithIcon("元CSVに追記", theme.DocumentSaveIcon(), func() { u.onExportAugmented() })
+
 	u.loadBtn = widget.NewButtonWithIcon("ファイル読込", theme.FolderOpenIcon(), func() { u.onLoadFile() })
 
 	settingsBtn := widget.NewButtonWithIcon("設定", theme.SettingsIcon(), func() { u.openSettings() })
 
 	u.catBtn = widget.NewButtonWithIcon("カテゴリ読込", theme.ContentAddIcon(), func() { u.onLoadCategories() })
 
+	u.catEditBtn = widget.NewButtonWithIcon("カテゴリ編集", theme.DocumentCreateIcon(), func() { u.onEditCategories() })
+
 	// テーブル生成
 	u.columns = u.makeColumns(u.cfg)
 	u.resTbl = widget.NewTable(
@@ -169,10 +204,17 @@ func buildUI(a fyne.App, svc *Service) *uiState {
 			}
 		},
 	)
+	u.resTbl.OnSelected = func(id widget.TableCellID) {
+		u.resTbl.UnselectAll()
+		if id.Row == 0 || id.Row-1 >= len(u.viewRows) {
+			return
+		}
+		u.showRowDetail(u.viewRows[id.Row-1], u.rowIndex(id.Row-1))
+	}
 	u.applyColumnWidths()
 
 	// --- UI: 上部ツールバー ---
-	toolbar := container.NewGridWithColumns(5, u.classifyBtn, u.loadBtn, u.catBtn, u.exportBtn, settingsBtn)
+	toolbar := container.NewGridWithColumns(8, u.classifyBtn, u.cancelBtn, u.loadBtn, u.catBtn, u.catEditBtn, u.exportBtn, u.augmentBtn, settingsBtn)
 
 	// --- 入力タブ ---
 	inputHeader := widget.NewLabelWithStyle("入力テキスト", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
@@ -183,12 +225,16 @@ func buildUI(a fyne.App, svc *Service) *uiState {
 	u.filterEnt = widget.NewEntry()
 	u.filterEnt.SetPlaceHolder("結果をフィルタ (本文/候補/ソースに含まれる語)")
 	u.filterEnt.OnChanged = func(s string) { u.applyFilter(strings.TrimSpace(s)) }
-	filterBar := container.NewGridWithColumns(2, widget.NewLabel("フィルタ"), u.filterEnt)
+	u.historySel = widget.NewSelect(nil, func(label string) { u.showHistory(label) })
+	u.historySel.PlaceHolder = "履歴なし"
+	u.reclassBtn = widget.NewButtonWithIcon("表示中の行を再分類", theme.ViewRefreshIcon(), func() { u.onReclassifyVisible() })
+	filterBar := container.NewGridWithColumns(5, widget.NewLabel("フィルタ"), u.filterEnt, widget.NewLabel("実行履歴"), u.historySel, u.reclassBtn)
 	resultsTab := container.NewBorder(filterBar, nil, nil, nil, container.NewMax(u.resTbl))
 
 	// --- アクティビティタブ: 進捗/ステータス/設定サマリ/ログ ---
 	progHeader := widget.NewLabelWithStyle("進捗", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	cfgHeader := widget.NewLabelWithStyle("設定サマリ", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	distHeader := widget.NewLabelWithStyle("カテゴリ分布 (1位)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	logHeader := widget.NewLabelWithStyle("ログ", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	activity := container.NewVBox(
 		progHeader,
@@ -198,6 +244,13 @@ func buildUI(a fyne.App, svc *Service) *uiState {
 		cfgHeader,
 		u.configSummary,
 		widget.NewSeparator(),
+		distHeader,
+		u.distribution,
+		widget.NewSeparator(),
+		widget.NewButtonWithIcon("カテゴリの出現回数", theme.ListIcon(), func() { u.onShowCoverage() }),
+		widget.NewButtonWithIcon("カテゴリの例文の充実度", theme.InfoIcon(), func() { u.onShowCategoryQuality() }),
+		widget.NewButtonWithIcon("キャッシュ削除", theme.DeleteIcon(), func() { u.onClearCache() }),
+		widget.NewSeparator(),
 		logHeader,
 		container.NewMax(u.log),
 	)
@@ -218,46 +271,78 @@ func buildUI(a fyne.App, svc *Service) *uiState {
 	u.updateConfigSummary()
 	// 初期はフィルタなしで viewRows = rows
 	u.viewRows = u.rows
+	u.warnAmbiguousCategories()
 	return u
 }
 
+// warnAmbiguousCategories は類似しすぎたカテゴリの組を警告する。
+func (u *uiState) warnAmbiguousCategories() {
+	pairs := u.service.DetectAmbiguousCategories(ambiguousCategoryThreshold)
+	if len(pairs) == 0 {
+		return
+	}
+	msg := formatAmbiguousPairs(pairs)
+	u.appendLog(fmt.Sprintf("類似カテゴリ %d組を検出しました", len(pairs)))
+	dialog.ShowInformation("警告", "これらのカテゴリは非常に似ており、分類が不安定になります\n\n"+msg, u.w)
+}
+
 // 列定義は既存ロジックを流用
 func (u *uiState) makeColumns(cfg Config) []tableColumn {
 	cols := []tableColumn{
 		{Title: "本文", Width: 360, Render: func(r ResultRow) string { return r.Text }},
 	}
-	for i := 0; i < cfg.TopK; i++ {
+	seeds, ndc := u.service.CandidateStats()
+	available := seeds
+	if cfg.Mode == ModeMixed && ndcEnabled(cfg) {
+		available += ndc
+	}
+	for i := 0; i < limitTopK(cfg.TopK, available); i++ {
 		idx := i
 		cols = append(cols, tableColumn{
-			Title:  fmt.Sprintf("候補%d", i+1),
-			Width:  190,
-			Render: func(r ResultRow) string { return formatSuggestionAt(r.Suggestions, idx, true) },
+			Title: fmt.Sprintf("候補%d", i+1),
+			Width: 190,
+			Render: func(r ResultRow) string {
+				if idx == 0 && r.BelowMinScore && len(r.Suggestions) == 0 {
+					return "候補なし"
+				}
+				return formatSuggestionAt(r.Suggestions, idx, true, cfg.SourceLabels)
+			},
 		})
 	}
 	cols = append(cols, tableColumn{
 		Title: "要確認",
 		Width: 80,
 		Render: func(r ResultRow) string {
+			if r.Pending {
+				return "未処理"
+			}
 			if r.NeedReview {
 				return "要確認"
 			}
 			return ""
 		},
 	})
-	if cfg.Mode == ModeSplit {
-		for i := 0; i < cfg.TopK; i++ {
+	if len(u.assigned) > 0 {
+		cols = append(cols, tableColumn{
+			Title:  "既存ラベル",
+			Width:  160,
+			Render: formatAssigned,
+		})
+	}
+	if separateNDC(cfg) {
+		for i := 0; i < limitTopK(cfg.TopK, ndc); i++ {
 			idx := i
 			cols = append(cols, tableColumn{
 				Title:  fmt.Sprintf("NDC%d", i+1),
 				Width:  190,
-				Render: func(r ResultRow) string { return formatSuggestionAt(r.NDCSuggestions, idx, false) },
+				Render: func(r ResultRow) string { return formatSuggestionAt(r.NDCSuggestions, idx, false, nil) },
 			})
 		}
 	} else {
 		cols = append(cols, tableColumn{
 			Title:  "ソース",
 			Width:  120,
-			Render: func(r ResultRow) string { return suggestionSources(r.Suggestions) },
+			Render: func(r ResultRow) string { return displaySource(suggestionSources(r.Suggestions), cfg.SourceLabels) },
 		})
 	}
 	return cols
@@ -281,14 +366,22 @@ func (u *uiState) setBusy(b bool) {
 	fyne.Do(func() {
 		if b {
 			u.classifyBtn.Disable()
+			u.cancelBtn.Enable()
 			u.exportBtn.Disable()
+			u.augmentBtn.Disable()
 			u.loadBtn.Disable()
 			u.catBtn.Disable()
+			u.catEditBtn.Disable()
+			u.reclassBtn.Disable()
 		} else {
 			u.classifyBtn.Enable()
+			u.cancelBtn.Disable()
 			u.exportBtn.Enable()
+			u.augmentBtn.Enable()
 			u.loadBtn.Enable()
 			u.catBtn.Enable()
+			u.catEditBtn.Enable()
+			u.reclassBtn.Enable()
 		}
 	})
 }
@@ -355,21 +448,25 @@ func (u *uiState) flushLog() {
 func (u *uiState) applyFilter(q string) {
 	if q == "" {
 		u.viewRows = u.rows
+		u.viewIdx = nil
 		u.resTbl.Refresh()
 		return
 	}
 	qLower := strings.ToLower(q)
 	filtered := make([]ResultRow, 0, len(u.rows))
-	for _, r := range u.rows {
+	var idx []int
+	for i, r := range u.rows {
 		if strings.Contains(strings.ToLower(r.Text), qLower) {
 			filtered = append(filtered, r)
+			idx = append(idx, i)
 			continue
 		}
 		// 候補
 		match := false
 		for _, s := range r.Suggestions {
 			if strings.Contains(strings.ToLower(suggestionLabel(s)), qLower) ||
-				strings.Contains(strings.ToLower(s.Source), qLower) {
+				strings.Contains(strings.ToLower(s.Source), qLower) ||
+				strings.Contains(strings.ToLower(displaySource(s.Source, u.cfg.SourceLabels)), qLower) {
 				match = true
 				break
 			}
@@ -384,12 +481,122 @@ func (u *uiState) applyFilter(q string) {
 		}
 		if match {
 			filtered = append(filtered, r)
+			idx = append(idx, i)
 		}
 	}
 	u.viewRows = filtered
+	u.viewIdx = idx
 	u.resTbl.Refresh()
 }
 
+// rowIndex は表示中の i 行目の rows 上の位置を返す。
+func (u *uiState) rowIndex(i int) int {
+	if u.viewIdx == nil {
+		return i
+	}
+	return u.viewIdx[i]
+}
+
+// onReclassifyVisible は表示中 (フィルタ後) の行だけを現在のカテゴリで分類し直す。
+func (u *uiState) onReclassifyVisible() {
+	idx := make([]int, len(u.viewRows))
+	for i := range u.viewRows {
+		idx[i] = u.rowIndex(i)
+	}
+	u.reclassifyRows(idx)
+}
+
+// reclassifyRows は rows の指定位置の行だけを分類し直し、その場で置き換える。
+// カテゴリを直した後に、問題のあった行だけを全件やり直さずに確かめるために使う。
+// 既存ラベルとの照合とまとめた件数は元の行から引き継ぐ。
+func (u *uiState) reclassifyRows(idx []int) {
+	if len(idx) == 0 {
+		dialog.ShowInformation("情報", "再分類する行がありません", u.w)
+		return
+	}
+	base := u.rows
+	texts := make([]string, len(idx))
+	for j, i := range idx {
+		texts[j] = base[i].Text
+	}
+	u.setBusy(true)
+	u.setStatus(fmt.Sprintf("再分類中 (%d件)", len(idx)))
+	go func() {
+		rows, err := u.service.ClassifyAll(context.Background(), texts, nil)
+		u.setBusy(false)
+		if err != nil {
+			fyne.Do(func() { dialog.ShowError(err, u.w) })
+			u.setStatus("エラー")
+			u.appendLog(fmt.Sprintf("再分類エラー: %v", err))
+			return
+		}
+		fyne.Do(func() {
+			if len(u.rows) != len(base) || (len(base) > 0 && &u.rows[0] != &base[0]) {
+				u.appendLog("結果が入れ替わったため再分類の結果を破棄しました")
+				return
+			}
+			// 履歴と共有しているスライスは書き換えずに複製する
+			updated := append([]ResultRow(nil), base...)
+			changed := 0
+			for j, i := range idx {
+				old := base[i]
+				if old.Assigned != "" {
+					annotateAssigned(rows[j:j+1], []string{old.Assigned})
+				}
+				r := rows[j]
+				r.Duplicates = old.Duplicates
+				if topLabel(r) != topLabel(old) {
+					changed++
+				}
+				updated[i] = r
+			}
+			u.rows = updated
+			u.applyFilter(strings.TrimSpace(u.filterEnt.Text))
+			u.updateDistribution()
+			u.setStatus(fmt.Sprintf("再分類 %d件", len(idx)))
+			u.appendLog(fmt.Sprintf("%d件を再分類しました (1位が変わった行 %d件)", len(idx), changed))
+		})
+	}()
+}
+
+// --- 詳細表示: 一致キーワードを強調 ---
+func (u *uiState) showRowDetail(r ResultRow, rowIdx int) {
+	rt := widget.NewRichTextFromMarkdown(buildRowDetailMarkdown(r, u.cfg.SourceLabels))
+	rt.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(rt)
+	scroll.SetMinSize(fyne.NewSize(560, 360))
+	whyNot := widget.NewButton("この文章でこのカテゴリが出ない理由", func() { u.onExplainText(r.Text) })
+	var d dialog.Dialog
+	reclass := widget.NewButton("この行を再分類", func() {
+		d.Hide()
+		u.reclassifyRows([]int{rowIdx})
+	})
+	actions := container.NewGridWithColumns(2, whyNot, reclass)
+	d = dialog.NewCustom("詳細", "閉じる", container.NewBorder(nil, actions, nil, nil, scroll), u.w)
+	d.Show()
+}
+
+// onExplainText は指定したカテゴリがこの入力で候補に出ない理由を表示する。
+func (u *uiState) onExplainText(text string) {
+	labelEntry := widget.NewSelectEntry(u.service.categoryLabels())
+	labelEntry.SetPlaceHolder("カテゴリ名 (別名も可)")
+	dialog.NewCustomConfirm("候補に出ない理由", "調べる", "キャンセル", labelEntry, func(ok bool) {
+		if !ok || strings.TrimSpace(labelEntry.Text) == "" {
+			return
+		}
+		ex, err := u.service.ExplainText(context.Background(), text, labelEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, u.w)
+			return
+		}
+		rt := widget.NewRichTextFromMarkdown(buildExplanationMarkdown(ex))
+		rt.Wrapping = fyne.TextWrapWord
+		scroll := container.NewVScroll(rt)
+		scroll.SetMinSize(fyne.NewSize(480, 280))
+		dialog.ShowCustom("候補に出ない理由", "閉じる", scroll, u.w)
+	}, u.w).Show()
+}
+
 // --- ステータス/進捗 ---
 func (u *uiState) setStatus(text string) { _ = u.statusBind.Set(text) }
 
@@ -404,12 +611,12 @@ func (u *uiState) updateConfigSummary() {
 	cfg := u.cfg
 	seeds, ndc := u.service.CandidateStats()
 	ndcStatus := "OFF"
-	if cfg.Mode == ModeSplit || cfg.UseNDC {
+	if ndcEnabled(cfg) {
 		ndcStatus = fmt.Sprintf("ON (w=%.2f)", cfg.WeightNDC)
 	}
 	clusterStatus := "OFF"
 	if cfg.ClusterCfg.Enabled {
-		clusterStatus = fmt.Sprintf("ON (τ=%.2f)", cfg.ClusterCfg.Threshold)
+		clusterStatus = fmt.Sprintf("ON (τ=%.2f, %s, %s)", cfg.ClusterCfg.Threshold, cfg.ClusterCfg.Linkage, cfg.ClusterCfg.Algorithm)
 	}
 	modeLabel := cfg.Mode
 	for _, c := range modeChoices {
@@ -418,14 +625,31 @@ func (u *uiState) updateConfigSummary() {
 			break
 		}
 	}
-	summary := fmt.Sprintf("モード:%s / Top-k:%d / SeedBias:%.2f / NDC:%s / クラスタ:%s / カテゴリ:%d / NDC辞書:%d",
-		modeLabel, cfg.TopK, cfg.SeedBias, ndcStatus, clusterStatus, seeds, ndc)
+	modelID, dim := u.service.ModelInfo()
+	dimStatus := "次元:未計測"
+	if dim > 0 {
+		dimStatus = fmt.Sprintf("%d次元", dim)
+	}
+	summary := fmt.Sprintf("モード:%s / Top-k:%d / SeedBias:%.2f / NDC:%s / クラスタ:%s / カテゴリ:%d / NDC辞書:%d / モデル:%s (%s / %s)",
+		modeLabel, cfg.TopK, cfg.SeedBias, ndcStatus, clusterStatus, seeds, ndc, modelID, dimStatus, u.service.Backend())
 	u.configSummary.SetText(summary)
 }
 
 // --- アクション: 既存ロジックを踏襲しつつ viewRows を更新 ---
 func (u *uiState) onClassify() {
-	lines := splitNonEmptyLines(u.input.Text)
+	src := u.source
+	var lines []string
+	switch {
+	case src != nil && u.input.Text == src.inputText:
+		// CSV の各行をそのまま分類し、追記出力で元の行に戻せるようにする
+		lines = append([]string(nil), src.entries...)
+	case src != nil:
+		u.source, src = nil, nil
+		u.appendLog("入力欄が編集されたため、元CSVへの追記は使えなくなりました")
+		fallthrough
+	default:
+		lines = splitInputLines(u.input.Text, u.cfg.KeepEmptyRows)
+	}
 	if len(lines) == 0 {
 		dialog.ShowInformation("情報", "入力テキストが空です", u.w)
 		return
@@ -438,109 +662,325 @@ func (u *uiState) onClassify() {
 	u.setBusy(true)
 	u.appendLog(fmt.Sprintf("分類開始 (%d件)", total))
 	start := time.Now()
+	cacheBefore := u.service.CacheStats()
 
+	assigned := u.assigned
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancelClassify = cancel
 	go func(entries []string) {
-		rows, err := u.service.ClassifyAll(context.Background(), entries, func(done, total int) {
-			u.setProgressValue(float64(done))
-			u.setStatus(fmt.Sprintf("処理中 %d/%d", done, total))
-		})
+		defer cancel()
+		var counts, owner []int
+		var err error
+		if cfg := u.service.Config(); cfg.DedupeInputs {
+			var keep []int
+			keep, owner, err = u.service.DedupeInputs(ctx, entries, cfg.DedupeThreshold)
+			counts = dedupeCounts(owner, len(keep))
+			if err == nil && len(keep) < len(entries) {
+				u.appendLog(fmt.Sprintf("重複した入力 %d件をまとめました (%d件を分類)", len(entries)-len(keep), len(keep)))
+				if len(assigned) == len(entries) {
+					assigned = selectStrings(assigned, keep)
+				}
+				entries = selectStrings(entries, keep)
+				u.configureProgress(0, float64(len(entries)))
+			} else {
+				owner = nil
+			}
+		}
+		var rows []ResultRow
+		if err == nil {
+			rows, err = u.service.ClassifyAll(ctx, entries, func(done, total int) {
+				u.setProgressValue(float64(done))
+				u.setStatus(fmt.Sprintf("処理中 %d/%d", done, total))
+			})
+		}
 
 		u.setBusy(false)
 		u.hideProgress()
+		if errors.Is(err, context.Canceled) {
+			// 途中までの結果は破棄し、前回の結果表示を維持する
+			u.setStatus("中止しました")
+			u.appendLog(fmt.Sprintf("分類を中止しました (%.1fs)", time.Since(start).Seconds()))
+			return
+		}
 		if err != nil {
 			fyne.Do(func() { dialog.ShowError(err, u.w) })
 			u.setStatus("エラー")
 			u.appendLog(fmt.Sprintf("エラー: %v", err))
 			return
 		}
+		setDuplicateCounts(rows, counts)
+		if len(assigned) == len(entries) {
+			annotateAssigned(rows, assigned)
+		}
+		runCfg := u.service.Config()
 		fyne.Do(func() {
 			u.rows = rows
+			u.rowOwner = owner
+			u.rowSource = src
+			u.rebuildTableColumns(u.cfg)
 			u.applyFilter(strings.TrimSpace(u.filterEnt.Text)) // 現在のフィルタを維持
+			u.recordHistory(historyEntry{At: time.Now(), Config: runCfg, Rows: rows, Owner: owner, Source: src})
+			u.updateDistribution()
 		})
 		elapsed := time.Since(start).Seconds()
+		if pending := countPending(rows); pending > 0 {
+			done := len(rows) - pending
+			u.setProgressValue(float64(done))
+			u.setStatus(fmt.Sprintf("途中結果 (%d/%d件)", done, len(rows)))
+			u.appendLog(fmt.Sprintf("最大実行時間に達したため途中結果を表示します (%d/%d件, %.1fs)", done, len(rows), elapsed))
+			return
+		}
 		u.setProgressValue(float64(len(rows)))
 		u.setStatus(fmt.Sprintf("完了 %d件 (%.1fs)", len(rows), elapsed))
 		u.appendLog(fmt.Sprintf("分類完了 %d件 (%.1fs)", len(rows), elapsed))
+		u.appendLog(formatCacheStats(u.service.CacheStats().Sub(cacheBefore)))
+		if none := countNoCandidates(rows); none > 0 {
+			u.appendLog(fmt.Sprintf("候補が1件もない入力 %d件を未分類 (要確認) にしました", none))
+		}
+		if short := countTooShort(rows); short > 0 {
+			u.appendLog(fmt.Sprintf("短すぎる入力 %d件 (%d文字未満) を要確認にしました", short, u.cfg.MinInputChars))
+		}
 	}(lines)
 }
 
+// distributionMaxRows はアクティビティタブに表示するカテゴリ数。
+const distributionMaxRows = 10
+
+// updateDistribution は現在の結果の1位カテゴリの分布を表示する。
+func (u *uiState) updateDistribution() {
+	if len(u.rows) == 0 {
+		u.distribution.SetText("")
+		return
+	}
+	list := SortCategoryCounts(SummarizeResults(u.rows))
+	u.distribution.SetText(formatCategoryDistribution(list, u.service.categoryLabels(), distributionMaxRows))
+}
+
+// formatCacheStats は1回の分類で使われた埋め込みキャッシュの内訳を整形する。
+func formatCacheStats(st CacheStats) string {
+	msg := fmt.Sprintf("キャッシュ: メモリ命中 %d / ディスク命中 %d / 未命中 %d (保持 %d件)",
+		st.MemoryHits, st.DiskHits, st.Misses, st.Entries)
+	if st.Evictions > 0 {
+		msg += fmt.Sprintf(" / 上限超過で破棄 %d件", st.Evictions)
+	}
+	return msg
+}
+
+// onShowCategoryQuality は各カテゴリの例文数とまとまりを表示する。
+func (u *uiState) onShowCategoryQuality() {
+	stats := u.service.CategoryQuality()
+	if len(stats) == 0 {
+		dialog.ShowInformation("情報", "カテゴリがありません", u.w)
+		return
+	}
+	lbl := widget.NewLabelWithStyle(formatCategoryQuality(stats), fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	scroll := container.NewVScroll(lbl)
+	scroll.SetMinSize(fyne.NewSize(480, 320))
+	dialog.ShowCustom("カテゴリの例文の充実度", "閉じる", scroll, u.w)
+}
+
+// onShowCoverage は現在の結果で各カテゴリが候補に出た行数を表示する。
+func (u *uiState) onShowCoverage() {
+	if len(u.rows) == 0 {
+		dialog.ShowInformation("情報", "分類結果がありません", u.w)
+		return
+	}
+	lbl := widget.NewLabelWithStyle(formatSeedCoverage(u.service.SeedCoverage(u.rows)), fyne.TextAlignLeading, fyne.TextStyle{Monospace: true})
+	scroll := container.NewVScroll(lbl)
+	scroll.SetMinSize(fyne.NewSize(420, 320))
+	dialog.ShowCustom("カテゴリの出現回数 (候補に出た行数)", "閉じる", scroll, u.w)
+}
+
+// onClearCache は確認の上で埋め込みキャッシュを破棄する。
+func (u *uiState) onClearCache() {
+	diskCheck := widget.NewCheck("ディスク上のベクトルファイルも削除する", nil)
+	diskCheck.SetChecked(false)
+	if u.cfg.CacheDir == "" {
+		diskCheck.Disable()
+	}
+	info := widget.NewLabel("現在のモデルの埋め込みキャッシュを削除します。")
+	content := container.NewVBox(info, diskCheck)
+	dialog.NewCustomConfirm("キャッシュ削除", "削除", "キャンセル", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		removed, err := u.service.ClearCache(diskCheck.Checked)
+		if err != nil {
+			dialog.ShowError(err, u.w)
+			u.appendLog(fmt.Sprintf("キャッシュ削除エラー: %v", err))
+			return
+		}
+		if diskCheck.Checked {
+			u.appendLog(fmt.Sprintf("キャッシュを削除しました (ファイル %d件)", removed))
+			return
+		}
+		u.appendLog("メモリ上のキャッシュを削除しました")
+	}, u.w).Show()
+}
+
+// recordHistory は実行結果を履歴に追加し、選択肢を最新に更新する。
+func (u *uiState) recordHistory(e historyEntry) {
+	u.history.add(e)
+	u.historyLoading = true
+	u.historySel.Options = u.history.labels()
+	u.historySel.SetSelected(e.label())
+	u.historyLoading = false
+}
+
+// showHistory は過去の実行結果を再埋め込みせずに表示する。
+func (u *uiState) showHistory(label string) {
+	if u.historyLoading {
+		return
+	}
+	e, ok := u.history.find(label)
+	if !ok {
+		return
+	}
+	u.rows = e.Rows
+	u.rowOwner = e.Owner
+	u.rowSource = e.Source
+	u.rebuildTableColumns(e.Config)
+	u.applyFilter(strings.TrimSpace(u.filterEnt.Text))
+	u.updateDistribution()
+	u.setStatus(fmt.Sprintf("履歴表示: %s", label))
+}
+
+func (u *uiState) onCancelClassify() {
+	if u.cancelClassify == nil {
+		return
+	}
+	u.cancelClassify()
+	u.cancelBtn.Disable()
+	u.setStatus("中止中...")
+}
+
 func (u *uiState) onExport() {
 	if len(u.rows) == 0 {
 		dialog.ShowInformation("情報", "出力データがありません", u.w)
 		return
 	}
 	cfg := u.cfg
+	delim := parseOutputDelimiter(cfg.OutputDelimiter)
 	fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
 		if err != nil || uc == nil {
 			return
 		}
 		defer uc.Close()
-		w := csv.NewWriter(uc)
-		header := []string{"text"}
-		for i := 0; i < cfg.TopK; i++ {
-			header = append(header,
-				fmt.Sprintf("suggestion%d", i+1),
-				fmt.Sprintf("score%d", i+1),
-				fmt.Sprintf("source%d", i+1))
-		}
-		if cfg.Mode == ModeSplit {
-			for i := 0; i < cfg.TopK; i++ {
-				header = append(header,
-					fmt.Sprintf("ndc%d", i+1),
-					fmt.Sprintf("ndc_score%d", i+1))
-			}
-		}
-		for i := 0; i < cfg.TopK; i++ {
-			header = append(header,
-				fmt.Sprintf("final_suggestion%d", i+1),
-				fmt.Sprintf("final_score%d", i+1),
-				fmt.Sprintf("final_source%d", i+1))
-		}
-		header = append(header, "final_need_review", "need_review")
-		_ = w.Write(header)
-		for _, r := range u.rows {
-			record := []string{r.Text}
-			for i := 0; i < cfg.TopK; i++ {
-				if sug, ok := suggestionAt(r.Suggestions, i); ok {
-					record = append(record, suggestionLabel(sug), fmt.Sprintf("%.3f", sug.Score), sug.Source)
-				} else {
-					record = append(record, "", "", "")
-				}
+		if cfg.WriteSummary {
+			defer u.exportRunSummary(uc.URI())
+		}
+		switch exportFormat(uc.URI().Name()) {
+		case exportFormatTraining:
+			examples := make([]TrainingExample, len(u.rows))
+			for i, r := range u.rows {
+				examples[i] = trainingExampleFromRow(r)
 			}
-			if cfg.Mode == ModeSplit {
-				for i := 0; i < cfg.TopK; i++ {
-					if sug, ok := suggestionAt(r.NDCSuggestions, i); ok {
-						record = append(record, suggestionLabel(sug), fmt.Sprintf("%.3f", sug.Score))
-					} else {
-						record = append(record, "", "")
-					}
-				}
+			if err := writeTrainingJSONL(uc, examples); err != nil {
+				dialog.ShowError(err, u.w)
+				return
 			}
-			for i := 0; i < cfg.TopK; i++ {
-				if sug, ok := suggestionAt(r.SeedSuggestions, i); ok {
-					record = append(record, suggestionLabel(sug), fmt.Sprintf("%.3f", sug.Score), sug.Source)
-				} else {
-					record = append(record, "", "", "")
-				}
+			u.appendLog(fmt.Sprintf("学習用JSONLエクスポート完了 (%d件)", len(examples)))
+			return
+		case exportFormatCategory:
+			lists := rankInputsFromRows(u.rows, u.service.categoryLabels(), perCategoryExportLimit)
+			if err := writeCategoryInputsCSV(uc, exportDelimiter(uc.URI().Name(), delim), lists); err != nil {
+				dialog.ShowError(err, u.w)
+				return
 			}
-			review := "no"
-			if r.NeedReview {
-				review = "yes"
+			u.appendLog(fmt.Sprintf("カテゴリ別一覧エクスポート完了 (%dカテゴリ)", len(lists)))
+			return
+		case exportFormatMatrix:
+			labels := u.service.categoryLabels()
+			if err := writeScoreMatrix(uc, exportDelimiter(uc.URI().Name(), delim), u.rows, labels, cfg.MatrixTopN); err != nil {
+				dialog.ShowError(err, u.w)
+				return
+			}
+			u.appendLog(fmt.Sprintf("スコア行列エクスポート完了 (%d件 × %dカテゴリ)", len(u.rows), len(labels)))
+			return
+		case exportFormatJSONL:
+			if err := writeResultsJSONL(uc, u.rows); err != nil {
+				dialog.ShowError(err, u.w)
+				return
+			}
+			u.appendLog(fmt.Sprintf("JSONLエクスポート完了 (%d件)", len(u.rows)))
+			return
+		case exportFormatJSON:
+			if err := writeResultsJSON(uc, u.rows); err != nil {
+				dialog.ShowError(err, u.w)
+				return
 			}
-			record = append(record, review, review)
-			_ = w.Write(record)
+			u.appendLog(fmt.Sprintf("JSONエクスポート完了 (%d件)", len(u.rows)))
+			return
 		}
-		w.Flush()
-		u.appendLog(fmt.Sprintf("CSVエクスポート完了 (%d件)", len(u.rows)))
+		cols := exportOutputColumns(cfg, len(u.assigned) > 0)
+		if err := writeOutputColumns(uc, exportDelimiter(uc.URI().Name(), delim), u.rows, cols, cfg.SourceLabels); err != nil {
+			dialog.ShowError(err, u.w)
+			return
+		}
+		u.appendLog(fmt.Sprintf("CSVエクスポート完了 (%d件, %d列)", len(u.rows), len(cols)))
 	}, u.w)
-	fd.SetFileName("result.csv")
+	fd.SetFileName(defaultResultFileName(cfg, time.Now(), u.inputName, delim))
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".csv", ".tsv", ".json", ".jsonl"}))
+	fd.Show()
+}
+
+// exportRunSummary は結果ファイルと同じフォルダに実行サマリーを書き出す。
+func (u *uiState) exportRunSummary(result fyne.URI) {
+	if result.Scheme() != "file" {
+		return
+	}
+	path, err := writeRunSummary(filepath.Dir(result.Path()), u.rows, u.cfg)
+	if err != nil {
+		u.appendLog(fmt.Sprintf("サマリー出力エラー: %v", err))
+		return
+	}
+	u.appendLog(fmt.Sprintf("サマリーを出力しました (%s)", filepath.Base(path)))
+}
+
+func (u *uiState) onExportAugmented() {
+	if len(u.rows) == 0 {
+		dialog.ShowInformation("情報", "出力データがありません", u.w)
+		return
+	}
+	src := u.rowSource
+	if src == nil {
+		dialog.ShowInformation("情報", "CSV/TSV から読み込んで編集せずに分類した結果のみ追記できます", u.w)
+		return
+	}
+	// 重複をまとめた場合も元の各行に結果を付けられるよう入力ごとの行に戻す
+	rows := expandDedupedRows(u.rows, u.rowOwner)
+	fd := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
+		if err != nil || uc == nil {
+			return
+		}
+		defer uc.Close()
+		if err := writeAugmentedCSV(uc, src, rows); err != nil {
+			dialog.ShowError(err, u.w)
+			return
+		}
+		u.appendLog(fmt.Sprintf("元CSVへの追記出力完了 (%s)", uc.URI().Name()))
+		if len(src.skipped) > 0 {
+			u.appendLog(fmt.Sprintf("読込時にスキップしたレコードは出力に含まれません: %s", formatParseWarnings(src.skipped)))
+		}
+	}, u.w)
+	fd.SetFileName(augmentedFileName(src.name))
 	fd.Show()
 }
 
 func (u *uiState) openSettings() {
 	cfg := u.cfg
-	topkSel := widget.NewSelect([]string{"3", "4", "5"}, nil)
+	topkSel := widget.NewSelect(topKChoices(cfg.MaxTopK), nil)
 	topkSel.SetSelected(strconv.Itoa(cfg.TopK))
+	maxTopKSel := widget.NewSelect(topKChoices(topKHardLimit)[defaultMaxTopK-minTopK:], func(v string) {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return
+		}
+		cur, _ := strconv.Atoi(topkSel.Selected)
+		topkSel.Options = topKChoices(limit)
+		topkSel.SetSelected(strconv.Itoa(clampTopK(cur, limit)))
+	})
+	maxTopKSel.SetSelected(strconv.Itoa(cfg.MaxTopK))
 
 	modeLabels := make([]string, len(modeChoices))
 	modeMap := make(map[string]string, len(modeChoices))
@@ -557,15 +997,113 @@ func (u *uiState) openSettings() {
 
 	ndcCheck := widget.NewCheck("NDC を候補に含める", nil)
 	ndcCheck.SetChecked(cfg.UseNDC || cfg.Mode == ModeSplit)
+	seededNDCCheck := widget.NewCheck("項目のみモードでも NDC を別枠で表示", nil)
+	seededNDCCheck.SetChecked(cfg.SeededShowNDC)
 	weightEntry := widget.NewEntry()
 	weightEntry.SetText(fmt.Sprintf("%.2f", cfg.WeightNDC))
 	seedBiasEntry := widget.NewEntry()
 	seedBiasEntry.SetText(fmt.Sprintf("%.2f", cfg.SeedBias))
+	minScoreEntry := widget.NewEntry()
+	minScoreEntry.SetText(fmt.Sprintf("%.2f", cfg.MinScore))
+	singleFloorCheck := widget.NewCheck("候補1件でもTop1閾値未満なら要確認", nil)
+	singleFloorCheck.SetChecked(cfg.ReviewSingleFloor)
+	substringEntry := widget.NewEntry()
+	substringEntry.SetText(fmt.Sprintf("%.2f", cfg.SubstringBoost))
 
 	clusterCheck := widget.NewCheck("類似カテゴリをまとめる", nil)
 	clusterCheck.SetChecked(cfg.ClusterCfg.Enabled)
 	clusterTauEntry := widget.NewEntry()
 	clusterTauEntry.SetText(fmt.Sprintf("%.2f", cfg.ClusterCfg.Threshold))
+	linkageSel := widget.NewSelect([]string{LinkageSingle, LinkageAverage, LinkageComplete}, nil)
+	linkageSel.SetSelected(cfg.ClusterCfg.Linkage)
+	clusterAlgoSel := widget.NewSelect([]string{ClusterGreedy, ClusterAgglomerative}, nil)
+	clusterAlgoSel.SetSelected(cfg.ClusterCfg.Algorithm)
+
+	keepEmptyCheck := widget.NewCheck("空行も1件として扱う", nil)
+	keepEmptyCheck.SetChecked(cfg.KeepEmptyRows)
+	dedupeCheck := widget.NewCheck("同じ内容の入力を1件にまとめる", nil)
+	dedupeCheck.SetChecked(cfg.DedupeInputs)
+	dedupeEntry := widget.NewEntry()
+	dedupeEntry.SetText(fmt.Sprintf("%.2f", cfg.DedupeThreshold))
+	collapseCheck := widget.NewCheck("連続した空白をまとめる", nil)
+	collapseCheck.SetChecked(cfg.CollapseSpaces)
+	stripHTMLCheck := widget.NewCheck("HTMLタグを除去する", nil)
+	stripHTMLCheck.SetChecked(cfg.StripHTML)
+	caseFoldCheck := widget.NewCheck("英字の大文字・小文字を区別しない", nil)
+	caseFoldCheck.SetChecked(cfg.CaseFold)
+	stripPunctCheck := widget.NewCheck("句読点・括弧類を除去する", nil)
+	stripPunctCheck.SetChecked(cfg.StripPunctuation)
+	trimLabelCheck := widget.NewCheck("カテゴリ名の記号・番号を除去する", nil)
+	trimLabelCheck.SetChecked(cfg.TrimLabelPunct)
+	breakdownCheck := widget.NewCheck("詳細表示に1位候補のスコア内訳を出す", nil)
+	breakdownCheck.SetChecked(cfg.ScoreBreakdown)
+	guessCatColCheck := widget.NewCheck("見出しが無いときカテゴリ列を推定する", nil)
+	guessCatColCheck.SetChecked(cfg.GuessCategoryColumn)
+	minCharsEntry := widget.NewEntry()
+	minCharsEntry.SetText(strconv.Itoa(cfg.MinInputChars))
+	summaryCheck := widget.NewCheck("エクスポート時にサマリーを出力する", nil)
+	summaryCheck.SetChecked(cfg.WriteSummary)
+	langRoutingCheck := widget.NewCheck("入力の言語に合うカテゴリのみ使う", nil)
+	langRoutingCheck.SetChecked(cfg.LanguageRouting)
+	lengthNormCheck := widget.NewCheck("短い入力の確信度を割り引く", nil)
+	lengthNormCheck.SetChecked(cfg.LengthNormalization)
+	delimChoices := []struct {
+		Label string
+		Value string
+	}{
+		{Label: "カンマ (CSV)", Value: ","},
+		{Label: "タブ (TSV)", Value: "\t"},
+		{Label: "セミコロン", Value: ";"},
+	}
+	delimLabels := make([]string, len(delimChoices))
+	for i, c := range delimChoices {
+		delimLabels[i] = c.Label
+	}
+	matrixTopNEntry := widget.NewEntry()
+	matrixTopNEntry.SetText(strconv.Itoa(cfg.MatrixTopN))
+	outputNameEntry := widget.NewEntry()
+	outputNameEntry.SetText(cfg.OutputTemplate)
+	outputNameEntry.SetPlaceHolder(defaultOutputTemplate)
+	outputColsEntry := widget.NewEntry()
+	outputColsEntry.SetText(formatOutputColumnSpec(cfg.OutputColumns, cfg.OutputHeaders))
+	outputColsEntry.SetPlaceHolder("空欄で従来の列構成")
+	delimSel := widget.NewSelect(delimLabels, nil)
+	for _, c := range delimChoices {
+		if c.Value == cfg.OutputDelimiter {
+			delimSel.SetSelected(c.Label)
+		}
+	}
+	noCandLabels := make([]string, len(noCandidateChoices))
+	for i, c := range noCandidateChoices {
+		noCandLabels[i] = c.Label
+	}
+	noCandSel := widget.NewSelect(noCandLabels, nil)
+	for _, c := range noCandidateChoices {
+		if c.Value == cfg.NoCandidate {
+			noCandSel.SetSelected(c.Label)
+		}
+	}
+	combineLabels := make([]string, len(mixedCombineChoices))
+	for i, c := range mixedCombineChoices {
+		combineLabels[i] = c.Label
+	}
+	combineSel := widget.NewSelect(combineLabels, nil)
+	for _, c := range mixedCombineChoices {
+		if c.Value == cfg.MixedCombine {
+			combineSel.SetSelected(c.Label)
+		}
+	}
+	tieBreakSel := widget.NewSelect([]string{TieBreakHash, TieBreakLabel, TieBreakInsertion}, nil)
+	tieBreakSel.SetSelected(cfg.TieBreak)
+	metricSel := widget.NewSelect([]string{MetricCosine, MetricDot, MetricEuclidean}, nil)
+	metricSel.SetSelected(cfg.Metric)
+	encodingSel := widget.NewSelect(encodingChoices, nil)
+	encodingSel.SetSelected(cfg.InputEncoding)
+	sheetEntry := widget.NewEntry()
+	sheetEntry.SetText(cfg.Sheet)
+	sheetEntry.SetPlaceHolder("先頭のシート")
+	maxRuntimeEntry := widget.NewEntry()
+	maxRuntimeEntry.SetText(strconv.Itoa(int(cfg.MaxRuntime / time.Second)))
 
 	top1Entry := widget.NewEntry()
 	top1Entry.SetText(fmt.Sprintf("%.2f", cfg.Thresh.Top1))
@@ -583,6 +1121,10 @@ func (u *uiState) openSettings() {
 			ndcCheck.SetChecked(true)
 			ndcCheck.Disable()
 			weightEntry.Enable()
+		} else if modeVal == ModeSeeded {
+			// 項目のみモードでは NDC使用 は効かない
+			ndcCheck.Disable()
+			weightEntry.Enable()
 		} else {
 			ndcCheck.Enable()
 			if ndcCheck.Checked {
@@ -609,16 +1151,48 @@ func (u *uiState) openSettings() {
 	updateControls()
 
 	form := &widget.Form{Items: []*widget.FormItem{
+		{Text: "Top-k 上限", Widget: maxTopKSel},
 		{Text: "Top-k", Widget: topkSel},
 		{Text: "ランキングモード", Widget: modeSel},
 		{Text: "NDC使用", Widget: ndcCheck},
+		{Text: "項目のみ+NDC", Widget: seededNDCCheck},
 		{Text: "NDC重み", Widget: weightEntry},
+		{Text: "同名ラベル (混合)", Widget: combineSel},
 		{Text: "Seedバイアス", Widget: seedBiasEntry},
+		{Text: "最低スコア", Widget: minScoreEntry},
+		{Text: "部分一致ボーナス", Widget: substringEntry},
 		{Text: "閾値 Top1", Widget: top1Entry},
+		{Text: "単独候補", Widget: singleFloorCheck},
 		{Text: "閾値 Top1-Top2", Widget: m12Entry},
 		{Text: "閾値 平均", Widget: meanEntry},
 		{Text: "クラスタリング", Widget: clusterCheck},
 		{Text: "クラスタ閾値", Widget: clusterTauEntry},
+		{Text: "クラスタ連結法", Widget: linkageSel},
+		{Text: "クラスタ手法", Widget: clusterAlgoSel, HintText: "agglomerative は候補の順序に依存しない"},
+		{Text: "空行", Widget: keepEmptyCheck},
+		{Text: "重複入力", Widget: dedupeCheck},
+		{Text: "重複の類似度", Widget: dedupeEntry, HintText: "この類似度以上の入力もまとめる (0 で完全一致のみ)"},
+		{Text: "空白", Widget: collapseCheck},
+		{Text: "HTML", Widget: stripHTMLCheck},
+		{Text: "大文字小文字", Widget: caseFoldCheck, HintText: "埋め込み前に小文字にそろえる。変更後はカテゴリを読み込み直す"},
+		{Text: "句読点", Widget: stripPunctCheck, HintText: "埋め込み・キーワード照合の前に除去する。変更後はカテゴリを読み込み直す"},
+		{Text: "カテゴリ名", Widget: trimLabelCheck},
+		{Text: "カテゴリ列", Widget: guessCatColCheck},
+		{Text: "最小文字数", Widget: minCharsEntry},
+		{Text: "長さ補正", Widget: lengthNormCheck},
+		{Text: "言語別カテゴリ", Widget: langRoutingCheck},
+		{Text: "最大実行時間(秒)", Widget: maxRuntimeEntry},
+		{Text: "出力区切り", Widget: delimSel},
+		{Text: "出力ファイル名", Widget: outputNameEntry, HintText: "{input} {date} {time} {mode} が使えます"},
+		{Text: "出力列", Widget: outputColsEntry, HintText: "例: index,text,category=カテゴリ,score (列名=見出し)"},
+		{Text: "行列の上位件数", Widget: matrixTopNEntry, HintText: ".matrix.csv で入力ごとに残すカテゴリ数 (0 で全件)"},
+		{Text: "サマリー", Widget: summaryCheck},
+		{Text: "スコア内訳", Widget: breakdownCheck},
+		{Text: "候補なし時", Widget: noCandSel},
+		{Text: "同点時の順序", Widget: tieBreakSel},
+		{Text: "類似度", Widget: metricSel, HintText: "cosine: コサイン / dot: 内積 (正規化済みのためセントロイド以外はコサインと同じ) / euclidean: 距離"},
+		{Text: "入力の文字コード", Widget: encodingSel},
+		{Text: "Excel シート", Widget: sheetEntry, HintText: ".xlsx を読み込むシート名 (空なら先頭)"},
 	}}
 
 	dialog.NewCustomConfirm("設定", "OK", "キャンセル", form, func(ok bool) {
@@ -626,6 +1200,9 @@ func (u *uiState) openSettings() {
 			return
 		}
 		newCfg := cfg
+		if v, err := strconv.Atoi(maxTopKSel.Selected); err == nil {
+			newCfg.MaxTopK = v
+		}
 		if v, err := strconv.Atoi(topkSel.Selected); err == nil {
 			newCfg.TopK = v
 		}
@@ -641,12 +1218,19 @@ func (u *uiState) openSettings() {
 		} else {
 			newCfg.UseNDC = ndcCheck.Checked
 		}
+		newCfg.SeededShowNDC = seededNDCCheck.Checked
 		if v, err := strconv.ParseFloat(weightEntry.Text, 32); err == nil {
 			newCfg.WeightNDC = float32(v)
 		}
 		if v, err := strconv.ParseFloat(seedBiasEntry.Text, 32); err == nil {
 			newCfg.SeedBias = float32(v)
 		}
+		if v, err := strconv.ParseFloat(minScoreEntry.Text, 32); err == nil {
+			newCfg.MinScore = float32(v)
+		}
+		if v, err := strconv.ParseFloat(substringEntry.Text, 32); err == nil {
+			newCfg.SubstringBoost = float32(v)
+		}
 		if v, err := strconv.ParseFloat(top1Entry.Text, 32); err == nil {
 			newCfg.Thresh.Top1 = float32(v)
 		}
@@ -660,6 +1244,76 @@ func (u *uiState) openSettings() {
 		if v, err := strconv.ParseFloat(clusterTauEntry.Text, 32); err == nil {
 			newCfg.ClusterCfg.Threshold = float32(v)
 		}
+		if clusterAlgoSel.Selected != "" {
+			newCfg.ClusterCfg.Algorithm = clusterAlgoSel.Selected
+		}
+		if linkageSel.Selected != "" {
+			newCfg.ClusterCfg.Linkage = linkageSel.Selected
+		}
+		newCfg.KeepEmptyRows = keepEmptyCheck.Checked
+		newCfg.DedupeInputs = dedupeCheck.Checked
+		if v, err := strconv.ParseFloat(dedupeEntry.Text, 32); err == nil {
+			newCfg.DedupeThreshold = float32(v)
+		}
+		newCfg.CollapseSpaces = collapseCheck.Checked
+		newCfg.StripHTML = stripHTMLCheck.Checked
+		newCfg.CaseFold = caseFoldCheck.Checked
+		newCfg.StripPunctuation = stripPunctCheck.Checked
+		newCfg.TrimLabelPunct = trimLabelCheck.Checked
+		newCfg.GuessCategoryColumn = guessCatColCheck.Checked
+		if v, err := strconv.Atoi(minCharsEntry.Text); err == nil {
+			newCfg.MinInputChars = v
+		}
+		newCfg.LengthNormalization = lengthNormCheck.Checked
+		newCfg.ReviewSingleFloor = singleFloorCheck.Checked
+		newCfg.LanguageRouting = langRoutingCheck.Checked
+		newCfg.WriteSummary = summaryCheck.Checked
+		newCfg.ScoreBreakdown = breakdownCheck.Checked
+		if v, err := strconv.Atoi(maxRuntimeEntry.Text); err == nil {
+			newCfg.MaxRuntime = time.Duration(v) * time.Second
+		}
+		for _, c := range delimChoices {
+			if c.Label == delimSel.Selected {
+				newCfg.OutputDelimiter = c.Value
+			}
+		}
+		if v, err := strconv.Atoi(strings.TrimSpace(matrixTopNEntry.Text)); err == nil {
+			newCfg.MatrixTopN = v
+		}
+		if tmpl := strings.TrimSpace(outputNameEntry.Text); tmpl != "" {
+			if err := validateOutputTemplate(tmpl); err != nil {
+				u.appendLog(fmt.Sprintf("出力ファイル名は変更しません: %v", err))
+			} else {
+				newCfg.OutputTemplate = tmpl
+			}
+		} else {
+			newCfg.OutputTemplate = defaultOutputTemplate
+		}
+		if cols, headers, err := parseOutputColumnSpec(outputColsEntry.Text); err != nil {
+			u.appendLog(fmt.Sprintf("出力列は変更しません: %v", err))
+		} else {
+			newCfg.OutputColumns, newCfg.OutputHeaders = cols, headers
+		}
+		for _, c := range noCandidateChoices {
+			if c.Label == noCandSel.Selected {
+				newCfg.NoCandidate = c.Value
+			}
+		}
+		for _, c := range mixedCombineChoices {
+			if c.Label == combineSel.Selected {
+				newCfg.MixedCombine = c.Value
+			}
+		}
+		if tieBreakSel.Selected != "" {
+			newCfg.TieBreak = tieBreakSel.Selected
+		}
+		if metricSel.Selected != "" {
+			newCfg.Metric = metricSel.Selected
+		}
+		if encodingSel.Selected != "" {
+			newCfg.InputEncoding = encodingSel.Selected
+		}
+		newCfg.Sheet = strings.TrimSpace(sheetEntry.Text)
 
 		newCfg = u.service.UpdateConfig(newCfg)
 		u.cfg = newCfg
@@ -675,67 +1329,303 @@ func (u *uiState) onLoadFile() {
 			return
 		}
 		defer rc.Close()
-		data, err := io.ReadAll(rc)
+		uri := rc.URI()
+		data, name, te, err := readInputDataEncoding(rc, uri.Path(), u.cfg.InputEncoding)
 		if err != nil {
 			dialog.ShowError(err, u.w)
 			return
 		}
-		uri := rc.URI()
-		ext := strings.ToLower(filepath.Ext(uri.Path()))
-		if ext == ".csv" || ext == ".tsv" {
-			delim := ','
-			if ext == ".tsv" {
-				delim = '\t'
-			}
-			records, err := readCSVRecords(data, delim)
+		if isTableFile(name) {
+			u.loadEncoding = te
+			records, delim, warnings, err := readTableRecordsWithWarnings(data, name, u.cfg.Sheet)
 			if err != nil {
 				dialog.ShowError(err, u.w)
 				return
 			}
-			u.handleCSVRecords(uri, records)
+			u.logParseWarnings(name, warnings)
+			u.loadWarnings = warnings
+			u.handleCSVRecords(uri, records, delim)
 			return
 		}
-		lines := splitNonEmptyLines(string(data))
+		lines := splitInputLines(string(data), u.cfg.KeepEmptyRows)
 		u.applyLoadedLines(uri, lines)
 	}, u.w)
-	fd.SetFilter(storage.NewExtensionFileFilter([]string{".txt", ".csv", ".tsv"}))
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".txt", ".csv", ".tsv", ".xlsx", ".gz"}))
 	fd.Show()
 }
 
 func (u *uiState) applyLoadedLines(uri fyne.URI, lines []string) {
+	if u.cfg.CollapseSpaces {
+		for i, line := range lines {
+			lines[i] = collapseSpaces(line)
+		}
+	}
+	u.setAssigned(nil)
+	u.source = nil
+	u.inputName = filepath.Base(uri.Path())
 	u.input.SetText(strings.Join(lines, "\n"))
 	u.appendLog(fmt.Sprintf("ファイル読込: %s (%d件)", filepath.Base(uri.Path()), len(lines)))
 }
 
+// logParseWarnings reports CSV records skipped while loading name.
+func (u *uiState) logParseWarnings(name string, warnings []ParseWarning) {
+	if len(warnings) == 0 {
+		return
+	}
+	u.appendLog(fmt.Sprintf("%s: %s", filepath.Base(name), formatParseWarnings(warnings)))
+}
+
 func (u *uiState) onLoadCategories() {
 	fd := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
 		if err != nil || rc == nil {
 			return
 		}
 		defer rc.Close()
-		data, err := io.ReadAll(rc)
+		data, name, err := readInputData(rc, rc.URI().Path(), categorySource(u.cfg).encoding)
 		if err != nil {
 			dialog.ShowError(err, u.w)
 			return
 		}
-		labels := parseCategoryText(string(data))
-		if len(labels) == 0 {
-			dialog.ShowInformation("情報", "カテゴリが検出できませんでした", u.w)
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext == ".yaml" || ext == ".yml" {
+			specs, err := parseCategoryYAML(data)
+			if err != nil {
+				dialog.ShowError(err, u.w)
+				return
+			}
+			u.applyCategorySpecs(specs, nil)
+			return
+		}
+		if isTableFile(name) {
+			records, _, warnings, err := readTableRecordsWithWarnings(data, name, categorySource(u.cfg).sheet)
+			if err != nil {
+				dialog.ShowError(err, u.w)
+				return
+			}
+			u.logParseWarnings(name, warnings)
+			u.handleCategoryRecords(records)
 			return
 		}
-		count, err := u.service.UpdateCategories(context.Background(), labels)
+		u.applyCategories(unweightedSeeds(parseCategoryText(string(data))), nil)
+	}, u.w)
+	fd.SetFilter(storage.NewExtensionFileFilter([]string{".txt", ".csv", ".tsv", ".xlsx", ".yaml", ".yml", ".gz"}))
+	fd.Show()
+}
+
+// handleCategoryRecords はカテゴリ CSV の列を選ばせ、選択列の値をまとめて1つのカテゴリ集合にする。
+func (u *uiState) handleCategoryRecords(records [][]string) {
+	hasHeader := detectHeaderColumn(records[0], categoryHeaderNames) >= 0
+	choices := buildCSVColumnChoices(records, hasHeader)
+	if len(choices) <= 1 {
+		u.applyCategories(collectCategoryColumns(records, []int{0}, -1, hasHeader), categoryRecordThresholds(records, []int{0}, hasHeader, false))
+		return
+	}
+	options := make([]string, len(choices))
+	var preselected []string
+	for i, c := range choices {
+		options[i] = c.Label
+		if hasHeader && c.Index < len(records[0]) && headerMatches(records[0][c.Index], categoryHeaderNames) {
+			preselected = append(preselected, c.Label)
+		}
+	}
+	if len(preselected) == 0 && u.cfg.GuessCategoryColumn {
+		if idx := guessCategoryColumn(records, hasHeader); idx >= 0 {
+			for i, c := range choices {
+				if c.Index == idx {
+					preselected = []string{options[i]}
+					u.appendLog(fmt.Sprintf("カテゴリ列を推定しました: %s", options[i]))
+				}
+			}
+		}
+	}
+	if len(preselected) == 0 {
+		preselected = []string{options[0]}
+	}
+	group := widget.NewCheckGroup(options, nil)
+	group.SetSelected(preselected)
+
+	weightCol := -1
+	weightOptions := append([]string{"（なし）"}, options...)
+	weightSelect := widget.NewSelect(weightOptions, func(value string) {
+		weightCol = -1
+		for i, opt := range options {
+			if opt == value {
+				weightCol = choices[i].Index
+				return
+			}
+		}
+	})
+	weightSelect.SetSelected(weightOptions[0])
+	if hasHeader {
+		if idx := detectHeaderColumn(records[0], weightHeaderNames); idx >= 0 {
+			for i, c := range choices {
+				if c.Index == idx {
+					weightSelect.SetSelected(options[i])
+				}
+			}
+		}
+	}
+
+	aliasCheck := widget.NewCheck("選択した先頭の列を正式名、残りの列を別名として読む", nil)
+
+	profileSelect := widget.NewSelect(categoryProfileNames(u.cfg.CategoryProfiles), func(name string) {
+		p, ok := u.cfg.CategoryProfiles[name]
+		if !ok {
+			return
+		}
+		cols, byName, err := resolveProfileColumns(records[0], p.Columns)
+		if err != nil {
+			u.appendLog(fmt.Sprintf("プロファイル %s を適用できません: %v", name, err))
+			return
+		}
+		if byName {
+			hasHeader = true
+		}
+		group.SetSelected(optionsForColumns(choices, cols))
+		aliasCheck.SetChecked(p.Aliases)
+		weightSelect.SetSelected(weightOptions[0])
+		if p.WeightColumn != "" {
+			if idx, _, err := resolveEvalColumn(records[0], p.WeightColumn, -1); err == nil {
+				if opts := optionsForColumns(choices, []int{idx}); len(opts) > 0 {
+					weightSelect.SetSelected(opts[0])
+				}
+			}
+		}
+	})
+	profileSelect.PlaceHolder = "保存したプロファイルを適用"
+	if len(u.cfg.CategoryProfiles) == 0 {
+		profileSelect.Disable()
+	}
+	saveCheck := widget.NewCheck("プロファイルとして保存", nil)
+	profileName := widget.NewEntry()
+	profileName.SetPlaceHolder("プロファイル名")
+
+	info := widget.NewLabel("カテゴリとして読み込む列を選択してください（複数選択可）")
+	weightInfo := widget.NewLabel("重み列（任意・既定 1.0）")
+	content := container.NewVBox(profileSelect, info, group, aliasCheck, weightInfo, weightSelect, saveCheck, profileName)
+	dialog.NewCustomConfirm("カテゴリ列の選択", "読み込む", "キャンセル", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		var cols []int
+		for i, opt := range options {
+			for _, sel := range group.Selected {
+				if sel == opt {
+					cols = append(cols, choices[i].Index)
+					break
+				}
+			}
+		}
+		if len(cols) == 0 {
+			dialog.ShowInformation("情報", "列が選択されていません", u.w)
+			return
+		}
+		if name := strings.TrimSpace(profileName.Text); saveCheck.Checked && name != "" {
+			p := CategoryProfile{Columns: columnSpecs(records[0], hasHeader, cols), Aliases: aliasCheck.Checked}
+			if weightCol >= 0 {
+				p.WeightColumn = columnSpec(records[0], hasHeader, weightCol)
+			}
+			u.saveProfiles(name, func(cfg *Config) { cfg.CategoryProfiles[name] = p })
+		}
+		thresholds := categoryRecordThresholds(records, cols, hasHeader, aliasCheck.Checked)
+		if aliasCheck.Checked {
+			u.applyCategorySpecs(collectCategoryAliases(records, cols, weightCol, hasHeader), thresholds)
+			return
+		}
+		u.applyCategories(collectCategoryColumns(records, cols, weightCol, hasHeader), thresholds)
+	}, u.w).Show()
+}
+
+// saveProfiles は列プロファイルを追加・更新して ProfileFile に保存する。
+func (u *uiState) saveProfiles(name string, update func(cfg *Config)) {
+	newCfg := u.cfg
+	newCfg.InputProfiles = make(map[string]InputProfile, len(u.cfg.InputProfiles)+1)
+	for k, v := range u.cfg.InputProfiles {
+		newCfg.InputProfiles[k] = v
+	}
+	newCfg.CategoryProfiles = make(map[string]CategoryProfile, len(u.cfg.CategoryProfiles)+1)
+	for k, v := range u.cfg.CategoryProfiles {
+		newCfg.CategoryProfiles[k] = v
+	}
+	update(&newCfg)
+	u.cfg = u.service.UpdateConfig(newCfg)
+	if err := saveColumnProfiles(u.cfg); err != nil {
+		u.appendLog(fmt.Sprintf("プロファイルを保存できませんでした: %v", err))
+		return
+	}
+	u.appendLog(fmt.Sprintf("列プロファイル %s を保存しました", name))
+}
+
+// onEditCategories は現在のカテゴリに追加・削除だけを行う。
+// 既存カテゴリは埋め込み直さないので、カテゴリ数が多くてもすぐ反映される。
+func (u *uiState) onEditCategories() {
+	addEntry := widget.NewMultiLineEntry()
+	addEntry.SetPlaceHolder("追加するカテゴリ (1行1件)")
+	removeEntry := widget.NewMultiLineEntry()
+	removeEntry.SetPlaceHolder("削除するカテゴリ (1行1件)")
+	catCount, _ := u.service.CandidateStats()
+	content := container.NewVBox(
+		widget.NewLabel(fmt.Sprintf("現在のカテゴリ: %d件", catCount)),
+		widget.NewLabel("追加"), addEntry,
+		widget.NewLabel("削除"), removeEntry,
+	)
+	dialog.NewCustomConfirm("カテゴリ編集", "反映", "キャンセル", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		removed := u.service.RemoveSeeds(parseCategoryText(removeEntry.Text))
+		added, err := u.service.AddSeeds(context.Background(), parseCategoryText(addEntry.Text))
 		if err != nil {
 			dialog.ShowError(err, u.w)
+		}
+		if added == 0 && removed == 0 {
 			return
 		}
 		u.updateConfigSummary()
-		u.appendLog(fmt.Sprintf("カテゴリを更新 (%d件)", count))
-	}, u.w)
-	fd.SetFilter(storage.NewExtensionFileFilter([]string{".txt", ".csv"}))
-	fd.Show()
+		u.appendLog(fmt.Sprintf("カテゴリを編集しました (追加 %d件 / 削除 %d件)", added, removed))
+		if added > 0 {
+			u.warnAmbiguousCategories()
+		}
+	}, u.w).Show()
 }
 
-func (u *uiState) handleCSVRecords(uri fyne.URI, records [][]string) {
+func (u *uiState) applyCategories(seeds []WeightedSeed, thresholds map[string]float32) {
+	specs := make([]CategorySpec, len(seeds))
+	for i, sd := range seeds {
+		specs[i] = CategorySpec{Label: sd.Label, Weight: sd.Weight}
+	}
+	u.applyCategorySpecs(specs, thresholds)
+}
+
+// applyCategorySpecs replaces the categories with specs and
+// CategoryThresholds with the thresholds read from the same file, so the
+// floors of a previously loaded file do not linger.
+func (u *uiState) applyCategorySpecs(specs []CategorySpec, thresholds map[string]float32) {
+	if len(specs) == 0 {
+		dialog.ShowInformation("情報", "カテゴリが検出できませんでした", u.w)
+		return
+	}
+	count, err := u.service.LoadCategorySpecs(context.Background(), specs)
+	if err != nil {
+		dialog.ShowError(err, u.w)
+		return
+	}
+	if len(thresholds) > 0 || len(u.cfg.CategoryThresholds) > 0 {
+		newCfg := u.cfg
+		newCfg.CategoryThresholds = thresholds
+		u.cfg = u.service.UpdateConfig(newCfg)
+		if len(thresholds) > 0 {
+			u.appendLog(fmt.Sprintf("カテゴリ別の閾値を %d件読み込みました", len(thresholds)))
+		} else {
+			u.appendLog("カテゴリ別の閾値を解除しました (読み込んだファイルに閾値列がありません)")
+		}
+	}
+	u.updateConfigSummary()
+	u.appendLog(fmt.Sprintf("カテゴリを更新 (%d件)", count))
+	u.warnAmbiguousCategories()
+}
+
+func (u *uiState) handleCSVRecords(uri fyne.URI, records [][]string, delim rune) {
 	maxCols := 0
 	for _, row := range records {
 		if len(row) > maxCols {
@@ -757,8 +1647,10 @@ func (u *uiState) handleCSVRecords(uri fyne.URI, records [][]string) {
 		defaultCol = 0
 	}
 	if maxCols == 1 {
-		lines := extractCSVColumn(records, defaultCol, hasHeader)
+		cols := []int{defaultCol}
+		lines := extractCSVColumns(records, cols, hasHeader, u.cfg.KeepEmptyRows)
 		u.applyLoadedLines(uri, lines)
+		u.setSource(uri, records, hasHeader, delim, cols, lines)
 		return
 	}
 	choices := buildCSVColumnChoices(records, hasHeader)
@@ -777,27 +1669,133 @@ func (u *uiState) handleCSVRecords(uri fyne.URI, records [][]string) {
 	for i, c := range choices {
 		options[i] = c.Label
 	}
-	selectedCol := choices[defaultChoice].Index
-	selectWidget := widget.NewSelect(options, func(value string) {
+	// 複数選択した列は元の列順に空白区切りで連結して1件の本文にする
+	textGroup := widget.NewCheckGroup(options, nil)
+	textGroup.SetSelected([]string{options[defaultChoice]})
+	selectedCols := func() []int {
+		var cols []int
+		for i, opt := range options {
+			for _, sel := range textGroup.Selected {
+				if sel == opt {
+					cols = append(cols, choices[i].Index)
+					break
+				}
+			}
+		}
+		return cols
+	}
+
+	assignedCol := -1
+	assignedOptions := append([]string{"（なし）"}, options...)
+	assignedSelect := widget.NewSelect(assignedOptions, func(value string) {
+		assignedCol = -1
 		for i, opt := range options {
 			if opt == value {
-				selectedCol = choices[i].Index
+				assignedCol = choices[i].Index
 				return
 			}
 		}
 	})
-	selectWidget.SetSelected(options[defaultChoice])
-	info := widget.NewLabel("読み込む列を選択してください")
-	content := container.NewVBox(info, selectWidget)
+	assignedSelect.SetSelected(assignedOptions[0])
+
+	profileSelect := widget.NewSelect(inputProfileNames(u.cfg.InputProfiles), func(name string) {
+		p, ok := u.cfg.InputProfiles[name]
+		if !ok {
+			return
+		}
+		cols, byName, err := resolveProfileColumns(records[0], p.TextColumns)
+		if err != nil {
+			u.appendLog(fmt.Sprintf("プロファイル %s を適用できません: %v", name, err))
+			return
+		}
+		if byName {
+			hasHeader = true
+		}
+		textGroup.SetSelected(optionsForColumns(choices, cols))
+		assignedSelect.SetSelected(assignedOptions[0])
+		if p.AssignedColumn != "" {
+			if idx, _, err := resolveEvalColumn(records[0], p.AssignedColumn, -1); err == nil {
+				if opts := optionsForColumns(choices, []int{idx}); len(opts) > 0 {
+					assignedSelect.SetSelected(opts[0])
+				}
+			}
+		}
+	})
+	profileSelect.PlaceHolder = "保存したプロファイルを適用"
+	if len(u.cfg.InputProfiles) == 0 {
+		profileSelect.Disable()
+	}
+	saveCheck := widget.NewCheck("プロファイルとして保存", nil)
+	profileName := widget.NewEntry()
+	profileName.SetPlaceHolder("プロファイル名")
+
+	info := widget.NewLabel("読み込む列を選択してください（複数選択時は連結）")
+	assignedInfo := widget.NewLabel("既存カテゴリ列（検証用・任意）")
+	content := container.NewVBox(profileSelect, info, textGroup, assignedInfo, assignedSelect, saveCheck, profileName)
 	dialog.NewCustomConfirm("列の選択", "読み込む", "キャンセル", content, func(ok bool) {
 		if !ok {
 			return
 		}
-		lines := extractCSVColumn(records, selectedCol, hasHeader)
+		cols := selectedCols()
+		if len(cols) == 0 {
+			dialog.ShowInformation("情報", "列が選択されていません", u.w)
+			return
+		}
+		if name := strings.TrimSpace(profileName.Text); saveCheck.Checked && name != "" {
+			p := InputProfile{TextColumns: columnSpecs(records[0], hasHeader, cols)}
+			if assignedCol >= 0 {
+				p.AssignedColumn = columnSpec(records[0], hasHeader, assignedCol)
+			}
+			u.saveProfiles(name, func(cfg *Config) { cfg.InputProfiles[name] = p })
+		}
+		lines := extractCSVColumns(records, cols, hasHeader, u.cfg.KeepEmptyRows)
 		u.applyLoadedLines(uri, lines)
+		u.setSource(uri, records, hasHeader, delim, cols, lines)
+		if assignedCol >= 0 {
+			u.setAssigned(extractAlignedColumn(records, cols, assignedCol, hasHeader, u.cfg.KeepEmptyRows))
+		}
 	}, u.w).Show()
 }
 
+// setSource remembers records as the origin of the input just shown. lines
+// are the texts applyLoadedLines put in the input box, one per kept record.
+func (u *uiState) setSource(uri fyne.URI, records [][]string, hasHeader bool, delim rune, textCols []int, lines []string) {
+	u.inputName = filepath.Base(uri.Path())
+	u.source = &csvSource{
+		name:      filepath.Base(uri.Path()),
+		records:   records,
+		hasHeader: hasHeader,
+		delim:     delim,
+		rowIndex:  keptRowIndices(records, textCols, hasHeader, u.cfg.KeepEmptyRows),
+		entries:   lines,
+		inputText: u.input.Text,
+		encoding:  u.loadEncoding,
+		skipped:   u.loadWarnings,
+	}
+}
+
+func (u *uiState) setAssigned(labels []string) {
+	if len(u.assigned) == 0 && len(labels) == 0 {
+		return
+	}
+	u.assigned = labels
+	u.rebuildTableColumns(u.cfg)
+}
+
+func formatAssigned(r ResultRow) string {
+	if r.Assigned == "" {
+		return ""
+	}
+	mark := "一致"
+	if r.AssignedMismatch {
+		mark = "不一致"
+	}
+	if r.AssignedRank == 0 {
+		return fmt.Sprintf("%s\n%s (候補外)", r.Assigned, mark)
+	}
+	return fmt.Sprintf("%s\n%s %d位 %.3f", r.Assigned, mark, r.AssignedRank, r.AssignedScore)
+}
+
 func wrappedHeightFor(text string, colWidth float32) float32 {
 	lbl := widget.NewLabel(text)
 	lbl.Wrapping = fyne.TextWrapWord
@@ -0,0 +1,362 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// VectorIndex finds the candidates closest to a query vector. Service
+// searches the NDC candidates through it (Config.NDCIndex): InMemoryIndex
+// compares every candidate, HNSWIndex answers approximately from a graph and
+// ExternalIndex asks a vector database over HTTP. Replace must not run
+// concurrently with Search; Service builds a new index instead of replacing
+// the one in use.
+type VectorIndex interface {
+	// Replace makes cands the searchable set.
+	Replace(cands []Candidate) error
+	// Search returns up to k candidates by descending similarity to q, equal
+	// scores ordered by label.
+	Search(ctx context.Context, q []float32, k int) ([]IndexHit, error)
+	// Size is the number of searchable candidates, or -1 when the index does
+	// not know it (ExternalIndex).
+	Size() int
+}
+
+// IndexHit is one search result. Score is the raw similarity under the
+// index's metric, before any weight.
+type IndexHit struct {
+	Cand  Candidate
+	Score float32
+	Pos   int // Replace に渡した cands 上の位置。ExternalIndex では -1
+}
+
+// sortHits orders hits by descending score, then label.
+func sortHits(hits []IndexHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Cand.Label < hits[j].Cand.Label
+	})
+}
+
+// InMemoryIndex is the exact index: every search scores all candidates.
+type InMemoryIndex struct {
+	sim   similarityFunc
+	cands []Candidate
+}
+
+// NewInMemoryIndex returns an empty exact index for Config.Metric metric.
+func NewInMemoryIndex(metric string) *InMemoryIndex {
+	return &InMemoryIndex{sim: metricFunc(metric)}
+}
+
+func (x *InMemoryIndex) Replace(cands []Candidate) error {
+	x.cands = cands
+	return nil
+}
+
+func (x *InMemoryIndex) Search(_ context.Context, q []float32, k int) ([]IndexHit, error) {
+	qNorm := vecNorm(q)
+	hits := make([]IndexHit, len(x.cands))
+	for i, c := range x.cands {
+		hits[i] = IndexHit{Cand: c, Score: candidateSimilarity(x.sim, q, qNorm, c), Pos: i}
+	}
+	sortHits(hits)
+	if k >= 0 && k < len(hits) {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+func (x *InMemoryIndex) Size() int { return len(x.cands) }
+
+// HNSW の構築パラメータ。M は各層で張る近傍数、efConstruction は構築時に辿る候補数。
+const (
+	hnswM               = 16
+	hnswEfConstruction  = 100
+	defaultHNSWEfSearch = 64
+)
+
+// HNSWIndex is a Hierarchical Navigable Small World graph over the
+// candidates' main vectors (aliases are not indexed). Search visits about
+// EfSearch nodes instead of all of them, so a 50k-entry NDC list is
+// searched in far fewer comparisons at the cost of occasionally missing a
+// close candidate. The graph is built with a fixed seed, so the same
+// candidates always give the same results.
+type HNSWIndex struct {
+	EfSearch int
+
+	sim      similarityFunc
+	nodes    []hnswNode
+	entry    int
+	maxLevel int
+}
+
+type hnswNode struct {
+	cand  Candidate
+	links [][]int // 層ごとの近傍 (nodes 上の位置)
+}
+
+// NewHNSWIndex returns an empty approximate index for Config.Metric metric.
+func NewHNSWIndex(metric string, efSearch int) *HNSWIndex {
+	if efSearch <= 0 {
+		efSearch = defaultHNSWEfSearch
+	}
+	return &HNSWIndex{EfSearch: efSearch, sim: metricFunc(metric)}
+}
+
+func (x *HNSWIndex) Size() int { return len(x.nodes) }
+
+func (x *HNSWIndex) Replace(cands []Candidate) error {
+	x.nodes = make([]hnswNode, 0, len(cands))
+	x.entry, x.maxLevel = -1, -1
+	rng := rand.New(rand.NewSource(1))
+	levelMult := 1 / math.Log(hnswM)
+	for _, c := range cands {
+		level := int(-math.Log(1-rng.Float64()) * levelMult)
+		x.insert(c, level)
+	}
+	return nil
+}
+
+func (x *HNSWIndex) similarity(q []float32, qNorm float32, i int) float32 {
+	c := x.nodes[i].cand
+	return x.sim(q, qNorm, c.Vec, c.Norm)
+}
+
+func (x *HNSWIndex) insert(c Candidate, level int) {
+	id := len(x.nodes)
+	x.nodes = append(x.nodes, hnswNode{cand: c, links: make([][]int, level+1)})
+	if x.entry < 0 {
+		x.entry, x.maxLevel = id, level
+		return
+	}
+	qNorm := c.Norm
+	if qNorm == 0 {
+		qNorm = vecNorm(c.Vec)
+	}
+	ep := x.entry
+	for l := x.maxLevel; l > level; l-- {
+		ep = x.greedy(c.Vec, qNorm, ep, l)
+	}
+	for l := min(level, x.maxLevel); l >= 0; l-- {
+		found := x.searchLayer(c.Vec, qNorm, ep, hnswEfConstruction, l)
+		limit := hnswM
+		if l == 0 {
+			limit = 2 * hnswM
+		}
+		neighbors := make([]int, 0, limit)
+		for _, h := range found {
+			if len(neighbors) == limit {
+				break
+			}
+			neighbors = append(neighbors, h.id)
+		}
+		x.nodes[id].links[l] = neighbors
+		for _, n := range neighbors {
+			x.nodes[n].links[l] = append(x.nodes[n].links[l], id)
+			if len(x.nodes[n].links[l]) > limit {
+				x.prune(n, l, limit)
+			}
+		}
+		ep = found[0].id
+	}
+	if level > x.maxLevel {
+		x.entry, x.maxLevel = id, level
+	}
+}
+
+// prune keeps the limit links of node n on layer l closest to n.
+func (x *HNSWIndex) prune(n, l, limit int) {
+	base := x.nodes[n].cand
+	baseNorm := base.Norm
+	if baseNorm == 0 {
+		baseNorm = vecNorm(base.Vec)
+	}
+	links := x.nodes[n].links[l]
+	scored := make([]hnswScored, len(links))
+	for i, id := range links {
+		scored[i] = hnswScored{id: id, score: x.similarity(base.Vec, baseNorm, id)}
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	for i := 0; i < limit; i++ {
+		links[i] = scored[i].id
+	}
+	x.nodes[n].links[l] = links[:limit]
+}
+
+type hnswScored struct {
+	id    int
+	score float32
+}
+
+// greedy walks layer l from ep to the node closest to q.
+func (x *HNSWIndex) greedy(q []float32, qNorm float32, ep, l int) int {
+	best := x.similarity(q, qNorm, ep)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range x.nodes[ep].links[l] {
+			if sc := x.similarity(q, qNorm, n); sc > best {
+				best, ep, changed = sc, n, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer is the HNSW beam search on layer l: it returns up to ef nodes
+// closest to q, best first.
+func (x *HNSWIndex) searchLayer(q []float32, qNorm float32, ep, ef, l int) []hnswScored {
+	visited := map[int]bool{ep: true}
+	start := hnswScored{id: ep, score: x.similarity(q, qNorm, ep)}
+	frontier := []hnswScored{start} // 未展開の候補 (スコアの高い順)
+	results := []hnswScored{start}  // 見つけた上位 ef 件 (スコアの高い順)
+	for len(frontier) > 0 {
+		cur := frontier[0]
+		frontier = frontier[1:]
+		if len(results) >= ef && cur.score < results[len(results)-1].score {
+			break
+		}
+		for _, n := range x.nodes[cur.id].links[l] {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+			h := hnswScored{id: n, score: x.similarity(q, qNorm, n)}
+			if len(results) >= ef && h.score <= results[len(results)-1].score {
+				continue
+			}
+			results = insertScored(results, h)
+			if len(results) > ef {
+				results = results[:ef]
+			}
+			frontier = insertScored(frontier, h)
+		}
+	}
+	return results
+}
+
+// insertScored inserts h into list, which is sorted by descending score.
+func insertScored(list []hnswScored, h hnswScored) []hnswScored {
+	i := sort.Search(len(list), func(i int) bool { return list[i].score < h.score })
+	list = append(list, hnswScored{})
+	copy(list[i+1:], list[i:])
+	list[i] = h
+	return list
+}
+
+func (x *HNSWIndex) Search(_ context.Context, q []float32, k int) ([]IndexHit, error) {
+	if x.entry < 0 || k == 0 {
+		return nil, nil
+	}
+	if k < 0 || k > len(x.nodes) {
+		k = len(x.nodes)
+	}
+	qNorm := vecNorm(q)
+	ep := x.entry
+	for l := x.maxLevel; l > 0; l-- {
+		ep = x.greedy(q, qNorm, ep, l)
+	}
+	found := x.searchLayer(q, qNorm, ep, max(x.EfSearch, k), 0)
+	hits := make([]IndexHit, len(found))
+	for i, h := range found {
+		hits[i] = IndexHit{Cand: x.nodes[h.id].cand, Score: h.score, Pos: h.id}
+	}
+	sortHits(hits)
+	if k < len(hits) {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// externalIndexTimeout は外部インデックスへの1回の問い合わせの上限時間。
+const externalIndexTimeout = 10 * time.Second
+
+// ExternalIndex searches a vector database behind an HTTP endpoint, so the
+// candidate vectors never have to be held in memory. The store is filled
+// separately (e.g. from the output of -dump-index-vectors); Replace is not
+// supported. The query contract is:
+//
+//	POST <URL>  {"vector": [0.12, ...], "k": 20}
+//	200 OK      {"results": [{"label": "913 小説", "score": 0.83}, ...]}
+//
+// label is the candidate label as shown to the user and score the raw
+// similarity (higher is closer). Results are re-sorted, so the server may
+// return them in any order.
+type ExternalIndex struct {
+	URL    string
+	Source string // 結果の Candidate.Source ("ndc")
+	Client *http.Client
+}
+
+// NewExternalIndex returns an index that queries url for candidates of
+// source.
+func NewExternalIndex(url, source string) *ExternalIndex {
+	return &ExternalIndex{URL: url, Source: source, Client: &http.Client{Timeout: externalIndexTimeout}}
+}
+
+var errExternalReplace = errors.New("外部インデックスの内容は外部で管理します (Replace できません)")
+
+func (x *ExternalIndex) Replace([]Candidate) error { return errExternalReplace }
+
+func (x *ExternalIndex) Size() int { return -1 }
+
+type externalQuery struct {
+	Vector []float32 `json:"vector"`
+	K      int       `json:"k"`
+}
+
+type externalResponse struct {
+	Results []struct {
+		Label string  `json:"label"`
+		Score float32 `json:"score"`
+	} `json:"results"`
+}
+
+func (x *ExternalIndex) Search(ctx context.Context, q []float32, k int) ([]IndexHit, error) {
+	body, err := json.Marshal(externalQuery{Vector: q, K: k})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := x.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("外部インデックスに問い合わせできません: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("外部インデックスがエラーを返しました (%s): %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var res externalResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("外部インデックスの応答を読めません: %w", err)
+	}
+	hits := make([]IndexHit, 0, len(res.Results))
+	for _, r := range res.Results {
+		label := normalize(r.Label)
+		if label == "" {
+			continue
+		}
+		hits = append(hits, IndexHit{Cand: Candidate{Label: label, Key: normalizeKey(label), Source: x.Source}, Score: r.Score, Pos: -1})
+	}
+	sortHits(hits)
+	if k >= 0 && k < len(hits) {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
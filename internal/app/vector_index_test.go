@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func randomCandidates(rng *rand.Rand, n, dim int) []Candidate {
+	cands := make([]Candidate, n)
+	for i := range cands {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		label := fmt.Sprintf("c%05d", i)
+		cands[i] = Candidate{Label: label, Key: label, Vec: v, Norm: vecNorm(v), Source: "ndc"}
+	}
+	return cands
+}
+
+func TestHNSWIndexRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	cands := randomCandidates(rng, 3000, 32)
+	queries := randomCandidates(rng, 100, 32)
+	const k = 10
+	tests := []struct {
+		metric    string
+		efSearch  int
+		minRecall float64
+	}{
+		{MetricCosine, 64, 0.9},
+		{MetricCosine, 200, 0.97},
+		{MetricDot, 64, 0.85},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/ef%d", tt.metric, tt.efSearch), func(t *testing.T) {
+			exact := NewInMemoryIndex(tt.metric)
+			approx := NewHNSWIndex(tt.metric, tt.efSearch)
+			if err := exact.Replace(cands); err != nil {
+				t.Fatal(err)
+			}
+			if err := approx.Replace(cands); err != nil {
+				t.Fatal(err)
+			}
+			if approx.Size() != len(cands) {
+				t.Fatalf("Size = %d, want %d", approx.Size(), len(cands))
+			}
+			found := 0
+			for _, q := range queries {
+				want, _ := exact.Search(context.Background(), q.Vec, k)
+				got, err := approx.Search(context.Background(), q.Vec, k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != k {
+					t.Fatalf("got %d hits, want %d", len(got), k)
+				}
+				for i := 1; i < len(got); i++ {
+					if got[i-1].Score < got[i].Score {
+						t.Fatalf("hits not ordered by score: %v", got)
+					}
+				}
+				inExact := make(map[string]bool, k)
+				for _, h := range want {
+					inExact[h.Cand.Label] = true
+				}
+				for _, h := range got {
+					if inExact[h.Cand.Label] {
+						found++
+					}
+				}
+			}
+			recall := float64(found) / float64(k*len(queries))
+			if recall < tt.minRecall {
+				t.Errorf("recall = %.3f, want >= %.2f", recall, tt.minRecall)
+			}
+		})
+	}
+}
+
+func TestInMemoryIndexTiesByLabel(t *testing.T) {
+	v := []float32{1, 0}
+	cands := []Candidate{{Label: "b", Vec: v}, {Label: "a", Vec: v}, {Label: "c", Vec: []float32{0, 1}}}
+	idx := NewInMemoryIndex(MetricCosine)
+	_ = idx.Replace(cands)
+	hits, _ := idx.Search(context.Background(), v, 2)
+	got := []string{hits[0].Cand.Label, hits[1].Cand.Label}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("labels = %v, want %v", got, want)
+	}
+	if hits[0].Pos != 1 || hits[1].Pos != 0 {
+		t.Errorf("Pos = %d,%d, want 1,0", hits[0].Pos, hits[1].Pos)
+	}
+}
+
+func TestExternalIndex(t *testing.T) {
+	var got externalQuery
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got.K == 0 {
+			http.Error(w, "k is required", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"results":[{"label":"290 地理","score":0.4},{"label":"913 小説","score":0.8},{"label":" ","score":0.9}]}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		k       int
+		want    []string
+		wantErr bool
+	}{
+		{"sorted and blank labels dropped", 5, []string{"913 小説", "290 地理"}, false},
+		{"truncated to k", 1, []string{"913 小説"}, false},
+		{"server error", 0, nil, true},
+	}
+	idx := NewExternalIndex(srv.URL, "ndc")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := idx.Search(context.Background(), []float32{0.5, 0.5}, tt.k)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var labels []string
+			for _, h := range hits {
+				labels = append(labels, h.Cand.Label)
+				if h.Cand.Source != "ndc" || h.Pos != -1 {
+					t.Errorf("hit %+v: want Source ndc and Pos -1", h)
+				}
+			}
+			if !reflect.DeepEqual(labels, tt.want) {
+				t.Errorf("labels = %q, want %q", labels, tt.want)
+			}
+		})
+	}
+	if !reflect.DeepEqual(got.Vector, []float32{0.5, 0.5}) {
+		t.Errorf("query vector = %v", got.Vector)
+	}
+	if err := idx.Replace(nil); err == nil {
+		t.Error("Replace should fail for an external index")
+	}
+}
+
+func TestNDCIndexMatchesExactTopK(t *testing.T) {
+	inputs := []string{"新鮮な野菜サラダ", "週末のスポーツ観戦", "北海道への旅行記"}
+	exact := newTestService(t, func(c *Config) { c.Mode = ModeSplit })
+	approx := newTestService(t, func(c *Config) {
+		c.Mode = ModeSplit
+		c.NDCIndex = NDCIndexHNSW
+	})
+	want, err := exact.ClassifyAll(context.Background(), inputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := approx.ClassifyAll(context.Background(), inputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		if !reflect.DeepEqual(got[i].NDCSuggestions, want[i].NDCSuggestions) {
+			t.Errorf("%s: hnsw %v, exact %v", inputs[i], got[i].NDCSuggestions, want[i].NDCSuggestions)
+		}
+	}
+}
+
+func TestServiceExternalNDCIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"results":[{"label":"290 地理","score":0.4},{"label":"913 小説","score":0.8}]}`)
+	}))
+	defer srv.Close()
+	svc := newTestService(t, func(c *Config) {
+		c.Mode = ModeSplit
+		c.NDCIndex = NDCIndexExternal
+		c.ExternalIndexURL = srv.URL
+	})
+	rows, err := svc.ClassifyAll(context.Background(), []string{"北海道への旅行記"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var labels []string
+	for _, s := range rows[0].NDCSuggestions {
+		labels = append(labels, s.Label)
+	}
+	if want := []string{"913 小説", "290 地理"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("NDC labels = %q, want %q", labels, want)
+	}
+}
+
+// BenchmarkIndexSearch measures one query against the NDC indexes. The
+// "no-norm" case clears the stored norms so every comparison recomputes
+// them, which is what precomputing Candidate.Norm saves.
+func BenchmarkIndexSearch(b *testing.B) {
+	const dim = 256
+	for _, n := range []int{1000, 10000} {
+		rng := rand.New(rand.NewSource(1))
+		cands := randomCandidates(rng, n, dim)
+		queries := randomCandidates(rng, 64, dim)
+		noNorm := make([]Candidate, len(cands))
+		for i, c := range cands {
+			c.Norm = 0
+			noNorm[i] = c
+		}
+		indexes := []struct {
+			name  string
+			idx   VectorIndex
+			cands []Candidate
+		}{
+			{"memory", NewInMemoryIndex(MetricCosine), cands},
+			{"memory-no-norm", NewInMemoryIndex(MetricCosine), noNorm},
+			{"hnsw", NewHNSWIndex(MetricCosine, defaultHNSWEfSearch), cands},
+		}
+		for _, ix := range indexes {
+			if err := ix.idx.Replace(ix.cands); err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/n=%d", ix.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := ix.idx.Search(context.Background(), queries[i%len(queries)].Vec, 10); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
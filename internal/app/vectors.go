@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EmbedAndExport embeds texts (normalized like classification, so the
+// vectors come from and stay in the same cache) and writes them to path in
+// input order, one row per text, for clustering or t-SNE outside the tool.
+// A ".npy" path gets a float32 matrix of shape (len(texts), dim); any other
+// path gets CSV (TSV for ".tsv") with index, text and d0..d<dim-1> columns.
+// Empty inputs are written as zero vectors so rows still line up.
+func (s *Service) EmbedAndExport(ctx context.Context, texts []string, path string) error {
+	prepared := make([]string, len(texts))
+	nonEmpty := make([]string, 0, len(texts))
+	for i, t := range texts {
+		prepared[i] = s.prepareText(t)
+		if prepared[i] != "" {
+			nonEmpty = append(nonEmpty, prepared[i])
+		}
+	}
+	embedded, err := s.EmbedBatchCached(ctx, nonEmpty)
+	if err != nil {
+		return err
+	}
+	_, dim := s.ModelInfo()
+	if dim == 0 && len(embedded) > 0 {
+		dim = len(embedded[0])
+	}
+	vecs := make([][]float32, len(texts))
+	next := 0
+	for i, p := range prepared {
+		if p == "" {
+			vecs[i] = make([]float32, dim)
+			continue
+		}
+		vecs[i] = embedded[next]
+		next++
+	}
+
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".npy") {
+		err = writeNPY(f, vecs, dim)
+	} else {
+		err = writeVectorCSV(f, exportDelimiter(path, ','), []string{"index", "text"}, vecs, dim, func(i int) []string {
+			return []string{strconv.Itoa(i + 1), texts[i]}
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ExportIndexVectors writes the embedded seed and NDC candidates to path as
+// CSV (TSV for ".tsv") with source, label and d0..d<dim-1> columns.
+func (s *Service) ExportIndexVectors(path string) error {
+	s.mu.RLock()
+	cands := make([]Candidate, 0, len(s.candsCat)+len(s.candsNDC))
+	cands = append(cands, s.candsCat...)
+	cands = append(cands, s.candsNDC...)
+	s.mu.RUnlock()
+	if len(cands) == 0 {
+		return errors.New("出力するカテゴリのベクトルがありません")
+	}
+	dim := len(cands[0].Vec)
+	vecs := make([][]float32, len(cands))
+	for i, c := range cands {
+		vecs[i] = c.Vec
+	}
+
+	f, err := os.Create(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = writeVectorCSV(f, exportDelimiter(path, ','), []string{"source", "label"}, vecs, dim, func(i int) []string {
+		return []string{cands[i].Source, cands[i].Label}
+	})
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeVectorCSV writes a header of lead columns followed by d0..d<dim-1>,
+// then one row per vector.
+func writeVectorCSV(w io.Writer, delim rune, lead []string, vecs [][]float32, dim int, leadFor func(i int) []string) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delim
+	header := append([]string(nil), lead...)
+	for d := 0; d < dim; d++ {
+		header = append(header, "d"+strconv.Itoa(d))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, v := range vecs {
+		if len(v) != dim {
+			return &DimensionMismatchError{Cache: len(v), Model: dim, Where: fmt.Sprintf("%d行目", i+1)}
+		}
+		record := leadFor(i)
+		for _, x := range v {
+			record = append(record, strconv.FormatFloat(float64(x), 'g', -1, 32))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeNPY writes vecs as a little-endian float32 .npy (format 1.0) matrix.
+func writeNPY(w io.Writer, vecs [][]float32, dim int) error {
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(vecs), dim)
+	// magic(6) + version(2) + 長さ(2) + header + '\n' を 64 バイト境界にそろえる
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x93NUMPY")
+	bw.Write([]byte{1, 0})
+	_ = binary.Write(bw, binary.LittleEndian, uint16(len(header)))
+	bw.WriteString(header)
+	for i, v := range vecs {
+		if len(v) != dim {
+			return &DimensionMismatchError{Cache: len(v), Model: dim, Where: fmt.Sprintf("%d行目", i+1)}
+		}
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
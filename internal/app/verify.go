@@ -0,0 +1,54 @@
+package app
+
+import "sort"
+
+// annotateAssigned compares each row against a pre-assigned label (e.g. a
+// reviewer's tentative category) and records where that label ranks among the
+// seed scores and whether the model's top-1 disagrees with it.
+func annotateAssigned(rows []ResultRow, assigned []string) {
+	for i := range rows {
+		if i >= len(assigned) {
+			return
+		}
+		label := normalize(assigned[i])
+		if label == "" {
+			continue
+		}
+		row := &rows[i]
+		row.Assigned = label
+		row.AssignedRank, row.AssignedScore = rankOfLabel(row.FinalScores, label)
+		row.AssignedMismatch = normalizeKey(topLabel(*row)) != normalizeKey(label)
+	}
+}
+
+// rankOfLabel returns the 1-based rank and score of label within scores, or
+// 0 when the label is not an indexed category.
+func rankOfLabel(scores map[string]float32, label string) (int, float32) {
+	key := normalizeKey(label)
+	target := ""
+	for lab := range scores {
+		if normalizeKey(lab) == key {
+			target = lab
+			break
+		}
+	}
+	if target == "" {
+		return 0, 0
+	}
+	labels := make([]string, 0, len(scores))
+	for lab := range scores {
+		labels = append(labels, lab)
+	}
+	sort.SliceStable(labels, func(i, j int) bool {
+		if scores[labels[i]] == scores[labels[j]] {
+			return labels[i] < labels[j]
+		}
+		return scores[labels[i]] > scores[labels[j]]
+	})
+	for i, lab := range labels {
+		if lab == target {
+			return i + 1, scores[lab]
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateAssigned(t *testing.T) {
+	scores := map[string]float32{"果物": 0.8, "野菜": 0.6, "家電": 0.2}
+	newRow := func() ResultRow {
+		return ResultRow{Suggestions: []Suggestion{{Label: "果物", Score: 0.8}}, FinalScores: scores}
+	}
+	tests := []struct {
+		name     string
+		assigned string
+		want     ResultRow // Assigned 以下の欄だけを比べる
+	}{
+		{"agree", "果物", ResultRow{Assigned: "果物", AssignedRank: 1, AssignedScore: 0.8}},
+		{"agree after normalization", " 果物 ", ResultRow{Assigned: "果物", AssignedRank: 1, AssignedScore: 0.8}},
+		{"disagree", "野菜", ResultRow{Assigned: "野菜", AssignedRank: 2, AssignedScore: 0.6, AssignedMismatch: true}},
+		{"disagree at the bottom", "家電", ResultRow{Assigned: "家電", AssignedRank: 3, AssignedScore: 0.2, AssignedMismatch: true}},
+		// 索引にないラベルは順位 0 で、不一致として印を付ける
+		{"unknown label", "旅行", ResultRow{Assigned: "旅行", AssignedMismatch: true}},
+		{"empty", "", ResultRow{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := []ResultRow{newRow()}
+			annotateAssigned(rows, []string{tt.assigned})
+			r := rows[0]
+			got := ResultRow{Assigned: r.Assigned, AssignedRank: r.AssignedRank, AssignedScore: r.AssignedScore, AssignedMismatch: r.AssignedMismatch}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// 既存ラベルが足りない行はそのまま
+	rows := []ResultRow{newRow(), newRow()}
+	annotateAssigned(rows, []string{"野菜"})
+	if rows[0].Assigned != "野菜" || rows[1].Assigned != "" || rows[1].AssignedMismatch {
+		t.Errorf("rows = %+v", rows)
+	}
+}
+
+func TestExtractAlignedColumn(t *testing.T) {
+	records := [][]string{
+		{"text", "category"},
+		{"りんご", " 果物 "},
+		{"", "野菜"}, // 本文が空の行
+		{"テレビ"},    // 既存カテゴリ列がない行
+	}
+	tests := []struct {
+		name      string
+		keepEmpty bool
+		want      []string
+	}{
+		{"skip empty", false, []string{"果物", ""}},
+		{"keep empty", true, []string{"果物", "野菜", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractAlignedColumn(records, []int{0}, 1, true, tt.keepEmpty)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// 本文の列と同じ行数で並ぶ
+			if texts := extractCSVColumns(records, []int{0}, true, tt.keepEmpty); len(texts) != len(got) {
+				t.Errorf("%d texts but %d assigned labels", len(texts), len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// 重みの許容範囲。入力ミス (9999 など) で1カテゴリが全体を支配しないよう丸める。
+const (
+	minSeedWeight float32 = 0.1
+	maxSeedWeight float32 = 2.0
+)
+
+// WeightedSeed is a category label with a score multiplier.
+type WeightedSeed struct {
+	Label  string
+	Weight float32
+}
+
+// LoadSeedsWeighted replaces the user categories like UpdateCategories and
+// stores a per-category weight that multiplies its base similarity before
+// ranking. Weights are clamped to [minSeedWeight, maxSeedWeight]; a zero
+// weight means 1.0.
+func (s *Service) LoadSeedsWeighted(ctx context.Context, seeds []WeightedSeed) (int, error) {
+	specs := make([]CategorySpec, len(seeds))
+	for i, sd := range seeds {
+		specs[i] = CategorySpec{Label: sd.Label, Weight: sd.Weight}
+	}
+	return s.updateCategories(ctx, specs)
+}
+
+func clampSeedWeight(w float32) float32 {
+	if w == 0 {
+		return 1
+	}
+	if w < minSeedWeight {
+		return minSeedWeight
+	}
+	if w > maxSeedWeight {
+		return maxSeedWeight
+	}
+	return w
+}
+
+// candidateWeight returns the multiplier for c; unset weights count as 1.
+func candidateWeight(c Candidate) float32 {
+	if c.Weight == 0 {
+		return 1
+	}
+	return c.Weight
+}
+
+// parseSeedWeight reads a weight cell, falling back to 1.0 when it is empty
+// or not a number.
+func parseSeedWeight(s string) float32 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 32)
+	if err != nil {
+		return 1
+	}
+	return clampSeedWeight(float32(v))
+}
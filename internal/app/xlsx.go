@@ -0,0 +1,251 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// xlsx はブック全体を読み込む簡易リーダー。値のセルだけを文字列として取り出し、
+// 書式 (日付など) は解釈しない。日付セルは Excel のシリアル値のまま読まれる。
+
+const (
+	// xlsxMaxColumns は Excel の列数の上限 (XFD 列)。
+	xlsxMaxColumns = 16384
+	// xlsxMaxPartSize は展開して読むブック内の1ファイルの上限。圧縮率の高い
+	// 細工されたファイルでメモリを使い切らないようにする。
+	xlsxMaxPartSize = 256 << 20
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText は共有文字列 <si> またはインライン文字列 <is>。
+// 振り仮名 (<rPh>) は読まない。
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXRecords returns the cells of one worksheet as records, like
+// readCSVRecords. sheet selects a sheet by name; empty means the first one.
+// Rows with no values are dropped and trailing empty cells are trimmed, so
+// rows may have different lengths.
+func readXLSXRecords(data []byte, sheet string) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("xlsx を開けません: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := decodeXLSXPart(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, errors.New("xlsx にシートがありません")
+	}
+	idx := 0
+	if sheet = strings.TrimSpace(sheet); sheet != "" {
+		idx = -1
+		for i, s := range wb.Sheets {
+			if s.Name == sheet {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("xlsx にシート %q がありません", sheet)
+		}
+	}
+
+	var rels xlsxRels
+	if err := decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	target := ""
+	for _, r := range rels.Items {
+		if r.ID == wb.Sheets[idx].RID {
+			target = r.Target
+			break
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("xlsx のシート %q の実体が見つかりません", wb.Sheets[idx].Name)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var ws xlsxWorksheet
+	if err := decodeXLSXPart(files, target, &ws); err != nil {
+		return nil, err
+	}
+
+	records := make([][]string, 0, len(ws.Rows))
+	for _, row := range ws.Rows {
+		var rec []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				n, ok := xlsxColumnIndex(c.Ref)
+				if !ok {
+					return nil, fmt.Errorf("xlsx のセル参照 %q が不正です (列は A〜XFD)", c.Ref)
+				}
+				col = n
+			}
+			if col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("xlsx の列数が上限 (%d) を超えています", xlsxMaxColumns)
+			}
+			val := xlsxCellValue(c.Type, c.Value, c.Inline, shared.Items)
+			if val == "" {
+				continue
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			rec[col] = val
+		}
+		if len(rec) > 0 {
+			records = append(records, rec)
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("シートが空です")
+	}
+	return records, nil
+}
+
+func decodeXLSXPart(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsx に %s がありません", name)
+	}
+	if f.UncompressedSize64 > xlsxMaxPartSize {
+		return fmt.Errorf("xlsx の %s が大きすぎます (%d MiB まで)", name, xlsxMaxPartSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// ヘッダーのサイズは偽れるため、実際に読んだ量でも上限を確かめる
+	data, err := io.ReadAll(io.LimitReader(rc, xlsxMaxPartSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > xlsxMaxPartSize {
+		return fmt.Errorf("xlsx の %s が大きすぎます (%d MiB まで)", name, xlsxMaxPartSize>>20)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("xlsx の %s を読めません: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxCellValue converts a cell to text. Numbers are written without a
+// trailing ".0" or exponent so index columns read as "12", not "1.2E+1".
+func xlsxCellValue(typ, v string, inline xlsxText, shared []xlsxText) string {
+	switch typ {
+	case "s":
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 || n >= len(shared) {
+			return ""
+		}
+		return shared[n].String()
+	case "inlineStr":
+		return inline.String()
+	case "b":
+		if strings.TrimSpace(v) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "e":
+		return v
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return v
+}
+
+// xlsxColumnIndex converts a cell reference such as "AB12" to a 0-based
+// column index. References without letters or beyond column XFD are
+// rejected.
+func xlsxColumnIndex(ref string) (int, bool) {
+	n := 0
+	letters := 0
+	for _, r := range ref {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		if letters++; letters > 3 {
+			return 0, false
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	if letters == 0 || n > xlsxMaxColumns {
+		return 0, false
+	}
+	return n - 1, true
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXLSXColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+		ok   bool
+	}{
+		{"A1", 0, true},
+		{"ab12", 27, true},
+		{"XFD1", xlsxMaxColumns - 1, true},
+		{"XFE1", 0, false},
+		{"AAAA1", 0, false},
+		{"ZZZZZZZZZZZZZZ1", 0, false},
+		{"12", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, ok := xlsxColumnIndex(tt.ref)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("xlsxColumnIndex(%q) = %d, %v, want %d, %v", tt.ref, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// xlsxTestSheet is one worksheet of writeTestXLSX: a name and one-column rows.
+type xlsxTestSheet struct {
+	name string
+	rows []string
+}
+
+// writeTestXLSX writes a minimal workbook whose sheets hold inline strings
+// in column A.
+func writeTestXLSX(t *testing.T, path string, sheets ...xlsxTestSheet) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	put := func(name, body string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wb, rels strings.Builder
+	wb.WriteString(`<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<Relationships>`)
+	for i, s := range sheets {
+		fmt.Fprintf(&wb, `<sheet name=%q r:id="rId%d"/>`, s.name, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		var ws strings.Builder
+		ws.WriteString(`<worksheet><sheetData>`)
+		for j, v := range s.rows {
+			fmt.Fprintf(&ws, `<row><c r="A%d" t="inlineStr"><is><t>%s</t></is></c></row>`, j+1, v)
+		}
+		ws.WriteString(`</sheetData></worksheet>`)
+		put(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), ws.String())
+	}
+	wb.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	put("xl/workbook.xml", wb.String())
+	put("xl/_rels/workbook.xml.rels", rels.String())
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestXLSXSheetSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	writeTestXLSX(t, path,
+		xlsxTestSheet{"一覧", []string{"本文", "りんごを買った"}},
+		xlsxTestSheet{"カテゴリ", []string{"カテゴリ", "果物", "野菜"}},
+	)
+	tests := []struct {
+		name          string
+		sheet         string // Config.Sheet
+		categorySheet string // Config.CategorySheet
+		wantInput     string // 入力として読んだ2行目
+		wantLabels    []string
+	}{
+		{"first sheet", "", "", "りんごを買った", []string{"本文", "りんごを買った"}},
+		{"Sheet for both", "カテゴリ", "", "果物", []string{"果物", "野菜"}},
+		{"CategorySheet", "一覧", "カテゴリ", "りんごを買った", []string{"果物", "野菜"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Sheet = tt.sheet
+			cfg.CategorySheet = tt.categorySheet
+			records, err := readEvalRecords(path, inputSource(cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := records[1][0]; got != tt.wantInput {
+				t.Errorf("input row = %q, want %q", got, tt.wantInput)
+			}
+			specs, err := loadEvalCategories(path, categorySource(cfg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := specLabels(specs); !reflect.DeepEqual(got, tt.wantLabels) {
+				t.Errorf("categories = %q, want %q", got, tt.wantLabels)
+			}
+		})
+	}
+	t.Run("missing sheet", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.Sheet = "なし"
+		if _, err := readEvalRecords(path, inputSource(cfg)); err == nil {
+			t.Error("readEvalRecords succeeded for a missing sheet")
+		}
+	})
+}